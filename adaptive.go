@@ -1,11 +1,16 @@
 package jit
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // AdaptiveSizer implements adaptive buffer sizing with minimal lock contention.
+// It is the SizingStrategy compilers and tuners use unless given another.
 // It operates in two phases:
 //
 // 1. Sampling Phase: Collects render size samples to establish optimal buffer size.
@@ -17,16 +22,72 @@ import (
 // - Cold path (sampling): mutex for statistical calculations during startup.
 type AdaptiveSizer struct {
 	// Atomic fields - read on every render without locking
-	baseline int64 // current optimal buffer size (atomic)
-	active   int64 // 1 if sampling, 0 if using baseline (atomic)
+	baseline  int64 // current optimal buffer size (atomic)
+	active    int64 // 1 if sampling, 0 if using baseline (atomic)
+	smoothing int64 // EWMA weight percentage of each new render, 0 if off (atomic)
+	average   int64 // moving average the baseline grows from with smoothing (atomic)
+	window    int64 // renders in the sliding window, 0 if off (atomic)
+	ceiling   int64 // largest baseline allowed, 0 for no cap (atomic)
+	floor     int64 // smallest baseline allowed (atomic)
+	modes     int64 // most size clusters tracked, 0 if off (atomic)
+
+	cooldown  int64 // renders after a baseline is set before it may resample (atomic)
+	quiet     int64 // nanoseconds after a baseline is set before it may resample (atomic)
+	settled   int64 // renders checked since the baseline was set (atomic)
+	settledAt int64 // when the baseline was set, in Unix nanoseconds (atomic)
+	thrash    int64 // resamples the cooldown held back (atomic)
+	settledOn int64 // last baseline set, kept across restarts for OnBaselineChange (atomic)
+
+	target    int64 // overflow percentage the growth factor is learned towards, 0 if off (atomic)
+	learned   int64 // growth factor learned with target, 0 for the configured one (atomic)
+	observed  int64 // renders counted towards the next growth adjustment (atomic)
+	overflows int64 // of those, renders that outgrew the baseline (atomic)
+	tight     int64 // and renders that would outgrow it a growth step lower (atomic)
+
+	refreshEvery int64 // renders after a baseline is set before it is resampled, 0 if off (atomic)
+	refreshAfter int64 // nanoseconds after a baseline is set before it is resampled, 0 if off (atomic)
+	aged         int64 // renders seen since the baseline was set (atomic)
+
+	// Written under mu, but atomic so that Compiler.Stats and Tuner.Stats
+	// can read them without it
+	count     int64 // sample count during sampling phase (atomic)
+	resamples int64 // times a deviating render restarted sampling (atomic)
+
+	histogram atomic.Pointer[sizeHistogram] // observed sizes, nil unless SetHistogram
+
+	onChange atomic.Pointer[func(old, new int)] // see OnBaselineChange
 
 	// Mutex-protected fields - only accessed during phase transitions
 	mu           sync.Mutex
-	sum          int // running sum during sampling phase
-	count        int // sample count during sampling phase
-	max          int // maximum samples before establishing baseline
-	variance     int // variance threshold percentage (e.g. 20 for 20%)
-	growthFactor int // growth factor percentage (e.g. 115 for 115%)
+	sum          int   // running sum during sampling phase
+	max          int   // maximum samples before establishing baseline
+	variance     int   // variance threshold percentage (e.g. 20 for 20%)
+	growthFactor int   // growth factor percentage (e.g. 115 for 115%)
+	percentile   int   // baseline percentile of samples, 0 for the mean
+	trim         int   // percentage of samples dropped from each end before averaging
+	samples      []int // sizes seen during sampling, kept only with a percentile or trim
+	recent       []int // ring of the last window sizes in the baseline phase
+	oldest       int   // index of the oldest size in recent once it is full
+	since        int   // renders added to recent since the baseline was recomputed
+	scratch      []int // reused to sort a copy of recent
+	centres      []int // centre of each size cluster with modes
+	refreshes    int64 // times SetRefresh restarted sampling
+}
+
+// SizerStats is a snapshot of an AdaptiveSizer, for working out why its
+// predictions behave as they do: a baseline that never settles shows as a
+// climbing Resamples, one stuck in sampling as Sampling with few Samples.
+type SizerStats struct {
+	Sampling  bool  // In the sampling phase rather than the baseline phase
+	Samples   int   // Samples collected in the current sampling phase
+	Sum       int   // Total size of those samples
+	Baseline  int   // Current prediction, 0 before the first baseline
+	Variance  int   // Deviation percentage that restarts sampling
+	Resamples int64 // Times a deviating render restarted sampling
+	Modes     []int // Centre of each size cluster, smallest first, with SetModes
+	Thrash    int64 // Resamples held back by the cooldown, see SetCooldown
+	Growth    int   // Growth factor in use, learned with SetTargetOverflow
+	Refreshes int64 // Times the baseline was resampled on schedule, see SetRefresh
 }
 
 // NewAdaptiveSizer creates a sizer with sensible defaults.
@@ -54,19 +115,125 @@ func NewAdaptiveSizer() *AdaptiveSizer {
 // - max: number of samples to collect before establishing baseline.
 // - variance: threshold percentage for detecting significant size changes (e.g. 20).
 // - growthFactor: multiplier percentage applied to average size (e.g. 115).
+//
+// Each must be above zero: no samples settle on an empty baseline, no
+// variance resamples on every render that differs, and no growth
+// predicts nothing. Otherwise the call is ignored and the sizer left as
+// it was; check the parameters with ValidateSizing, or use
+// MustConfigure.
 func (as *AdaptiveSizer) Configure(max int, variance, growthFactor int) {
+	if ValidateSizing(max, variance, growthFactor) != nil {
+		return
+	}
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
 	as.max = max
 	as.variance = variance
 	as.growthFactor = growthFactor
+	atomic.StoreInt64(&as.learned, 0) // learn again from the new factor
 
 	// Stale statistics from previous configuration would skew the new baseline
-	as.sum = 0
-	as.count = 0
-	atomic.StoreInt64(&as.baseline, 0)
-	atomic.StoreInt64(&as.active, 1) // restart sampling
+	as.restart()
+}
+
+// MustConfigure is like Configure but panics with the error from
+// ValidateSizing if the parameters are invalid, for sizers set up once at
+// startup from constants.
+func (as *AdaptiveSizer) MustConfigure(max int, variance, growthFactor int) {
+	if err := ValidateSizing(max, variance, growthFactor); err != nil {
+		panic(err)
+	}
+	as.Configure(max, variance, growthFactor)
+}
+
+// ValidateSizing returns an error wrapping ErrInvalidSizing for each of
+// max, variance and growthFactor that is not positive, or nil if
+// AdaptiveSizer.Configure, Compiler.Configure and Tuner.Configure would
+// accept them.
+func ValidateSizing(max, variance, growthFactor int) error {
+	var errs []error
+	for _, p := range []struct {
+		name  string
+		value int
+	}{{"max", max}, {"variance", variance}, {"growth factor", growthFactor}} {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %s %d is not positive", ErrInvalidSizing, p.name, p.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetTrim discards the smallest and largest p percent of the samples
+// before averaging them into a baseline, and resets all statistics as
+// Configure does. One pathological render - an admin exporting a huge
+// table - otherwise drags the mean far above every ordinary page, or,
+// arriving in the baseline phase, starts a resample it then dominates.
+// Trimmed, it is dropped along with the smallest samples.
+//
+// Trimming drops whole samples, p percent of max rounded down from each
+// end, so with the default 5 samples it does nothing below 20; raise max
+// with Configure. p is clamped to 0-49, and 0 turns trimming off. It
+// shapes the mean only: a percentile baseline ignores it.
+func (as *AdaptiveSizer) SetTrim(p int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.trim = min(max(p, 0), 49)
+	as.restart()
+}
+
+// SetPercentile sets the baseline from a percentile of the sampled sizes
+// rather than their mean, and resets all statistics as Configure does.
+// The mean sits below most of a skewed distribution's tail - a feed where
+// most pages are small and a few are huge - so every large render
+// outgrows its buffer; a baseline at p90 or p95 covers all but the
+// largest. The growth factor is still applied on top.
+//
+// p is a percentage: 0 restores the mean and values above 100 are
+// treated as 100, the largest sample. A percentile needs more samples
+// than the default 5 to mean much, so raise max with Configure too.
+//
+// Most renders fall below a percentile baseline, so in the baseline phase
+// only renders that outgrow it by more than the variance start sampling
+// again. A template whose output shrinks for good keeps its larger buffer
+// until Reset.
+func (as *AdaptiveSizer) SetPercentile(p int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.percentile = min(max(p, 0), 100)
+	as.restart()
+}
+
+// SetInitialBaseline skips the sampling phase and starts from a baseline
+// of n bytes, for a template whose output size is roughly known, so the
+// first renders are preallocated too. n is the buffer capacity as it is,
+// without the growth factor; the floor and cap still apply. The sizer is
+// then in its baseline phase as if sampling had just ended: deviations
+// resample as usual, and EWMA, a window or modes start from n.
+//
+// It discards collected statistics and reports to OnBaselineChange. n of
+// 0 or less does nothing.
+func (as *AdaptiveSizer) SetInitialBaseline(n int) {
+	if n <= 0 {
+		return
+	}
+	var change baselineChange
+	defer as.report(&change)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.restart()
+	atomic.StoreInt64(&as.average, int64(n))
+	if atomic.LoadInt64(&as.modes) > 0 {
+		as.centres = append(as.centres, n)
+	}
+	change = as.setBaseline(int64(n))
+	atomic.StoreInt64(&as.settled, 0)
+	atomic.StoreInt64(&as.aged, 0)
+	atomic.StoreInt64(&as.settledAt, time.Now().UnixNano())
+	atomic.StoreInt64(&as.active, 0)
 }
 
 // GetBaseline returns the current optimal buffer size.
@@ -88,19 +255,200 @@ func (as *AdaptiveSizer) Reset() {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
+	as.restart()
+}
+
+// Stats returns a consistent snapshot of the sizer's state, taken under
+// its lock. Resamples counts only restarts caused by a deviating render,
+// not Reset or reconfiguration, and survives both.
+func (as *AdaptiveSizer) Stats() SizerStats {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.stats()
+}
+
+// stats is Stats for a caller that holds as.mu.
+func (as *AdaptiveSizer) stats() SizerStats {
+	return SizerStats{
+		Sampling:  as.Active(),
+		Samples:   int(atomic.LoadInt64(&as.count)),
+		Sum:       as.sum,
+		Baseline:  as.GetBaseline(),
+		Variance:  as.variance,
+		Resamples: atomic.LoadInt64(&as.resamples),
+		Modes:     slices.Sorted(slices.Values(as.centres)),
+		Thrash:    atomic.LoadInt64(&as.thrash),
+		Growth:    as.growth(),
+		Refreshes: as.refreshes,
+	}
+}
+
+// restart clears the statistics and returns to sampling. The caller holds
+// as.mu.
+func (as *AdaptiveSizer) restart() {
 	as.sum = 0
-	as.count = 0
+	atomic.StoreInt64(&as.count, 0)
+	as.samples = as.samples[:0]
+	as.clearWindow()
+	as.centres = as.centres[:0]
+	atomic.StoreInt64(&as.average, 0)
 	atomic.StoreInt64(&as.baseline, 0)
-	atomic.StoreInt64(&as.active, 1) // return to sampling
+	atomic.StoreInt64(&as.active, 1)
+}
+
+// SetEWMA switches the baseline phase to an exponentially weighted moving
+// average: once sampling has set the first baseline, every render moves
+// the average by weight percent of its difference from it, and the
+// baseline follows, grown by the growth factor. Drifting sizes are
+// tracked as they drift, where the default resets and resamples on a
+// large change and under-allocates until the new samples are in.
+// Variance no longer applies, as the sizer never returns to sampling on
+// its own, and Percentile only shapes the first baseline.
+//
+// A weight of 10-30 follows drift over tens of renders without chasing
+// single outliers. 0 turns it off; values above 100 are treated as 100,
+// which follows the last render exactly. Statistics are reset as Configure
+// does.
+func (as *AdaptiveSizer) SetEWMA(weight int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	atomic.StoreInt64(&as.smoothing, int64(min(max(weight, 0), 100)))
+	as.restart()
+}
+
+// SetMaxBaseline caps the baseline at n bytes, whatever sizes are
+// observed, so a burst of huge renders cannot leave every later render
+// preallocating megabytes. Renders larger than the cap still complete;
+// their buffers grow as they would without a baseline. A render past the
+// cap while the baseline sits on it does not restart sampling, as a new
+// baseline would be capped the same.
+//
+// Unlike the other settings it keeps the statistics, lowering the current
+// baseline to the cap if it is above. 0 removes the cap.
+func (as *AdaptiveSizer) SetMaxBaseline(n int) {
+	ceiling := int64(max(n, 0))
+	atomic.StoreInt64(&as.ceiling, ceiling)
+	if ceiling > 0 && atomic.LoadInt64(&as.baseline) > ceiling {
+		atomic.StoreInt64(&as.baseline, ceiling)
+	}
+}
+
+// SetMinBaseline sets a floor of n bytes under the baseline, so a few
+// tiny early renders - a health check, an empty listing - cannot settle a
+// baseline that nearly every real render then outgrows. Renders smaller
+// than the floor while the baseline sits on it do not restart sampling.
+// It applies once a baseline is set; while the first samples are taken
+// renders start without preallocation as before.
+//
+// Like SetMaxBaseline it keeps the statistics, raising the current
+// baseline to the floor if it is below. 0 removes the floor, and the cap
+// wins if the two conflict.
+func (as *AdaptiveSizer) SetMinBaseline(n int) {
+	floor := int64(max(n, 0))
+	atomic.StoreInt64(&as.floor, floor)
+	if baseline := atomic.LoadInt64(&as.baseline); baseline > 0 && baseline < floor {
+		as.setBaseline(floor)
+	}
+}
+
+// setBaseline stores baseline, raised to the floor and then lowered to the
+// cap if there is one, and returns the change for report.
+func (as *AdaptiveSizer) setBaseline(baseline int64) baselineChange {
+	baseline = max(baseline, atomic.LoadInt64(&as.floor))
+	if ceiling := atomic.LoadInt64(&as.ceiling); ceiling > 0 {
+		baseline = min(baseline, ceiling)
+	}
+	atomic.StoreInt64(&as.baseline, baseline)
+	return baselineChange{old: atomic.SwapInt64(&as.settledOn, baseline), new: baseline}
+}
+
+// OnBaselineChange sets fn to be called each time the sizer settles on a
+// baseline different from the one before - when sampling ends, and with
+// SetEWMA, SetWindow or SetModes as the baseline moves - with the old and
+// new values, to log or export alongside memory metrics. A resample does
+// not report the baseline dropping to zero; old is the last baseline set.
+// Changing the sizer's configuration does not report either.
+//
+// fn runs on the rendering goroutine after the sizer's lock is released,
+// so it may read Stats, but it must be fast: with EWMA it can run on most
+// renders. nil removes it.
+func (as *AdaptiveSizer) OnBaselineChange(fn func(old, new int)) {
+	if fn == nil {
+		as.onChange.Store(nil)
+		return
+	}
+	as.onChange.Store(&fn)
+}
+
+// baselineChange is a baseline set by setBaseline, reported to
+// OnBaselineChange once the sizer's lock is released.
+type baselineChange struct {
+	old, new int64
+}
+
+// report calls the OnBaselineChange callback for c if the baseline
+// changed. It takes a pointer so that it can be deferred before the lock
+// and see the change made under it.
+func (as *AdaptiveSizer) report(c *baselineChange) {
+	if c.old == c.new {
+		return
+	}
+	if fn := as.onChange.Load(); fn != nil {
+		(*fn)(int(c.old), int(c.new))
+	}
+}
+
+// SetWindow keeps the last n render sizes in the baseline phase and
+// recomputes the baseline from them every n renders, and resets all
+// statistics as Configure does. Without it the baseline only moves when a
+// single render deviates past the variance, so drift that stays inside it
+// - a page growing a few bytes a day - is never picked up. The window is
+// summarised as the samples are, so Percentile and Trim apply to it, and
+// a render past the variance still restarts sampling at once.
+//
+// Each windowed render takes the sizer's mutex briefly, which the default
+// baseline phase avoids; EWMA tracks drift lock-free and takes precedence
+// if both are set. 0 turns the window off.
+func (as *AdaptiveSizer) SetWindow(n int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	atomic.StoreInt64(&as.window, int64(max(n, 0)))
+	as.restart()
+}
+
+// tracking reports whether the sizer is following every render with a
+// moving average or a window, recording a histogram, learning its growth
+// factor or refreshing on a schedule (see SetEWMA, SetWindow,
+// SetHistogram, SetTargetOverflow and SetRefresh), in which case callers
+// should report every render size rather than only those that deviate
+// from the baseline.
+func (as *AdaptiveSizer) tracking() bool {
+	if as.histogram.Load() != nil || atomic.LoadInt64(&as.target) > 0 || as.refreshing() {
+		return true
+	}
+	return (atomic.LoadInt64(&as.smoothing) > 0 || atomic.LoadInt64(&as.window) > 0 || atomic.LoadInt64(&as.modes) > 0) && !as.Active()
 }
 
 // UpdateStats updates sizing statistics based on actual render size.
 // This automatically chooses between sampling and variance checking
 // based on the current phase.
 func (as *AdaptiveSizer) UpdateStats(size int) {
-	if as.Active() {
+	as.histogram.Load().observe(size)
+	as.learn(size)
+	as.age()
+	switch {
+	case as.Active():
 		as.sample(size)
-	} else {
+	case atomic.LoadInt64(&as.modes) > 0:
+		as.cluster(size)
+	case atomic.LoadInt64(&as.smoothing) > 0:
+		as.track(size)
+	case atomic.LoadInt64(&as.window) > 0:
+		as.slide(size)
+		as.check(size)
+	default:
 		as.check(size)
 	}
 }
@@ -109,6 +457,8 @@ func (as *AdaptiveSizer) UpdateStats(size int) {
 // This method is called during the sampling phase to build up statistics.
 // Once we have enough samples, it calculates the baseline and switches to baseline phase.
 func (as *AdaptiveSizer) sample(size int) {
+	var change baselineChange
+	defer as.report(&change) // deferred first, so it runs after the unlock
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
@@ -119,20 +469,48 @@ func (as *AdaptiveSizer) sample(size int) {
 	}
 
 	as.sum += size
-	as.count++
+	count := atomic.AddInt64(&as.count, 1)
+	if as.keepSamples() {
+		as.samples = append(as.samples, size)
+	}
 
 	// Check if we have enough samples to establish baseline
-	if as.count >= as.max {
+	if count >= int64(as.max) {
 		// Growth factor prevents tight buffer fits that would cause reallocations
 		// on renders slightly larger than average
-		average := as.sum / as.count
-		newBaseline := (average * as.growthFactor) / 100
+		typical := as.typical()
+		if atomic.LoadInt64(&as.modes) > 0 {
+			// Start from the mode of the render that completed sampling
+			as.seedModes(as.samples)
+			typical = as.centres[nearest(as.centres, size)]
+		}
+		newBaseline := (typical * as.growth()) / 100
 
-		atomic.StoreInt64(&as.baseline, int64(newBaseline))
+		atomic.StoreInt64(&as.average, int64(typical))
+		change = as.setBaseline(int64(newBaseline))
+		atomic.StoreInt64(&as.settled, 0)
+		atomic.StoreInt64(&as.aged, 0)
+		atomic.StoreInt64(&as.settledAt, time.Now().UnixNano())
 		atomic.StoreInt64(&as.active, 0) // switch to baseline phase
 	}
 }
 
+// track moves the moving average towards size and the baseline with it.
+// It runs on every render in EWMA mode, so it is lock-free: concurrent
+// renders retry the compare-and-swap rather than queue on the mutex.
+func (as *AdaptiveSizer) track(size int) {
+	weight := atomic.LoadInt64(&as.smoothing)
+	for {
+		old := atomic.LoadInt64(&as.average)
+		next := old + (int64(size)-old)*weight/100
+		if atomic.CompareAndSwapInt64(&as.average, old, next) {
+			change := as.setBaseline(next * int64(as.growth()) / 100)
+			as.report(&change)
+			return
+		}
+	}
+}
+
 // check monitors deviation from baseline and reactivates sampling if needed.
 // This method is called during the baseline phase to detect when content patterns
 // have changed significantly, triggering a return to sampling phase.
@@ -145,16 +523,318 @@ func (as *AdaptiveSizer) check(size int) {
 	// Integer math equivalent of: abs(size - baseline) / baseline > variance / 100
 	// This avoids floating point on the hot path
 	diff := abs(size - baseline)
+	if size < baseline && as.percentile > 0 {
+		// Most renders sit below a percentile baseline by design, so only
+		// outgrowing it counts as a change
+		return
+	}
+	if size > baseline && int64(baseline) == atomic.LoadInt64(&as.ceiling) {
+		return // resampling would only arrive at the cap again
+	}
+	if size < baseline && int64(baseline) == atomic.LoadInt64(&as.floor) {
+		return // or at the floor
+	}
+	settled := atomic.AddInt64(&as.settled, 1)
 	if diff*100 > baseline*as.variance {
+		if as.cooling(settled) {
+			atomic.AddInt64(&as.thrash, 1)
+			return
+		}
 		// Significant change detected - restart sampling to establish a new baseline
 		as.mu.Lock()
 		as.sum = size // seed new sampling with the value that triggered the change
-		as.count = 1
+		atomic.StoreInt64(&as.count, 1)
+		if as.keepSamples() {
+			as.samples = append(as.samples[:0], size)
+		}
+		as.clearWindow()
+		atomic.AddInt64(&as.resamples, 1)
 		atomic.StoreInt64(&as.active, 1) // return to sampling phase
 		as.mu.Unlock()
 	}
 }
 
+// SetCooldown holds a new baseline for at least renders renders and
+// period of time before a deviating render may restart sampling; either
+// may be 0. Alternating small and large renders otherwise send the sizer
+// back and forth between sampling and its baseline indefinitely, and it
+// spends its time sampling instead of predicting. Deviations held back are
+// counted as Thrash in Stats, so a climbing count shows the cooldown is
+// doing work and the template might suit SetModes or SetPercentile
+// better.
+//
+// Renders are those the sizer checks: a Compiler only reports renders
+// deviating past its Threshold, so with a Compiler the count is of those.
+// The statistics are kept.
+func (as *AdaptiveSizer) SetCooldown(renders int, period time.Duration) {
+	atomic.StoreInt64(&as.cooldown, int64(max(renders, 0)))
+	atomic.StoreInt64(&as.quiet, int64(max(period, 0)))
+}
+
+// cooling reports whether the baseline is still inside its cooldown, the
+// settled'th render checked since it was set.
+func (as *AdaptiveSizer) cooling(settled int64) bool {
+	if settled <= atomic.LoadInt64(&as.cooldown) {
+		return true
+	}
+	quiet := atomic.LoadInt64(&as.quiet)
+	return quiet > 0 && time.Now().UnixNano()-atomic.LoadInt64(&as.settledAt) < quiet
+}
+
+// slide adds size to the window, replacing the oldest once it is full,
+// and recomputes the baseline from the window every window renders.
+func (as *AdaptiveSizer) slide(size int) {
+	var change baselineChange
+	defer as.report(&change)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	n := int(atomic.LoadInt64(&as.window))
+	if atomic.LoadInt64(&as.active) == 1 || n == 0 {
+		return // sampling restarted or the window was turned off meanwhile
+	}
+	if len(as.recent) < n {
+		as.recent = append(as.recent, size)
+	} else {
+		as.recent[as.oldest] = size
+		as.oldest = (as.oldest + 1) % n
+	}
+	as.since++
+	if as.since < n {
+		return
+	}
+	as.since = 0
+	// Sorted as a copy so the ring keeps track of which size is oldest
+	as.scratch = append(as.scratch[:0], as.recent...)
+	change = as.setBaseline(int64(as.summarise(as.scratch) * as.growth() / 100))
+}
+
+// clearWindow empties the window. The caller holds as.mu.
+func (as *AdaptiveSizer) clearWindow() {
+	as.recent = as.recent[:0]
+	as.oldest = 0
+	as.since = 0
+}
+
+// keepSamples reports whether each sample is needed individually, rather
+// than only in the running sum. The caller holds as.mu.
+func (as *AdaptiveSizer) keepSamples() bool {
+	return as.percentile > 0 || as.trim > 0 || atomic.LoadInt64(&as.modes) > 0
+}
+
+// typical returns the size the baseline is grown from: the configured
+// percentile of the samples by nearest rank, their trimmed mean, or their
+// mean. The caller holds as.mu and there is at least one sample.
+func (as *AdaptiveSizer) typical() int {
+	if !as.keepSamples() || len(as.samples) == 0 {
+		return as.sum / int(atomic.LoadInt64(&as.count))
+	}
+	return as.summarise(as.samples)
+}
+
+// summarise returns the configured percentile of sizes, their trimmed
+// mean, or their mean, sorting sizes in place. The caller holds as.mu and
+// sizes is not empty.
+func (as *AdaptiveSizer) summarise(sizes []int) int {
+	slices.Sort(sizes)
+	if as.percentile > 0 {
+		rank := (as.percentile*len(sizes) + 99) / 100
+		return sizes[max(rank, 1)-1]
+	}
+	cut := len(sizes) * as.trim / 100
+	kept := sizes[cut : len(sizes)-cut]
+	sum := 0
+	for _, size := range kept {
+		sum += size
+	}
+	return sum / len(kept)
+}
+
+// Baseline returns the current buffer size, implementing SizingStrategy.
+// It is GetBaseline.
+func (as *AdaptiveSizer) Baseline() int {
+	return as.GetBaseline()
+}
+
+// Observe reports a render's size, implementing SizingStrategy. It is
+// UpdateStats.
+func (as *AdaptiveSizer) Observe(size int) {
+	as.UpdateStats(size)
+}
+
+// SizerStats returns a snapshot of the compiler's AdaptiveSizer. With a
+// custom CompilerCfg.Sizing strategy only Baseline is filled in.
+func (jc *Compiler) SizerStats() SizerStats {
+	return sizerStats(jc.sizer)
+}
+
+// ByteSizerStats returns a snapshot of the sizer for renders returning
+// bytes, with CompilerCfg.SeparateByteSizing. Without it those renders
+// share the writer sizer and this is SizerStats.
+func (jc *Compiler) ByteSizerStats() SizerStats {
+	return sizerStats(jc.byteSizing())
+}
+
+// SizerStats returns a snapshot of the tuner's AdaptiveSizer. With a
+// custom TunerCfg.Sizing strategy only Baseline is filled in.
+func (jt *Tuner) SizerStats() SizerStats {
+	return sizerStats(jt.sizer)
+}
+
+// sizerStats returns Stats for an AdaptiveSizer, or the baseline alone for
+// any other strategy.
+func sizerStats(s SizingStrategy) SizerStats {
+	if as, ok := s.(*AdaptiveSizer); ok {
+		return as.Stats()
+	}
+	return SizerStats{Baseline: s.Baseline()}
+}
+
+// SharedSizer returns a CompilerCfg.Sizing or TunerCfg.Sizing function that
+// hands every compiler, tuner and clone it configures the same s, so that
+// templates with the same output characteristics pool their samples and
+// settle on a baseline sooner. It also lets a test drive a compiler's
+// sizing deterministically, by feeding and inspecting s directly.
+//
+// s is configured by its owner, not by the cfg it is passed in. Configure
+// on any compiler or tuner sharing it reconfigures it for all of them.
+//
+// Example:
+//
+//	cards := jit.NewAdaptiveSizer()
+//	cards.Configure(20, 20, 115)
+//	cfg := &jit.CompilerCfg{Threshold: 15, Sizing: jit.SharedSizer(cards)}
+//	productCard := jit.NewCompiler(cfg)
+//	offerCard := jit.NewCompiler(cfg)
+func SharedSizer(s SizingStrategy) func() SizingStrategy {
+	return func() SizingStrategy { return s }
+}
+
+// sizerParams are the AdaptiveSizer settings shared by CompilerCfg and
+// TunerCfg.
+type sizerParams struct {
+	max, variance, growthFactor    int
+	percentile, ewma, trim, window int
+	minBaseline, maxBaseline       int
+	histogram                      bool
+	modes                          int
+	cooldown                       int
+	cooldownPeriod                 time.Duration
+	onChange                       func(old, new int)
+	initial                        int
+	targetOverflow                 int
+	refreshEvery                   int
+	refreshPeriod                  time.Duration
+}
+
+// newSizer returns the sizing strategy for a compiler or tuner: one from
+// sizing if the application supplied it, otherwise an AdaptiveSizer with
+// the given parameters. If max, variance or growth factor is invalid, the
+// sizer keeps NewAdaptiveSizer's defaults for all three; see
+// CompilerCfg.Validate.
+func newSizer(sizing func() SizingStrategy, p sizerParams) SizingStrategy {
+	if sizing != nil {
+		return sizing()
+	}
+	as := NewAdaptiveSizer()
+	as.Configure(p.max, p.variance, p.growthFactor)
+	as.SetPercentile(p.percentile)
+	as.SetEWMA(p.ewma)
+	as.SetTrim(p.trim)
+	as.SetWindow(p.window)
+	as.SetMinBaseline(p.minBaseline)
+	as.SetMaxBaseline(p.maxBaseline)
+	as.SetHistogram(p.histogram)
+	as.SetModes(p.modes)
+	as.SetCooldown(p.cooldown, p.cooldownPeriod)
+	as.OnBaselineChange(p.onChange)
+	as.SetTargetOverflow(p.targetOverflow)
+	as.SetRefresh(p.refreshEvery, p.refreshPeriod)
+	as.SetInitialBaseline(p.initial)
+	return as
+}
+
+// sizerParams returns the cfg's AdaptiveSizer settings.
+func (cfg *CompilerCfg) sizerParams() sizerParams {
+	return sizerParams{
+		max:            cfg.Max,
+		variance:       cfg.Variance,
+		growthFactor:   cfg.GrowthFactor,
+		percentile:     cfg.Percentile,
+		ewma:           cfg.EWMA,
+		trim:           cfg.Trim,
+		window:         cfg.Window,
+		minBaseline:    cfg.MinBaseline,
+		maxBaseline:    cfg.MaxBaseline,
+		histogram:      cfg.SizeHistogram,
+		modes:          cfg.Modes,
+		cooldown:       cfg.Cooldown,
+		cooldownPeriod: cfg.CooldownPeriod,
+		onChange:       cfg.OnBaselineChange,
+		initial:        cfg.InitialBaseline,
+		targetOverflow: cfg.TargetOverflow,
+		refreshEvery:   cfg.RefreshEvery,
+		refreshPeriod:  cfg.RefreshPeriod,
+	}
+}
+
+// sizerParams returns the cfg's AdaptiveSizer settings, named as on
+// CompilerCfg.
+func (cfg *TunerCfg) sizerParams() sizerParams {
+	return sizerParams{
+		max:            cfg.Max,
+		variance:       cfg.Variance,
+		growthFactor:   cfg.GrowthFactor,
+		percentile:     cfg.Percentile,
+		ewma:           cfg.EWMA,
+		trim:           cfg.Trim,
+		window:         cfg.Window,
+		minBaseline:    cfg.MinBaseline,
+		maxBaseline:    cfg.MaxBaseline,
+		histogram:      cfg.SizeHistogram,
+		modes:          cfg.Modes,
+		cooldown:       cfg.Cooldown,
+		cooldownPeriod: cfg.CooldownPeriod,
+		onChange:       cfg.OnBaselineChange,
+		initial:        cfg.InitialBaseline,
+		targetOverflow: cfg.TargetOverflow,
+		refreshEvery:   cfg.RefreshEvery,
+		refreshPeriod:  cfg.RefreshPeriod,
+	}
+}
+
+// Validate reports sizing parameters the compiler's AdaptiveSizer would
+// reject, with an error wrapping ErrInvalidSizing for each: Max, Variance
+// and GrowthFactor must be left all zero for the defaults, or all set
+// positive. NewCompiler does not fail on a cfg that sets only some of
+// them, or sets one that is not positive, but keeps the defaults for all
+// three, which is rarely what it meant; MustCompileConfig panics instead.
+// It returns nil when Sizing is set, since the fields are then unused.
+func (cfg *CompilerCfg) Validate() error {
+	if cfg.Sizing != nil {
+		return nil
+	}
+	return validateCfgSizing(cfg.Max, cfg.Variance, cfg.GrowthFactor)
+}
+
+// Validate reports sizing parameters the tuner's AdaptiveSizer would
+// reject, as CompilerCfg.Validate does.
+func (cfg *TunerCfg) Validate() error {
+	if cfg.Sizing != nil {
+		return nil
+	}
+	return validateCfgSizing(cfg.Max, cfg.Variance, cfg.GrowthFactor)
+}
+
+// validateCfgSizing is ValidateSizing for a cfg, where leaving all three
+// zero asks for the defaults.
+func validateCfgSizing(max, variance, growthFactor int) error {
+	if max == 0 && variance == 0 && growthFactor == 0 {
+		return nil
+	}
+	return ValidateSizing(max, variance, growthFactor)
+}
+
 // abs returns the absolute value of an integer.
 // Used for variance calculation to avoid importing math.
 func abs(x int) int {
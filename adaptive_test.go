@@ -1,6 +1,17 @@
 package jit
 
-import "testing"
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+)
 
 // TestAdaptiveSizerSamplingPhase verifies that the sizer starts in sampling
 // phase, collects the configured number of samples, then transitions to
@@ -172,3 +183,552 @@ func TestAdaptiveSizerResamplingEstablishesNewBaseline(t *testing.T) {
 		t.Errorf("new baseline should be average (500) * growthFactor (115%%) = 575, got %d", secondBaseline)
 	}
 }
+
+// TestAdaptiveSizerPercentile verifies that a percentile baseline covers
+// the tail of a skewed distribution the mean would undershoot, and that
+// renders below it do not restart sampling.
+func TestAdaptiveSizerPercentile(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(10, 20, 100)
+	as.SetPercentile(90)
+
+	// Eight small pages and two large: mean 280, p90 1000
+	for _, size := range []int{100, 100, 100, 100, 100, 100, 100, 100, 1000, 1000} {
+		as.UpdateStats(size)
+	}
+	if as.Active() {
+		t.Fatal("sizer should establish a baseline after 10 samples")
+	}
+	if baseline := as.GetBaseline(); baseline != 1000 {
+		t.Errorf("p90 of the samples should be 1000, got %d", baseline)
+	}
+
+	as.UpdateStats(100)
+	if as.Active() {
+		t.Error("a render below a percentile baseline should not restart sampling")
+	}
+	as.UpdateStats(2000)
+	if !as.Active() {
+		t.Error("a render outgrowing the baseline should restart sampling")
+	}
+
+	as.SetPercentile(0)
+	for range 10 {
+		as.UpdateStats(100)
+	}
+	if baseline := as.GetBaseline(); baseline != 100 {
+		t.Errorf("percentile 0 should restore the mean, got %d", baseline)
+	}
+}
+
+// TestCompilerPercentileCfg verifies that CompilerCfg.Percentile reaches
+// the sizer, including on clones.
+func TestCompilerPercentileCfg(t *testing.T) {
+	jc := NewCompiler(&CompilerCfg{Max: 10, Variance: 20, GrowthFactor: 100, Threshold: 15, Percentile: 95})
+	for _, c := range []*Compiler{jc, jc.Clone()} {
+		if got := sizingState(c.sizer).Percentile; got != 95 {
+			t.Errorf("sizer percentile should be 95, got %d", got)
+		}
+	}
+}
+
+// TestAdaptiveSizerEWMA verifies that with a moving average the baseline
+// follows drifting sizes render by render instead of resampling.
+func TestAdaptiveSizerEWMA(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(5, 20, 100)
+	as.SetEWMA(50)
+
+	for range 5 {
+		as.UpdateStats(1000)
+	}
+	if as.Active() || as.GetBaseline() != 1000 {
+		t.Fatalf("sampling should set the first baseline to 1000, got %d (sampling %v)", as.GetBaseline(), as.Active())
+	}
+	if !as.tracking() {
+		t.Fatal("sizer should track every render once the baseline is set")
+	}
+
+	// Each render moves the average halfway: 1500, 1750, 1875
+	for i, want := range []int{1500, 1750, 1875} {
+		as.UpdateStats(2000)
+		if as.Active() {
+			t.Fatalf("render %d: a moving average should never return to sampling", i)
+		}
+		if got := as.GetBaseline(); got != want {
+			t.Errorf("render %d: baseline should be %d, got %d", i, want, got)
+		}
+	}
+
+	as.SetEWMA(0)
+	if as.tracking() {
+		t.Error("EWMA 0 should turn tracking off")
+	}
+}
+
+// TestCompilerEWMARecordsEveryRender verifies that a compiler with EWMA
+// feeds renders within its threshold to the sizer, which it otherwise
+// skips.
+func TestCompilerEWMARecordsEveryRender(t *testing.T) {
+	jc := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100, Threshold: 15, EWMA: 50})
+	jc.record(0, 1000)
+	jc.record(1000, 1100) // 10%, inside the threshold
+	if got := jc.sizer.Baseline(); got != 1050 {
+		t.Errorf("baseline should move to 1050, got %d", got)
+	}
+}
+
+// recordingSizer is a SizingStrategy that always predicts a fixed size
+// and counts what it observes.
+type recordingSizer struct {
+	size     int
+	observed atomic.Int64
+	resets   atomic.Int64
+}
+
+func (rs *recordingSizer) Observe(int)   { rs.observed.Add(1) }
+func (rs *recordingSizer) Baseline() int { return rs.size }
+func (rs *recordingSizer) Reset()        { rs.resets.Add(1) }
+
+// TestCompilerCustomSizing verifies that a compiler uses the strategy from
+// CompilerCfg.Sizing, observes every render, and gives a clone its own.
+func TestCompilerCustomSizing(t *testing.T) {
+	var made []*recordingSizer
+	jc := NewCompiler(&CompilerCfg{Threshold: 15, Sizing: func() SizingStrategy {
+		rs := &recordingSizer{size: 4096}
+		made = append(made, rs)
+		return rs
+	}})
+	for range 3 {
+		jc.Render(div.New(span.Text("same")))
+	}
+	if len(made) != 1 {
+		t.Fatalf("one strategy should be made per compiler, got %d", len(made))
+	}
+	// Identical renders never deviate past Threshold, so an AdaptiveSizer
+	// would not see them; a custom strategy sees each one
+	if got := made[0].observed.Load(); got < 3 {
+		t.Errorf("strategy should observe every render, got %d of 3", got)
+	}
+	if jc.predict() != 4096 {
+		t.Errorf("prediction should come from the strategy, got %d", jc.predict())
+	}
+
+	jc.Clone()
+	if len(made) != 2 {
+		t.Errorf("a clone should get its own strategy, got %d made", len(made))
+	}
+
+	if st := sizingState(jc.sizer); st.Strategy != "*jit.recordingSizer" || st.Baseline != 4096 {
+		t.Errorf("diagnostics should name the strategy and its baseline, got %+v", st)
+	}
+}
+
+// TestTunerCustomSizing verifies that a tuner observes through the strategy
+// from TunerCfg.Sizing and resets it on Reset.
+func TestTunerCustomSizing(t *testing.T) {
+	rs := &recordingSizer{size: 64}
+	jt := NewTuner(&TunerCfg{Sizing: func() SizingStrategy { return rs }})
+	jt.Tune(span.Static("x"))
+	jt.Render()
+	jt.Reset()
+	if rs.observed.Load() != 1 || rs.resets.Load() != 1 {
+		t.Errorf("strategy should see 1 render and 1 reset, got %d and %d", rs.observed.Load(), rs.resets.Load())
+	}
+}
+
+// TestAdaptiveSizerTrim verifies that trimming keeps one huge render out
+// of the baseline, both while sampling and when it arrives afterwards.
+func TestAdaptiveSizerTrim(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(10, 20, 100)
+	as.SetTrim(10)
+
+	for _, size := range []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 50000} {
+		as.UpdateStats(size)
+	}
+	if baseline := as.GetBaseline(); baseline != 100 {
+		t.Errorf("the outlier should be trimmed from the baseline, got %d", baseline)
+	}
+
+	// An outlier after the baseline restarts sampling, seeded with itself,
+	// but is trimmed from the new baseline
+	as.UpdateStats(50000)
+	for range 9 {
+		as.UpdateStats(100)
+	}
+	if baseline := as.GetBaseline(); as.Active() || baseline != 100 {
+		t.Errorf("resampling around an outlier should settle back on 100, got %d (sampling %v)", baseline, as.Active())
+	}
+
+	untrimmed := NewAdaptiveSizer()
+	untrimmed.Configure(10, 20, 100)
+	for _, size := range []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 50000} {
+		untrimmed.UpdateStats(size)
+	}
+	if untrimmed.GetBaseline() <= 100 {
+		t.Errorf("without trimming the outlier should raise the mean, got %d", untrimmed.GetBaseline())
+	}
+}
+
+// TestAdaptiveSizerWindow verifies that a window follows drift too small
+// for the variance check, recomputing once per window of renders.
+func TestAdaptiveSizerWindow(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(5, 20, 100)
+	as.SetWindow(4)
+
+	for range 5 {
+		as.UpdateStats(1000)
+	}
+	if !as.tracking() {
+		t.Fatal("a windowed sizer should ask for every render once the baseline is set")
+	}
+
+	// 10% growth never crosses the 20% variance
+	for i := range 3 {
+		as.UpdateStats(1100)
+		if got := as.GetBaseline(); got != 1000 {
+			t.Fatalf("render %d: baseline should hold until the window fills, got %d", i, got)
+		}
+	}
+	as.UpdateStats(1100)
+	if got := as.GetBaseline(); got != 1100 {
+		t.Errorf("a full window should move the baseline to 1100, got %d", got)
+	}
+
+	// The ring keeps only the last 4 renders, so the 1100s drop out
+	for range 4 {
+		as.UpdateStats(1200)
+	}
+	if got := as.GetBaseline(); got != 1200 || as.Active() {
+		t.Errorf("the window should slide to 1200 without resampling, got %d (sampling %v)", got, as.Active())
+	}
+}
+
+// TestAdaptiveSizerMaxBaseline verifies that the cap holds against huge
+// renders in every mode and does not cause endless resampling.
+func TestAdaptiveSizerMaxBaseline(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.SetMaxBaseline(4096)
+	for range 5 {
+		as.UpdateStats(1 << 20)
+	}
+	if got := as.GetBaseline(); got != 4096 {
+		t.Fatalf("baseline should be capped at 4096, got %d", got)
+	}
+	as.UpdateStats(1 << 20)
+	if as.Active() {
+		t.Error("a render past the cap should not restart sampling when the baseline sits on it")
+	}
+
+	ewma := NewAdaptiveSizer()
+	ewma.SetEWMA(50)
+	ewma.SetMaxBaseline(4096)
+	for range 10 {
+		ewma.UpdateStats(1 << 20)
+	}
+	if got := ewma.GetBaseline(); got != 4096 {
+		t.Errorf("EWMA baseline should be capped at 4096, got %d", got)
+	}
+
+	// Lowering the cap takes effect at once, without resampling
+	as.SetMaxBaseline(1024)
+	if got := as.GetBaseline(); got != 1024 || as.Active() {
+		t.Errorf("a lower cap should lower the baseline to 1024 in place, got %d (sampling %v)", got, as.Active())
+	}
+}
+
+// TestAdaptiveSizerMinBaseline verifies that tiny samples settle on the
+// floor, that renders below it do not resample, and that the cap wins.
+func TestAdaptiveSizerMinBaseline(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.SetMinBaseline(4096)
+	if as.GetBaseline() != 0 {
+		t.Errorf("the floor should not apply before the first baseline, got %d", as.GetBaseline())
+	}
+	for range 5 {
+		as.UpdateStats(10)
+	}
+	if got := as.GetBaseline(); got != 4096 {
+		t.Fatalf("tiny samples should settle on the 4096 floor, got %d", got)
+	}
+	as.UpdateStats(10)
+	if as.Active() {
+		t.Error("a render below the floor should not restart sampling when the baseline sits on it")
+	}
+
+	as.SetMaxBaseline(1024)
+	if got := as.GetBaseline(); got != 1024 {
+		t.Errorf("the cap should win over the floor, got %d", got)
+	}
+}
+
+// TestAdaptiveSizerStats verifies the snapshot through sampling, the
+// baseline phase and a deviation-triggered resample.
+func TestAdaptiveSizerStats(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.UpdateStats(100)
+	as.UpdateStats(300)
+	st := as.Stats()
+	if !st.Sampling || st.Samples != 2 || st.Sum != 400 || st.Baseline != 0 || st.Variance != 20 {
+		t.Errorf("mid-sampling stats: got %+v", st)
+	}
+
+	for range 3 {
+		as.UpdateStats(200)
+	}
+	as.UpdateStats(10000)
+	if st := as.Stats(); !st.Sampling || st.Resamples != 1 || st.Samples != 1 || st.Sum != 10000 {
+		t.Errorf("after a deviation, sampling should restart seeded with it and count one resample, got %+v", st)
+	}
+
+	as.Reset()
+	if st := as.Stats(); st.Resamples != 1 {
+		t.Errorf("Reset should not clear or add to Resamples, got %d", st.Resamples)
+	}
+
+	jc := NewCompiler()
+	jc.Render(span.Static("x"))
+	if st := jc.SizerStats(); !st.Sampling || st.Samples == 0 || st.Sum == 0 {
+		t.Errorf("compiler's sizer should be sampling its first renders, got %+v", st)
+	}
+}
+
+// TestSharedSizer verifies that compilers sharing a sizer pool their
+// samples, and that the shared sizer can be driven directly.
+func TestSharedSizer(t *testing.T) {
+	shared := NewAdaptiveSizer()
+	shared.Configure(4, 20, 100)
+	cfg := &CompilerCfg{Threshold: 15, Sizing: SharedSizer(shared)}
+	a, b := NewCompiler(cfg), NewCompiler(cfg)
+
+	a.Render(span.Text("same"))
+	b.Render(span.Text("same"))
+	if st := shared.Stats(); st.Sampling || st.Baseline == 0 {
+		t.Fatalf("two compilers' renders should fill one sizer's 4 samples between them, got %+v", st)
+	}
+	if a.predict() != b.predict() || a.Clone().predict() != shared.GetBaseline() {
+		t.Error("compilers and clones sharing a sizer should predict the same size")
+	}
+
+	// Deterministic: the test sets the baseline and both compilers see it
+	shared.Reset()
+	for range 4 {
+		shared.UpdateStats(5000)
+	}
+	if a.predict() != 5000 || b.predict() != 5000 {
+		t.Errorf("both compilers should predict the shared baseline 5000, got %d and %d", a.predict(), b.predict())
+	}
+}
+
+// TestAdaptiveSizerCooldown verifies that alternating sizes stop
+// resampling during the cooldown, counted as thrash, and resume after.
+func TestAdaptiveSizerCooldown(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(2, 20, 100)
+	as.SetCooldown(4, 0)
+	as.UpdateStats(1000)
+	as.UpdateStats(1000)
+
+	for i := range 4 {
+		size := 1000
+		if i%2 == 0 {
+			size = 5000
+		}
+		as.UpdateStats(size)
+		if as.Active() {
+			t.Fatalf("render %d: the cooldown should hold the baseline", i)
+		}
+	}
+	if st := as.Stats(); st.Thrash != 2 || st.Resamples != 0 {
+		t.Errorf("two deviations should be held back as thrash, got %+v", st)
+	}
+	as.UpdateStats(5000)
+	if !as.Active() {
+		t.Error("after the cooldown a deviation should resample")
+	}
+
+	timed := NewAdaptiveSizer()
+	timed.Configure(1, 20, 100)
+	timed.SetCooldown(0, time.Hour)
+	timed.UpdateStats(1000)
+	timed.UpdateStats(5000)
+	if timed.Active() || timed.Stats().Thrash != 1 {
+		t.Errorf("a cooldown period should hold the baseline, got %+v", timed.Stats())
+	}
+}
+
+// TestAdaptiveSizerOnBaselineChange verifies that each new baseline is
+// reported with the one before it, across a resample, and that the
+// callback may read the sizer.
+func TestAdaptiveSizerOnBaselineChange(t *testing.T) {
+	type change struct{ old, new int }
+	var changes []change
+	as := NewAdaptiveSizer()
+	as.Configure(2, 20, 100)
+	as.OnBaselineChange(func(old, new int) {
+		_ = as.Stats() // must not deadlock
+		changes = append(changes, change{old, new})
+	})
+
+	as.UpdateStats(1000)
+	as.UpdateStats(1000)
+	as.UpdateStats(1050) // within the variance
+	as.UpdateStats(3000) // resample
+	as.UpdateStats(3000)
+
+	want := []change{{0, 1000}, {1000, 3000}}
+	if !slices.Equal(changes, want) {
+		t.Errorf("want changes %v, got %v", want, changes)
+	}
+
+	jc := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100, OnBaselineChange: func(old, new int) {
+		changes = append(changes, change{old, new})
+	}})
+	changes = nil
+	jc.Render(span.Static("x"))
+	if len(changes) != 1 || changes[0].new != len("<span>x</span>") {
+		t.Errorf("CompilerCfg.OnBaselineChange should see the first baseline, got %v", changes)
+	}
+}
+
+// TestAdaptiveSizerInitialBaseline verifies that a warm start skips
+// sampling, still resamples on a deviation, and reaches a compiler's
+// first render.
+func TestAdaptiveSizerInitialBaseline(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(2, 20, 100)
+	as.SetInitialBaseline(1000)
+	if got := as.GetBaseline(); got != 1000 || as.Active() {
+		t.Fatalf("want baseline 1000 without sampling, got %d (sampling %v)", got, as.Active())
+	}
+	as.UpdateStats(1050)
+	if as.Active() {
+		t.Error("a render within the variance of the initial baseline should not resample")
+	}
+	as.UpdateStats(3000)
+	if !as.Active() {
+		t.Error("a render past the variance of the initial baseline should resample")
+	}
+
+	jc := NewCompiler(&CompilerCfg{InitialBaseline: 4096})
+	if got := jc.predict(); got != 4096 {
+		t.Errorf("CompilerCfg.InitialBaseline should size the first render, got %d", got)
+	}
+}
+
+// TestAdaptiveSizerConfigureInvalid verifies that non-positive sizing
+// parameters are reported by ValidateSizing, ignored by Configure and
+// panicked on by MustConfigure.
+func TestAdaptiveSizerConfigureInvalid(t *testing.T) {
+	err := ValidateSizing(0, -5, 0)
+	if !errors.Is(err, ErrInvalidSizing) {
+		t.Fatalf("want ErrInvalidSizing, got %v", err)
+	}
+	for _, name := range []string{"max 0", "variance -5", "growth factor 0"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error should name %q, got %v", name, err)
+		}
+	}
+
+	as := NewAdaptiveSizer()
+	as.MustConfigure(2, 20, 100)
+	as.Configure(0, -5, 0)
+	as.UpdateStats(1000)
+	as.UpdateStats(1000)
+	if got := as.GetBaseline(); got != 1000 {
+		t.Errorf("an ignored Configure should keep the previous parameters, got baseline %d", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustConfigure should panic on invalid parameters")
+		}
+	}()
+	as.MustConfigure(5, 0, 115)
+}
+
+// TestCfgValidate verifies the cfg checks, that the Must variants panic
+// on what they report without registering anything, that a partial cfg
+// keeps the defaults for all three sizing fields, and that Configure
+// ignores invalid parameters but still chains.
+func TestCfgValidate(t *testing.T) {
+	defer ResetCompile()
+	defer ResetTune()
+	if err := (&CompilerCfg{Max: 5, Variance: 20, GrowthFactor: 115}).Validate(); err != nil {
+		t.Errorf("valid cfg should pass, got %v", err)
+	}
+	if err := (&CompilerCfg{Threshold: 15}).Validate(); err != nil {
+		t.Errorf("a cfg leaving all sizing fields zero should pass, got %v", err)
+	}
+	if err := (&CompilerCfg{Max: 5, Variance: 20}).Validate(); !errors.Is(err, ErrInvalidSizing) {
+		t.Errorf("a partial cfg should be reported, got %v", err)
+	}
+	if err := (&TunerCfg{Variance: -1}).Validate(); !errors.Is(err, ErrInvalidSizing) {
+		t.Errorf("a negative Variance should be reported, got %v", err)
+	}
+	if err := (&TunerCfg{Sizing: SharedSizer(NewAdaptiveSizer())}).Validate(); err != nil {
+		t.Errorf("sizing fields are unused with Sizing, got %v", err)
+	}
+
+	mustPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, ErrInvalidSizing) {
+				t.Errorf("%s should panic with ErrInvalidSizing, got %v", name, err)
+			}
+		}()
+		fn()
+	}
+	mustPanic("MustCompileConfig", func() { MustCompileConfig("validate:partial", CompilerCfg{Max: 10}) })
+	if _, ok := compilers.Load("validate:partial"); ok {
+		t.Error("a rejected cfg should not be registered")
+	}
+	mustPanic("MustTuneConfig", func() { MustTuneConfig("validate:partial", TunerCfg{GrowthFactor: -1, Max: 5, Variance: 20}) })
+	if _, ok := tuners.Load("validate:partial"); ok {
+		t.Error("a rejected cfg should not be registered")
+	}
+	MustCompileConfig("validate:ok", CompilerCfg{Threshold: 15})
+	if _, ok := compilers.Load("validate:ok"); !ok {
+		t.Error("a valid cfg should be registered")
+	}
+
+	jc := NewCompiler(&CompilerCfg{Threshold: 15, Max: 10})
+	if as := jc.sizer.(*AdaptiveSizer); as.max != 5 || as.variance != 20 || as.growthFactor != 115 {
+		t.Errorf("a partial cfg should keep the defaults for all three, got %d, %d, %d", as.max, as.variance, as.growthFactor)
+	}
+	if jc.Configure(15, 3, 30, 115).Configure(40, 0, 20, 115) != jc {
+		t.Error("Configure should return the compiler for chaining")
+	}
+	if st := jc.SizerStats(); st.Variance != 30 || jc.cfg.Max != 3 || jc.threshold != 15 {
+		t.Errorf("an invalid Configure should leave the compiler unchanged, got %+v threshold %d", st, jc.threshold)
+	}
+	mustPanic("Compiler.MustConfigure", func() { jc.MustConfigure(15, 3, 30, 0) })
+	mustPanic("Tuner.MustConfigure", func() { NewTuner().MustConfigure(5, 20, 0) })
+}
+
+// TestCompilerSeparateByteSizing verifies that renders returning bytes
+// and renders to a writer keep their own baselines when asked to.
+func TestCompilerSeparateByteSizing(t *testing.T) {
+	fragment := span.Text("x")
+	page := span.Text(strings.Repeat("x", 1000))
+	jc := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100, SeparateByteSizing: true})
+	for range 3 {
+		jc.Render(page, io.Discard)
+		jc.Render(fragment)
+		jc.AppendRender(nil, fragment)
+	}
+	if got := jc.SizerStats().Baseline; got != len("<span></span>")+1000 {
+		t.Errorf("writer renders should settle on the page size, got %d", got)
+	}
+	if got := jc.ByteSizerStats().Baseline; got != len("<span>x</span>") {
+		t.Errorf("byte renders should settle on the fragment size, got %d", got)
+	}
+
+	shared := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100})
+	shared.Render(page)
+	if shared.byteSizing() != shared.sizer {
+		t.Error("without SeparateByteSizing both paths should share one sizer")
+	}
+}
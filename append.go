@@ -0,0 +1,48 @@
+package jit
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// appendBuffers holds the bytes.Buffer headers AppendRender wraps around
+// the caller's slice. Only the header is pooled - its storage is always the
+// caller's - so taking one does not allocate.
+var appendBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// AppendRender renders root and appends the output to dst, returning the
+// extended slice, in the manner of the standard library's Append functions.
+// It is for callers that manage their own buffers, such as fasthttp
+// handlers: rendering into a slice that already has room allocates
+// nothing. If dst is too small it is grown once, to the compiler's
+// predicted size.
+//
+// Example:
+//
+//	buf := bufPool.Get().([]byte)
+//	buf = compiler.AppendRender(buf[:0], Page(data))
+//	ctx.Write(buf)
+func (jc *Compiler) AppendRender(dst []byte, root node.Node) []byte {
+	plan := jc.currentPlan(root)
+
+	sizer := jc.byteSizing()
+	predictedSize := jc.predictWith(sizer)
+	buf := appendBuffers.Get().(*bytes.Buffer) //nolint:forcetypeassert // only *bytes.Buffer is stored
+	*buf = *bytes.NewBuffer(dst)
+	buf.Grow(predictedSize)
+
+	jc.execute(plan, root, buf)
+	out := buf.Bytes()
+
+	actualSize := len(out) - len(dst)
+	jc.recordTo(sizer, predictedSize, actualSize)
+
+	// Drop the reference to the caller's memory before pooling the header.
+	*buf = bytes.Buffer{}
+	appendBuffers.Put(buf)
+	return out
+}
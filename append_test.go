@@ -0,0 +1,38 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestAppendRenderAppends verifies that AppendRender keeps dst's existing
+// content, appends the same output Render produces, and writes into dst's
+// spare capacity rather than a new slice when there is room.
+func TestAppendRenderAppends(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(p.Static("Hello"), span.Text("Alice"))
+	want := string(compiler.Render(tree))
+
+	dst := make([]byte, 0, 256)
+	dst = append(dst, "HTTP/1.1 200 OK\r\n\r\n"...)
+	got := compiler.AppendRender(dst, tree)
+
+	if string(got) != "HTTP/1.1 200 OK\r\n\r\n"+want {
+		t.Errorf("expected prefix followed by the render:\n  got  %q\n  want %q", got, "HTTP/1.1 200 OK\r\n\r\n"+want)
+	}
+	if &got[0] != &dst[0] {
+		t.Error("output should be written into dst's spare capacity")
+	}
+}
+
+// TestAppendRenderNilDst verifies that a nil dst works like a fresh slice.
+func TestAppendRenderNilDst(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(p.Static("Hello"), span.Text("Bob"))
+	if got, want := string(compiler.AppendRender(nil, tree)), string(compiler.Render(tree)); got != want {
+		t.Errorf("AppendRender(nil) should match Render:\n  got  %q\n  want %q", got, want)
+	}
+}
@@ -0,0 +1,314 @@
+package jit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// artifactMagic starts every artifact, and changes whenever the encoding
+// does so an old artifact is rejected rather than misread.
+const artifactMagic = "FJITART1"
+
+// Entry kinds in an artifact.
+const (
+	artifactCompiled  = 'c'
+	artifactFlattened = 'f'
+)
+
+// Element kinds within an encoded plan.
+const (
+	artifactStatic      = 's'
+	artifactDynamic     = 'd'
+	artifactConditional = 'q'
+)
+
+// ExportArtifact writes the compiled plans and flattened content in the
+// global Compile and Flatten registries to w, for LoadArtifact to share
+// between processes. Run it at deploy time, after warming every template
+// (see Warm), and ship the file alongside the binary.
+//
+// Only compiled templates are written - a compiler that has not rendered
+// has no plan. Conditional branches are written if they have been compiled.
+// Tuners are skipped, since they hold nothing but sizing statistics.
+func ExportArtifact(w io.Writer) error {
+	plans := make(map[string]*ExecutionPlan)
+	compilers.Range(func(key, val any) bool {
+		if plan := val.(*Compiler).executionPlan.Load(); plan != nil { //nolint:forcetypeassert // only *Compiler is stored
+			plans[key.(string)] = plan //nolint:forcetypeassert // only string IDs are stored
+		}
+		return true
+	})
+	flat := make(map[string][]byte)
+	flattened.Range(func(key, val any) bool {
+		flat[key.(string)] = val.(*flatEntry).content //nolint:forcetypeassert // only string IDs and *flatEntry are stored
+		return true
+	})
+
+	e := artifactEncoder{w: bufio.NewWriter(w)}
+	e.w.WriteString(artifactMagic)
+	e.uvarint(len(plans) + len(flat))
+	// Sorted so the same registries always produce the same artifact.
+	for _, id := range slices.Sorted(maps.Keys(plans)) {
+		e.w.WriteByte(artifactCompiled)
+		e.string(id)
+		e.plan(plans[id])
+	}
+	for _, id := range slices.Sorted(maps.Keys(flat)) {
+		e.w.WriteByte(artifactFlattened)
+		e.string(id)
+		e.bytes(flat[id])
+	}
+	return e.w.Flush()
+}
+
+// LoadArtifact registers the plans and flattened content from an artifact
+// written by ExportArtifact. Where the platform allows, the file is mapped
+// read-only into memory and the plans' static content is used in place, so
+// every process on a host that loads the same file shares one copy of it
+// through the page cache rather than holding its own. The mapping lasts
+// for the life of the process. Flattened content is copied out of the
+// mapping, since Flatten hands it to callers, and shared across IDs as
+// Flatten's own content is.
+//
+// Because plans keep reading the mapping, the file must never be rewritten
+// or truncated in place while a process has it loaded - that faults the
+// process with SIGBUS or serves changed bytes. Replace it atomically
+// instead: write the new artifact to a temporary file beside it and rename
+// it over the old one, which leaves loaded processes on the old file.
+//
+// A template already configured with CompileConfig keeps its
+// configuration and takes the loaded plan, with its settings applied. A
+// template that has already compiled keeps its own plan. Content in the
+// Flatten registry is replaced.
+//
+// Returns an error wrapping ErrBadArtifact if the file is not an artifact
+// or is truncated, in which case nothing is registered.
+func LoadArtifact(path string) error {
+	data, err := mapFile(path)
+	if err != nil {
+		return err
+	}
+
+	d := artifactDecoder{data: data}
+	if string(d.next(len(artifactMagic))) != artifactMagic {
+		return fmt.Errorf("%w: %s is not an artifact", ErrBadArtifact, path)
+	}
+
+	plans := make(map[string]*ExecutionPlan)
+	flat := make(map[string][]byte)
+	for range d.uvarint() {
+		kind := d.byte()
+		id := d.string()
+		switch kind {
+		case artifactCompiled:
+			plans[id] = d.plan()
+		case artifactFlattened:
+			flat[id] = d.bytes()
+		default:
+			d.fail()
+		}
+		if d.err != nil {
+			break
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrBadArtifact, path, d.err)
+	}
+
+	for id, plan := range plans {
+		compiler := registeredCompiler(id)
+		plan.apply(compiler.settings)
+		plan.version = planVersion(plan)
+		compiler.executionPlan.CompareAndSwap(nil, plan)
+	}
+	for id, content := range flat {
+		flattened.Store(id, sharedFlat(content))
+		markAdded(Flattened, id)
+	}
+	return nil
+}
+
+// artifactEncoder writes the artifact encoding. Write errors are sticky in
+// bufio.Writer and surface from the final Flush.
+type artifactEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *artifactEncoder) uvarint(n int) {
+	e.w.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *artifactEncoder) bytes(b []byte) {
+	e.uvarint(len(b))
+	e.w.Write(b)
+}
+
+func (e *artifactEncoder) string(s string) {
+	e.uvarint(len(s))
+	e.w.WriteString(s)
+}
+
+func (e *artifactEncoder) ints(v []int) {
+	e.uvarint(len(v))
+	for _, n := range v {
+		e.uvarint(n)
+	}
+}
+
+func (e *artifactEncoder) strings(v []string) {
+	e.uvarint(len(v))
+	for _, s := range v {
+		e.string(s)
+	}
+}
+
+// plan writes a plan's elements, including compiled conditional branches.
+func (e *artifactEncoder) plan(plan *ExecutionPlan) {
+	e.uvarint(len(plan.Elements))
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			e.w.WriteByte(artifactStatic)
+			e.bytes(el.Content)
+		case *DynamicPath:
+			e.w.WriteByte(artifactDynamic)
+			e.ints(el.Path)
+			e.strings(el.Tags)
+			e.string(el.Key)
+			flags := 0
+			if el.OpenTag {
+				flags = 1
+			}
+			e.uvarint(flags)
+			e.bytes(el.open)
+			e.bytes(el.close)
+		case *ConditionalPath:
+			e.w.WriteByte(artifactConditional)
+			e.ints(el.Path)
+			e.strings(el.Tags)
+			e.string(el.Key)
+			for i := range el.branches {
+				sub := el.branches[i].Load()
+				if sub == nil {
+					e.w.WriteByte(0)
+					continue
+				}
+				e.w.WriteByte(1)
+				e.plan(sub)
+			}
+		}
+	}
+}
+
+// artifactDecoder reads the artifact encoding from data. The first
+// malformed or truncated read sets err, after which every read returns a
+// zero value, so callers check err once at the end.
+type artifactDecoder struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (d *artifactDecoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed data at offset %d", d.off)
+	}
+}
+
+// next returns the next n bytes in place - the returned slice aliases the
+// mapped file, which is what lets processes share static content.
+func (d *artifactDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.data)-d.off {
+		d.fail()
+		return nil
+	}
+	b := d.data[d.off : d.off+n : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *artifactDecoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *artifactDecoder) uvarint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.off:])
+	if n <= 0 || v > uint64(len(d.data)) {
+		// No count or index in a valid artifact exceeds its own size.
+		d.fail()
+		return 0
+	}
+	d.off += n
+	return int(v)
+}
+
+func (d *artifactDecoder) bytes() []byte {
+	return d.next(d.uvarint())
+}
+
+func (d *artifactDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *artifactDecoder) ints() []int {
+	v := make([]int, d.uvarint())
+	for i := range v {
+		v[i] = d.uvarint()
+	}
+	return v
+}
+
+func (d *artifactDecoder) strings() []string {
+	v := make([]string, d.uvarint())
+	for i := range v {
+		v[i] = d.string()
+	}
+	return v
+}
+
+// plan reads a plan written by artifactEncoder.plan.
+func (d *artifactDecoder) plan() *ExecutionPlan {
+	plan := &ExecutionPlan{mapped: true}
+	for range d.uvarint() {
+		switch d.byte() {
+		case artifactStatic:
+			plan.Elements = append(plan.Elements, &StaticContent{Content: d.bytes()})
+		case artifactDynamic:
+			dp := &DynamicPath{Path: d.ints(), Tags: d.strings(), Key: d.string()}
+			dp.path = packPath(dp.Path)
+			dp.OpenTag = d.uvarint()&1 != 0
+			if open := d.bytes(); len(open) > 0 {
+				dp.open = open
+			}
+			if closeTag := d.bytes(); len(closeTag) > 0 {
+				dp.close = closeTag
+			}
+			plan.Elements = append(plan.Elements, dp)
+		case artifactConditional:
+			cp := &ConditionalPath{Path: d.ints(), Tags: d.strings(), Key: d.string()}
+			cp.path = packPath(cp.Path)
+			for i := range cp.branches {
+				if d.byte() == 1 {
+					cp.branches[i].Store(d.plan())
+				}
+			}
+			plan.Elements = append(plan.Elements, cp)
+		default:
+			d.fail()
+		}
+		if d.err != nil {
+			return plan
+		}
+	}
+	return plan
+}
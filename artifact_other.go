@@ -0,0 +1,11 @@
+//go:build !unix
+
+package jit
+
+import "os"
+
+// mapFile reads path into memory. Platforms without mmap support still load
+// artifacts, but each process holds its own copy.
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
@@ -0,0 +1,143 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// artifactPage mixes static content, a keyed slot and a conditional.
+func artifactPage(name string, admin bool) node.Node {
+	return div.New(
+		h1.Static("Profile"),
+		span.Text(name).Dynamic("name"),
+		node.When(admin, div.New(span.Static("Admin: "), span.Text(name))),
+	)
+}
+
+// exportArtifact writes the current registries to a file and returns its
+// path.
+func exportArtifact(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ExportArtifact(&buf); err != nil {
+		t.Fatalf("ExportArtifact failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "plans.jit")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestArtifactRoundTrip verifies that loaded plans render exactly as the
+// plans they were exported from, without compiling from the tree first.
+func TestArtifactRoundTrip(t *testing.T) {
+	defer Reset(All)
+
+	Compile("profile", artifactPage("Alice", true))
+	Flatten("footer", div.Static("(c) 2026"))
+	wantVersion := registeredCompiler("profile").Version()
+	path := exportArtifact(t)
+	Reset(All)
+
+	if err := LoadArtifact(path); err != nil {
+		t.Fatalf("LoadArtifact failed: %v", err)
+	}
+
+	compiler := registeredCompiler("profile")
+	if compiler.Version() != wantVersion {
+		t.Errorf("loaded plan should have the exported version: got %q, want %q", compiler.Version(), wantVersion)
+	}
+	plan := compiler.executionPlan.Load()
+	cp, ok := plan.Elements[len(plan.Elements)-2].(*ConditionalPath)
+	if !ok || cp.Branch(true) == nil {
+		t.Error("compiled conditional branch should be restored")
+	}
+
+	for _, tree := range []node.Node{artifactPage("Bob", true), artifactPage("Carol", false)} {
+		want := string(tree.Render())
+		if got := string(Compile("profile", tree)); got != want {
+			t.Errorf("loaded plan output:\n  got  %q\n  want %q", got, want)
+		}
+	}
+	if got := string(Flatten("footer", nil)); got != "<div>(c) 2026</div>" {
+		t.Errorf("flattened content should be restored, got %q", got)
+	}
+}
+
+// TestArtifactCopiesFlattened verifies that loaded flattened content is
+// copied out of the mapped file and shared like content Flatten stored.
+func TestArtifactCopiesFlattened(t *testing.T) {
+	defer Reset(All)
+
+	Flatten("footer", div.Static("(c) 2026"))
+	path := exportArtifact(t)
+	Reset(All)
+
+	Flatten("other-footer", div.Static("(c) 2026"))
+	if err := LoadArtifact(path); err != nil {
+		t.Fatalf("LoadArtifact failed: %v", err)
+	}
+
+	loaded, _ := flattened.Load("footer")
+	other, _ := flattened.Load("other-footer")
+	if &loaded.(*flatEntry).content[0] != &other.(*flatEntry).content[0] { //nolint:forcetypeassert // only *flatEntry is stored
+		t.Error("loaded content should be copied and shared with identical flattened content")
+	}
+}
+
+// TestArtifactKeepsCompiledPlan verifies a template that compiled before
+// the artifact was loaded keeps its own plan.
+func TestArtifactKeepsCompiledPlan(t *testing.T) {
+	defer Reset(All)
+
+	Compile("kept", div.New(h1.Static("old"), span.Text("x")))
+	path := exportArtifact(t)
+	Reset(All)
+
+	Compile("kept", div.New(h1.Static("new"), span.Text("x")))
+	before := registeredCompiler("kept").executionPlan.Load()
+	if err := LoadArtifact(path); err != nil {
+		t.Fatalf("LoadArtifact failed: %v", err)
+	}
+	if registeredCompiler("kept").executionPlan.Load() != before {
+		t.Error("an already compiled template should keep its plan")
+	}
+}
+
+// TestArtifactRejectsBadFiles verifies that foreign and truncated files are
+// refused without registering anything.
+func TestArtifactRejectsBadFiles(t *testing.T) {
+	defer Reset(All)
+
+	Compile("truncated", artifactPage("Alice", true))
+	path := exportArtifact(t)
+	Reset(All)
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(data)-5], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadArtifact(path); !errors.Is(err, ErrBadArtifact) {
+		t.Errorf("truncated artifact: expected ErrBadArtifact, got: %v", err)
+	}
+	if registered(Compilers, "truncated") {
+		t.Error("nothing should be registered from a bad artifact")
+	}
+
+	foreign := filepath.Join(t.TempDir(), "foreign")
+	if err := os.WriteFile(foreign, []byte("<html></html>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadArtifact(foreign); !errors.Is(err, ErrBadArtifact) {
+		t.Errorf("foreign file: expected ErrBadArtifact, got: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package jit
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps path read-only into memory. The mapping is never released,
+// since plans loaded from it may be in use for the life of the process.
+func mapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
@@ -0,0 +1,142 @@
+package jit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// unlabelledInputs are input types that need no label: they are hidden, or
+// their value or alt text already names them.
+var unlabelledInputs = []string{"hidden", "submit", "reset", "button", "image"}
+
+// Audit checks the compiled template's static markup for common
+// accessibility problems and returns one Issue for each:
+//
+//   - img-alt: an img with no alt attribute. Decorative images should
+//     have alt="".
+//   - control-label: an input, select or textarea with no label - not
+//     inside a label, not the target of a label's for attribute, and with
+//     no aria-label, aria-labelledby or title.
+//   - heading-order: a heading more than one level below the previous
+//     heading, such as an h4 straight after an h2.
+//
+// The compiler already holds the template's static markup as plain bytes,
+// so the audit is a single scan with no tree walk or rendering. Dynamic
+// content is not seen: a heading or label rendered dynamically can cause
+// a false report, and problems inside dynamic content are not found.
+// Conditional branches are audited once they have been compiled. Issues
+// are located by their enclosing tags, e.g. "form > div > input"; Path is
+// not set.
+//
+// Returns ErrNotCompiled if the compiler has not rendered yet. Run it from
+// a test against each template, like Validate.
+func (jc *Compiler) Audit() ([]Issue, error) {
+	plan := jc.executionPlan.Load()
+	if plan == nil {
+		return nil, ErrNotCompiled
+	}
+	a := &auditor{labelled: make(map[string]bool)}
+	a.scan = markupScan{ids: make(map[string]bool), onStart: a.start}
+	a.plan(plan)
+	return a.finish(), nil
+}
+
+// auditor carries the audit's state across a plan and its branches.
+type auditor struct {
+	scan     markupScan
+	heading  int             // Level of the last heading seen, or 0
+	labelled map[string]bool // ids named by a label's for attribute
+	controls []auditControl  // Controls that are only labelled if a label names their id
+	issues   []Issue
+}
+
+// auditControl is a form control waiting to be matched to a label.
+type auditControl struct {
+	name     string
+	id       string
+	location string
+}
+
+// plan scans a plan's static content in order. Each conditional branch is
+// scanned where the conditional sits, starting from the heading level
+// before it, since only one branch renders.
+func (a *auditor) plan(plan *ExecutionPlan) {
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			a.scan.scan(el.Content)
+		case *DynamicPath:
+			if el.OpenTag && len(el.Tags) > 0 {
+				a.scan.open = append(a.scan.open, el.Tags[len(el.Tags)-1])
+			}
+		case *ConditionalPath:
+			heading := a.heading
+			for _, condition := range []bool{true, false} {
+				if sub := el.Branch(condition); sub != nil {
+					a.heading = heading
+					a.plan(sub)
+				}
+			}
+			a.heading = heading
+		}
+	}
+}
+
+// start checks one start tag. a.scan.open holds its ancestors.
+func (a *auditor) start(name string, attrs []byte) {
+	location := strings.Join(append(slices.Clone(a.scan.open), name), " > ")
+	switch name {
+	case "img":
+		if _, ok := attrValue(attrs, "alt"); !ok {
+			a.report("img-alt", location, "<img> has no alt attribute")
+		}
+	case "label":
+		if id, ok := attrValue(attrs, "for"); ok {
+			a.labelled[id] = true
+		}
+	case "input", "select", "textarea":
+		if name == "input" {
+			if typ, _ := attrValue(attrs, "type"); slices.Contains(unlabelledInputs, strings.ToLower(typ)) {
+				return
+			}
+		}
+		if slices.Contains(a.scan.open, "label") || hasAttr(attrs, "aria-label", "aria-labelledby", "title") {
+			return
+		}
+		id, _ := attrValue(attrs, "id")
+		a.controls = append(a.controls, auditControl{name: name, id: id, location: location})
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(name[1] - '0')
+		if a.heading > 0 && level > a.heading+1 {
+			a.report("heading-order", location, fmt.Sprintf("<%s> follows <h%d>, skipping a level", name, a.heading))
+		}
+		a.heading = level
+	}
+}
+
+// finish reports controls that no label named, now that every label has
+// been seen, and returns the issues.
+func (a *auditor) finish() []Issue {
+	for _, c := range a.controls {
+		if c.id == "" || !a.labelled[c.id] {
+			a.report("control-label", c.location, fmt.Sprintf("<%s> has no label", c.name))
+		}
+	}
+	return a.issues
+}
+
+// report records one issue.
+func (a *auditor) report(rule, location, message string) {
+	a.issues = append(a.issues, Issue{Rule: rule, Message: message, Location: location})
+}
+
+// hasAttr reports whether attrs has any of names.
+func hasAttr(attrs []byte, names ...string) bool {
+	for _, name := range names {
+		if _, ok := attrValue(attrs, name); ok {
+			return true
+		}
+	}
+	return false
+}
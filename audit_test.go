@@ -0,0 +1,80 @@
+package jit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/attr/inputtype"
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/form"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/h2"
+	"github.com/jpl-au/fluent/html5/h4"
+	"github.com/jpl-au/fluent/html5/img"
+	"github.com/jpl-au/fluent/html5/input"
+	"github.com/jpl-au/fluent/html5/label"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestAuditReportsStaticProblems verifies each built-in rule on a page that
+// breaks it once, alongside markup that satisfies it.
+func TestAuditReportsStaticProblems(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(
+		h1.Static("Title"),
+		img.New().Src("logo.png").Alt("Logo"),
+		img.New().Src("hero.png"),
+		h2.Static("Section"),
+		h4.Static("Too deep"),
+		form.New(
+			label.New(input.New().Name("wrapped")),
+			label.Static("Email").For("email"),
+			input.New().ID("email").Name("email"),
+			input.New().Name("orphan"),
+			input.New().Type(inputtype.Hidden).Name("token"),
+			input.New().Name("q").AriaLabel("Search"),
+		),
+		span.Text("dynamic"),
+	))
+
+	issues, err := compiler.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"img-alt":       "div > img",
+		"heading-order": "div > h4",
+		"control-label": "div > form > input",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d: %v", len(want), len(issues), issues)
+	}
+	for _, issue := range issues {
+		if want[issue.Rule] != issue.Location {
+			t.Errorf("unexpected issue %v", issue)
+		}
+	}
+}
+
+// TestAuditLabelAfterControl verifies that a label naming a control by id
+// counts even when it comes after the control.
+func TestAuditLabelAfterControl(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(form.New(input.New().ID("name"), label.Static("Name").For("name")))
+
+	issues, err := compiler.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("label after its control should satisfy control-label, got %v", issues)
+	}
+}
+
+// TestAuditNotCompiled verifies that auditing before the first render
+// returns ErrNotCompiled.
+func TestAuditNotCompiled(t *testing.T) {
+	if _, err := NewCompiler().Audit(); !errors.Is(err, ErrNotCompiled) {
+		t.Errorf("expected ErrNotCompiled, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package jit
+
+import "github.com/jpl-au/fluent/node"
+
+// fallbackPlan returns the plan a compiler with CompilerCfg.BackgroundCompile
+// renders with until its first plan is ready: a single dynamic element at
+// the root, so the whole tree renders the standard way. Being a real plan,
+// every render path uses it unchanged. s is applied so a root Timeout or
+// a SafeRender count behave as they will once compiled.
+func fallbackPlan(s planSettings) *ExecutionPlan {
+	plan := &ExecutionPlan{Elements: []CompiledElement{&DynamicPath{}}}
+	s.markup = nil // There is no static markup to check
+	plan.apply(s)
+	return plan
+}
+
+// compileInBackground starts compiling the first plan from root unless a
+// compile is already running. Renders keep using the fallback plan until
+// the compiled one is stored.
+func (jc *Compiler) compileInBackground(root node.Node) {
+	if !jc.compiling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer func() {
+			r := recover()
+			// Cleared before reporting, so a render prompted by the report
+			// can start the next attempt.
+			jc.compiling.Store(false)
+			if err, ok := r.(error); ok && jc.cfg.OnPanic != nil {
+				jc.cfg.OnPanic(err)
+			}
+		}()
+		jc.compileMu.Lock()
+		defer jc.compileMu.Unlock()
+		if jc.executionPlan.Load() == nil {
+			jc.executionPlan.Store(jc.compile(root))
+		}
+	}()
+}
@@ -0,0 +1,73 @@
+package jit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// waitForPlan waits for compiler's first plan to be stored.
+func waitForPlan(t *testing.T, compiler *Compiler) *ExecutionPlan {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if plan := compiler.executionPlan.Load(); plan != nil {
+			return plan
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("background compile did not store a plan")
+	return nil
+}
+
+// TestBackgroundCompileFallsBack verifies that with BackgroundCompile the
+// first render does not wait for a plan, renders the tree correctly, and
+// that later renders use the plan compiled in the background.
+func TestBackgroundCompileFallsBack(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, BackgroundCompile: true})
+
+	got := string(compiler.Render(div.New(span.Static("Hello "), span.Text("Alice"))))
+	if want := "<div><span>Hello </span><span>Alice</span></div>"; got != want {
+		t.Errorf("fallback render should match standard rendering:\n  got  %q\n  want %q", got, want)
+	}
+
+	plan := waitForPlan(t, compiler)
+	if plan == compiler.fallback || len(plan.Elements) < 2 {
+		t.Fatalf("compiled plan should replace the fallback, got %d elements", len(plan.Elements))
+	}
+	got = string(compiler.Render(div.New(span.Static("ignored "), span.Text("Bob"))))
+	if want := "<div><span>Hello </span><span>Bob</span></div>"; got != want {
+		t.Errorf("renders after the compile should use the plan:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestBackgroundCompilePanicReported verifies that a background compile
+// that panics reports to OnPanic instead of crashing, and leaves the
+// compiler free to try again.
+func TestBackgroundCompilePanicReported(t *testing.T) {
+	reported := make(chan error, 1)
+	compiler := NewCompiler(&CompilerCfg{
+		Threshold:         15,
+		BackgroundCompile: true,
+		OnPanic:           func(err error) { reported <- err },
+	})
+
+	compiler.compileInBackground(div.New(panicky{errors.New("boom")}))
+	select {
+	case err := <-reported:
+		if !errors.Is(err, ErrCompilePanic) {
+			t.Errorf("OnPanic should receive a CompileError, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panicking background compile was not reported")
+	}
+	if compiler.executionPlan.Load() != nil {
+		t.Error("failed compile should not store a plan")
+	}
+
+	compiler.Render(div.New(span.Text("Alice")))
+	waitForPlan(t, compiler)
+}
@@ -0,0 +1,318 @@
+package jit
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// Strategy identifies which optimisation a Budget has chosen for a template.
+type Strategy int
+
+const (
+	// StrategyTune keeps only an adaptive sizer. It costs nothing beyond a
+	// few counters, so it is what every template falls back to.
+	StrategyTune Strategy = iota
+	// StrategyCompile keeps an execution plan, costing the template's
+	// static bytes.
+	StrategyCompile
+	// StrategyFlatten keeps the fully rendered output. Only fully static
+	// templates can be flattened.
+	StrategyFlatten
+)
+
+// String returns the strategy name as used in the package API.
+func (s Strategy) String() string {
+	switch s {
+	case StrategyCompile:
+		return "compile"
+	case StrategyFlatten:
+		return "flatten"
+	default:
+		return "tune"
+	}
+}
+
+// Budget chooses a strategy per template so that the bytes held by
+// flattened output and compiled plans stay within a fixed limit. Templates
+// that render most often get the most expensive strategy they can use;
+// everything else is demoted to tuning, which holds no template bytes.
+//
+// Each template is profiled on its first render - its static byte count,
+// rendered size and whether it contains dynamic content. Every
+// BudgetCfg.Interval renders the budget is rebalanced using the render counts
+// since the last rebalance, so the templates that are hot now are the ones
+// that hold memory.
+//
+// Example:
+//
+//	var pages = jit.NewBudget(jit.BudgetCfg{Limit: 256 << 20})
+//
+//	func homeHandler(w http.ResponseWriter, r *http.Request) {
+//	    pages.Render("home", HomePage(), w)
+//	}
+type Budget struct {
+	entries  sync.Map     // template ID -> *budgetEntry
+	renders  atomic.Int64 // renders since creation, drives periodic rebalancing
+	used     atomic.Int64 // bytes held by the current assignments
+	rebalMu  sync.Mutex   // serialises Rebalance and new assignments
+	limit    int64
+	interval int64
+	minRatio int
+}
+
+// budgetEntry is one template managed by a Budget. The profile fields are
+// written once on first render; the current strategy is swapped on rebalance.
+type budgetEntry struct {
+	id          string
+	dynamic     bool // whether the template can never be flattened
+	staticBytes int  // bytes the plan would hold - also the flattened size when static
+	size        int  // rendered size at profiling time
+	hits        atomic.Int64
+
+	current atomic.Pointer[budgetInstance] // read on every render without locking
+	mu      sync.Mutex                     // serialises building a new instance
+}
+
+// budgetInstance is a strategy together with the instance that implements
+// it. The instance is nil until the first render after the strategy was
+// assigned.
+type budgetInstance struct {
+	strategy  Strategy
+	flattener *Flattener
+	compiler  *Compiler
+	tuner     *Tuner
+}
+
+// ready reports whether the instance for the strategy has been built.
+func (bi *budgetInstance) ready() bool {
+	switch bi.strategy {
+	case StrategyFlatten:
+		return bi.flattener != nil
+	case StrategyCompile:
+		return bi.compiler != nil
+	default:
+		return bi.tuner != nil
+	}
+}
+
+// NewBudget creates a budget with the given configuration. An Interval of
+// zero rebalances every 1000 renders, and a MinStaticRatio of zero compiles
+// templates that are at least half static.
+func NewBudget(cfg BudgetCfg) *Budget {
+	b := &Budget{
+		limit:    cfg.Limit,
+		interval: int64(cfg.Interval),
+		minRatio: cfg.MinStaticRatio,
+	}
+	if b.interval <= 0 {
+		b.interval = 1000
+	}
+	if b.minRatio <= 0 {
+		b.minRatio = 50
+	}
+	return b
+}
+
+// Render renders n using whichever strategy the budget has assigned to id.
+// The first render of an id profiles the tree and assigns the best strategy
+// that still fits in the budget.
+func (b *Budget) Render(id string, n node.Node, w ...io.Writer) []byte {
+	val, loaded := b.entries.Load(id)
+	if !loaded {
+		val = b.register(id, n)
+	}
+	e := val.(*budgetEntry) //nolint:forcetypeassert // only *budgetEntry is stored
+	e.hits.Add(1)
+
+	if b.renders.Add(1)%b.interval == 0 {
+		b.Rebalance()
+	}
+
+	return e.render(n, w...)
+}
+
+// Strategy reports the strategy currently assigned to id. Unknown IDs
+// report StrategyTune, which is what they would get on first render if the
+// budget were full.
+func (b *Budget) Strategy(id string) Strategy {
+	val, ok := b.entries.Load(id)
+	if !ok {
+		return StrategyTune
+	}
+	return val.(*budgetEntry).current.Load().strategy //nolint:forcetypeassert // only *budgetEntry is stored
+}
+
+// Used returns the bytes currently held by flattened output and compiled
+// plans across all of the budget's templates.
+func (b *Budget) Used() int64 {
+	return b.used.Load()
+}
+
+// Rebalance reassigns every template's strategy by render frequency since
+// the previous rebalance. The most frequently rendered templates are placed
+// first, each taking its preferred strategy if it fits in what is left of
+// the limit, otherwise falling back to tuning.
+//
+// Rebalance runs automatically every BudgetCfg.Interval renders. Call it
+// directly to rebalance on a timer instead.
+func (b *Budget) Rebalance() {
+	b.rebalMu.Lock()
+	defer b.rebalMu.Unlock()
+
+	var all []*budgetEntry
+	hits := make(map[*budgetEntry]int64)
+	b.entries.Range(func(_, val any) bool {
+		e := val.(*budgetEntry) //nolint:forcetypeassert // only *budgetEntry is stored
+		all = append(all, e)
+		hits[e] = e.hits.Swap(0)
+		return true
+	})
+
+	// Ties break on ID so that rebalancing an idle budget is stable rather
+	// than shuffling templates between strategies at random.
+	slices.SortFunc(all, func(x, y *budgetEntry) int {
+		if c := cmp.Compare(hits[y], hits[x]); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.id, y.id)
+	})
+
+	var used int64
+	for _, e := range all {
+		s := b.fit(e, used)
+		used += e.cost(s)
+		e.assign(s)
+	}
+	b.used.Store(used)
+}
+
+// register profiles n and adds it to the budget with the best strategy that
+// fits. Concurrent first renders of the same id both profile, but only one
+// entry is kept.
+func (b *Budget) register(id string, n node.Node) any {
+	e := &budgetEntry{id: id, dynamic: isDynamic(n)}
+	for _, element := range buildPlan(n, planSettings{}).Elements {
+		if sc, ok := element.(*StaticContent); ok {
+			e.staticBytes += len(sc.Content)
+		}
+	}
+	var buf bytes.Buffer
+	n.RenderBuilder(&buf)
+	e.size = buf.Len()
+
+	b.rebalMu.Lock()
+	defer b.rebalMu.Unlock()
+
+	// Assign before storing so a concurrent Render never sees an entry
+	// without a strategy.
+	s := b.fit(e, b.used.Load())
+	e.assign(s)
+	val, loaded := b.entries.LoadOrStore(id, e)
+	if !loaded {
+		b.used.Add(e.cost(s))
+	}
+	return val
+}
+
+// fit returns the most effective strategy e can use within the budget,
+// given that used bytes are already committed elsewhere.
+func (b *Budget) fit(e *budgetEntry, used int64) Strategy {
+	s := b.preferred(e)
+	if used+e.cost(s) > b.limit {
+		return StrategyTune
+	}
+	return s
+}
+
+// preferred returns the strategy e would use with no memory limit. A
+// template that is mostly dynamic gains little from a plan, since most of
+// each render is still evaluated from the tree, so it is only tuned.
+func (b *Budget) preferred(e *budgetEntry) Strategy {
+	switch {
+	case !e.dynamic:
+		return StrategyFlatten
+	case e.size > 0 && e.staticBytes*100 >= e.size*b.minRatio:
+		return StrategyCompile
+	default:
+		return StrategyTune
+	}
+}
+
+// cost returns the bytes e holds under strategy s. Flattened output and a
+// compiled plan of a static tree are the same bytes, and a plan's dynamic
+// paths are small enough to ignore.
+func (e *budgetEntry) cost(s Strategy) int64 {
+	if s == StrategyTune {
+		return 0
+	}
+	return int64(e.staticBytes)
+}
+
+// assign switches e to s. The previous strategy's instance is dropped so
+// its memory can be collected; the new one is built lazily on the next
+// render, since only a render has a tree to build it from.
+func (e *budgetEntry) assign(s Strategy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cur := e.current.Load(); cur != nil && cur.strategy == s {
+		return
+	}
+	e.current.Store(&budgetInstance{strategy: s})
+}
+
+// render renders n with e's current strategy.
+func (e *budgetEntry) render(n node.Node, w ...io.Writer) []byte {
+	inst := e.current.Load()
+	if !inst.ready() {
+		inst = e.build(n)
+		if inst == nil {
+			// The profile said static but this tree is not - fall back
+			// rather than flatten dynamic content.
+			return n.Render(w...)
+		}
+	}
+
+	switch inst.strategy {
+	case StrategyFlatten:
+		return inst.flattener.Render(w...)
+	case StrategyCompile:
+		return inst.compiler.Render(n, w...)
+	default:
+		return inst.tuner.Tune(n).Render(w...)
+	}
+}
+
+// build creates the instance for e's current strategy from n. Returns nil
+// if n cannot be flattened despite being assigned StrategyFlatten.
+func (e *budgetEntry) build(n node.Node) *budgetInstance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Another render may have built it while we waited for the lock.
+	inst := e.current.Load()
+	if inst.ready() {
+		return inst
+	}
+
+	next := &budgetInstance{strategy: inst.strategy}
+	switch inst.strategy {
+	case StrategyFlatten:
+		f, err := NewFlattener(n)
+		if err != nil {
+			return nil
+		}
+		next.flattener = f
+	case StrategyCompile:
+		next.compiler = namedCompiler(e.id, nil)
+	default:
+		next.tuner = NewTuner()
+	}
+	e.current.Store(next)
+	return next
+}
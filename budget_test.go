@@ -0,0 +1,116 @@
+package jit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestBudgetAssignsPreferredStrategy verifies that with room to spare each
+// template gets the strategy that suits its content: static trees are
+// flattened, mostly static trees compiled, and mostly dynamic trees tuned.
+func TestBudgetAssignsPreferredStrategy(t *testing.T) {
+	b := NewBudget(BudgetCfg{Limit: 1 << 20})
+
+	b.Render("static", div.New(span.Static("hello")))
+	b.Render("mixed", div.New(p.Static(strings.Repeat("static ", 20)), span.Text("x")))
+	b.Render("dynamic", div.New(span.Text(strings.Repeat("dynamic ", 20))))
+
+	for id, want := range map[string]Strategy{
+		"static":  StrategyFlatten,
+		"mixed":   StrategyCompile,
+		"dynamic": StrategyTune,
+	} {
+		if got := b.Strategy(id); got != want {
+			t.Errorf("%s template should use %s, got %s", id, want, got)
+		}
+	}
+}
+
+// TestBudgetRespectsLimit verifies that once the limit is spent, further
+// templates are tuned rather than pushing the budget over.
+func TestBudgetRespectsLimit(t *testing.T) {
+	tree := div.Static(strings.Repeat("x", 100))
+	size := int64(len(tree.Render()))
+	b := NewBudget(BudgetCfg{Limit: size})
+
+	b.Render("first", tree)
+	b.Render("second", tree)
+
+	if got := b.Strategy("first"); got != StrategyFlatten {
+		t.Errorf("first template fits the budget and should be flattened, got %s", got)
+	}
+	if got := b.Strategy("second"); got != StrategyTune {
+		t.Errorf("second template does not fit and should be tuned, got %s", got)
+	}
+	if b.Used() > size {
+		t.Errorf("budget used %d bytes, over its limit of %d", b.Used(), size)
+	}
+}
+
+// TestBudgetRebalanceFavoursHotTemplates verifies that rebalancing moves
+// memory to whichever template is rendered most, even if it registered
+// after the budget was full.
+func TestBudgetRebalanceFavoursHotTemplates(t *testing.T) {
+	tree := div.Static(strings.Repeat("x", 100))
+	b := NewBudget(BudgetCfg{Limit: int64(len(tree.Render()))})
+
+	b.Render("cold", tree)
+	for range 10 {
+		b.Render("hot", tree)
+	}
+	b.Rebalance()
+
+	if got := b.Strategy("hot"); got != StrategyFlatten {
+		t.Errorf("most rendered template should be flattened after rebalance, got %s", got)
+	}
+	if got := b.Strategy("cold"); got != StrategyTune {
+		t.Errorf("rarely rendered template should be demoted to tune, got %s", got)
+	}
+}
+
+// TestBudgetRenderOutput verifies that every strategy renders the same
+// output, including after a template is demoted by a rebalance.
+func TestBudgetRenderOutput(t *testing.T) {
+	tree := div.New(p.Static(strings.Repeat("static ", 20)), span.Text("Alice"))
+	want := string(tree.Render())
+	b := NewBudget(BudgetCfg{Limit: 1 << 20})
+
+	if got := string(b.Render("page", tree)); got != want {
+		t.Errorf("compiled render should match standard rendering:\n  got  %q\n  want %q", got, want)
+	}
+
+	b.limit = 0
+	b.Rebalance()
+	if got := b.Strategy("page"); got != StrategyTune {
+		t.Fatalf("template should be demoted when the budget shrinks, got %s", got)
+	}
+
+	var buf bytes.Buffer
+	if out := b.Render("page", tree, &buf); out != nil {
+		t.Error("Render should return nil when writing to a writer")
+	}
+	if buf.String() != want {
+		t.Errorf("tuned render should match standard rendering:\n  got  %q\n  want %q", buf.String(), want)
+	}
+}
+
+// TestBudgetAutomaticRebalance verifies that the budget rebalances on its
+// own every Interval renders.
+func TestBudgetAutomaticRebalance(t *testing.T) {
+	tree := div.Static(strings.Repeat("x", 100))
+	b := NewBudget(BudgetCfg{Limit: int64(len(tree.Render())), Interval: 5})
+
+	b.Render("cold", tree)
+	for range 4 {
+		b.Render("hot", tree)
+	}
+
+	if got := b.Strategy("hot"); got != StrategyFlatten {
+		t.Errorf("rebalance on the fifth render should give the hot template the budget, got %s", got)
+	}
+}
@@ -0,0 +1,270 @@
+package jit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// Warm compiles each template into the global Compile registry ahead of
+// its first request, so the first visitor after a deploy does not pay for
+// plan building. Each builder is called once and its tree rendered to
+// io.Discard under the same ID that handlers pass to Compile. It is
+// BuildAll for the Compilers registry alone.
+//
+// Templates are warmed concurrently, up to BulkCfg.Concurrency at a time.
+// Warming stops starting new templates once ctx is done. A builder that
+// panics does not stop the others - every failure is returned, joined, with
+// the ID of the template it came from.
+//
+// Example:
+//
+//	err := jit.Warm(ctx, map[string]func() node.Node{
+//	    "home":  func() node.Node { return HomePage(sampleData) },
+//	    "about": func() node.Node { return AboutPage() },
+//	})
+func Warm(ctx context.Context, templates map[string]func() node.Node, cfg ...BulkCfg) error {
+	return BuildAll(ctx, Compilers, templates, cfg...)
+}
+
+// BuildAll registers each template in every selected registry ahead of
+// its first request: compiled as by Compile, tuned as by Tune, or
+// flattened as by Flatten, each rendering to io.Discard. Each builder is
+// called once and its tree used for every selected registry. A template
+// that is dynamic is not flattened and is reported with the paths to its
+// dynamic nodes, wrapping ErrDynamicContent, as by FlattenAll.
+//
+// Concurrency, cancellation and errors behave as for Warm. An ID that is
+// already registered keeps its entry; use Rebuild to replace it.
+//
+// Example:
+//
+//	err := jit.BuildAll(ctx, jit.Compilers|jit.Tuners, templates,
+//	    jit.BulkCfg{Concurrency: 4})
+func BuildAll(ctx context.Context, which Registry, templates map[string]func() node.Node, cfg ...BulkCfg) error {
+	return runBulk(ctx, slices.Sorted(maps.Keys(templates)), cfg, func(id string) error {
+		n := templates[id]()
+		if which&Compilers != 0 {
+			Compile(id, n, io.Discard)
+		}
+		if which&Tuners != 0 {
+			Tune(id, n, io.Discard)
+		}
+		if which&Flattened != 0 {
+			return flattenStatic(id, n)
+		}
+		return nil
+	})
+}
+
+// FlattenAll flattens each template into the global Flatten registry at
+// startup. Flatten falls back to rendering a template that turns out to be
+// dynamic on every request, which is easy to miss; FlattenAll checks every
+// template first and returns an error naming each dynamic one, with the
+// paths to its dynamic nodes, so a misconfigured template fails the boot
+// instead. The static templates are flattened even when others fail.
+//
+// The returned error wraps ErrDynamicContent if any template is dynamic.
+// An ID that is already flattened keeps its content, as with Flatten; call
+// Rebuild or ResetFlatten first to replace it. Concurrency and
+// cancellation behave as for Warm.
+//
+// Example:
+//
+//	if err := jit.FlattenAll(ctx, map[string]node.Node{
+//	    "footer": Footer(),
+//	    "about":  AboutPage(),
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func FlattenAll(ctx context.Context, templates map[string]node.Node, cfg ...BulkCfg) error {
+	return runBulk(ctx, slices.Sorted(maps.Keys(templates)), cfg, func(id string) error {
+		return flattenStatic(id, templates[id])
+	})
+}
+
+// flattenStatic flattens n under id as Flatten does, or returns an error
+// wrapping ErrDynamicContent if n is dynamic.
+func flattenStatic(id string, n node.Node) error {
+	if paths := dynamicPaths(n, nil, nil); len(paths) > 0 {
+		return fmt.Errorf("%w: dynamic nodes at paths %v", ErrDynamicContent, paths)
+	}
+	Flatten(id, n)
+	return nil
+}
+
+// Rebuild replaces templates that are already registered with the trees
+// their builders return, such as after reloading translations or a new
+// deploy's content. In each selected registry holding the ID, a compiler
+// is recompiled in place (see Compiler.Recompile), a tuner renders the new
+// tree with its sizing statistics reset, and flattened content is
+// replaced. Renders already in flight finish on what they started with.
+//
+// An ID held by none of the selected registries is not built, and is
+// reported with ErrNotRegistered; a dynamic tree is not flattened and is
+// reported with ErrDynamicContent. Concurrency, cancellation and errors
+// behave as for Warm.
+//
+// Example:
+//
+//	err := jit.Rebuild(ctx, jit.All, map[string]func() node.Node{
+//	    "footer": func() node.Node { return Footer(newLocale) },
+//	})
+func Rebuild(ctx context.Context, which Registry, templates map[string]func() node.Node, cfg ...BulkCfg) error {
+	return runBulk(ctx, slices.Sorted(maps.Keys(templates)), cfg, func(id string) error {
+		if !registeredAny(which, id) {
+			return ErrNotRegistered
+		}
+		n := templates[id]()
+		if val, ok := compilers.Load(id); ok && which&Compilers != 0 {
+			val.(*Compiler).Recompile(n) //nolint:forcetypeassert // only *Compiler is stored
+		}
+		if val, ok := tuners.Load(id); ok && which&Tuners != 0 {
+			val.(*Tuner).Tune(n).Reset().Render(io.Discard) //nolint:forcetypeassert // only *Tuner is stored
+		}
+		if _, ok := flattened.Load(id); ok && which&Flattened != 0 {
+			if paths := dynamicPaths(n, nil, nil); len(paths) > 0 {
+				return fmt.Errorf("%w: dynamic nodes at paths %v", ErrDynamicContent, paths)
+			}
+			var buf bytes.Buffer
+			n.RenderBuilder(&buf)
+			flattened.Store(id, sharedFlat(buf.Bytes()))
+			markAdded(Flattened, id)
+		}
+		return nil
+	})
+}
+
+// Prune removes every entry of the selected registries whose ID keep
+// rejects, and returns how many were removed. It is Reset for cleanup
+// that needs a decision per ID, such as asking a database whether a
+// tenant still exists, so keep is called concurrently, once per ID, up to
+// BulkCfg.Concurrency at a time.
+//
+// Once ctx is done no further IDs are checked and the entries already
+// removed stay removed. A keep that panics keeps that ID's entries and is
+// reported with the ID, alongside ctx.Err() if the run was cancelled.
+//
+// Example:
+//
+//	n, err := jit.Prune(ctx, jit.All, func(id string) bool {
+//	    return tenants.Exists(strings.Split(id, ":")[1])
+//	})
+func Prune(ctx context.Context, which Registry, keep func(id string) bool, cfg ...BulkCfg) (int, error) {
+	seen := make(map[string]bool)
+	for _, reg := range []Registry{Compilers, Tuners, Flattened} {
+		if which&reg == 0 {
+			continue
+		}
+		reg.entries().Range(func(key, _ any) bool {
+			seen[key.(string)] = true //nolint:forcetypeassert // only string IDs are stored
+			return true
+		})
+	}
+
+	var removed atomic.Int64
+	err := runBulk(ctx, slices.Sorted(maps.Keys(seen)), cfg, func(id string) error {
+		if keep(id) {
+			return nil
+		}
+		for _, reg := range []Registry{Compilers, Tuners, Flattened} {
+			if which&reg == 0 {
+				continue
+			}
+			if _, ok := reg.entries().LoadAndDelete(id); ok {
+				added.Delete(registryKey{reg, id})
+				removed.Add(1)
+			}
+		}
+		return nil
+	})
+	return int(removed.Load()), err
+}
+
+// registeredAny reports whether id is held by any of the selected
+// registries.
+func registeredAny(which Registry, id string) bool {
+	for _, reg := range []Registry{Compilers, Tuners, Flattened} {
+		if which&reg != 0 {
+			if _, ok := reg.entries().Load(id); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runBulk calls fn for each ID with bounded concurrency. It is shared by
+// every registry-wide operation so they agree on how concurrency,
+// cancellation and errors behave.
+//
+// IDs are started in order, so a cancelled run has processed a predictable
+// prefix. Once ctx is done no further IDs are started, and ctx.Err() is
+// included in the returned error alongside any failures from IDs that had
+// already started. A panic in fn is recovered and reported as that ID's
+// error, since one broken template should not take the others down.
+func runBulk(ctx context.Context, ids []string, cfg []BulkCfg, fn func(id string) error) error {
+	limit := runtime.GOMAXPROCS(0)
+	if len(cfg) > 0 && cfg[0].Concurrency > 0 {
+		limit = cfg[0].Concurrency
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	record := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	sem := make(chan struct{}, limit)
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		// Checked after acquiring too - select picks randomly when both
+		// cases are ready, so a slot may have been taken after cancellation.
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					record(fmt.Errorf("%s: panic: %v", id, r))
+				}
+			}()
+			if err := fn(id); err != nil {
+				record(fmt.Errorf("%s: %w", id, err))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Goroutines finish in any order - sort so the joined error reads the
+	// same from run to run.
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,242 @@
+package jit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestWarmCompilesTemplates verifies that Warm leaves a compiled plan in
+// the global registry under each ID, so the first Compile call reuses it.
+func TestWarmCompilesTemplates(t *testing.T) {
+	defer ResetCompile()
+
+	err := Warm(context.Background(), map[string]func() node.Node{
+		"warm-a": func() node.Node { return div.New(span.Text("a")) },
+		"warm-b": func() node.Node { return div.Static("b") },
+	})
+	if err != nil {
+		t.Fatalf("warming valid templates should not fail, got: %v", err)
+	}
+
+	for _, id := range []string{"warm-a", "warm-b"} {
+		val, ok := compilers.Load(id)
+		if !ok {
+			t.Fatalf("%s should be in the registry after Warm", id)
+		}
+		if val.(*Compiler).Version() == "" {
+			t.Errorf("%s should have a compiled plan after Warm", id)
+		}
+	}
+}
+
+// TestWarmCollectsPanics verifies that one template panicking does not stop
+// the rest from warming, and that the error names the template.
+func TestWarmCollectsPanics(t *testing.T) {
+	defer ResetCompile()
+
+	err := Warm(context.Background(), map[string]func() node.Node{
+		"warm-broken": func() node.Node { panic("missing data") },
+		"warm-ok":     func() node.Node { return div.Static("ok") },
+	})
+	if err == nil || !strings.Contains(err.Error(), "warm-broken: panic: missing data") {
+		t.Errorf("error should name the template that panicked, got: %v", err)
+	}
+	if _, ok := compilers.Load("warm-ok"); !ok {
+		t.Error("a panic in one template should not stop the others from warming")
+	}
+}
+
+// TestRunBulkConcurrencyLimit verifies that no more than Concurrency items
+// run at once.
+func TestRunBulkConcurrencyLimit(t *testing.T) {
+	var running, peak atomic.Int32
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	err := runBulk(context.Background(), ids, []BulkCfg{{Concurrency: 2}}, func(string) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		running.Add(-1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("no item failed, got: %v", err)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("at most 2 items should run at once, saw %d", peak.Load())
+	}
+}
+
+// TestRunBulkCancelled verifies that a cancelled context stops new items
+// from starting and is reported in the error.
+func TestRunBulkCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var started atomic.Int32
+	err := runBulk(ctx, []string{"a", "b", "c"}, nil, func(string) error {
+		started.Add(1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error should report the cancellation, got: %v", err)
+	}
+	if started.Load() != 0 {
+		t.Errorf("no items should start after cancellation, %d did", started.Load())
+	}
+}
+
+// TestRunBulkJoinsErrors verifies that every failure is reported with its
+// ID, not just the first.
+func TestRunBulkJoinsErrors(t *testing.T) {
+	fail := errors.New("boom")
+	err := runBulk(context.Background(), []string{"a", "b", "c"}, nil, func(id string) error {
+		if id == "b" {
+			return nil
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("joined error should wrap each failure, got: %v", err)
+	}
+	if err.Error() != "a: boom\nc: boom" {
+		t.Errorf("error should list each failed ID in order, got %q", err.Error())
+	}
+}
+
+// TestFlattenAll verifies that static templates are flattened and each
+// dynamic one is named in the returned error.
+func TestFlattenAll(t *testing.T) {
+	defer ResetFlatten()
+
+	err := FlattenAll(context.Background(), map[string]node.Node{
+		"footer": div.New(span.Static("footer")),
+		"about":  div.New(span.Static("about")),
+		"card":   div.New(span.Static("name"), span.Text("Alice")),
+		"badge":  span.Text("new"),
+	})
+	if !errors.Is(err, ErrDynamicContent) {
+		t.Fatalf("expected ErrDynamicContent, got %v", err)
+	}
+	for _, want := range []string{"badge: ", "card: ", "[[1 0]]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "footer") || strings.Contains(err.Error(), "about") {
+		t.Errorf("static templates should not be reported, got %v", err)
+	}
+
+	for id, want := range map[string]string{"footer": "footer", "about": "about"} {
+		if !registered(Flattened, id) {
+			t.Errorf("%s should be flattened despite the failures", id)
+		} else if got := string(Flatten(id, nil)); got != "<div><span>"+want+"</span></div>" {
+			t.Errorf("%s flattened as %q", id, got)
+		}
+	}
+	if registered(Flattened, "card") {
+		t.Error("a dynamic template should not be flattened")
+	}
+}
+
+// TestBuildAllSelectedRegistries verifies that BuildAll registers each
+// template in every selected registry and only those.
+func TestBuildAllSelectedRegistries(t *testing.T) {
+	defer Reset(All)
+
+	err := BuildAll(context.Background(), Tuners|Flattened, map[string]func() node.Node{
+		"build-a": func() node.Node { return div.Static("a") },
+	})
+	if err != nil {
+		t.Fatalf("building a static template should not fail, got: %v", err)
+	}
+	if !registered(Tuners, "build-a") || !registered(Flattened, "build-a") {
+		t.Error("build-a should be tuned and flattened")
+	}
+	if registered(Compilers, "build-a") {
+		t.Error("build-a should not be compiled when Compilers is not selected")
+	}
+
+	err = BuildAll(context.Background(), Flattened, map[string]func() node.Node{
+		"build-dynamic": func() node.Node { return span.Text("x") },
+	})
+	if !errors.Is(err, ErrDynamicContent) || !strings.Contains(err.Error(), "build-dynamic: ") {
+		t.Errorf("a dynamic template should be named with ErrDynamicContent, got: %v", err)
+	}
+}
+
+// TestRebuildReplacesRegistered verifies that Rebuild swaps in the new
+// tree for a registered ID and reports an ID that is not registered.
+func TestRebuildReplacesRegistered(t *testing.T) {
+	defer Reset(All)
+
+	Compile("rebuild-page", div.New(span.Static("old"), span.Text("x")))
+	Flatten("rebuild-footer", div.Static("old"))
+
+	err := Rebuild(context.Background(), All, map[string]func() node.Node{
+		"rebuild-page":   func() node.Node { return div.New(span.Static("new"), span.Text("x")) },
+		"rebuild-footer": func() node.Node { return div.Static("new") },
+	})
+	if err != nil {
+		t.Fatalf("rebuilding registered templates should not fail, got: %v", err)
+	}
+	if got := string(Compile("rebuild-page", div.New(span.Static("old"), span.Text("y")))); got != "<div><span>new</span><span>y</span></div>" {
+		t.Errorf("compiled template should use the rebuilt static content, got %q", got)
+	}
+	if got := string(Flatten("rebuild-footer", nil)); got != "<div>new</div>" {
+		t.Errorf("flattened content should be replaced, got %q", got)
+	}
+
+	built := false
+	err = Rebuild(context.Background(), All, map[string]func() node.Node{
+		"rebuild-missing": func() node.Node { built = true; return div.Static("x") },
+	})
+	if !errors.Is(err, ErrNotRegistered) || !strings.Contains(err.Error(), "rebuild-missing: ") {
+		t.Errorf("an unregistered ID should be named with ErrNotRegistered, got: %v", err)
+	}
+	if built {
+		t.Error("the builder of an unregistered ID should not be called")
+	}
+}
+
+// TestPruneRemovesRejected verifies that Prune removes the entries keep
+// rejects from the selected registries and counts them.
+func TestPruneRemovesRejected(t *testing.T) {
+	defer Reset(All)
+
+	for _, id := range []string{"prune-keep", "prune-drop"} {
+		Compile(id, div.Static(id))
+		Flatten(id, div.Static(id))
+	}
+	Tune("prune-drop", div.Static("t"))
+
+	n, err := Prune(context.Background(), Compilers|Flattened, func(id string) bool {
+		return id == "prune-keep"
+	}, BulkCfg{Concurrency: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("prune-drop's compiler and flattened entry should be removed, got %d", n)
+	}
+	if registered(Compilers, "prune-drop") || registered(Flattened, "prune-drop") {
+		t.Error("prune-drop should be removed from the selected registries")
+	}
+	if !registered(Tuners, "prune-drop") {
+		t.Error("a registry that is not selected should be left alone")
+	}
+	if !registered(Compilers, "prune-keep") || !registered(Flattened, "prune-keep") {
+		t.Error("prune-keep should be kept")
+	}
+}
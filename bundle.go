@@ -0,0 +1,99 @@
+package jit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// FlattenerBundle holds several static fragments flattened back to back in
+// one byte slice, so a page shell such as head, nav and footer can be
+// served with a single write. It is a Flattener over the whole bundle, so
+// Render, ETag and NotModified cover every part; Part and Parts serve
+// some of them.
+type FlattenerBundle struct {
+	*Flattener
+	offsets []int // Start of each part in bytes, plus the end of the last
+
+	rebuilt atomic.Pointer[FlattenerBundle] // replacement from the last Rebuild, nil until then
+}
+
+// NewFlattenerBundle flattens each part in order into one contiguous
+// slice. It returns an error wrapping ErrDynamicContent, naming the part,
+// if any part is not fully static.
+//
+// Example:
+//
+//	shell, err := jit.NewFlattenerBundle(Head(), Nav(), Footer())
+//	...
+//	shell.Parts(0, 2, w) // head + nav in one write
+//	renderContent(w)
+//	shell.Part(2, w)     // footer
+func NewFlattenerBundle(parts ...node.Node) (*FlattenerBundle, error) {
+	var buf bytes.Buffer
+	offsets := make([]int, 0, len(parts)+1)
+	for i, part := range parts {
+		if isDynamic(part) {
+			return nil, fmt.Errorf("%w: bundle part %d", ErrDynamicContent, i)
+		}
+		offsets = append(offsets, buf.Len())
+		part.RenderBuilder(&buf)
+	}
+	offsets = append(offsets, buf.Len())
+
+	return &FlattenerBundle{
+		Flattener: newFlattener(buf.Bytes()),
+		offsets:   offsets,
+	}, nil
+}
+
+// NumParts returns the number of parts in the bundle. Len, from the
+// embedded Flattener, is the size of the whole bundle in bytes.
+func (fb *FlattenerBundle) NumParts() int {
+	return len(fb.current().offsets) - 1
+}
+
+// Part writes part i to the writer or returns it. Like Render, the
+// returned slice is shared and must not be written into. It panics if i
+// is out of range, like indexing a slice.
+func (fb *FlattenerBundle) Part(i int, w ...io.Writer) []byte {
+	return fb.Parts(i, i+1, w...)
+}
+
+// Parts writes parts from through to-1 to the writer as one write, or
+// returns them as one slice, since they sit next to each other in the
+// bundle. It panics if the range is out of bounds, like slicing.
+func (fb *FlattenerBundle) Parts(from, to int, w ...io.Writer) []byte {
+	fb = fb.current()
+	content := fb.bytes[fb.offsets[from]:fb.offsets[to]:fb.offsets[to]]
+	if len(w) > 0 && w[0] != nil {
+		_, _ = w[0].Write(content)
+		return nil
+	}
+	return content
+}
+
+// Rebuild flattens parts as a new bundle and serves it from then on, as
+// Flattener.Rebuild does for a single template. The parts may differ in
+// number from before. On error the current bundle is kept.
+func (fb *FlattenerBundle) Rebuild(parts ...node.Node) error {
+	next, err := NewFlattenerBundle(parts...)
+	if err != nil {
+		return err
+	}
+	fb.rebuilt.Store(next)
+	fb.Flattener.rebuilt.Store(next.Flattener)
+	return nil
+}
+
+// current returns the bundle holding the content to serve, as
+// Flattener.current does.
+func (fb *FlattenerBundle) current() *FlattenerBundle {
+	if next := fb.rebuilt.Load(); next != nil {
+		return next
+	}
+	return fb
+}
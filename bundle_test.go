@@ -0,0 +1,71 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestFlattenerBundle verifies that parts are stored back to back and can
+// be served whole, singly or as a contiguous range.
+func TestFlattenerBundle(t *testing.T) {
+	fb, err := NewFlattenerBundle(span.Static("head"), span.Static("nav"), span.Static("foot"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fb.NumParts() != 3 {
+		t.Errorf("expected 3 parts, got %d", fb.NumParts())
+	}
+	if fb.Len() != len(fb.Render()) {
+		t.Errorf("Len should be the bundle's size in bytes, got %d", fb.Len())
+	}
+	if got := string(fb.Render()); got != "<span>head</span><span>nav</span><span>foot</span>" {
+		t.Errorf("whole bundle rendered %q", got)
+	}
+	if got := string(fb.Part(1)); got != "<span>nav</span>" {
+		t.Errorf("part 1 rendered %q", got)
+	}
+
+	var w bytes.Buffer
+	fb.Parts(0, 2, &w)
+	if w.String() != "<span>head</span><span>nav</span>" {
+		t.Errorf("parts 0-1 wrote %q", w.String())
+	}
+
+	head := fb.Part(0)
+	_ = append(head, "X"...)
+	if got := string(fb.Part(1)); got != "<span>nav</span>" {
+		t.Errorf("appending to a part should not overwrite the next, got %q", got)
+	}
+	if fb.ETag() == "" {
+		t.Error("bundle should have an ETag")
+	}
+}
+
+// TestFlattenerBundleDynamic verifies that a dynamic part is rejected by
+// its index.
+func TestFlattenerBundleDynamic(t *testing.T) {
+	_, err := NewFlattenerBundle(span.Static("head"), div.New(span.Text("x")))
+	if !errors.Is(err, ErrDynamicContent) || !strings.Contains(err.Error(), "part 1") {
+		t.Errorf("expected ErrDynamicContent naming part 1, got %v", err)
+	}
+}
+
+// TestFlattenerBundleRebuild verifies that a rebuilt bundle serves its new
+// parts and offsets through every method.
+func TestFlattenerBundleRebuild(t *testing.T) {
+	fb, _ := NewFlattenerBundle(span.Static("a"), span.Static("b"))
+	if err := fb.Rebuild(span.Static("head"), span.Static("nav"), span.Static("foot")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fb.NumParts() != 3 || string(fb.Part(2)) != "<span>foot</span>" {
+		t.Errorf("rebuilt parts should be served, got %d parts, part 2 %q", fb.NumParts(), fb.Part(2))
+	}
+	if got := string(fb.Render()); got != "<span>head</span><span>nav</span><span>foot</span>" {
+		t.Errorf("rebuilt bundle rendered %q", got)
+	}
+}
@@ -0,0 +1,105 @@
+package jit
+
+import (
+	"bytes"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// rangeMember is one dynamic or conditional sibling rendered by an opRange.
+type rangeMember struct {
+	op    planOp // The member's own op, used to render it
+	child int    // Its index among the parent's children
+	gap   []byte // Static content written after it, before the next member
+}
+
+// coalesceOps merges each run of dynamic and conditional ops whose nodes
+// share a parent, and that have at most a static op between each pair,
+// into one opRange. Static content between two siblings in the plan is
+// everything rendered between them - the static siblings in between, or
+// the rest of an element whose opening tag was dynamic - so writing it from
+// the plan as the gap after each member renders exactly what the separate
+// ops did, and the static content may be any size. Ops for the root itself
+// have no parent and are left alone.
+func coalesceOps(ops []planOp) []planOp {
+	out := ops[:0]
+	for i := 0; i < len(ops); {
+		parent, child, ok := splitPath(ops[i])
+		if !ok {
+			out = append(out, ops[i])
+			i++
+			continue
+		}
+
+		members := []rangeMember{{op: ops[i], child: child}}
+		j := i + 1
+		for {
+			var gap []byte
+			next := j
+			if next < len(ops) && ops[next].kind == opStatic {
+				gap = ops[next].static
+				next++
+			}
+			if next >= len(ops) {
+				break
+			}
+			p, c, ok := splitPath(ops[next])
+			if !ok || p != parent {
+				break
+			}
+			members[len(members)-1].gap = gap
+			members = append(members, rangeMember{op: ops[next], child: c})
+			j = next + 1
+		}
+
+		if len(members) == 1 {
+			out = append(out, ops[i])
+		} else {
+			out = append(out, planOp{kind: opRange, path: parent, members: members, element: ops[i].element})
+		}
+		i = j
+	}
+	return out
+}
+
+// splitPath returns the path to op's parent and op's index under it, or
+// false if op is static or its node is the root.
+func splitPath(op planOp) (packedPath, int, bool) {
+	if op.kind != opDynamic && op.kind != opConditional {
+		return "", 0, false
+	}
+	path := op.path.ints()
+	if len(path) == 0 {
+		return "", 0, false
+	}
+	return packPath(path[:len(path)-1]), path[len(path)-1], true
+}
+
+// renderRange renders each member of an opRange and the static content
+// between them. Unless nodes already holds every member's node, the parent
+// is resolved once and the members are taken from its children. A member
+// the tree has no node for falls back to its own op, which reports the
+// mismatch.
+func (op *planOp) renderRange(root node.Node, nodes []node.Node, buf *bytes.Buffer) {
+	var children []node.Node
+	if nodes == nil {
+		if parent, ok := op.path.resolve(root); ok {
+			children = parent.Nodes()
+		}
+	}
+	for i := range op.members {
+		m := &op.members[i]
+		var n node.Node
+		if nodes != nil {
+			n = nodes[m.op.element]
+		} else if m.child < len(children) {
+			n = children[m.child]
+		}
+		if n != nil {
+			m.op.renderNode(n, buf)
+		} else {
+			m.op.render(root, nil, buf)
+		}
+		buf.Write(m.gap)
+	}
+}
@@ -0,0 +1,77 @@
+package jit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/td"
+	"github.com/jpl-au/fluent/html5/tr"
+	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
+)
+
+// row builds a table row whose cell holds dynamic text separated by
+// static text, with a conditional at the end.
+func row(name, email string, admin bool) node.Node {
+	return tr.New(td.New(
+		text.Text(name),
+		text.Static(" <"),
+		text.Text(email),
+		text.Text(strings.ToUpper(name)),
+		node.When(admin, text.Static(" admin")),
+	))
+}
+
+// TestCoalesceDynamicMatchesOutput verifies that coalescing merges the
+// row's dynamic cells into one op and renders exactly what the uncoalesced
+// plan does, including on the resolved-tree fast path and RenderContext.
+func TestCoalesceDynamicMatchesOutput(t *testing.T) {
+	plain := NewCompiler(&CompilerCfg{Threshold: 15})
+	coalesced := NewCompiler(&CompilerCfg{Threshold: 15, CoalesceDynamic: true})
+
+	plain.Render(row("ann", "ann@example.com", true))
+	coalesced.Render(row("ann", "ann@example.com", true))
+
+	plan := coalesced.executionPlan.Load()
+	ranges := 0
+	for _, op := range plan.ops {
+		if op.kind == opRange {
+			ranges++
+			if len(op.members) != 4 {
+				t.Errorf("range should hold all four dynamic cells, got %d", len(op.members))
+			}
+		}
+	}
+	if ranges != 1 || len(plan.ops) >= len(plan.Elements) {
+		t.Fatalf("expected one range op and fewer ops than elements, got %d ranges, %d ops for %d elements", ranges, len(plan.ops), len(plan.Elements))
+	}
+
+	root := row("bob", "bob@example.com", false)
+	want := string(plain.Render(root))
+	for i := range 2 { // The second render of the same root uses resolved nodes
+		if got := string(coalesced.Render(root)); got != want {
+			t.Errorf("render %d: coalesced output differs:\ngot:  %s\nwant: %s", i, got, want)
+		}
+	}
+	var sb strings.Builder
+	if err := coalesced.RenderContext(context.Background(), row("bob", "bob@example.com", false), &sb); err != nil || sb.String() != want {
+		t.Errorf("RenderContext output differs (err %v):\ngot:  %s\nwant: %s", err, sb.String(), want)
+	}
+}
+
+// TestCoalesceDynamicReportsMismatch verifies that a member whose node is
+// missing from the tree is still reported, and the rest of the range
+// renders.
+func TestCoalesceDynamicReportsMismatch(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, CoalesceDynamic: true, SafeRender: true})
+	compiler.Render(td.New(text.Text("a"), text.Static("|"), text.Text("b")))
+
+	got := string(compiler.Render(td.New(text.Text("x"), text.Static("|"))))
+	if got != "<td>x|</td>" {
+		t.Errorf("members present should render, got %s", got)
+	}
+	if mismatches := compiler.Stats().Mismatches; mismatches != 1 {
+		t.Errorf("missing member should count one mismatch, got %d", mismatches)
+	}
+}
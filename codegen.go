@@ -0,0 +1,102 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// GenerateFlattened writes Go source for package pkg that embeds the
+// flattened output of each template, so fully static shells ship in the
+// binary precomputed and nothing is rendered at startup. Templates are
+// keyed by the name of the variable to declare. For each one the file
+// holds a string constant named with an HTML suffix and a ready-made
+// Flattener built from it:
+//
+//	const FooterHTML = "<footer>...</footer>"
+//
+//	var Footer = jit.FlattenerFromBytes([]byte(FooterHTML))
+//
+// Every template is checked before anything is written, and an error
+// names each one that is dynamic (wrapping ErrDynamicContent), whose name
+// is not a Go identifier, or whose constant would clash with another
+// name.
+//
+// Run it from a small program invoked by go:generate:
+//
+//	//go:generate go run ./cmd/genshells
+//
+//	func main() {
+//	    f, _ := os.Create("shells_gen.go")
+//	    defer f.Close()
+//	    if err := jit.GenerateFlattened(f, "shells", map[string]node.Node{
+//	        "Footer": Footer(),
+//	    }); err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+func GenerateFlattened(w io.Writer, pkg string, templates map[string]node.Node) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("package name %q is not a Go identifier", pkg)
+	}
+
+	names := slices.Sorted(maps.Keys(templates))
+	declared := make(map[string]bool, 2*len(names))
+	var errs []error
+	for _, name := range names {
+		if !token.IsIdentifier(name) {
+			errs = append(errs, fmt.Errorf("%q: not a Go identifier", name))
+			continue
+		}
+		if paths := dynamicPaths(templates[name], nil, nil); len(paths) > 0 {
+			errs = append(errs, fmt.Errorf("%s: %w: dynamic nodes at paths %v", name, ErrDynamicContent, paths))
+		}
+		for _, ident := range []string{name, name + "HTML"} {
+			if declared[ident] {
+				errs = append(errs, fmt.Errorf("%s: %s is declared twice", name, ident))
+			}
+			declared[ident] = true
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by fluent-jit GenerateFlattened. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	src.WriteString("import jit \"github.com/jpl-au/fluent-jit\"\n")
+	for _, name := range names {
+		var content bytes.Buffer
+		templates[name].RenderBuilder(&content)
+		fmt.Fprintf(&src, "\n// %sHTML is the flattened output of %s.\n", name, name)
+		fmt.Fprintf(&src, "const %sHTML = %s\n", name, strconv.Quote(content.String()))
+		fmt.Fprintf(&src, "\n// %s serves %sHTML.\n", name, name)
+		fmt.Fprintf(&src, "var %s = jit.FlattenerFromBytes([]byte(%sHTML))\n", name, name)
+	}
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated source: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// FlattenerFromBytes returns a flattener serving content as it is, for
+// content flattened ahead of time - by GenerateFlattened, or loaded from
+// a build artifact. Nothing is rendered or checked; content is trusted to
+// be the output of a static tree, and must not be modified afterwards.
+// Options such as transforms and compressed variants are applied with
+// NewFlattener instead, or baked into content before it is generated.
+func FlattenerFromBytes(content []byte) *Flattener {
+	return newFlattener(content)
+}
@@ -0,0 +1,76 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestGenerateFlattened verifies that the generated file parses, carries
+// the generated-code marker, and embeds the flattened bytes exactly.
+func TestGenerateFlattened(t *testing.T) {
+	var out bytes.Buffer
+	err := GenerateFlattened(&out, "shells", map[string]node.Node{
+		"Footer": div.New(span.Static(`"quoted" & <tagged>` + "\n")),
+		"nav":    span.Static("nav"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	src := out.String()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "shells_gen.go", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"// Code generated by fluent-jit GenerateFlattened. DO NOT EDIT.\n",
+		"package shells\n",
+		`const FooterHTML = "<div><span>\"quoted\" & <tagged>\n</span></div>"`,
+		"var Footer = jit.FlattenerFromBytes([]byte(FooterHTML))",
+		"var nav = jit.FlattenerFromBytes([]byte(navHTML))",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source should contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// TestGenerateFlattenedRejects verifies that dynamic templates, invalid
+// names and clashing constants are all reported and nothing is written.
+func TestGenerateFlattenedRejects(t *testing.T) {
+	var out bytes.Buffer
+	err := GenerateFlattened(&out, "shells", map[string]node.Node{
+		"Card":       span.Text("x"),
+		"not-valid":  span.Static("x"),
+		"Footer":     span.Static("x"),
+		"FooterHTML": span.Static("x"),
+	})
+	if !errors.Is(err, ErrDynamicContent) {
+		t.Errorf("expected ErrDynamicContent, got %v", err)
+	}
+	for _, want := range []string{"Card: ", `"not-valid": not a Go identifier`, "FooterHTML is declared twice"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got %v", want, err)
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("nothing should be written on error, got %d bytes", out.Len())
+	}
+}
+
+// TestFlattenerFromBytes verifies that pre-flattened content is served
+// with the same metadata as if it had been rendered.
+func TestFlattenerFromBytes(t *testing.T) {
+	rendered, _ := NewFlattener(div.New(span.Static("shell")))
+	f := FlattenerFromBytes([]byte("<div><span>shell</span></div>"))
+	if string(f.Render()) != string(rendered.Render()) || f.ETag() != rendered.ETag() {
+		t.Errorf("pre-flattened content should match rendered, got %q ETag %s", f.Render(), f.ETag())
+	}
+}
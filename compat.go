@@ -0,0 +1,96 @@
+package jit
+
+import (
+	"fmt"
+)
+
+// CompatibleWith reports whether trees built for other's template can be
+// rendered by jc's plan, and the other way round. Two plans are compatible
+// when they navigate to dynamic content along the same paths in the same
+// order - their static markup may differ freely, which is what lets a
+// blue/green deploy ship new markup for the same data.
+//
+// Both compilers must have rendered at least once. Returns nil if the plans
+// are compatible, or an error wrapping ErrStructureMismatch that describes
+// the first dynamic element where they diverge.
+//
+// Example:
+//
+//	next := jit.NewCompiler()
+//	next.Render(ProductPageV2(sample))
+//	if err := next.CompatibleWith(current); err != nil {
+//	    log.Printf("v2 is not a drop-in replacement: %v", err)
+//	}
+func (jc *Compiler) CompatibleWith(other *Compiler) error {
+	a, b := jc.executionPlan.Load(), other.executionPlan.Load()
+	if a == nil || b == nil {
+		return ErrNotCompiled
+	}
+	return comparePlans(a, b)
+}
+
+// comparePlans compares the dynamic elements of two plans in order. Static
+// content is skipped, and adjacent static chunks merge differently when
+// markup changes, so elements are paired by their position among dynamic
+// elements rather than by index in the plan.
+func comparePlans(a, b *ExecutionPlan) error {
+	da, db := dynamicElements(a), dynamicElements(b)
+
+	for i := range min(len(da), len(db)) {
+		if err := compareElements(da[i], db[i]); err != nil {
+			return err
+		}
+	}
+	if len(da) != len(db) {
+		return fmt.Errorf("%w: plans have %d and %d dynamic elements", ErrStructureMismatch, len(da), len(db))
+	}
+	return nil
+}
+
+// dynamicElements returns the plan's elements that read from the tree.
+func dynamicElements(plan *ExecutionPlan) []CompiledElement {
+	var out []CompiledElement
+	for _, element := range plan.Elements {
+		if _, static := element.(*StaticContent); !static {
+			out = append(out, element)
+		}
+	}
+	return out
+}
+
+// compareElements checks that two dynamic elements navigate to the same
+// place. For conditionals, branches compiled in both plans are compared too;
+// a branch only one side has seen cannot be checked yet.
+func compareElements(a, b CompiledElement) error {
+	switch ea := a.(type) {
+	case *DynamicPath:
+		eb, ok := b.(*DynamicPath)
+		if !ok {
+			return fmt.Errorf("%w: %s is dynamic in one plan but a conditional in the other", ErrStructureMismatch, ea)
+		}
+		if ea.path != eb.path {
+			return fmt.Errorf("%w: dynamic path %s does not match %s", ErrStructureMismatch, ea, eb)
+		}
+		if ea.OpenTag != eb.OpenTag {
+			return fmt.Errorf("%w: %s has dynamic attributes in only one plan", ErrStructureMismatch, ea)
+		}
+	case *ConditionalPath:
+		eb, ok := b.(*ConditionalPath)
+		if !ok {
+			return fmt.Errorf("%w: %s is a conditional in one plan but dynamic in the other", ErrStructureMismatch, ea)
+		}
+		if ea.path != eb.path {
+			return fmt.Errorf("%w: conditional path %s does not match %s", ErrStructureMismatch, ea, eb)
+		}
+		for _, condition := range []bool{true, false} {
+			sa, sb := ea.Branch(condition), eb.Branch(condition)
+			if sa == nil || sb == nil {
+				continue
+			}
+			if err := comparePlans(sa, sb); err != nil {
+				return fmt.Errorf("in %v branch of %s: %w", condition, ea, err)
+			}
+		}
+	}
+	return nil
+}
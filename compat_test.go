@@ -0,0 +1,81 @@
+package jit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestCompatibleWithNewMarkup verifies that changing static markup alone
+// keeps plans compatible - that is the change a blue/green deploy ships.
+func TestCompatibleWithNewMarkup(t *testing.T) {
+	v1 := NewCompiler()
+	v2 := NewCompiler()
+	v1.Render(div.New(h1.Static("Products"), span.Text("Alice")))
+	v2.Render(div.New(h1.Static("All products"), span.Text("Alice")).Class("v2"))
+
+	if err := v2.CompatibleWith(v1); err != nil {
+		t.Errorf("plans differing only in static content should be compatible, got: %v", err)
+	}
+}
+
+// TestCompatibleWithMovedDynamic verifies that moving dynamic content to a
+// different position is reported, naming the paths involved.
+func TestCompatibleWithMovedDynamic(t *testing.T) {
+	v1 := NewCompiler()
+	v2 := NewCompiler()
+	v1.Render(div.New(h1.Static("Products"), span.Text("Alice")))
+	v2.Render(div.New(span.Text("Alice"), h1.Static("Products")))
+
+	err := v2.CompatibleWith(v1)
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Fatalf("moved dynamic content should be incompatible, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "div > span[0] > text[0] does not match div > span[1] > text[0]") {
+		t.Errorf("error should name both paths, got: %v", err)
+	}
+}
+
+// TestCompatibleWithExtraDynamic verifies that a plan with more dynamic
+// elements than the other is incompatible.
+func TestCompatibleWithExtraDynamic(t *testing.T) {
+	v1 := NewCompiler()
+	v2 := NewCompiler()
+	v1.Render(div.New(span.Text("Alice")))
+	v2.Render(div.New(span.Text("Alice"), p.Text("Admin")))
+
+	if err := v2.CompatibleWith(v1); !errors.Is(err, ErrStructureMismatch) {
+		t.Errorf("extra dynamic element should be incompatible, got: %v", err)
+	}
+}
+
+// TestCompatibleWithConditionalBranch verifies that branch sub-plans are
+// compared when both compilers have compiled them.
+func TestCompatibleWithConditionalBranch(t *testing.T) {
+	v1 := NewCompiler()
+	v2 := NewCompiler()
+	v1.Render(div.New(node.When(true, div.New(span.Static("Hi "), span.Text("Alice")))))
+	v2.Render(div.New(node.When(true, div.New(span.Text("Alice")))))
+
+	err := v2.CompatibleWith(v1)
+	if !errors.Is(err, ErrStructureMismatch) || !strings.Contains(err.Error(), "true branch") {
+		t.Errorf("differing branch plans should be incompatible and name the branch, got: %v", err)
+	}
+}
+
+// TestCompatibleWithNotCompiled verifies that comparing against a compiler
+// that has not rendered is an error rather than a vacuous success.
+func TestCompatibleWithNotCompiled(t *testing.T) {
+	v1 := NewCompiler()
+	v1.Render(div.New(span.Text("Alice")))
+
+	if err := v1.CompatibleWith(NewCompiler()); !errors.Is(err, ErrNotCompiled) {
+		t.Errorf("uncompiled compiler should report ErrNotCompiled, got: %v", err)
+	}
+}
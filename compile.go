@@ -2,13 +2,19 @@ package jit
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"reflect"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"unique"
 
 	"github.com/jpl-au/fluent"
 	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
 )
 
 // CompiledElement represents a single rendering operation in the execution plan.
@@ -20,7 +26,9 @@ type CompiledElement interface {
 // StaticContent holds pre-rendered static HTML content as raw bytes.
 // Adjacent static nodes are merged into single StaticContent elements for efficiency.
 type StaticContent struct {
-	Content []byte // Pre-rendered HTML bytes ready for direct buffer writes
+	Content []byte // Pre-rendered HTML bytes ready for direct buffer writes - must not be modified
+
+	handle unique.Handle[string] // Keeps an interned Content shared, see CompilerCfg.InternStatic
 }
 
 // Render writes the pre-compiled static content directly to the buffer.
@@ -32,39 +40,260 @@ func (sc *StaticContent) Render(_ node.Node, buf *bytes.Buffer) {
 // DynamicPath holds the path to a dynamic node in the tree structure.
 // The path is a slice of indices that navigates from root to the dynamic node.
 // This enables re-evaluation with new tree instances that share the same structure.
+//
+// Renders follow a packed copy of Path made when the element is built or
+// its plan is laid out, so changing Path afterwards has no effect.
 type DynamicPath struct {
-	Path []int // Indices to navigate: e.g., [0, 1] means root.Nodes()[0].Nodes()[1]
+	Path []int    // Indices to navigate: e.g., [0, 1] means root.Nodes()[0].Nodes()[1]
+	Tags []string // Label of each node along Path, starting with the root - for diagnostics only
+	Key  string   // The node's dynamic key at compile time, or "" if it had none - see Compiler.Slots
+	// OpenTag is set when only the element's opening tag is dynamic, and
+	// its children are compiled into the rest of the plan - see DynamicAttr.
+	OpenTag bool
+
+	mismatches *mismatchCounter // Reports paths that fail to resolve, set when compiled by a Compiler
+	open       []byte           // A keyed element's opening tag, for RenderFromMap
+	close      []byte           // A keyed element's closing tag, for RenderFromMap
+	timeouts   *timeoutCounter  // Counts Timeout nodes at this path that miss their deadline
+
+	lastGood sharedOutput // Last output of TimeoutShared nodes at this path by key, served if they time out
+
+	path packedPath // Path packed for the render loop, see packedPath
+}
+
+// String describes the path by tag, e.g. "div > ul[0] > li[2]".
+func (dp *DynamicPath) String() string {
+	return describePath(dp.Path, dp.Tags)
 }
 
 // Render navigates the tree using the stored path and renders the dynamic node.
 // This allows different tree instances (with same structure) to render different values.
 func (dp *DynamicPath) Render(root node.Node, buf *bytes.Buffer) {
+	n, ok := dp.path.resolve(root)
+	if !ok {
+		// Path invalid for this tree - safety check
+		if dp.mismatches != nil {
+			dp.mismatches.report(dp.Path, dp.Tags)
+		}
+		return
+	}
+	dp.renderNode(n, buf)
+}
+
+// renderNode renders n, the node dp.Path leads to.
+func (dp *DynamicPath) renderNode(n node.Node, buf *bytes.Buffer) {
+	if t, ok := n.(*timed); ok {
+		dp.renderTimed(t, buf)
+		return
+	}
+	if dp.OpenTag {
+		if elem, ok := n.(node.Element); ok {
+			elem.RenderOpen(buf)
+			return
+		}
+	}
+	n.RenderBuilder(buf)
+}
+
+// resolve follows a path of child indices from root and returns the node it
+// leads to. Returns false if any index is out of range for the given tree.
+func resolve(root node.Node, path []int) (node.Node, bool) {
 	n := root
-	for _, idx := range dp.Path {
+	for _, idx := range path {
 		children := n.Nodes()
 		if idx >= len(children) {
-			return // Path invalid for this tree - safety check
+			return nil, false
 		}
 		n = children[idx]
 	}
-	n.RenderBuilder(buf)
+	return n, true
 }
 
 // ExecutionPlan contains the compiled sequence of static and dynamic elements.
 // The plan is a linear sequence that can be executed without tree traversal.
 type ExecutionPlan struct {
 	Elements []CompiledElement // Linear sequence of rendering operations
+
+	ops  []planOp // Elements laid out for the render loop, see layout
+	slab []byte   // Every static chunk back to back, see layout
+
+	mapped bool // Static content points into a loaded artifact, see LoadArtifact
+
+	version string // Hash of the plan, see Compiler.Version - kept with the plan so a swap replaces both together
+
+	staticRatio int // Percentage of the compiling render that was static, see CompilerStats.StaticRatio
+
+	fragments sync.Map // Path key -> *ExecutionPlan for a subtree, see Compiler.RenderFragment
+
+	pretty atomic.Pointer[ExecutionPlan] // The same plan with indented static content, see Compiler.RenderPretty
+}
+
+// opKind says which fields of a planOp are set.
+type opKind uint8
+
+const (
+	opStatic      opKind = iota // static holds the bytes to write
+	opDynamic                   // path and dynamic locate and render a dynamic node
+	opConditional               // path and conditional locate a conditional and run its branch
+	opRange                     // path locates a parent, and members render some of its children, see coalesce
+)
+
+// planOp is one plan element as the render loop sees it. Elements is the
+// public form of the plan, but rendering it costs an interface call per
+// element and a pointer chase to reach each element's bytes or path. The
+// ops hold those inline in one slice, so the loop is a switch over
+// adjacent structs and static content is written without leaving it.
+type planOp struct {
+	kind        opKind
+	static      []byte
+	path        packedPath
+	dynamic     *DynamicPath
+	conditional *ConditionalPath
+	members     []rangeMember // For opRange
+	element     int           // Index in plan.Elements, for the nodes passed to run
+}
+
+// layout builds plan.ops from plan.Elements. It must run after anything
+// that rewrites static content, which is why apply calls it last.
+//
+// Static chunks are copied into a single slab and each StaticContent is
+// re-pointed at its region of it, so a plan's static bytes are one
+// allocation read front to back rather than one per chunk. Interned chunks
+// and chunks read from an artifact are left where they are: they are
+// shared with other plans or processes, and copying them would undo that.
+//
+// With coalesce set, runs of dynamic siblings are then merged, see
+// coalesceOps.
+func (plan *ExecutionPlan) layout(coalesce bool) {
+	size := 0
+	for _, element := range plan.Elements {
+		if sc, ok := element.(*StaticContent); ok && plan.slabbed(sc) {
+			size += len(sc.Content)
+		}
+	}
+	slab := make([]byte, 0, size)
+
+	ops := make([]planOp, len(plan.Elements))
+	for i, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			if plan.slabbed(el) {
+				start := len(slab)
+				slab = append(slab, el.Content...)
+				// Cap the region so appending to Content cannot overwrite
+				// the next chunk.
+				el.Content = slab[start:len(slab):len(slab)]
+			}
+			ops[i] = planOp{kind: opStatic, static: el.Content, element: i}
+		case *DynamicPath:
+			el.path = el.path.or(el.Path)
+			ops[i] = planOp{kind: opDynamic, path: el.path, dynamic: el, element: i}
+		case *ConditionalPath:
+			el.path = el.path.or(el.Path)
+			ops[i] = planOp{kind: opConditional, path: el.path, conditional: el, element: i}
+		}
+	}
+	if coalesce {
+		ops = coalesceOps(ops)
+	}
+	plan.ops = ops
+	plan.slab = slab
+}
+
+// slabbed reports whether layout copies sc into the plan's slab.
+func (plan *ExecutionPlan) slabbed(sc *StaticContent) bool {
+	return !plan.mapped && sc.handle == (unique.Handle[string]{})
+}
+
+// run renders plan against root. nodes, if not nil, holds the node each
+// op's path resolves to in root, indexed like plan.Elements.
+func (plan *ExecutionPlan) run(root node.Node, nodes []node.Node, buf *bytes.Buffer) {
+	for i := range plan.ops {
+		op := &plan.ops[i]
+		if op.kind == opStatic {
+			buf.Write(op.static)
+			continue
+		}
+		op.render(root, nodes, buf)
+	}
+}
+
+// render renders a dynamic, conditional or range op, resolving its path in
+// root unless nodes already holds the node it leads to.
+func (op *planOp) render(root node.Node, nodes []node.Node, buf *bytes.Buffer) {
+	if op.kind == opRange {
+		op.renderRange(root, nodes, buf)
+		return
+	}
+	var n node.Node
+	if nodes != nil {
+		n = nodes[op.element]
+	}
+	if n == nil {
+		var ok bool
+		if n, ok = op.path.resolve(root); !ok {
+			// Path invalid for this tree - safety check
+			if op.kind == opDynamic {
+				op.dynamic.Render(root, buf)
+			} else {
+				op.conditional.Render(root, buf)
+			}
+			return
+		}
+	}
+	op.renderNode(n, buf)
+}
+
+// renderNode renders a dynamic or conditional op for n, the node its path
+// leads to.
+func (op *planOp) renderNode(n node.Node, buf *bytes.Buffer) {
+	if op.kind == opDynamic {
+		op.dynamic.renderNode(n, buf)
+	} else {
+		op.conditional.renderNode(n, buf)
+	}
 }
 
 // Compiler builds immutable execution plans with optimised buffer sizing.
 // It separates static and dynamic content during compilation, then uses
 // conditional statistical updates to maintain optimal buffer allocation.
+//
+// Concurrency model: a plan is never modified once published. Each render
+// loads the current plan once and uses it to the end, and Recompile or
+// Invalidate replace it with a single atomic pointer swap. A render that is
+// already in flight finishes on the plan it started with, new renders pick
+// up the replacement, and no render ever waits for a recompile except the
+// very first, when there is no plan to fall back on.
 type Compiler struct {
-	executionPlan *ExecutionPlan // Built once using sync.Once
-	compileOnce   sync.Once      // Ensures single compilation
-	sizer         *AdaptiveSizer // Shared adaptive buffer sizing
-	threshold     int            // Deviation threshold percentage for conditional updates
-	cfg           *CompilerCfg   // Optional custom configuration
+	executionPlan atomic.Pointer[ExecutionPlan] // Current plan, swapped whole on recompile
+	compileMu     sync.Mutex                    // Serialises building a replacement plan
+	stale         atomic.Bool                   // Set by Invalidate, cleared by the render that rebuilds
+	updates       atomic.Uint64                 // Counts Recompile and UpdatePlan calls, so a superseded update is skipped
+	fallback      *ExecutionPlan                // Renders the whole tree until the first plan is ready, nil unless CompilerCfg.BackgroundCompile
+	compiling     atomic.Bool                   // Set while the first plan compiles in the background
+	sizer         SizingStrategy                // Buffer sizing, an AdaptiveSizer unless CompilerCfg.Sizing
+	byteSizer     SizingStrategy                // Sizing for renders returning bytes, nil unless CompilerCfg.SeparateByteSizing
+	threshold     int                           // Deviation threshold percentage for conditional updates
+	fixed         int                           // Buffer capacity for every render, bypassing sizer, see CompilerCfg.FixedSize
+	cfg           *CompilerCfg                  // Optional custom configuration
+	id            string                        // Registry ID for diagnostics, or "" if not registered
+	recovered     atomic.Int64                  // Renders that panicked and fell back, see CompilerCfg.RecoverPanics
+	settings      planSettings                  // Applied to every plan this compiler builds
+	pool          *poolCounter                  // Buffer pool counters, nil unless CompilerCfg.PoolStats
+	buffers       *localPool                    // The compiler's own buffers, nil for Fluent's pool, see CompilerCfg.LocalPool
+	latency       *latencyHistogram             // Render times, nil unless CompilerCfg.Latency
+
+	resolvedTree atomic.Pointer[resolvedTree] // Dynamic nodes resolved from a root rendered repeatedly
+	candidateMu  sync.Mutex                   // Protects candidate
+	candidate    node.Node                    // Last root that missed resolvedTree
+}
+
+// resolvedTree holds the node each plan element's path leads to in root,
+// so rendering the same root again can skip walking the paths.
+type resolvedTree struct {
+	root  node.Node
+	plan  *ExecutionPlan
+	nodes []node.Node // Indexed like plan.Elements; nil for static content
 }
 
 // NewCompiler creates a compiler with sensible defaults.
@@ -73,32 +302,128 @@ func NewCompiler(cfg ...*CompilerCfg) *Compiler {
 	jc := &Compiler{
 		sizer:     NewAdaptiveSizer(),
 		threshold: 15, // Default: update stats when >15% size deviation
+		settings:  planSettings{mismatches: &mismatchCounter{}, timeouts: &timeoutCounter{}, maxDepth: DefaultMaxDepth},
 	}
 
 	// Apply custom config if provided
 	if len(cfg) > 0 && cfg[0] != nil {
 		jc.cfg = cfg[0]
 		jc.threshold = cfg[0].Threshold
-		jc.sizer.Configure(cfg[0].Max, cfg[0].Variance, cfg[0].GrowthFactor)
+		jc.sizer = newSizer(cfg[0].Sizing, cfg[0].sizerParams())
+		if cfg[0].SeparateByteSizing {
+			jc.byteSizer = newSizer(cfg[0].Sizing, cfg[0].sizerParams())
+		}
+		jc.fixed = max(cfg[0].FixedSize, 0)
+		if cfg[0].SafeRender {
+			jc.settings.mismatches.safe = true
+			jc.settings.mismatches.onMismatch = cfg[0].OnMismatch
+		}
+		jc.settings.intern = cfg[0].InternStatic
+		jc.settings.minify = cfg[0].Minify
+		jc.settings.pretty = cfg[0].Pretty
+		jc.settings.coalesce = cfg[0].CoalesceDynamic
+		jc.settings.timeouts.onTimeout = cfg[0].OnTimeout
+		if cfg[0].MaxDepth > 0 {
+			jc.settings.maxDepth = cfg[0].MaxDepth
+		}
+		if cfg[0].PoolStats {
+			jc.pool = &poolCounter{}
+		}
+		if cfg[0].LocalPool {
+			jc.buffers = newLocalPool(jc.predict)
+		}
+		if cfg[0].Latency {
+			jc.latency = &latencyHistogram{}
+		}
+		if cfg[0].BackgroundCompile {
+			jc.fallback = fallbackPlan(jc.settings)
+		}
+		if cfg[0].OnMarkupError != nil {
+			jc.settings.markup = &markupChecker{onError: cfg[0].OnMarkupError}
+		}
 	}
 
 	return jc
 }
 
 // Configure customises the compiler's threshold and adaptive sizing parameters.
-// Returns the same instance for method chaining.
+// Returns the same instance for method chaining. Sizing parameters that
+// ValidateSizing rejects leave the compiler unchanged, threshold included;
+// MustConfigure panics on them instead.
 func (jc *Compiler) Configure(threshold int, max int, variance, growthFactor int) *Compiler {
-	jc.cfg = &CompilerCfg{
-		Threshold:    threshold,
-		Max:          max,
-		Variance:     variance,
-		GrowthFactor: growthFactor,
+	if ValidateSizing(max, variance, growthFactor) != nil {
+		return jc
 	}
+	cfg := CompilerCfg{}
+	if jc.cfg != nil {
+		cfg = *jc.cfg // keep SafeRender and OnMismatch, which this does not set
+	}
+	cfg.Threshold = threshold
+	cfg.Max = max
+	cfg.Variance = variance
+	cfg.GrowthFactor = growthFactor
+	jc.cfg = &cfg
 	jc.threshold = threshold
-	jc.sizer.Configure(max, variance, growthFactor)
+	for _, s := range []SizingStrategy{jc.sizer, jc.byteSizer} {
+		if as, ok := s.(*AdaptiveSizer); ok {
+			as.Configure(max, variance, growthFactor)
+		}
+	}
 	return jc
 }
 
+// MustConfigure is like Configure but panics with the error from
+// ValidateSizing if the sizing parameters are invalid.
+func (jc *Compiler) MustConfigure(threshold int, max int, variance, growthFactor int) *Compiler {
+	if err := ValidateSizing(max, variance, growthFactor); err != nil {
+		panic(err)
+	}
+	return jc.Configure(threshold, max, variance, growthFactor)
+}
+
+// Clone returns a compiler that shares jc's current plan but keeps its
+// own buffer sizing statistics. Give each worker shard its own clone so the
+// shards read one immutable plan without contending on a shared sizer.
+//
+// The clone starts sampling from scratch with jc's configuration. If jc has
+// not rendered yet, the clone compiles its own plan on first render. Plans
+// are shared only at the moment of cloning - a later Recompile or
+// Invalidate on either compiler does not affect the other. With SafeRender,
+// mismatches on the shared plan are counted against both.
+func (jc *Compiler) Clone() *Compiler {
+	clone := &Compiler{
+		sizer:     NewAdaptiveSizer(),
+		threshold: jc.threshold,
+		fixed:     jc.fixed,
+		settings:  jc.settings,
+		id:        jc.id,
+	}
+	if jc.cfg != nil {
+		cfg := *jc.cfg
+		clone.cfg = &cfg
+		clone.sizer = newSizer(cfg.Sizing, cfg.sizerParams())
+		if cfg.SeparateByteSizing {
+			clone.byteSizer = newSizer(cfg.Sizing, cfg.sizerParams())
+		}
+		if cfg.PoolStats {
+			clone.pool = &poolCounter{}
+		}
+		if cfg.LocalPool {
+			clone.buffers = newLocalPool(clone.predict)
+		}
+		if cfg.Latency {
+			clone.latency = &latencyHistogram{}
+		}
+		if cfg.BackgroundCompile {
+			clone.fallback = fallbackPlan(clone.settings)
+		}
+	}
+	if plan := jc.executionPlan.Load(); plan != nil {
+		clone.executionPlan.Store(plan)
+	}
+	return clone
+}
+
 // Validate checks whether a node tree is structurally compatible with the
 // compiled execution plan. It walks each DynamicPath in the plan and verifies
 // that the path resolves to a valid node in the provided tree.
@@ -119,25 +444,82 @@ func (jc *Compiler) Configure(threshold int, max int, variance, growthFactor int
 //	    t.Fatalf("tree structure changed: %v", err)
 //	}
 func (jc *Compiler) Validate(root node.Node) error {
-	plan := jc.executionPlan
+	plan := jc.executionPlan.Load()
 	if plan == nil {
 		return nil // no plan compiled yet - nothing to validate against
 	}
+	return validatePlan(plan, root, false)
+}
 
+// ValidateDeep is Validate with an additional check that every node along
+// each dynamic path has the same tag or node type as when the plan was
+// compiled. Validate only checks that the child indices exist, so reordered
+// siblings with the same count pass it but render dynamic content from the
+// wrong nodes.
+//
+// Like Validate, this is for tests and development. It renders each
+// element's tags to compare them, so it costs more than Validate.
+func (jc *Compiler) ValidateDeep(root node.Node) error {
+	plan := jc.executionPlan.Load()
+	if plan == nil {
+		return nil
+	}
+	return validatePlan(plan, root, true)
+}
+
+// validatePlan checks every path in the plan against root. Conditional
+// branches are validated against the branch that is active in root, since
+// that is the only branch the render path will navigate into. When deep is
+// set, each node along the path must also match the label recorded at
+// compile time.
+func validatePlan(plan *ExecutionPlan, root node.Node, deep bool) error {
 	for _, element := range plan.Elements {
-		dp, ok := element.(*DynamicPath)
-		if !ok {
+		var path []int
+		var tags []string
+		switch el := element.(type) {
+		case *DynamicPath:
+			path, tags = el.Path, el.Tags
+		case *ConditionalPath:
+			path, tags = el.Path, el.Tags
+		default:
 			continue // static content - always valid
 		}
 
+		// Paths built before tags were recorded, or by hand, have nothing
+		// to compare against.
+		checkTags := deep && len(tags) == len(path)+1
+		if checkTags {
+			if got := nodeLabel(root); got != tags[0] {
+				return fmt.Errorf("%w: path %s expected %s at the root but found %s",
+					ErrStructureMismatch, describePath(path, tags), tags[0], got)
+			}
+		}
+
 		n := root
-		for depth, idx := range dp.Path {
+		for depth, idx := range path {
 			children := n.Nodes()
 			if idx >= len(children) {
-				return fmt.Errorf("%w: path %v failed at depth %d - expected child index %d but node only has %d children",
-					ErrStructureMismatch, dp.Path, depth, idx, len(children))
+				var at []string
+				if len(tags) > depth {
+					at = tags[:depth+1]
+				}
+				return fmt.Errorf("%w: path %s failed at %s - expected child index %d but node only has %d children",
+					ErrStructureMismatch, describePath(path, tags), describePath(path[:depth], at), idx, len(children))
 			}
 			n = children[idx]
+			if checkTags {
+				if got := nodeLabel(n); got != tags[depth+1] {
+					return fmt.Errorf("%w: path %s expected %s at %s but found %s",
+						ErrStructureMismatch, describePath(path, tags), tags[depth+1],
+						describePath(path[:depth+1], tags[:depth+2]), got)
+				}
+			}
+		}
+
+		if cp, ok := element.(*ConditionalPath); ok {
+			if err := cp.validate(n, deep); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -157,64 +539,364 @@ func (jc *Compiler) Validate(root node.Node) error {
 //	compiler.Render(UserCard("Bob", 25), w)    // reuses plan, renders Bob
 //	compiler.Render(UserCard("Dan", 40), w)    // reuses plan, renders Dan
 func (jc *Compiler) Render(root node.Node, w ...io.Writer) []byte {
-	jc.compileOnce.Do(func() {
-		jc.executionPlan = jc.compile(root)
-	})
-
-	plan := jc.executionPlan
-	if plan == nil {
-		return nil
-	}
-
-	predictedSize := jc.sizer.GetBaseline()
+	plan := jc.currentPlan(root)
 
 	// With writer: use pooled buffer, write, then return to pool
 	if len(w) > 0 && w[0] != nil {
-		buf := fluent.NewBuffer(predictedSize)
-		for _, element := range plan.Elements {
-			element.Render(root, buf)
+		if jc.cfg != nil && jc.cfg.SpillThreshold > 0 {
+			jc.renderSpill(plan, root, w[0])
+			return nil
 		}
+		predictedSize := jc.predict()
+		buf, capacity := jc.pool.get(jc.buffers, predictedSize)
+		jc.execute(plan, root, buf)
 		actualSize := buf.Len()
-		if jc.shouldUpdateStats(predictedSize, actualSize) {
-			jc.sizer.UpdateStats(actualSize)
-		}
+		jc.record(predictedSize, actualSize)
 		// Write errors are not actionable mid-render - a closed connection can't be
 		// recovered, and the caller controls the writer's error handling.
 		_, _ = buf.WriteTo(w[0])
-		fluent.PutBuffer(buf)
+		jc.pool.put(jc.buffers, buf, capacity)
 		return nil
 	}
 
 	// Without writer: use local buffer with predicted capacity
+	sizer := jc.byteSizing()
+	predictedSize := jc.predictWith(sizer)
 	buf := bytes.NewBuffer(make([]byte, 0, predictedSize))
-	for _, element := range plan.Elements {
-		element.Render(root, buf)
+	jc.execute(plan, root, buf)
+	actualSize := buf.Len()
+	jc.recordTo(sizer, predictedSize, actualSize)
+	return buf.Bytes()
+}
+
+// RenderContext renders like Render but stops evaluating dynamic content as
+// soon as ctx is done. In an HTTP handler pass r.Context(), which is cancelled
+// when the client disconnects, so an abandoned request stops spending CPU on
+// the rest of the template.
+//
+// Cancellation is checked before each dynamic element - static content is a
+// memory copy and not worth interrupting. Output is buffered, so a cancelled
+// render writes nothing to w and returns ctx.Err(). Otherwise the error from
+// writing to w is returned, which is how a disconnect that happened after the
+// last check surfaces.
+func (jc *Compiler) RenderContext(ctx context.Context, root node.Node, w io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	plan := jc.currentPlan(root)
+
+	predictedSize := jc.predict()
+	buf, capacity := jc.pool.get(jc.buffers, predictedSize)
+	defer func() { jc.pool.put(jc.buffers, buf, capacity) }()
+
+	start := jc.latency.start()
+	var err error
+	jc.recovering(buf, root, func() { err = runContext(ctx, plan, root, jc.resolved(plan, root), buf) })
+	if err != nil {
+		return err
 	}
+
+	// Only completed renders feed the sizer and the latency histogram - an
+	// abandoned render's partial size would drag the baseline down.
+	jc.latency.observe(start)
 	actualSize := buf.Len()
-	if jc.shouldUpdateStats(predictedSize, actualSize) {
-		jc.sizer.UpdateStats(actualSize)
+	jc.record(predictedSize, actualSize)
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// runContext runs plan like ExecutionPlan.run, returning ctx.Err() before
+// any dynamic element once ctx is done.
+func runContext(ctx context.Context, plan *ExecutionPlan, root node.Node, nodes []node.Node, buf *bytes.Buffer) error {
+	for i := range plan.ops {
+		op := &plan.ops[i]
+		if op.kind == opStatic {
+			buf.Write(op.static)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		op.render(root, nodes, buf)
+	}
+	return nil
+}
+
+// execute runs plan against root, writing the output to buf.
+func (jc *Compiler) execute(plan *ExecutionPlan, root node.Node, buf *bytes.Buffer) {
+	defer jc.latency.observe(jc.latency.start())
+	jc.recovering(buf, root, func() { plan.run(root, jc.resolved(plan, root), buf) })
+}
+
+// recovering calls render, which writes fallback's output to buf. With
+// CompilerCfg.RecoverPanics, a panic in render is counted and reported,
+// what render wrote is dropped and fallback is rendered the standard way
+// instead. The fallback runs in the deferred call, so a panic there
+// propagates as it would without recovery. Every entry point that runs a
+// plan goes through it, except RenderSegments and the chunks of
+// RenderStream, which report panics per element as SegmentErrors.
+func (jc *Compiler) recovering(buf *bytes.Buffer, fallback node.Node, render func()) {
+	if jc.cfg == nil || !jc.cfg.RecoverPanics {
+		render()
+		return
+	}
+	start := buf.Len()
+	defer func() {
+		if r := recover(); r != nil {
+			jc.recoverPanic(r)
+			buf.Truncate(start)
+			fallback.RenderBuilder(buf)
+		}
+	}()
+	render()
+}
+
+// recoverPanic counts a panic recovered from a render and passes it to
+// CompilerCfg.OnPanic.
+func (jc *Compiler) recoverPanic(r any) {
+	jc.recovered.Add(1)
+	if jc.cfg.OnPanic != nil {
+		err := fmt.Errorf("%w: %v", ErrRenderPanic, r)
+		if cause, ok := r.(error); ok {
+			err = fmt.Errorf("%w: %w", ErrRenderPanic, cause)
+		}
+		jc.cfg.OnPanic(err)
+	}
+}
+
+// resolved returns the dynamic nodes of root indexed like plan.Elements, or
+// nil if root has to be navigated path by path.
+//
+// Long-lived component instances are often rendered as the same root
+// pointer every time, and walking each path again finds the same nodes. The
+// nodes are cached the second time in a row a root is seen - caching on the
+// first sighting would allocate on every render for handlers that build a
+// fresh tree per request, which is the common case.
+//
+// The cache assumes a root that is rendered again has kept its structure.
+// Mutating a dynamic node in place is fine, since the cached pointer still
+// leads to it, but replacing children of the same root between renders is
+// not seen until a different root is rendered.
+func (jc *Compiler) resolved(plan *ExecutionPlan, root node.Node) []node.Node {
+	if rt := jc.resolvedTree.Load(); rt != nil && rt.plan == plan && rt.root == root {
+		return rt.nodes
+	}
+
+	// Only pointer roots have an identity to cache on, and comparing two
+	// non-pointer nodes of the same type could panic if the type holds a
+	// slice. Skip under contention - the path walk is always correct.
+	if root == nil || reflect.TypeOf(root).Kind() != reflect.Pointer || !jc.candidateMu.TryLock() {
+		return nil
+	}
+	defer jc.candidateMu.Unlock()
+
+	if jc.candidate != root {
+		jc.candidate = root
+		return nil
+	}
+
+	nodes := make([]node.Node, len(plan.Elements))
+	for i, element := range plan.Elements {
+		switch el := element.(type) {
+		case *DynamicPath:
+			nodes[i], _ = el.path.resolve(root)
+		case *ConditionalPath:
+			nodes[i], _ = el.path.resolve(root)
+		}
+	}
+	jc.resolvedTree.Store(&resolvedTree{root: root, plan: plan, nodes: nodes})
+	return nodes
+}
+
+// renderResolved renders a dynamic plan element whose node has already
+// been resolved to n.
+func renderResolved(element CompiledElement, n node.Node, buf *bytes.Buffer) {
+	switch el := element.(type) {
+	case *ConditionalPath:
+		el.renderNode(n, buf)
+	case *DynamicPath:
+		el.renderNode(n, buf)
+	default:
+		n.RenderBuilder(buf)
 	}
-	return buf.Bytes()
 }
 
 // compile builds the execution plan and seeds initial buffer sizing.
 //
 // Step 1: Tree Analysis
-// - Recursively walk the node tree to identify static vs dynamic content.
+// - Walk the node tree to identify static vs dynamic content.
 // - Merge adjacent static nodes into single []byte chunks for efficiency.
 // - Store direct references to dynamic nodes.
 //
 // Step 2: Initial Size Sampling
 // - Execute the compiled plan once to seed buffer size optimisation.
 // - This provides the initial data point for adaptive sizing.
-func (jc *Compiler) compile(rootNode node.Node) *ExecutionPlan {
+func (jc *Compiler) compile(rootNode node.Node) (plan *ExecutionPlan) {
+	var seeding CompiledElement
+	defer func() {
+		if r := recover(); r != nil {
+			var ce *CompileError
+			if seeding != nil {
+				ce = seedPanic(r, seeding, rootNode)
+			} else {
+				ce = compilePanic(r, rootNode, nil, nil)
+			}
+			ce.Template = jc.id
+			panic(ce)
+		}
+	}()
+
+	plan = buildPlan(rootNode, jc.settings)
+	plan.apply(jc.settings)
+	if jc.cfg != nil && jc.cfg.OnLint != nil {
+		runLints(rootNode, jc.cfg.OnLint)
+	}
+
+	// Execute the plan once to seed adaptive sizing with an actual output size,
+	// so the very first real render already has a reasonable buffer prediction.
+	buf := fluent.NewBuffer()
+	defer fluent.PutBuffer(buf)
+
+	for _, element := range plan.Elements {
+		seeding = element
+		element.Render(rootNode, buf)
+	}
+	seeding = nil
+
+	if jc.fixed == 0 {
+		jc.sizer.Observe(buf.Len())
+		if jc.byteSizer != nil {
+			jc.byteSizer.Observe(buf.Len())
+		}
+	}
+	plan.version = planVersion(plan)
+	plan.staticRatio = staticRatio(plan, buf.Len())
+	if jc.mostlyDynamic(plan) && jc.cfg.OnMostlyDynamic != nil {
+		template := ""
+		if jc.id != "" {
+			template = fmt.Sprintf(" %q", jc.id)
+		}
+		jc.cfg.OnMostlyDynamic(fmt.Errorf("%w: template%s output is %d%% static, below MinStaticRatio %d%%", ErrMostlyDynamic, template, plan.staticRatio, jc.cfg.MinStaticRatio))
+	}
+
+	return plan
+}
+
+// currentPlan returns the plan to render root with. The first render
+// compiles from root while any concurrent first renders wait, since they
+// have nothing else to render with - unless CompilerCfg.BackgroundCompile
+// is set, when they render with the fallback plan instead. After
+// Invalidate, one render rebuilds from its tree while the rest carry on
+// with the old plan.
+func (jc *Compiler) currentPlan(root node.Node) *ExecutionPlan {
+	plan := jc.executionPlan.Load()
+	if plan != nil {
+		if !jc.stale.Load() || !jc.compileMu.TryLock() {
+			return plan
+		}
+		defer jc.compileMu.Unlock()
+		// Cleared before compiling so an Invalidate that lands during the
+		// rebuild is not lost - it marks the new plan stale in turn.
+		if jc.stale.CompareAndSwap(true, false) {
+			plan = jc.compile(root)
+			jc.executionPlan.Store(plan)
+		}
+		return jc.executionPlan.Load()
+	}
+
+	if jc.fallback != nil {
+		jc.compileInBackground(root)
+		return jc.fallback
+	}
+
+	jc.compileMu.Lock()
+	defer jc.compileMu.Unlock()
+	if plan := jc.executionPlan.Load(); plan != nil {
+		return plan
+	}
+	plan = jc.compile(root)
+	jc.executionPlan.Store(plan)
+	return plan
+}
+
+// Recompile builds a new plan from root and swaps it in. Renders already
+// in flight finish on the old plan; renders that start afterwards use the
+// new one. Use it when a template's static content changes at runtime,
+// for example after reloading translations.
+//
+// Recompile blocks only other recompiles, never renders.
+func (jc *Compiler) Recompile(root node.Node) {
+	jc.updates.Add(1) // Supersede any pending UpdatePlan
+	jc.compileMu.Lock()
+	defer jc.compileMu.Unlock()
+	jc.stale.Store(false)
+	jc.executionPlan.Store(jc.compile(root))
+}
+
+// UpdatePlan is Recompile in the background: it returns at once, builds a
+// plan from root on another goroutine and swaps it in, so a server can
+// move to a new layout variant or feature-flagged template without the
+// caller waiting on the compile. Renders carry on with the current plan
+// until the swap.
+//
+// The returned channel receives nil once the new plan is in place, or the
+// *CompileError if root panicked while compiling, in which case the
+// current plan is kept. An update that has not started when UpdatePlan or
+// Recompile is called again is skipped, so the latest call always wins;
+// its channel receives nil.
+//
+// Example:
+//
+//	if err := <-pageCompiler.UpdatePlan(Page(variantB)); err != nil {
+//	    log.Printf("layout variant not applied: %v", err)
+//	}
+func (jc *Compiler) UpdatePlan(root node.Node) <-chan error {
+	done := make(chan error, 1)
+	update := jc.updates.Add(1)
+	go func() {
+		jc.compileMu.Lock()
+		defer jc.compileMu.Unlock()
+		if jc.updates.Load() != update {
+			done <- nil
+			return
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err, ok := r.(error)
+				if !ok {
+					err = fmt.Errorf("%w: %v", ErrCompilePanic, r)
+				}
+				done <- err
+			}
+		}()
+		plan := jc.compile(root)
+		jc.stale.Store(false)
+		jc.executionPlan.Store(plan)
+		done <- nil
+	}()
+	return done
+}
+
+// Invalidate marks the current plan as out of date. The next render
+// rebuilds the plan from the tree it was given, while renders running at
+// the same time keep using the old plan rather than waiting. Use it when
+// the tree to rebuild from is not at hand - otherwise prefer Recompile.
+func (jc *Compiler) Invalidate() {
+	jc.stale.Store(true)
+}
+
+// buildPlan walks a tree and returns its execution plan. It is used for the
+// root of a compiled template and for each conditional branch, whose
+// sub-plans navigate relative to the branch node rather than the root. Only
+// the depth limit in s is used here; the rest is applied afterwards.
+func buildPlan(rootNode node.Node, s planSettings) *ExecutionPlan {
 	plan := &ExecutionPlan{}
 	var staticBuffer bytes.Buffer
 
 	// Build execution plan by walking tree and compiling static/dynamic elements.
-	// The empty path slice tracks position in the tree - extended with child indices
-	// as we recurse, so dynamic nodes can record how to navigate back to themselves.
-	jc.walk(rootNode, &staticBuffer, plan, []int{})
+	walk(rootNode, &staticBuffer, plan, s)
 
 	// Static content is only flushed to the plan when a dynamic node is encountered,
 	// so any trailing static content needs to be flushed here.
@@ -224,18 +906,53 @@ func (jc *Compiler) compile(rootNode node.Node) *ExecutionPlan {
 		})
 	}
 
-	// Execute the plan once to seed adaptive sizing with an actual output size,
-	// so the very first real render already has a reasonable buffer prediction.
-	buf := fluent.NewBuffer()
-	defer fluent.PutBuffer(buf)
+	return plan
+}
 
-	for _, element := range plan.Elements {
-		element.Render(rootNode, buf)
+// predict returns the buffer capacity to start a render to a writer with.
+func (jc *Compiler) predict() int {
+	return jc.predictWith(jc.sizer)
+}
+
+// predictWith returns the buffer capacity sizer predicts for a render,
+// scaled to the SetSizingBudget cap if the compiler is registered.
+func (jc *Compiler) predictWith(sizer SizingStrategy) int {
+	if jc.fixed > 0 {
+		return jc.fixed
 	}
+	if jc.id != "" {
+		return sizingBudget.apply(sizer.Baseline())
+	}
+	return sizer.Baseline()
+}
 
-	jc.sizer.UpdateStats(buf.Len())
+// byteSizing returns the sizer for renders that return their output
+// rather than write it: the separate one with
+// CompilerCfg.SeparateByteSizing, otherwise the compiler's only sizer.
+func (jc *Compiler) byteSizing() SizingStrategy {
+	if jc.byteSizer != nil {
+		return jc.byteSizer
+	}
+	return jc.sizer
+}
 
-	return plan
+// record feeds a render's actual size to the sizer for renders to a
+// writer, as recordTo does.
+func (jc *Compiler) record(predicted, actual int) {
+	jc.recordTo(jc.sizer, predicted, actual)
+}
+
+// recordTo feeds a render's actual size to sizer if it deviates enough
+// from predicted, or always when the sizer tracks a moving average or is
+// the application's own, and does nothing with CompilerCfg.FixedSize.
+func (jc *Compiler) recordTo(sizer SizingStrategy, predicted, actual int) {
+	if jc.fixed > 0 {
+		return
+	}
+	as, adaptive := sizer.(*AdaptiveSizer)
+	if !adaptive || as.tracking() || jc.shouldUpdateStats(predicted, actual) {
+		sizer.Observe(actual)
+	}
 }
 
 // shouldUpdateStats determines if we should update sizing statistics based on deviation.
@@ -253,7 +970,16 @@ func (jc *Compiler) shouldUpdateStats(predicted, actual int) bool {
 	return diff*100 > predicted*jc.threshold
 }
 
-// walk recursively builds the execution plan by separating static and dynamic content.
+// walkFrame is one entry on walk's explicit stack: either a node to visit,
+// or the closing tag of an element whose children have all been visited.
+type walkFrame struct {
+	n     node.Node
+	depth int          // len of n's path
+	index int          // n's index among its parent's children
+	close node.Element // When set, write this element's closing tag instead of visiting n
+}
+
+// walk builds the execution plan by separating static and dynamic content.
 // This is the core compilation algorithm that determines what can be pre-rendered.
 //
 // Static Content Strategy:
@@ -265,58 +991,239 @@ func (jc *Compiler) shouldUpdateStats(predicted, actual int) bool {
 // - Dynamic nodes store their path (slice of child indices from root).
 // - On render, the path is traversed on the NEW tree to get fresh values.
 // - This enables re-evaluation of dynamic content with different data.
-func (jc *Compiler) walk(n node.Node, staticBuffer *bytes.Buffer, plan *ExecutionPlan, path []int) {
-	// Attributes (e.g. .Class(variable)) are treated as static after first render  -
-	// their values are frozen at compile time. Use Tune() if values must change between renders.
-	if isDynamicNode(n) {
-		// Flush accumulated static content before recording the dynamic path,
-		// so the execution plan preserves the correct rendering order.
-		if staticBuffer.Len() > 0 {
-			plan.Elements = append(plan.Elements, &StaticContent{
-				Content: append([]byte{}, staticBuffer.Bytes()...), // copy - staticBuffer is reset and reused below
+//
+// Conditional Strategy:
+// - Conditionals store their path plus a sub-plan for the branch that was active.
+// - Static content inside the branch is frozen just like the rest of the tree.
+//
+// The tree is walked with an explicit stack rather than by recursion, so a
+// generated tree nested many thousands deep cannot exhaust the goroutine
+// stack. Nodes nested deeper than s.maxDepth, counted from the page root,
+// panic with ErrTreeTooDeep instead.
+func walk(rootNode node.Node, staticBuffer *bytes.Buffer, plan *ExecutionPlan, s planSettings) {
+	// path and tags describe the node being visited: its child indices from
+	// the root, and the label of each of its ancestors. A frame at depth d
+	// only rewrites entries from d on, and every frame below it on the stack
+	// was pushed by an ancestor, so one pair of slices serves the whole walk.
+	// Stored paths are explicit copies.
+	var path []int
+	var tags []string
+	var n node.Node
+
+	// Attach where in the tree a panic came from, from the page root for
+	// a conditional branch.
+	defer func() {
+		if r := recover(); r != nil {
+			if s.base != nil {
+				path, tags = slices.Concat(s.base.path, path), slices.Concat(s.base.tags, tags)
+			}
+			panic(compilePanic(r, n, path, tags))
+		}
+	}()
+
+	stack := []walkFrame{{n: rootNode}}
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if frame.close != nil {
+			frame.close.RenderClose(staticBuffer)
+			continue
+		}
+
+		n = frame.n
+		tags = tags[:frame.depth]
+		path = path[:max(frame.depth-1, 0)]
+		if frame.depth > 0 {
+			path = append(path, frame.index)
+		}
+		if s.maxDepth > 0 && s.nodeDepth+frame.depth > s.maxDepth {
+			panic(fmt.Errorf("%w: nested deeper than %d", ErrTreeTooDeep, s.maxDepth))
+		}
+
+		// Attributes (e.g. .Class(variable)) are treated as static after first render  -
+		// their values are frozen at compile time. Use Tune() if values must change between renders.
+		if fa, ok := n.(*forcedAttr); ok {
+			// The opening tag becomes a dynamic path of its own, and the
+			// children and closing tag are walked as if the element were an
+			// ordinary container.
+			flushStatic(staticBuffer, plan)
+			tags = append(tags, nodeLabel(fa))
+			plan.Elements = append(plan.Elements, &DynamicPath{
+				Path:    slices.Clone(path),
+				path:    packPath(path),
+				Tags:    slices.Clone(tags),
+				Key:     slotName(fa),
+				OpenTag: true,
 			})
-			staticBuffer.Reset()
+			stack = pushChildren(stack, fa.Nodes(), frame.depth, fa)
+			continue
 		}
 
-		// Explicit copy because append(path, i) in the loop below may share
-		// the same backing array - without a copy, stored paths could be
-		// silently corrupted by later iterations.
-		pathCopy := make([]int, len(path))
-		copy(pathCopy, path)
-		plan.Elements = append(plan.Elements, &DynamicPath{Path: pathCopy})
-		return
-	}
+		if isDynamicNode(n) {
+			// Flush accumulated static content before recording the dynamic path,
+			// so the execution plan preserves the correct rendering order.
+			flushStatic(staticBuffer, plan)
+
+			tagsCopy := append(slices.Clone(tags), nodeLabel(n))
+			key := slotName(n)
+
+			if c, ok := n.(*node.ConditionalBuilder); ok && conditionField >= 0 {
+				// The branch is compiled as a plan of its own, rooted one
+				// level below the conditional.
+				cs := planSettings{maxDepth: s.maxDepth, nodeDepth: s.nodeDepth + len(path) + 1}
+				cs.base = s.base.branch(path, tagsCopy)
+				cp := newConditionalPath(slices.Clone(path), c, cs)
+				cp.Tags = tagsCopy
+				cp.Key = key
+				plan.Elements = append(plan.Elements, cp)
+				continue
+			}
 
-	// Determine whether children need individual processing or if the
-	// entire subtree can be rendered as a single static chunk.
-	children := n.Nodes()
-	hasDynamicChildren := slices.ContainsFunc(children, isDynamic)
+			dp := &DynamicPath{Path: slices.Clone(path), path: packPath(path), Tags: tagsCopy, Key: key}
+			if elem, ok := unforced(n).(node.Element); ok && key != "" {
+				// Only keyed slots can be filled from a map, so only they pay
+				// for keeping the element's tags.
+				var tag bytes.Buffer
+				elem.RenderOpen(&tag)
+				dp.open = bytes.Clone(tag.Bytes())
+				tag.Reset()
+				elem.RenderClose(&tag)
+				dp.close = bytes.Clone(tag.Bytes())
+			}
+			plan.Elements = append(plan.Elements, dp)
+			continue
+		}
+
+		// Determine whether children need individual processing or if the
+		// entire subtree can be rendered as a single static chunk.
+		children := n.Nodes()
+		if !slices.ContainsFunc(children, isDynamic) {
+			// Entirely static subtree - render directly for merging with
+			// adjacent static content. Fluent renders it recursively, so its
+			// depth is checked first.
+			if s.maxDepth > 0 && s.nodeDepth+frame.depth+subtreeDepth(n) > s.maxDepth {
+				panic(fmt.Errorf("%w: static content nested deeper than %d", ErrTreeTooDeep, s.maxDepth))
+			}
+			n.RenderBuilder(staticBuffer)
+			continue
+		}
 
-	if hasDynamicChildren {
 		// Node has dynamic children - render opening/closing tags as static content,
 		// but process children individually so dynamic ones get their own paths.
-		if elem, ok := n.(node.Element); ok {
+		// A non-Element container (e.g. Fragment) has no tags to render.
+		tags = append(tags, nodeLabel(n))
+		elem, _ := n.(node.Element)
+		if elem != nil {
 			elem.RenderOpen(staticBuffer)
+		}
+		stack = pushChildren(stack, children, frame.depth, elem)
+	}
+}
+
+// pushChildren pushes children onto the walk stack so they are visited in
+// order, preceded by a frame that writes parent's closing tag once they are
+// all done. parent may be nil for a container with no tags.
+func pushChildren(stack []walkFrame, children []node.Node, depth int, parent node.Element) []walkFrame {
+	if parent != nil {
+		stack = append(stack, walkFrame{close: parent})
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		stack = append(stack, walkFrame{n: children[i], depth: depth + 1, index: i})
+	}
+	return stack
+}
+
+// flushStatic moves accumulated static content into the plan.
+func flushStatic(staticBuffer *bytes.Buffer, plan *ExecutionPlan) {
+	if staticBuffer.Len() > 0 {
+		plan.Elements = append(plan.Elements, &StaticContent{
+			Content: append([]byte{}, staticBuffer.Bytes()...), // copy - staticBuffer is reset and reused
+		})
+		staticBuffer.Reset()
+	}
+}
+
+// subtreeDepth returns how many levels n's descendants reach below it,
+// without recursing.
+func subtreeDepth(n node.Node) int {
+	type level struct {
+		n     node.Node
+		depth int
+	}
+	deepest := 0
+	stack := []level{{n, 0}}
+	for len(stack) > 0 {
+		l := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		deepest = max(deepest, l.depth)
+		for _, child := range l.n.Nodes() {
+			stack = append(stack, level{child, l.depth + 1})
+		}
+	}
+	return deepest
+}
 
-			for i, child := range children {
-				// append may reuse path's backing array, which is safe here because
-				// walk is depth-first: each recursive call completes before the next
-				// iteration overwrites the same position. Stored paths use explicit
-				// copies (pathCopy above) so they aren't affected.
-				childPath := append(path, i)
-				jc.walk(child, staticBuffer, plan, childPath)
+// describePath formats a path with the labels recorded alongside it, e.g.
+// "div > ul[0] > li[2]", so a mismatch can be traced back to template code.
+// Falls back to the bare indices when no labels were recorded. Paths deeper
+// than describeDepth keep only their ends, e.g. "div > ... > li[2]", so an
+// error about a pathologically deep tree stays readable.
+func describePath(path []int, tags []string) string {
+	if len(tags) != len(path)+1 {
+		return fmt.Sprint(path)
+	}
+	var b strings.Builder
+	b.WriteString(tags[0])
+	for i, idx := range path {
+		if len(path) > describeDepth && i >= describeDepth/2 && i < len(path)-describeDepth/2 {
+			if i == describeDepth/2 {
+				b.WriteString(" > ...")
 			}
+			continue
+		}
+		fmt.Fprintf(&b, " > %s[%d]", tags[i+1], idx)
+	}
+	return b.String()
+}
 
-			elem.RenderClose(staticBuffer)
-		} else {
-			// Non-Element container (e.g. Fragment) - no opening/closing tags to render
-			for i, child := range children {
-				childPath := append(path, i)
-				jc.walk(child, staticBuffer, plan, childPath)
+// describeDepth is the most path steps describePath writes out in full.
+const describeDepth = 16
+
+// nodeLabel names a node for path descriptions. Elements are named by tag;
+// Fluent does not expose the tag directly, so it is read back from the
+// rendered closing tag, or the opening tag for void elements.
+func nodeLabel(n node.Node) string {
+	switch n := n.(type) {
+	case node.Element:
+		var buf bytes.Buffer
+		n.RenderClose(&buf)
+		if name, ok := bytes.CutPrefix(buf.Bytes(), []byte("</")); ok {
+			return string(bytes.TrimSuffix(name, []byte(">")))
+		}
+		buf.Reset()
+		n.RenderOpen(&buf)
+		open := buf.Bytes()
+		if i := bytes.IndexByte(open, '<'); i >= 0 {
+			name := open[i+1:]
+			if end := bytes.IndexAny(name, " />"); end >= 0 {
+				name = name[:end]
+			}
+			if len(name) > 0 {
+				return string(name)
 			}
 		}
-	} else {
-		// Entirely static subtree - render directly for merging with adjacent static content
-		n.RenderBuilder(staticBuffer)
+		return "element"
+	case *forced:
+		return nodeLabel(unforced(n))
+	case *text.Node:
+		return "text"
+	case *node.ConditionalBuilder:
+		return "condition"
+	case *node.FunctionComponent:
+		return "func"
+	case *node.FuncsComponent:
+		return "funcs"
+	default:
+		return "node"
 	}
 }
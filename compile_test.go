@@ -2,15 +2,20 @@ package jit
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"io"
 	"strings"
 	"testing"
 
 	"github.com/jpl-au/fluent/html5/div"
 	"github.com/jpl-au/fluent/html5/html"
+	"github.com/jpl-au/fluent/html5/li"
 	"github.com/jpl-au/fluent/html5/p"
 	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/html5/ul"
 	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
 )
 
 // TestCompilerStaticOnly verifies the simplest case: a fully static tree.
@@ -235,3 +240,574 @@ func TestCompilerValidateBeforeCompile(t *testing.T) {
 		t.Errorf("validate before compile should return nil (no plan yet), got: %v", err)
 	}
 }
+
+// TestCompilerConditionalBranchPlan verifies that the active branch of a
+// conditional is compiled into its own sub-plan. Dynamic content inside the
+// branch must still be re-evaluated, while static content in the branch is
+// rendered from the frozen sub-plan.
+func TestCompilerConditionalBranchPlan(t *testing.T) {
+	compiler := NewCompiler()
+
+	makeTree := func(show bool, name string) node.Node {
+		return div.New(
+			node.When(show, div.New(span.Static("Hi "), span.Text(name))),
+		)
+	}
+
+	compiler.Render(makeTree(true, "Alice"))
+	plan := compiler.executionPlan.Load()
+
+	var cp *ConditionalPath
+	for _, el := range plan.Elements {
+		if c, ok := el.(*ConditionalPath); ok {
+			cp = c
+		}
+	}
+	if cp == nil {
+		t.Fatal("conditional should compile to a ConditionalPath with its own sub-plan")
+	}
+	if cp.Branch(true) == nil {
+		t.Error("true branch should be compiled up front because it was active at compile time")
+	}
+	if sub := cp.Branch(false); sub == nil || len(sub.Elements) != 0 {
+		t.Error("false branch has no node, so it should be compiled up front to an empty sub-plan")
+	}
+
+	result := string(compiler.Render(makeTree(true, "Bob")))
+	expected := "<div><div><span>Hi </span><span>Bob</span></div></div>"
+	if result != expected {
+		t.Errorf("branch sub-plan should re-evaluate dynamic content:\n  got  %q\n  want %q", result, expected)
+	}
+}
+
+// TestCompilerConditionalOtherBranch verifies that when the condition flips
+// to the branch that was not active at compile time, that branch gets its own
+// cached sub-plan rather than reusing the compiled branch's frozen content.
+func TestCompilerConditionalOtherBranch(t *testing.T) {
+	compiler := NewCompiler()
+
+	makeTree := func(loggedIn bool) node.Node {
+		return div.New(
+			node.Condition(loggedIn).
+				True(span.Static("Welcome back")).
+				False(span.Static("Please log in")),
+		)
+	}
+
+	first := string(compiler.Render(makeTree(true)))
+	second := string(compiler.Render(makeTree(false)))
+
+	if first != "<div><span>Welcome back</span></div>" {
+		t.Errorf("true branch should render from its sub-plan, got %q", first)
+	}
+	if second != "<div><span>Please log in</span></div>" {
+		t.Errorf("false branch should render its own content when the true branch was compiled first, got %q", second)
+	}
+
+	cp := compiler.executionPlan.Load().Elements[1].(*ConditionalPath)
+	if cp.Branch(true) == nil || cp.Branch(false) == nil {
+		t.Error("both branches should have cached sub-plans once each has been rendered")
+	}
+
+	third := string(compiler.Render(makeTree(true)))
+	if third != first {
+		t.Errorf("switching back should reuse the true branch sub-plan:\n  got  %q\n  want %q", third, first)
+	}
+}
+
+// TestCompilerValidateConditionalBranch verifies that Validate descends into
+// the compiled branch, so a structural change inside a conditional is caught
+// just like one elsewhere in the tree.
+func TestCompilerValidateConditionalBranch(t *testing.T) {
+	compiler := NewCompiler()
+
+	compiler.Render(div.New(node.When(true, div.New(span.Static("a"), span.Text("b")))))
+
+	err := compiler.Validate(div.New(node.When(true, div.New(span.Text("b")))))
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Errorf("missing child inside compiled branch should fail validation, got: %v", err)
+	}
+}
+
+// TestCompilerRenderContextCancelled verifies that a render whose context is
+// already done writes nothing and reports the cancellation, so handlers for
+// disconnected clients skip the work entirely.
+func TestCompilerRenderContextCancelled(t *testing.T) {
+	compiler := NewCompiler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := compiler.RenderContext(ctx, div.New(span.Text("hello")), &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context should be reported, got: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("cancelled render should write nothing, got %q", buf.String())
+	}
+}
+
+// TestCompilerRenderContextStopsMidRender verifies that cancellation during a
+// render stops the remaining dynamic nodes from being evaluated. The first
+// Func cancels the context, so the second must never run.
+func TestCompilerRenderContextStopsMidRender(t *testing.T) {
+	compiler := NewCompiler()
+
+	makeTree := func(onFirst func(), second *bool) node.Node {
+		return div.New(
+			node.Func(func() node.Node {
+				onFirst()
+				return span.Text("one")
+			}),
+			node.Func(func() node.Node {
+				*second = true
+				return span.Text("two")
+			}),
+		)
+	}
+
+	// Build the plan with a render that is allowed to complete.
+	var ran bool
+	compiler.Render(makeTree(func() {}, &ran))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ran = false
+
+	var buf bytes.Buffer
+	err := compiler.RenderContext(ctx, makeTree(cancel, &ran), &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancellation mid-render should be reported, got: %v", err)
+	}
+	if ran {
+		t.Error("dynamic nodes after cancellation should not be evaluated")
+	}
+}
+
+// TestCompilerRenderContextWrites verifies the happy path matches Render.
+func TestCompilerRenderContextWrites(t *testing.T) {
+	compiler := NewCompiler()
+
+	var buf bytes.Buffer
+	if err := compiler.RenderContext(context.Background(), div.New(span.Text("hi")), &buf); err != nil {
+		t.Fatalf("uncancelled render should succeed, got: %v", err)
+	}
+	if buf.String() != "<div><span>hi</span></div>" {
+		t.Errorf("RenderContext output should match Render, got %q", buf.String())
+	}
+}
+
+// TestCompilerSameRootFastPath verifies that re-rendering the same tree
+// instance caches its resolved dynamic nodes and still picks up values that
+// change inside them, as a long-lived component's Func would.
+func TestCompilerSameRootFastPath(t *testing.T) {
+	compiler := NewCompiler()
+	name := "Alice"
+	tree := div.New(
+		span.Static("Hello "),
+		node.Func(func() node.Node { return span.Text(name) }),
+	)
+
+	compiler.Render(tree)
+	compiler.Render(tree)
+	if compiler.resolvedTree.Load() == nil {
+		t.Fatal("rendering the same root twice should cache its resolved nodes")
+	}
+
+	name = "Bob"
+	got := string(compiler.Render(tree))
+	want := "<div><span>Hello </span><span>Bob</span></div>"
+	if got != want {
+		t.Errorf("cached nodes should still be re-rendered:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestCompilerFreshRootsSkipFastPath verifies that a handler building a new
+// tree per render never populates the cache, since doing so would allocate
+// on every render for no benefit.
+func TestCompilerFreshRootsSkipFastPath(t *testing.T) {
+	compiler := NewCompiler()
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		got := string(compiler.Render(div.New(span.Text(name))))
+		if !strings.Contains(got, name) {
+			t.Errorf("render should contain %q, got %q", name, got)
+		}
+	}
+	if compiler.resolvedTree.Load() != nil {
+		t.Error("distinct roots should not be cached")
+	}
+}
+
+// TestCompilerValidateDescribesPathByTag verifies that a structure mismatch
+// names the elements along the path, so the failing template code can be
+// found without counting child indices by hand.
+func TestCompilerValidateDescribesPathByTag(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(ul.New(li.Static("a"), li.Static("b"), li.Text("c"))))
+
+	err := compiler.Validate(div.New(ul.New(li.Static("a"))))
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Fatalf("shorter list should fail validation, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "div > ul[0] > li[2] > text[0]") {
+		t.Errorf("error should describe the path by tag, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed at div > ul[0]") {
+		t.Errorf("error should name the node that is missing children, got: %v", err)
+	}
+}
+
+// TestCompilerValidateDeepCatchesReorderedSiblings verifies that swapping
+// siblings of different types fails deep validation, even though the child
+// counts still match and plain Validate passes.
+func TestCompilerValidateDeepCatchesReorderedSiblings(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(p.Static("intro"), span.Text("Alice")))
+
+	reordered := div.New(span.Static("intro"), p.Text("Alice"))
+	if err := compiler.Validate(reordered); err != nil {
+		t.Fatalf("plain Validate only checks child counts and should pass, got: %v", err)
+	}
+
+	err := compiler.ValidateDeep(reordered)
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Fatalf("deep validation should catch the reordered siblings, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "expected span at div > span[1] but found p") {
+		t.Errorf("error should say which tag was expected where, got: %v", err)
+	}
+
+	if err := compiler.ValidateDeep(div.New(p.Static("intro"), span.Text("Bob"))); err != nil {
+		t.Errorf("same structure with new data should pass deep validation, got: %v", err)
+	}
+}
+
+// TestCompilerRecompileSwapsPlan verifies that Recompile replaces the
+// frozen static content for subsequent renders.
+func TestCompilerRecompileSwapsPlan(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+	before := compiler.Version()
+
+	compiler.Recompile(div.New(span.Static("Bonjour "), span.Text("Alice")))
+	got := string(compiler.Render(div.New(span.Static("ignored "), span.Text("Bob"))))
+
+	if want := "<div><span>Bonjour </span><span>Bob</span></div>"; got != want {
+		t.Errorf("render after Recompile should use the new static content:\n  got  %q\n  want %q", got, want)
+	}
+	if compiler.Version() == before {
+		t.Error("version should change with the new plan")
+	}
+}
+
+// TestCompilerInvalidateRebuildsOnNextRender verifies that Invalidate
+// causes the next render to compile from the tree it is given.
+func TestCompilerInvalidateRebuildsOnNextRender(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+
+	compiler.Invalidate()
+	got := string(compiler.Render(div.New(span.Static("Bonjour "), span.Text("Bob"))))
+	if want := "<div><span>Bonjour </span><span>Bob</span></div>"; got != want {
+		t.Errorf("render after Invalidate should rebuild from its tree:\n  got  %q\n  want %q", got, want)
+	}
+
+	got = string(compiler.Render(div.New(span.Static("ignored "), span.Text("Carol"))))
+	if want := "<div><span>Bonjour </span><span>Carol</span></div>"; got != want {
+		t.Errorf("the rebuilt plan should be reused afterwards:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestCompilerRecompileDuringRender verifies the copy-on-write guarantee:
+// a render that is mid-flight when the plan is swapped finishes on the plan
+// it started with, rather than mixing static content from both.
+func TestCompilerRecompileDuringRender(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("old"), span.Text("x"), span.Static("old")))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan string)
+	go func() {
+		blocking := div.New(span.Static("old"), node.Func(func() node.Node {
+			close(entered)
+			<-release
+			return span.Text("x")
+		}), span.Static("old"))
+		done <- string(compiler.Render(blocking))
+	}()
+
+	<-entered
+	compiler.Recompile(div.New(span.Static("new"), span.Text("x"), span.Static("new")))
+	close(release)
+
+	if got := <-done; strings.Contains(got, "new") {
+		t.Errorf("in-flight render should finish on the plan it started with, got %q", got)
+	}
+	if got := string(compiler.Render(div.New(span.Static("new"), span.Text("y"), span.Static("new")))); !strings.Contains(got, "new") {
+		t.Errorf("renders after the swap should use the new plan, got %q", got)
+	}
+}
+
+// TestCompilerUpdatePlanSwapsInBackground verifies that UpdatePlan swaps
+// in the new plan once its channel reports success, and that a tree that
+// panics while compiling leaves the current plan in place.
+func TestCompilerUpdatePlanSwapsInBackground(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+
+	if err := <-compiler.UpdatePlan(div.New(span.Static("Bonjour "), span.Text("Alice"))); err != nil {
+		t.Fatalf("update should succeed, got %v", err)
+	}
+	want := "<div><span>Bonjour </span><span>Bob</span></div>"
+	if got := string(compiler.Render(div.New(span.Static("ignored "), span.Text("Bob")))); got != want {
+		t.Errorf("render after UpdatePlan should use the new plan:\n  got  %q\n  want %q", got, want)
+	}
+
+	err := <-compiler.UpdatePlan(div.New(panicky{errors.New("boom")}))
+	if !errors.Is(err, ErrCompilePanic) {
+		t.Errorf("panicking tree should report a CompileError, got %v", err)
+	}
+	if got := string(compiler.Render(div.New(span.Static("ignored "), span.Text("Bob")))); got != want {
+		t.Errorf("failed update should keep the current plan, got %q", got)
+	}
+}
+
+// TestCompilerUpdatePlanLatestWins verifies that an update still waiting
+// when another is requested is skipped, so the last call's plan is the one
+// left in place.
+func TestCompilerUpdatePlanLatestWins(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("v0 "), span.Text("x")))
+
+	compiler.compileMu.Lock() // Hold both updates until both are queued
+	first := compiler.UpdatePlan(div.New(span.Static("v1 "), span.Text("x")))
+	second := compiler.UpdatePlan(div.New(span.Static("v2 "), span.Text("x")))
+	compiler.compileMu.Unlock()
+
+	if err1, err2 := <-first, <-second; err1 != nil || err2 != nil {
+		t.Fatalf("both updates should report success, got %v and %v", err1, err2)
+	}
+	if got := string(compiler.Render(div.New(span.Static("ignored "), span.Text("y")))); !strings.Contains(got, "v2") {
+		t.Errorf("the latest update should win, got %q", got)
+	}
+}
+
+// TestCompilerCloneSharesPlan verifies that a clone renders from the same
+// plan object as its source but samples buffer sizes on its own.
+func TestCompilerCloneSharesPlan(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+
+	clone := compiler.Clone()
+	if clone.executionPlan.Load() != compiler.executionPlan.Load() {
+		t.Fatal("clone should share the source's plan rather than compile its own")
+	}
+	if clone.sizer == compiler.sizer {
+		t.Fatal("clone should have its own sizer to avoid contention between shards")
+	}
+	if clone.sizer.Baseline() != 0 {
+		t.Errorf("clone's sizer should start from scratch, baseline was %d", clone.sizer.Baseline())
+	}
+
+	got := string(clone.Render(div.New(span.Static("ignored "), span.Text("Bob"))))
+	if want := "<div><span>Hello </span><span>Bob</span></div>"; got != want {
+		t.Errorf("clone should render with the shared plan:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestPlanLayoutMatchesElements verifies that the render layout has one op
+// per element of the public plan, of the matching kind, and that static ops
+// write the content as it is after minifying.
+func TestPlanLayoutMatchesElements(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Minify: true})
+	compiler.Render(div.New(
+		p.Static("  intro  "),
+		span.Text("name"),
+		node.When(true, span.Static("active")),
+	))
+
+	plan := compiler.executionPlan.Load()
+	if len(plan.ops) != len(plan.Elements) {
+		t.Fatalf("expected one op per element, got %d ops for %d elements", len(plan.ops), len(plan.Elements))
+	}
+	for i, element := range plan.Elements {
+		op := plan.ops[i]
+		switch el := element.(type) {
+		case *StaticContent:
+			if op.kind != opStatic || !bytes.Equal(op.static, el.Content) {
+				t.Errorf("op %d should write the element's minified content %q, got kind %d %q", i, el.Content, op.kind, op.static)
+			}
+		case *DynamicPath:
+			if op.kind != opDynamic || op.dynamic != el {
+				t.Errorf("op %d should be the element's dynamic path, got kind %d", i, op.kind)
+			}
+		case *ConditionalPath:
+			if op.kind != opConditional || op.conditional != el {
+				t.Errorf("op %d should be the element's conditional, got kind %d", i, op.kind)
+			}
+			if sub := el.Branch(true); sub == nil || len(sub.ops) != len(sub.Elements) {
+				t.Errorf("op %d: the compiled branch should have its own layout", i)
+			}
+		}
+	}
+}
+
+// TestPlanStaticSlab verifies that a plan's static chunks end up back to
+// back in one slab, each capped so appending to one cannot overwrite the
+// next, and that interned chunks are left shared instead.
+func TestPlanStaticSlab(t *testing.T) {
+	tree := func() node.Node {
+		return div.New(p.Static("one"), span.Text("a"), p.Static("two"), span.Text("b"), p.Static("three"))
+	}
+
+	compiler := NewCompiler()
+	compiler.Render(tree())
+	plan := compiler.executionPlan.Load()
+	offset := 0
+	for _, element := range plan.Elements {
+		sc, ok := element.(*StaticContent)
+		if !ok {
+			continue
+		}
+		if &sc.Content[0] != &plan.slab[offset] {
+			t.Errorf("chunk %q should start at slab offset %d", sc.Content, offset)
+		}
+		if cap(sc.Content) != len(sc.Content) {
+			t.Errorf("chunk %q should be capped at its length, cap is %d", sc.Content, cap(sc.Content))
+		}
+		offset += len(sc.Content)
+	}
+	if offset != len(plan.slab) {
+		t.Errorf("slab should hold exactly the static chunks: %d bytes of chunks, slab is %d", offset, len(plan.slab))
+	}
+
+	interned := NewCompiler(&CompilerCfg{Threshold: 15, InternStatic: true})
+	interned.Render(tree())
+	if slab := interned.executionPlan.Load().slab; len(slab) != 0 {
+		t.Errorf("interned chunks should not be copied into a slab, got %d bytes", len(slab))
+	}
+}
+
+// nest wraps leaf in depth divs.
+func nest(depth int, leaf node.Node) node.Node {
+	n := leaf
+	for range depth {
+		n = div.New(n)
+	}
+	return n
+}
+
+// TestCompilerDeepTree verifies that a tree nested far deeper than any
+// hand-written template compiles and renders, with the dynamic leaf at the
+// bottom still re-evaluated.
+func TestCompilerDeepTree(t *testing.T) {
+	const depth = 5000
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, MaxDepth: depth + 10})
+
+	compiler.Render(nest(depth, span.Text("Alice")))
+	got := string(compiler.Render(nest(depth, span.Text("Bob"))))
+
+	want := strings.Repeat("<div>", depth) + "<span>Bob</span>" + strings.Repeat("</div>", depth)
+	if got != want {
+		t.Errorf("deep tree rendered %d bytes, want %d bytes of nested divs around <span>Bob</span>", len(got), len(want))
+	}
+}
+
+// TestCompilerMaxDepth verifies that a tree nested past the limit panics
+// with a CompileError wrapping ErrTreeTooDeep, whether the offending nodes
+// sit above dynamic content or inside a static subtree.
+func TestCompilerMaxDepth(t *testing.T) {
+	trees := map[string]node.Node{
+		"dynamic": nest(20, span.Text("Alice")),
+		"static":  div.New(span.Text("Alice"), nest(20, span.Static("deep"))),
+	}
+	for name, tree := range trees {
+		compiler := NewCompiler(&CompilerCfg{Threshold: 15, MaxDepth: 10})
+		ce := recoverCompileError(t, func() { compiler.Render(tree) })
+		if !errors.Is(ce, ErrTreeTooDeep) {
+			t.Errorf("%s: panic should wrap ErrTreeTooDeep, got: %v", name, ce)
+		}
+	}
+
+	compiler := NewCompiler()
+	ce := recoverCompileError(t, func() { compiler.Render(nest(DefaultMaxDepth+1, span.Text("Alice"))) })
+	if !errors.Is(ce, ErrTreeTooDeep) {
+		t.Fatalf("default limit should apply without MaxDepth, got: %v", ce)
+	}
+	if !strings.Contains(ce.Path, " > ... > ") || len(ce.Path) > 500 {
+		t.Errorf("path of a very deep node should be shortened, got %d bytes: %.200s", len(ce.Path), ce.Path)
+	}
+}
+
+// TestCompilerMaxDepthConditionalBranch verifies that a conditional
+// branch's depth counts from the page root, not from the branch.
+func TestCompilerMaxDepthConditionalBranch(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, MaxDepth: 10})
+	tree := nest(6, node.When(true, nest(6, span.Text("Alice"))))
+	ce := recoverCompileError(t, func() { compiler.Render(tree) })
+	if !errors.Is(ce, ErrTreeTooDeep) {
+		t.Errorf("branch nested past the limit should panic with ErrTreeTooDeep, got: %v", ce)
+	}
+}
+
+// TestCompilerFixedSize verifies that FixedSize sets the starting capacity
+// of every render and that the adaptive sizer is never fed.
+func TestCompilerFixedSize(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{FixedSize: 4096})
+	for _, name := range []string{"Alice", "Bob", "Charlotte"} {
+		out := compiler.Render(div.New(span.Text(name)))
+		if cap(out) != 4096 {
+			t.Errorf("render should start with the fixed capacity 4096, got %d", cap(out))
+		}
+	}
+
+	state := sizingState(compiler.sizer)
+	if baseline, count := state.Baseline, state.Samples; baseline != 0 || count != 0 {
+		t.Errorf("sizer should not be fed with FixedSize, got baseline %d after %d samples", baseline, count)
+	}
+	if got := compiler.Clone().predict(); got != 4096 {
+		t.Errorf("clone should keep the fixed size, predicted %d", got)
+	}
+}
+
+// comment is a node that writes an HTML comment and, like most custom
+// nodes, does not implement node.Dynamic.
+type comment string
+
+func (c comment) RenderBuilder(buf *bytes.Buffer) { buf.WriteString("<!--" + string(c) + "-->") }
+func (c comment) Render(...io.Writer) []byte {
+	var buf bytes.Buffer
+	c.RenderBuilder(&buf)
+	return buf.Bytes()
+}
+func (c comment) Nodes() []node.Node { return nil }
+
+// TestCompilerMarkupClassification verifies that a doctype, comments and
+// static text are frozen into the plan, while raw HTML is evaluated on
+// every render.
+func TestCompilerMarkupClassification(t *testing.T) {
+	compiler := NewCompiler()
+	tree := func(raw string) node.Node {
+		return html.New(comment(" nav "), text.Static("<!-- static -->"), div.New(text.RawText(raw)))
+	}
+	compiler.Render(tree("<b>first</b>"))
+
+	plan := compiler.executionPlan.Load()
+	if len(plan.Elements) != 3 {
+		t.Fatalf("expected static, raw HTML, static; got %d elements", len(plan.Elements))
+	}
+	head, ok := plan.Elements[0].(*StaticContent)
+	if want := "<!DOCTYPE html><html><!-- nav --><!-- static --><div>"; !ok || string(head.Content) != want {
+		t.Errorf("doctype and comments should be frozen as %q, got %#v", want, plan.Elements[0])
+	}
+	if _, ok := plan.Elements[1].(*DynamicPath); !ok {
+		t.Errorf("raw HTML should be a dynamic path, got %T", plan.Elements[1])
+	}
+
+	want := "<!DOCTYPE html><html><!-- nav --><!-- static --><div><i>second</i></div></html>"
+	if got := string(compiler.Render(tree("<i>second</i>"))); got != want {
+		t.Errorf("raw HTML should be re-evaluated:\ngot:  %s\nwant: %s", got, want)
+	}
+}
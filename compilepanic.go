@@ -0,0 +1,103 @@
+package jit
+
+import (
+	"fmt"
+	"runtime/debug"
+	"slices"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// CompileError is the panic value when a node panics while a plan is being
+// built or seeded. A bare panic from deep in a template says nothing about
+// where it came from; this records which template, which node and where in
+// the tree, and keeps the original value and stack.
+//
+// Recover it to log the context:
+//
+//	defer func() {
+//	    if r := recover(); r != nil {
+//	        var ce *jit.CompileError
+//	        if err, ok := r.(error); ok && errors.As(err, &ce) {
+//	            log.Printf("template %s: %v\n%s", ce.Template, ce, ce.Stack)
+//	        }
+//	        panic(r)
+//	    }
+//	}()
+type CompileError struct {
+	Template string // The registry ID of the compiler, or "" for one created with NewCompiler
+	Path     string // Where the node sits, described by tag, e.g. "div > ul[1] > li[0]"
+	Node     string // The panicking node's Go type, e.g. "*node.FunctionComponent"
+	Value    any    // The value the node panicked with
+	Stack    []byte // The stack at the point of the panic
+}
+
+// Error describes the template, path, node and panic value.
+func (e *CompileError) Error() string {
+	template := ""
+	if e.Template != "" {
+		template = fmt.Sprintf(" in template %q", e.Template)
+	}
+	return fmt.Sprintf("panic compiling %s (%s)%s: %v", e.Path, e.Node, template, e.Value)
+}
+
+// Unwrap returns ErrCompilePanic, and the panic value too if it is an
+// error, so errors.Is matches either.
+func (e *CompileError) Unwrap() []error {
+	if err, ok := e.Value.(error); ok {
+		return []error{ErrCompilePanic, err}
+	}
+	return []error{ErrCompilePanic}
+}
+
+// compilePanic converts a value recovered while compiling n at path into a
+// *CompileError. A value that already is one came from deeper in the tree,
+// which is the more precise location, and is returned unchanged.
+func compilePanic(r any, n node.Node, path []int, tags []string) *CompileError {
+	if ce, ok := r.(*CompileError); ok {
+		return ce
+	}
+	return &CompileError{
+		Path:  describePath(path, append(slices.Clone(tags), safeLabel(n))),
+		Node:  fmt.Sprintf("%T", n),
+		Value: r,
+		Stack: debug.Stack(),
+	}
+}
+
+// safeLabel returns nodeLabel(n), or "node" if n panics while being
+// labelled - it is already known to be misbehaving.
+func safeLabel(n node.Node) (label string) {
+	defer func() {
+		if recover() != nil {
+			label = "node"
+		}
+	}()
+	return nodeLabel(n)
+}
+
+// seedPanic converts a value recovered while seeding element against root.
+func seedPanic(r any, element CompiledElement, root node.Node) *CompileError {
+	var path []int
+	var tags []string
+	switch el := element.(type) {
+	case *DynamicPath:
+		path, tags = el.Path, el.Tags
+	case *ConditionalPath:
+		path, tags = el.Path, el.Tags
+	}
+	if len(tags) > 0 {
+		tags = tags[:len(tags)-1] // compilePanic labels the node itself
+	}
+	n, _ := resolve(root, path)
+	return compilePanic(r, n, path, tags)
+}
+
+// buildPanic converts a value recovered from a builder func into an error
+// wrapping ErrBuildPanic, and the value too if it is an error.
+func buildPanic(r any) error {
+	if err, ok := r.(error); ok {
+		return fmt.Errorf("%w: %w", ErrBuildPanic, err)
+	}
+	return fmt.Errorf("%w: %v", ErrBuildPanic, r)
+}
@@ -0,0 +1,101 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// panicky is a static node whose rendering panics with err.
+type panicky struct{ err error }
+
+func (p panicky) Render(...io.Writer) []byte  { panic(p.err) }
+func (p panicky) RenderBuilder(*bytes.Buffer) { panic(p.err) }
+func (p panicky) Nodes() []node.Node          { return nil }
+
+// recoverCompileError runs fn and returns the *CompileError it panics with.
+func recoverCompileError(t *testing.T, fn func()) (ce *CompileError) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		var ok bool
+		if ce, ok = r.(*CompileError); !ok {
+			t.Fatalf("expected a *CompileError panic, got %T: %v", r, r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// TestCompilePanicInStaticNode verifies that a panic while freezing static
+// content names the template, the node's path and its type, and keeps the
+// original error reachable.
+func TestCompilePanicInStaticNode(t *testing.T) {
+	t.Cleanup(func() { ResetCompile("panic-static") })
+	cause := errors.New("template bug")
+	tree := div.New(span.Text("ok"), ul.New(li.Static("a"), panicky{cause}))
+
+	ce := recoverCompileError(t, func() { Compile("panic-static", tree) })
+	if ce.Template != "panic-static" {
+		t.Errorf("expected template ID panic-static, got %q", ce.Template)
+	}
+	if ce.Path != "div > ul[1]" {
+		t.Errorf("expected the static subtree's path div > ul[1], got %q", ce.Path)
+	}
+	if !strings.Contains(ce.Node, "ul") {
+		t.Errorf("expected the node type to be the ul element, got %q", ce.Node)
+	}
+	if !errors.Is(ce, ErrCompilePanic) || !errors.Is(ce, cause) {
+		t.Errorf("CompileError should wrap ErrCompilePanic and the cause: %v", ce)
+	}
+	if len(ce.Stack) == 0 {
+		t.Error("CompileError should keep the stack of the panic")
+	}
+}
+
+// TestCompilePanicInSeedRender verifies that a dynamic node panicking in
+// the render that seeds the sizer is reported at its own path.
+func TestCompilePanicInSeedRender(t *testing.T) {
+	tree := div.New(span.Static("header"), node.Func(func() node.Node { panic("no data") }))
+
+	ce := recoverCompileError(t, func() { NewCompiler().Render(tree) })
+	if ce.Path != "div > func[1]" {
+		t.Errorf("expected path div > func[1], got %q", ce.Path)
+	}
+	if ce.Node != "*node.FunctionComponent" || ce.Value != "no data" {
+		t.Errorf("expected *node.FunctionComponent panicking with \"no data\", got %s: %v", ce.Node, ce.Value)
+	}
+	if ce.Template != "" {
+		t.Errorf("an unregistered compiler has no template ID, got %q", ce.Template)
+	}
+}
+
+// TestCompilePanicInInactiveBranch verifies that the branch not taken is
+// compiled with the page, and that a panic there is reported from the page
+// root rather than on a later request that selects it.
+func TestCompilePanicInInactiveBranch(t *testing.T) {
+	t.Cleanup(func() { ResetCompile("panic-branch") })
+	cause := errors.New("template bug")
+	tree := div.New(span.Text("ok"), node.Condition(true).
+		True(span.Static("shown")).
+		False(ul.New(li.Static("a"), panicky{cause})))
+
+	ce := recoverCompileError(t, func() { Compile("panic-branch", tree) })
+	if ce.Template != "panic-branch" {
+		t.Errorf("expected template ID panic-branch, got %q", ce.Template)
+	}
+	if want := "div > condition[1] > ul[0]"; ce.Path != want {
+		t.Errorf("expected the path from the page root %q, got %q", want, ce.Path)
+	}
+	if !errors.Is(ce, cause) {
+		t.Errorf("CompileError should wrap the cause: %v", ce)
+	}
+}
@@ -0,0 +1,195 @@
+package jit
+
+import (
+	"bytes"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// conditionField is the index of ConditionalBuilder's unexported condition
+// field. Fluent only exposes the active branch through Nodes(), which does
+// not say whether that branch is True or False, so the compiler reads the
+// flag directly to know which sub-plan applies. If a future Fluent release
+// renames the field this is -1 and conditionals fall back to being compiled
+// as ordinary dynamic nodes.
+var conditionField = func() int {
+	f, ok := reflect.TypeFor[node.ConditionalBuilder]().FieldByName("condition")
+	if !ok || f.Type.Kind() != reflect.Bool {
+		return -1
+	}
+	return f.Index[0]
+}()
+
+// conditionOf reports which branch a conditional will render.
+// Reading a bool through reflect does not require the field to be exported.
+func conditionOf(c *node.ConditionalBuilder) bool {
+	return reflect.ValueOf(c).Elem().Field(conditionField).Bool()
+}
+
+// branchFields are the indices of ConditionalBuilder's unexported falseNode
+// and trueNode fields, ordered by branchIndex, so the branch Nodes() does
+// not expose can be compiled too. Either is -1 if a future Fluent release
+// renames it, and that branch is then compiled when a render selects it.
+var branchFields = [2]int{branchField("falseNode"), branchField("trueNode")}
+
+// branchField returns the index of ConditionalBuilder's node.Node field
+// name, or -1.
+func branchField(name string) int {
+	f, ok := reflect.TypeFor[node.ConditionalBuilder]().FieldByName(name)
+	if !ok || f.Type != reflect.TypeFor[node.Node]() {
+		return -1
+	}
+	return f.Index[0]
+}
+
+// branchOf returns the node c renders when its condition is condition,
+// active or not, and false if the field cannot be read. reflect will not
+// return an unexported interface, so it is read through its address.
+func branchOf(c *node.ConditionalBuilder, condition bool) (node.Node, bool) {
+	i := branchFields[branchIndex(condition)]
+	if i < 0 {
+		return nil, false
+	}
+	f := reflect.ValueOf(c).Elem().Field(i)
+	return *(*node.Node)(unsafe.Pointer(f.UnsafeAddr())), true
+}
+
+// ConditionalPath holds the path to a conditional node together with a
+// pre-compiled sub-plan for each of its branches. At render time the
+// condition is read from the new tree and the matching sub-plan runs against
+// the active branch, so static content inside either branch stays frozen.
+//
+// Both branches are compiled up front, the inactive one read from the
+// conditional's unexported field since Fluent only exposes the active
+// branch. Should that field ever be unreadable, the branch's sub-plan is
+// built the first time a render selects it and cached from then on.
+type ConditionalPath struct {
+	Path     []int                            // Indices to navigate from root to the conditional, see DynamicPath
+	Tags     []string                         // Label of each node along Path, starting with the root - for diagnostics only
+	Key      string                           // The conditional's dynamic key at compile time, or "" if it had none
+	branches [2]atomic.Pointer[ExecutionPlan] // Sub-plans indexed by branchIndex, relative to the branch node
+
+	settings planSettings // The compiling compiler's settings, applied to sub-plans built later
+
+	path packedPath // Path packed for the render loop, see packedPath
+}
+
+// newConditionalPath records the conditional at path and compiles both of
+// its branches immediately, so neither compiles at render time, a panic in
+// either is raised while compiling the page as a *CompileError with its
+// path from the page root, and the plan's Version covers both. s carries
+// the depth limit and base for the branches; the rest of the compiler's
+// settings are applied when the enclosing plan is.
+func newConditionalPath(path []int, c *node.ConditionalBuilder, s planSettings) *ConditionalPath {
+	cp := &ConditionalPath{Path: path, path: packPath(path), settings: s}
+	condition := conditionOf(c)
+	cp.branchPlan(c)
+	if other, ok := branchOf(c, !condition); ok {
+		cp.compileBranch(!condition, other)
+	}
+	return cp
+}
+
+// String describes the path by tag, e.g. "div > section[1] > condition[0]".
+func (cp *ConditionalPath) String() string {
+	return describePath(cp.Path, cp.Tags)
+}
+
+// Branch returns the cached sub-plan for the True or False branch, or nil if
+// that branch has not been compiled.
+func (cp *ConditionalPath) Branch(condition bool) *ExecutionPlan {
+	return cp.branches[branchIndex(condition)].Load()
+}
+
+// branchIndex maps a condition to its slot in ConditionalPath.branches.
+func branchIndex(condition bool) int {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// branchPlan returns the sub-plan for the branch c will render, compiling and
+// caching it on first use.
+func (cp *ConditionalPath) branchPlan(c *node.ConditionalBuilder) (*ExecutionPlan, node.Node) {
+	var branchRoot node.Node
+	if branch := c.Nodes(); len(branch) > 0 {
+		branchRoot = branch[0]
+	}
+	return cp.compileBranch(conditionOf(c), branchRoot), branchRoot
+}
+
+// compileBranch returns the sub-plan for the condition branch, compiling it
+// from branchRoot if it has none yet. A branch with no node set compiles to
+// an empty plan, which renders nothing - matching
+// ConditionalBuilder.RenderBuilder.
+//
+// Concurrent first renders may both compile the branch. CompareAndSwap keeps
+// whichever finished first so every caller uses the same plan afterwards.
+func (cp *ConditionalPath) compileBranch(condition bool, branchRoot node.Node) *ExecutionPlan {
+	slot := &cp.branches[branchIndex(condition)]
+	if plan := slot.Load(); plan != nil {
+		return plan
+	}
+
+	plan := &ExecutionPlan{}
+	if branchRoot != nil {
+		plan = buildPlan(branchRoot, cp.settings)
+	}
+	plan.apply(cp.settings)
+	slot.CompareAndSwap(nil, plan)
+	return slot.Load()
+}
+
+// Render navigates to the conditional and runs the sub-plan for whichever
+// branch is active in this tree.
+func (cp *ConditionalPath) Render(root node.Node, buf *bytes.Buffer) {
+	n, ok := cp.path.resolve(root)
+	if !ok {
+		// Path invalid for this tree - safety check
+		if cp.settings.mismatches != nil {
+			cp.settings.mismatches.report(cp.Path, cp.Tags)
+		}
+		return
+	}
+	cp.renderNode(n, buf)
+}
+
+// renderNode runs the active branch's sub-plan for n, the node cp.path
+// resolves to. It is split from Render so a compiler that has already
+// resolved n can skip the path walk.
+func (cp *ConditionalPath) renderNode(n node.Node, buf *bytes.Buffer) {
+	c, ok := n.(*node.ConditionalBuilder)
+	if !ok {
+		n.RenderBuilder(buf)
+		return
+	}
+
+	plan, branchRoot := cp.branchPlan(c)
+	if branchRoot == nil {
+		return
+	}
+	plan.run(branchRoot, nil, buf)
+}
+
+// validate checks the active branch of the conditional n against its cached
+// sub-plan. A branch without a sub-plan will be compiled from whatever
+// structure it has when it is first selected.
+func (cp *ConditionalPath) validate(n node.Node, deep bool) error {
+	c, ok := n.(*node.ConditionalBuilder)
+	if !ok {
+		return nil
+	}
+	plan := cp.Branch(conditionOf(c))
+	if plan == nil {
+		return nil
+	}
+	branch := c.Nodes()
+	if len(branch) == 0 {
+		return nil
+	}
+	return validatePlan(plan, branch[0], deep)
+}
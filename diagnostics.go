@@ -0,0 +1,306 @@
+package jit
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Diagnostics writes a JSON snapshot of everything in the global
+// registries, for attaching to a bug report: each compiled template's plan
+// summary, version, configuration, sizer state and counters, each tuner's
+// configuration and sizer state, the size of each flattened entry, and
+// the SizingBudget totals.
+// Entries are sorted by ID so two snapshots diff cleanly.
+//
+// Only registered templates are included - compilers made with
+// NewCompiler are not known to the package. Callbacks in configuration are
+// reported as whether they are set. Template content is not included.
+//
+// Example:
+//
+//	http.HandleFunc("/debug/jit", func(w http.ResponseWriter, r *http.Request) {
+//	    w.Header().Set("Content-Type", "application/json")
+//	    jit.Diagnostics(w)
+//	})
+func Diagnostics(w io.Writer) error {
+	d := diagnostics{
+		Generated: time.Now().UTC(),
+		Go:        runtime.Version(),
+		Sizing:    SizingBudget(),
+		Compilers: []compilerDiagnostics{},
+		Tuners:    []tunerDiagnostics{},
+		Flattened: []flattenedDiagnostics{},
+	}
+
+	compilers.Range(func(key, val any) bool {
+		id := key.(string)    //nolint:forcetypeassert // keys are always IDs
+		jc := val.(*Compiler) //nolint:forcetypeassert // only *Compiler is stored
+		d.Compilers = append(d.Compilers, jc.diagnostics(id))
+		return true
+	})
+	tuners.Range(func(key, val any) bool {
+		id := key.(string) //nolint:forcetypeassert // keys are always IDs
+		jt := val.(*Tuner) //nolint:forcetypeassert // only *Tuner is stored
+		d.Tuners = append(d.Tuners, tunerDiagnostics{
+			ID:     id,
+			Added:  addedAt(Tuners, id),
+			Config: jt.cfg,
+			Sizer:  sizingState(jt.sizer),
+			Pool:   jt.PoolStats(),
+		})
+		return true
+	})
+	flattened.Range(func(key, val any) bool {
+		id := key.(string) //nolint:forcetypeassert // keys are always IDs
+		d.Flattened = append(d.Flattened, flattenedDiagnostics{
+			ID:    id,
+			Added: addedAt(Flattened, id),
+			Bytes: len(val.(*flatEntry).content), //nolint:forcetypeassert // only *flatEntry is stored
+		})
+		return true
+	})
+
+	slices.SortFunc(d.Compilers, func(a, b compilerDiagnostics) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortFunc(d.Tuners, func(a, b tunerDiagnostics) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortFunc(d.Flattened, func(a, b flattenedDiagnostics) int { return cmp.Compare(a.ID, b.ID) })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// diagnostics is the document Diagnostics writes.
+type diagnostics struct {
+	Generated time.Time
+	Go        string
+	Sizing    SizingBudgetStats
+	Compilers []compilerDiagnostics
+	Tuners    []tunerDiagnostics
+	Flattened []flattenedDiagnostics
+}
+
+// compilerDiagnostics describes one registered compiler.
+type compilerDiagnostics struct {
+	ID      string
+	Added   *time.Time `json:",omitempty"`
+	Version string
+	Plan    *planDiagnostics
+	Config  *configDiagnostics
+	Sizer   sizerState
+	Bytes   *sizerState `json:",omitempty"`
+	Stats   CompilerStats
+	Pool    PoolStats
+	Latency *LatencyStats `json:",omitempty"`
+}
+
+// tunerDiagnostics describes one registered tuner.
+type tunerDiagnostics struct {
+	ID     string
+	Added  *time.Time `json:",omitempty"`
+	Config *TunerCfg
+	Sizer  sizerState
+	Pool   PoolStats
+}
+
+// flattenedDiagnostics describes one flattened entry by size.
+type flattenedDiagnostics struct {
+	ID    string
+	Added *time.Time `json:",omitempty"`
+	Bytes int
+}
+
+// planDiagnostics summarises a plan's shape without its content.
+type planDiagnostics struct {
+	Elements     int
+	StaticBytes  int
+	Dynamic      int
+	Conditionals int
+	Fragments    int
+}
+
+// configDiagnostics is CompilerCfg with callbacks reduced to whether they
+// are set, since functions cannot be encoded.
+type configDiagnostics struct {
+	Threshold       int
+	Max             int
+	Variance        int
+	GrowthFactor    int
+	Percentile      int
+	EWMA            int
+	Trim            int
+	Window          int
+	MinBaseline     int
+	MaxBaseline     int
+	Modes           int
+	InitialBaseline int
+	TargetOverflow  int
+	Cooldown        int
+	CooldownPeriod  time.Duration
+	RefreshEvery    int
+	RefreshPeriod   time.Duration
+	SizeHistogram   bool
+	FixedSize       int
+	SafeRender      bool
+	RecoverPanics   bool
+	InternStatic    bool
+	Minify          bool
+	Pretty          bool
+	SpillThreshold  int
+	PoolStats       bool
+	LocalPool       bool
+	Latency         bool
+	MinStaticRatio  int
+	SlotEscaping    map[string]Escaping `json:",omitempty"`
+	Surrogate       SurrogateCfg
+	Callbacks       []string `json:",omitempty"`
+
+	SeparateByteSizing bool
+}
+
+// sizerState is a snapshot of an AdaptiveSizer, or of the baseline and
+// type of a custom SizingStrategy.
+type sizerState struct {
+	Strategy string `json:",omitempty"`
+	SizerStats
+	Max          int
+	GrowthFactor int
+	Percentile   int
+	EWMA         int
+	Trim         int
+	Window       int
+	MinBaseline  int
+	MaxBaseline  int
+	Histogram    []SizeBucket `json:",omitempty"`
+}
+
+// diagnostics summarises jc for Diagnostics.
+func (jc *Compiler) diagnostics(id string) compilerDiagnostics {
+	cd := compilerDiagnostics{
+		ID:      id,
+		Added:   addedAt(Compilers, id),
+		Version: jc.Version(),
+		Sizer:   sizingState(jc.sizer),
+		Stats:   jc.Stats(),
+		Pool:    jc.PoolStats(),
+	}
+	if jc.byteSizer != nil {
+		state := sizingState(jc.byteSizer)
+		cd.Bytes = &state
+	}
+	if jc.latency != nil {
+		latency := jc.Latency()
+		cd.Latency = &latency
+	}
+	if plan := jc.executionPlan.Load(); plan != nil {
+		cd.Plan = &planDiagnostics{Elements: len(plan.Elements)}
+		for _, element := range plan.Elements {
+			switch el := element.(type) {
+			case *StaticContent:
+				cd.Plan.StaticBytes += len(el.Content)
+			case *DynamicPath:
+				cd.Plan.Dynamic++
+			case *ConditionalPath:
+				cd.Plan.Conditionals++
+			}
+		}
+		plan.fragments.Range(func(_, _ any) bool {
+			cd.Plan.Fragments++
+			return true
+		})
+	}
+	if cfg := jc.cfg; cfg != nil {
+		cd.Config = &configDiagnostics{
+			Threshold:       cfg.Threshold,
+			Max:             cfg.Max,
+			Variance:        cfg.Variance,
+			GrowthFactor:    cfg.GrowthFactor,
+			Percentile:      cfg.Percentile,
+			EWMA:            cfg.EWMA,
+			Trim:            cfg.Trim,
+			Window:          cfg.Window,
+			MinBaseline:     cfg.MinBaseline,
+			MaxBaseline:     cfg.MaxBaseline,
+			Modes:           cfg.Modes,
+			InitialBaseline: cfg.InitialBaseline,
+			TargetOverflow:  cfg.TargetOverflow,
+			Cooldown:        cfg.Cooldown,
+			CooldownPeriod:  cfg.CooldownPeriod,
+			RefreshEvery:    cfg.RefreshEvery,
+			RefreshPeriod:   cfg.RefreshPeriod,
+			SizeHistogram:   cfg.SizeHistogram,
+			FixedSize:       cfg.FixedSize,
+			SafeRender:      cfg.SafeRender,
+			RecoverPanics:   cfg.RecoverPanics,
+			InternStatic:    cfg.InternStatic,
+			Minify:          cfg.Minify,
+			Pretty:          cfg.Pretty,
+			SpillThreshold:  cfg.SpillThreshold,
+			PoolStats:       cfg.PoolStats,
+			LocalPool:       cfg.LocalPool,
+			Latency:         cfg.Latency,
+			MinStaticRatio:  cfg.MinStaticRatio,
+			SlotEscaping:    cfg.SlotEscaping,
+			Surrogate:       cfg.Surrogate,
+
+			SeparateByteSizing: cfg.SeparateByteSizing,
+		}
+		for name, set := range map[string]bool{
+			"OnMismatch":       cfg.OnMismatch != nil,
+			"OnMarkupError":    cfg.OnMarkupError != nil,
+			"OnLint":           cfg.OnLint != nil,
+			"OnTimeout":        cfg.OnTimeout != nil,
+			"OnPanic":          cfg.OnPanic != nil,
+			"OnMostlyDynamic":  cfg.OnMostlyDynamic != nil,
+			"OnBaselineChange": cfg.OnBaselineChange != nil,
+			"Sizing":           cfg.Sizing != nil,
+		} {
+			if set {
+				cd.Config.Callbacks = append(cd.Config.Callbacks, name)
+			}
+		}
+		slices.Sort(cd.Config.Callbacks)
+	}
+	return cd
+}
+
+// sizingState snapshots s, in full for an AdaptiveSizer.
+func sizingState(s SizingStrategy) sizerState {
+	if as, ok := s.(*AdaptiveSizer); ok {
+		return as.state()
+	}
+	return sizerState{Strategy: fmt.Sprintf("%T", s), SizerStats: sizerStats(s)}
+}
+
+// state snapshots the sizer under its lock.
+func (as *AdaptiveSizer) state() sizerState {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return sizerState{
+		SizerStats:   as.stats(),
+		Max:          as.max,
+		GrowthFactor: as.growthFactor,
+		Percentile:   as.percentile,
+		EWMA:         int(atomic.LoadInt64(&as.smoothing)),
+		Trim:         as.trim,
+		Window:       int(atomic.LoadInt64(&as.window)),
+		MinBaseline:  int(atomic.LoadInt64(&as.floor)),
+		MaxBaseline:  int(atomic.LoadInt64(&as.ceiling)),
+		Histogram:    as.Histogram(),
+	}
+}
+
+// addedAt returns when the registry entry was created, or nil if unknown.
+func addedAt(reg Registry, id string) *time.Time {
+	at, ok := added.Load(registryKey{reg, id})
+	if !ok {
+		return nil
+	}
+	t := at.(time.Time) //nolint:forcetypeassert // only time.Time is stored
+	return &t
+}
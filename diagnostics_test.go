@@ -0,0 +1,65 @@
+package jit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestDiagnosticsDescribesRegistries verifies that the bundle is valid JSON
+// describing each registry entry, with plan summaries, configuration and
+// callbacks reduced to their names.
+func TestDiagnosticsDescribesRegistries(t *testing.T) {
+	t.Cleanup(func() {
+		ResetCompile("diag-page")
+		ResetTune("diag-list")
+		ResetFlatten("diag-footer")
+	})
+	CompileConfig("diag-page", CompilerCfg{Threshold: 15, Minify: true, OnMismatch: func(error) {}})
+	Compile("diag-page", div.New(p.Static("Hello"), span.Text("Alice")))
+	Tune("diag-list", div.New(span.Text("item")))
+	Flatten("diag-footer", p.Static("Footer"))
+
+	var buf bytes.Buffer
+	if err := Diagnostics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var d diagnostics
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatalf("bundle should be valid JSON: %v\n%s", err, buf.String())
+	}
+
+	var page *compilerDiagnostics
+	for i := range d.Compilers {
+		if d.Compilers[i].ID == "diag-page" {
+			page = &d.Compilers[i]
+		}
+	}
+	if page == nil {
+		t.Fatalf("bundle should list the diag-page compiler:\n%s", buf.String())
+	}
+	if page.Plan == nil || page.Plan.Dynamic != 1 || page.Plan.StaticBytes == 0 || page.Version == "" {
+		t.Errorf("compiler should have a plan summary and version, got %+v", page)
+	}
+	if page.Config == nil || !page.Config.Minify || len(page.Config.Callbacks) != 1 || page.Config.Callbacks[0] != "OnMismatch" {
+		t.Errorf("config should show Minify and the OnMismatch callback, got %+v", page.Config)
+	}
+	if page.Added == nil {
+		t.Error("compiler should record when it was registered")
+	}
+
+	found := map[string]bool{}
+	for _, tuner := range d.Tuners {
+		found[tuner.ID] = true
+	}
+	for _, flat := range d.Flattened {
+		found[flat.ID] = flat.Bytes == len("<p>Footer</p>") || found[flat.ID]
+	}
+	if !found["diag-list"] || !found["diag-footer"] {
+		t.Errorf("bundle should list the tuner and the flattened entry with its size:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,163 @@
+package jit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeNegotiated serves the flattened content in the best encoding the
+// request accepts out of those the flattener holds - the plain bytes and
+// any variants made with FlattenerCfg.Gzip or FlattenerCfg.Encoders - and
+// sets the headers that go with it: Content-Encoding, Content-Length,
+// Vary: Accept-Encoding, an ETag for the chosen representation, and
+// Content-Type text/html if the handler has not set one. A request whose
+// If-None-Match names that ETag gets 304 Not Modified, and a HEAD request
+// gets the headers alone.
+//
+// Encodings are chosen by the Accept-Encoding quality values; between
+// equal ones the smallest variant wins. Identity is acceptable but least
+// preferred unless the header names it. If it is refused, with
+// identity;q=0 or *;q=0, and no variant is acceptable either, the plain
+// bytes are sent anyway as RFC 9110 allows, rather than failing the page.
+//
+// Last-Modified is FlattenerCfg.LastModified, or LastRendered if unset,
+// and Cache-Control is FlattenerCfg.CacheControl if set. If-Modified-Since
+// is honoured when the request has no If-None-Match.
+//
+// Compressed representations get the weak ETag "W/" + ETag(), so a cache
+// never mixes one up with the plain bytes.
+//
+// Example:
+//
+//	func aboutHandler(w http.ResponseWriter, r *http.Request) {
+//	    aboutPage.ServeNegotiated(w, r)
+//	}
+func (f *Flattener) ServeNegotiated(w http.ResponseWriter, r *http.Request) {
+	f = f.current()
+	encoding, content := f.negotiate(r.Header.Get("Accept-Encoding"))
+
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	etag := f.etag
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+		etag = "W/" + etag
+	}
+	h.Set("ETag", etag)
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	modified := f.lastModified()
+	h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if f.cfg != nil && f.cfg.CacheControl != "" {
+		h.Set("Cache-Control", f.cfg.CacheControl)
+	}
+	if f.notModified(r, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(content)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// ServeHTTP makes a Flattener an http.Handler, serving it with
+// ServeNegotiated along with the cache metadata from its FlattenerCfg.
+//
+// Example:
+//
+//	mux.Handle("GET /about", aboutPage)
+func (f *Flattener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.ServeNegotiated(w, r)
+}
+
+// lastModified returns the time to send as Last-Modified.
+func (f *Flattener) lastModified() time.Time {
+	if f.cfg != nil && !f.cfg.LastModified.IsZero() {
+		return f.cfg.LastModified
+	}
+	return f.rendered
+}
+
+// notModified reports whether r's validators match the content: its
+// If-None-Match names the ETag, or, without one, its If-Modified-Since is
+// no earlier than modified. HTTP dates have whole seconds, so modified is
+// compared at that precision.
+func (f *Flattener) notModified(r *http.Request, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, f.etag)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// negotiate returns the encoding to serve for an Accept-Encoding header
+// and the bytes in it, with "" for the plain bytes.
+func (f *Flattener) negotiate(header string) (string, []byte) {
+	accepted := parseAcceptEncoding(header)
+	quality := func(encoding string) float64 {
+		if q, ok := accepted[encoding]; ok {
+			return q
+		}
+		if q, ok := accepted["*"]; ok {
+			return q
+		}
+		if encoding == "identity" {
+			// Acceptable unless refused (RFC 9110 section 12.5.3), but a
+			// coding the client names is preferred, whatever its quality.
+			return 0.001
+		}
+		return 0
+	}
+
+	best, bestContent, bestQ := "", f.bytes, quality("identity")
+	for encoding, content := range f.variants {
+		q := quality(encoding)
+		if q <= 0 {
+			continue
+		}
+		// Map order is random, so equal candidates are settled by name to
+		// serve the same encoding every time.
+		smaller := len(content) < len(bestContent) || len(content) == len(bestContent) && best != "" && encoding < best
+		if q > bestQ || q == bestQ && smaller {
+			best, bestContent, bestQ = encoding, content, q
+		}
+	}
+	return best, bestContent
+}
+
+// parseAcceptEncoding returns the quality of each coding named in an
+// Accept-Encoding header, lower-cased. A coding without a valid q
+// parameter has quality 1. An empty header gives an empty map, which
+// accepts identity only.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for item := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && v >= 0 && v <= 1 {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q
+	}
+	return accepted
+}
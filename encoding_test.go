@@ -0,0 +1,159 @@
+package jit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// negotiatedFlattener holds a plain page with gzip and a fake br variant
+// that is always the smallest.
+func negotiatedFlattener(t *testing.T) *Flattener {
+	t.Helper()
+	f, err := NewFlattener(div.New(span.Static(strings.Repeat("page ", 100))), &FlattenerCfg{
+		Gzip:     true,
+		Encoders: map[string]Encoder{"br": func([]byte) ([]byte, error) { return []byte("br"), nil }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// TestServeNegotiatedChoosesEncoding verifies the choice of variant for a
+// range of Accept-Encoding headers.
+func TestServeNegotiatedChoosesEncoding(t *testing.T) {
+	f := negotiatedFlattener(t)
+	tests := []struct {
+		accept string
+		want   string // Content-Encoding, "" for the plain bytes
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"}, // equal quality, br smallest
+		{"br;q=0.5, gzip", "gzip"},  // quality beats size
+		{"GZIP;Q=0.8", "gzip"},      // case-insensitive
+		{"br;q=0, gzip;q=0", ""},    // both refused
+		{"*", "br"},                 // wildcard accepts every variant
+		{"*;q=0.1, identity", ""},   // identity preferred by quality
+		{"zstd", ""},                // no such variant
+		{"identity;q=0, *;q=0", ""}, // nothing acceptable, plain sent anyway
+		{"gzip;q=bogus", "gzip"},    // invalid q counts as 1
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		f.ServeNegotiated(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: served %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// TestServeNegotiatedHeaders verifies the headers and body that go with
+// the chosen representation, conditional GET and HEAD.
+func TestServeNegotiatedHeaders(t *testing.T) {
+	f := negotiatedFlattener(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	f.ServeNegotiated(w, r)
+	h := w.Header()
+	if w.Body.String() != "br" || h.Get("Content-Length") != "2" {
+		t.Errorf("br body and length: got %q, %s", w.Body.String(), h.Get("Content-Length"))
+	}
+	if h.Get("Vary") != "Accept-Encoding" || h.Get("ETag") != "W/"+f.ETag() {
+		t.Errorf("compressed response should vary on Accept-Encoding with a weak ETag, got Vary %q ETag %q", h.Get("Vary"), h.Get("ETag"))
+	}
+	if !strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+		t.Errorf("Content-Type should default to HTML, got %q", h.Get("Content-Type"))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Type", "text/plain")
+	f.ServeNegotiated(w, r)
+	if w.Body.String() != string(f.Render()) || w.Header().Get("ETag") != f.ETag() || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("plain response should carry the strong ETag and keep the handler's Content-Type, got ETag %q type %q", w.Header().Get("ETag"), w.Header().Get("Content-Type"))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("If-None-Match", "W/"+f.ETag())
+	w = httptest.NewRecorder()
+	f.ServeNegotiated(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+		t.Errorf("matching If-None-Match should get an empty 304, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	r = httptest.NewRequest(http.MethodHead, "/", nil)
+	w = httptest.NewRecorder()
+	f.ServeNegotiated(w, r)
+	if w.Body.Len() > 0 || w.Header().Get("Content-Length") != strconv.Itoa(f.Len()) {
+		t.Errorf("HEAD should send headers only, got %d bytes, length %q", w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+}
+
+// TestServeHTTPCacheMetadata verifies that the Flattener, as a handler,
+// sends the cache metadata from its cfg and honours If-Modified-Since.
+func TestServeHTTPCacheMetadata(t *testing.T) {
+	built := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f, err := NewFlattener(span.Static("cached"), &FlattenerCfg{
+		CacheControl: "public, max-age=3600",
+		LastModified: built,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handler http.Handler = f
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	h := w.Header()
+	if h.Get("Cache-Control") != "public, max-age=3600" || h.Get("Last-Modified") != built.Format(http.TimeFormat) {
+		t.Errorf("cache metadata: got Cache-Control %q, Last-Modified %q", h.Get("Cache-Control"), h.Get("Last-Modified"))
+	}
+	if w.Body.String() != "<span>cached</span>" {
+		t.Errorf("body: got %q", w.Body.String())
+	}
+
+	tests := []struct {
+		name      string
+		since     string
+		noneMatch string
+		wantCode  int
+	}{
+		{"same time", built.Format(http.TimeFormat), "", http.StatusNotModified},
+		{"later", built.Add(time.Hour).Format(http.TimeFormat), "", http.StatusNotModified},
+		{"earlier", built.Add(-time.Hour).Format(http.TimeFormat), "", http.StatusOK},
+		{"unparseable", "yesterday", "", http.StatusOK},
+		{"If-None-Match takes precedence", built.Format(http.TimeFormat), `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-Modified-Since", tt.since)
+		if tt.noneMatch != "" {
+			r.Header.Set("If-None-Match", tt.noneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+	}
+
+	plain, _ := NewFlattener(span.Static("plain"))
+	w = httptest.NewRecorder()
+	plain.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("Cache-Control") != "" || w.Header().Get("Last-Modified") != plain.LastRendered().UTC().Format(http.TimeFormat) {
+		t.Errorf("without cfg, no Cache-Control and Last-Modified from LastRendered, got %q, %q", w.Header().Get("Cache-Control"), w.Header().Get("Last-Modified"))
+	}
+}
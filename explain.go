@@ -0,0 +1,126 @@
+package jit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
+)
+
+// Explanation says how one subtree of a template compiles: frozen into the
+// plan as static bytes, or kept dynamic and re-rendered on every render,
+// and why. Containers that hold dynamic content explain each child in turn.
+type Explanation struct {
+	Path     string        // Where the subtree sits, described by tag, e.g. "div > ul[1]"
+	Frozen   bool          // Rendered once at compile time and reused verbatim
+	Reason   string        // Why it was frozen or kept dynamic
+	Children []Explanation // Set for containers with dynamic content, DynamicAttr elements and the active branch of a conditional
+}
+
+// String lays the explanation out one subtree per line, indented by
+// nesting, e.g.
+//
+//	div: container - tags frozen, dynamic content inside
+//	  div > h1[0]: frozen - no dynamic content
+//	  div > func[1]: dynamic - function component, called on every render
+func (e Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+// write appends e and its children to b at the given indent.
+func (e Explanation) write(b *strings.Builder, indent int) {
+	state := "dynamic"
+	if e.Frozen {
+		state = "frozen"
+	}
+	fmt.Fprintf(b, "%s%s: %s - %s\n", strings.Repeat("  ", indent), e.Path, state, e.Reason)
+	for _, child := range e.Children {
+		child.write(b, indent+1)
+	}
+}
+
+// Explain reports, subtree by subtree, what compiling root freezes and what
+// stays dynamic, and why - so a template that is not getting faster can be
+// traced to the node keeping it dynamic. It follows the same rules as
+// compiling but builds no plan, so it can be called on any tree at any
+// time; conditionals are explained for the branch that is active in root.
+//
+// Example:
+//
+//	fmt.Print(pageCompiler.Explain(Page(sample)))
+func (jc *Compiler) Explain(root node.Node) Explanation {
+	return jc.explain(root, nil, nil)
+}
+
+// explain explains n at path, with tags holding the label of each ancestor.
+func (jc *Compiler) explain(n node.Node, path []int, tags []string) Explanation {
+	e := Explanation{Path: describePath(path, append(tags, nodeLabel(n)))}
+	if limit := jc.settings.maxDepth; limit > 0 && len(path) > limit {
+		e.Reason = fmt.Sprintf("nested deeper than MaxDepth (%d), so compiling panics", limit)
+		return e
+	}
+
+	if fa, ok := n.(*forcedAttr); ok {
+		e.Reason = "DynamicAttr, opening tag re-rendered on every render"
+		e.Children = jc.explainChildren(fa.Nodes(), path, append(tags, nodeLabel(n)))
+		return e
+	}
+	if isDynamicNode(n) {
+		e.Reason = dynamicReason(n)
+		if c, ok := n.(*node.ConditionalBuilder); ok && conditionField >= 0 {
+			e.Children = jc.explainChildren(c.Nodes(), path, append(tags, nodeLabel(n)))
+		}
+		return e
+	}
+
+	children := n.Nodes()
+	if !isDynamic(n) {
+		e.Frozen = true
+		e.Reason = "no dynamic content"
+		if _, ok := n.(*pure); ok {
+			e.Reason = "marked Pure"
+		}
+		return e
+	}
+	e.Reason = "container - tags frozen, dynamic content inside"
+	e.Children = jc.explainChildren(children, path, append(tags, nodeLabel(n)))
+	return e
+}
+
+// explainChildren explains each of children, the children of the node at
+// path.
+func (jc *Compiler) explainChildren(children []node.Node, path []int, tags []string) []Explanation {
+	explained := make([]Explanation, len(children))
+	for i, child := range children {
+		explained[i] = jc.explain(child, append(path[:len(path):len(path)], i), tags[:len(tags):len(tags)])
+	}
+	return explained
+}
+
+// dynamicReason says why n, a dynamic node, is re-rendered on every render.
+func dynamicReason(n node.Node) string {
+	switch n := n.(type) {
+	case *node.ConditionalBuilder:
+		if conditionField < 0 {
+			return "conditional, rendered whole as this Fluent version's branch cannot be read"
+		}
+		return "conditional, each branch compiled to its own sub-plan"
+	case *node.FunctionComponent:
+		return "function component, called on every render"
+	case *node.FuncsComponent:
+		return "function list, called on every render"
+	case *text.Node:
+		return "dynamic text"
+	case *forced:
+		return "marked Dynamic"
+	case *timed:
+		return "Timeout, rendered within a deadline"
+	case *deferred:
+		return "Defer, streamed after the page"
+	default:
+		return fmt.Sprintf("%T implements node.Dynamic and reports IsDynamic", n)
+	}
+}
@@ -0,0 +1,56 @@
+package jit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestCompilerExplain verifies that each subtree is reported frozen or
+// dynamic with the reason, following the compiler's own rules.
+func TestCompilerExplain(t *testing.T) {
+	tree := div.New(
+		h1.Static("Title"),
+		node.Func(func() node.Node { return span.Static("x") }),
+		node.When(true, div.New(span.Static("on"), span.Text("name"))),
+		Pure(span.Text("fixed")),
+	)
+	e := NewCompiler().Explain(tree)
+
+	if e.Frozen || !strings.Contains(e.Reason, "container") || len(e.Children) != 4 {
+		t.Fatalf("root should be a container with four children explained, got %+v", e)
+	}
+	want := []struct {
+		path   string
+		frozen bool
+		reason string
+	}{
+		{"div > h1[0]", true, "no dynamic content"},
+		{"div > func[1]", false, "function component"},
+		{"div > condition[2]", false, "conditional"},
+		{"div > node[3]", true, "marked Pure"},
+	}
+	for i, w := range want {
+		got := e.Children[i]
+		if got.Path != w.path || got.Frozen != w.frozen || !strings.Contains(got.Reason, w.reason) {
+			t.Errorf("child %d: got %q frozen=%v %q, want %q frozen=%v containing %q", i, got.Path, got.Frozen, got.Reason, w.path, w.frozen, w.reason)
+		}
+	}
+
+	branch := e.Children[2].Children
+	if len(branch) != 1 || len(branch[0].Children) != 2 {
+		t.Fatalf("conditional should explain its active branch, got %+v", e.Children[2])
+	}
+	if name := branch[0].Children[1]; len(name.Children) != 1 || name.Children[0].Reason != "dynamic text" {
+		t.Errorf("span.Text inside the branch should hold dynamic text, got:\n%s", name)
+	}
+
+	out := e.String()
+	if !strings.Contains(out, "\n  div > h1[0]: frozen - no dynamic content\n") {
+		t.Errorf("String should indent children one level, got:\n%s", out)
+	}
+}
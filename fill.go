@@ -0,0 +1,111 @@
+package jit
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"slices"
+
+	"github.com/jpl-au/fluent"
+)
+
+// Escaping selects how Compiler.RenderFromMap writes a slot's value.
+type Escaping int
+
+const (
+	// EscapeHTML escapes the value as HTML text. It is the default, and the
+	// only safe choice for content editors can type into.
+	EscapeHTML Escaping = iota
+	// EscapeNone writes the value as is. Use it only for slots whose
+	// content is trusted markup, such as the output of a sanitiser.
+	EscapeNone
+)
+
+// scriptElements hold content that HTML escaping does not make safe, so a
+// slot inside one is refused unless it is explicitly trusted.
+var scriptElements = []string{"script", "style"}
+
+// RenderFromMap renders the compiled template with each named slot's
+// content taken from values instead of from a node tree, so content managed
+// outside Go - a headless CMS, a translations file - can populate a
+// template at request time. Each slot keeps its element and attributes from
+// compile time; only its content is replaced. A slot missing from values
+// renders empty, and values with no matching slot are ignored.
+//
+// Values are escaped per slot as set in CompilerCfg.SlotEscaping,
+// defaulting to EscapeHTML. A slot inside script or style must be set to
+// EscapeNone, since HTML escaping does not make content safe there.
+//
+// Every dynamic element of the plan must be a named slot - see Slots. If
+// any is unnamed, or is a conditional that needs a tree to choose its
+// branch, ErrUnfillableSlot is returned and nothing is written. Returns
+// ErrNotCompiled if the compiler has not rendered yet.
+//
+// Example:
+//
+//	article.Render(Article(sample)) // compile once from a sample tree
+//	err := article.RenderFromMap(map[string]string{
+//	    "title": entry.Title,
+//	    "body":  entry.BodyHTML, // CompilerCfg.SlotEscaping: {"body": jit.EscapeNone}
+//	}, w)
+func (jc *Compiler) RenderFromMap(values map[string]string, w io.Writer) error {
+	plan := jc.executionPlan.Load()
+	if plan == nil {
+		return ErrNotCompiled
+	}
+
+	var rules map[string]Escaping
+	if jc.cfg != nil {
+		rules = jc.cfg.SlotEscaping
+	}
+
+	// Check the whole plan first so a template that cannot be filled
+	// writes nothing, rather than half a page.
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *DynamicPath:
+			if el.OpenTag {
+				return fmt.Errorf("%w: %s has dynamic attributes", ErrUnfillableSlot, el)
+			}
+			if el.Key == "" {
+				return fmt.Errorf("%w: %s has no name", ErrUnfillableSlot, el)
+			}
+			if rules[el.Key] != EscapeNone && slices.ContainsFunc(el.Tags, inScript) {
+				return fmt.Errorf("%w: %s is inside script or style and is not set to EscapeNone", ErrUnfillableSlot, el)
+			}
+		case *ConditionalPath:
+			return fmt.Errorf("%w: %s is a conditional", ErrUnfillableSlot, el)
+		}
+	}
+
+	predictedSize := jc.predict()
+	buf := fluent.NewBuffer(predictedSize)
+	defer fluent.PutBuffer(buf)
+
+	for _, element := range plan.Elements {
+		dp, ok := element.(*DynamicPath)
+		if !ok {
+			element.Render(nil, buf)
+			continue
+		}
+		buf.Write(dp.open)
+		if rules[dp.Key] == EscapeNone {
+			buf.WriteString(values[dp.Key])
+		} else {
+			buf.WriteString(html.EscapeString(values[dp.Key]))
+		}
+		buf.Write(dp.close)
+	}
+
+	actualSize := buf.Len()
+	jc.record(predictedSize, actualSize)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// inScript reports whether a path label names an element whose content
+// HTML escaping does not protect.
+func inScript(tag string) bool {
+	return slices.Contains(scriptElements, tag)
+}
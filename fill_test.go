@@ -0,0 +1,97 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/script"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// article is a CMS-style template whose dynamic content is all named.
+func article(title, body string) node.Node {
+	return div.New(
+		h1.Text(title).Class("title").Dynamic("title"),
+		p.Text(body).Dynamic("body"),
+	)
+}
+
+// TestRenderFromMapFillsSlots verifies that each named slot keeps its
+// element and attributes and takes its content from the map, escaped.
+func TestRenderFromMapFillsSlots(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(article("sample", "sample"))
+
+	var buf bytes.Buffer
+	err := compiler.RenderFromMap(map[string]string{
+		"title": "Fish & Chips",
+		"body":  "<b>crispy</b>",
+		"extra": "ignored",
+	}, &buf)
+	if err != nil {
+		t.Fatalf("RenderFromMap failed: %v", err)
+	}
+
+	want := string(article("Fish & Chips", "<b>crispy</b>").Render())
+	if buf.String() != want {
+		t.Errorf("filled template should match rendering the same values as nodes:\n  got  %q\n  want %q", buf.String(), want)
+	}
+}
+
+// TestRenderFromMapEscaping verifies that EscapeNone writes trusted markup
+// as is, and that a missing value renders an empty slot.
+func TestRenderFromMapEscaping(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{SlotEscaping: map[string]Escaping{"body": EscapeNone}})
+	compiler.Render(article("sample", "sample"))
+
+	var buf bytes.Buffer
+	if err := compiler.RenderFromMap(map[string]string{"body": "<b>crispy</b>"}, &buf); err != nil {
+		t.Fatalf("RenderFromMap failed: %v", err)
+	}
+
+	want := `<div><h1 class="title" data-tether-key="title"></h1><p data-tether-key="body"><b>crispy</b></p></div>`
+	if buf.String() != want {
+		t.Errorf("trusted slot should be written unescaped and missing slot empty:\n  got  %q\n  want %q", buf.String(), want)
+	}
+}
+
+// TestRenderFromMapRefusesUnfillable verifies that plans a map cannot
+// supply are refused before anything is written.
+func TestRenderFromMapRefusesUnfillable(t *testing.T) {
+	tests := []struct {
+		name string
+		tree node.Node
+	}{
+		{"unnamed", div.New(p.Static("intro"), span.Text("x"))},
+		{"conditional", div.New(node.When(true, span.Text("x").Dynamic("x")))},
+		{"script", div.New(script.Text("x").Dynamic("config"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiler := NewCompiler()
+			compiler.Render(tt.tree)
+
+			var buf bytes.Buffer
+			err := compiler.RenderFromMap(map[string]string{"x": "y", "config": "{}"}, &buf)
+			if !errors.Is(err, ErrUnfillableSlot) {
+				t.Errorf("expected ErrUnfillableSlot, got: %v", err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("nothing should be written when the plan is refused, got %q", buf.String())
+			}
+		})
+	}
+}
+
+// TestRenderFromMapNotCompiled verifies the error before the first render.
+func TestRenderFromMapNotCompiled(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewCompiler().RenderFromMap(nil, &buf); !errors.Is(err, ErrNotCompiled) {
+		t.Errorf("expected ErrNotCompiled, got: %v", err)
+	}
+}
@@ -2,7 +2,16 @@ package jit
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/jpl-au/fluent/node"
 )
@@ -11,30 +20,263 @@ import (
 // This is the instance API for static content rendering - no map lookups,
 // just direct byte access. Ideal for maximum performance with static templates.
 type Flattener struct {
-	bytes []byte // pre-rendered static content
+	bytes    []byte            // pre-rendered static content
+	variants map[string][]byte // bytes by content encoding, see FlattenerCfg
+	hash     uint64            // FNV-1a hash of bytes, see Hash
+	etag     string            // quoted hash, see ETag
+	rendered time.Time         // when bytes were rendered, see LastRendered
+
+	cfg     *FlattenerCfg             // applied again by Rebuild
+	rebuilt atomic.Pointer[Flattener] // replacement from the last Rebuild, nil until then
 }
 
 // NewFlattener creates a flattener by rendering static content once.
-// Returns an error if the node contains dynamic content.
-func NewFlattener(n node.Node) (*Flattener, error) {
+// Returns an error if the node contains dynamic content, if a transform or
+// encoder fails, or if FlattenerCfg.GzipLevel is not a valid gzip level.
+func NewFlattener(n node.Node, cfg ...*FlattenerCfg) (*Flattener, error) {
 	if isDynamic(n) {
 		return nil, ErrDynamicContent
 	}
 
 	var buf bytes.Buffer
 	n.RenderBuilder(&buf)
+	content := buf.Bytes()
+
+	var fc *FlattenerCfg
+	if len(cfg) > 0 {
+		fc = cfg[0]
+	}
+	if fc != nil {
+		for i, transform := range fc.Transforms {
+			var err error
+			if content, err = transform(content); err != nil {
+				return nil, fmt.Errorf("transform %d: %w", i, err)
+			}
+		}
+	}
+
+	f := newFlattener(content)
+	f.cfg = fc
+	if fc != nil {
+		if err := f.encode(fc); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
 
+// newFlattener returns a flattener serving content, with its metadata.
+func newFlattener(content []byte) *Flattener {
+	h := fnv.New64a()
+	h.Write(content)
+	hash := h.Sum64()
+	// Clipped so that appending to the slice Render returns copies it
+	// rather than writing into spare capacity every caller shares.
 	return &Flattener{
-		bytes: buf.Bytes(),
-	}, nil
+		bytes:    slices.Clip(content),
+		hash:     hash,
+		etag:     `"` + strconv.FormatUint(hash, 16) + `"`,
+		rendered: time.Now(),
+	}
+}
+
+// MinifyHTML is a Transform that collapses whitespace in text and strips
+// comments, as CompilerCfg.Minify does for a compiled plan's static
+// content. Content of pre, textarea, script and style is left alone.
+func MinifyHTML(content []byte) ([]byte, error) {
+	out, _ := minifyChunk(content, "")
+	return out, nil
+}
+
+// encode makes the compressed variants cfg asks for.
+func (f *Flattener) encode(cfg *FlattenerCfg) error {
+	encoders := maps.Clone(cfg.Encoders)
+	if cfg.Gzip {
+		level := cfg.GzipLevel
+		if level == 0 {
+			level = gzip.BestCompression
+		}
+		if encoders == nil {
+			encoders = make(map[string]Encoder, 1)
+		}
+		encoders["gzip"] = func(plain []byte) ([]byte, error) { return gzipBytes(plain, level) }
+	}
+	for encoding, encoder := range encoders {
+		compressed, err := encoder(f.bytes)
+		if err != nil {
+			return fmt.Errorf("%s encoding: %w", encoding, err)
+		}
+		if f.variants == nil {
+			f.variants = make(map[string][]byte, len(encoders))
+		}
+		f.variants[encoding] = compressed
+	}
+	return nil
 }
 
 // Render writes the pre-rendered bytes to the writer or returns them.
 // No rendering logic is executed - this is a direct byte slice write.
+//
+// This is the fast path: the returned slice is the flattener's own, not a
+// copy, and every later render returns it too. Writing into it changes the
+// page for everyone; appending is safe, as it has no spare capacity. Use
+// RenderCopy for a slice the caller may change.
 func (f *Flattener) Render(w ...io.Writer) []byte {
+	f = f.current()
 	if len(w) > 0 && w[0] != nil {
 		_, _ = w[0].Write(f.bytes)
 		return nil
 	}
 	return f.bytes
 }
+
+// RenderCopy returns a copy of the pre-rendered bytes, for a caller that
+// modifies the result - splicing in a nonce, say - or hands it to code it
+// does not trust to leave it alone. It allocates on every call, so prefer
+// Render where the bytes are only written out.
+func (f *Flattener) RenderCopy() []byte {
+	return slices.Clone(f.current().bytes)
+}
+
+// RenderCompressed writes the content to w in the given content encoding:
+// "gzip" for the variant made with FlattenerCfg.Gzip, an encoding from
+// FlattenerCfg.Encoders such as "br", or "identity" or "" for the plain
+// bytes. For an encoding with no variant, nothing is written and
+// ErrEncodingUnavailable is returned, so the caller can fall back to
+// Render. Otherwise the error is from writing to w.
+//
+// Example:
+//
+//	w.Header().Add("Vary", "Accept-Encoding")
+//	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+//	    w.Header().Set("Content-Encoding", "gzip")
+//	    footer.RenderCompressed(w, "gzip")
+//	    return
+//	}
+//	footer.Render(w)
+func (f *Flattener) RenderCompressed(w io.Writer, encoding string) error {
+	f = f.current()
+	content := f.bytes
+	if encoding != "" && encoding != "identity" {
+		var ok bool
+		if content, ok = f.variants[encoding]; !ok {
+			return ErrEncodingUnavailable
+		}
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+// ETag returns an entity tag for the flattened content, hashed once when
+// the flattener was created, so a handler can answer conditional GETs
+// without hashing the page on every request. The result is quoted, ready
+// for the ETag header.
+//
+// The tag identifies the plain bytes. A compressed variant is a different
+// representation, so send those with the weak form, "W/" + ETag();
+// NotModified accepts either in If-None-Match.
+func (f *Flattener) ETag() string {
+	return f.current().etag
+}
+
+// NotModified sets the ETag header and reports whether the request's
+// If-None-Match already names it, in which case it has also sent 304 Not
+// Modified and the handler should return without writing a body.
+//
+// Example:
+//
+//	if aboutPage.NotModified(w, r) {
+//	    return
+//	}
+//	aboutPage.Render(w)
+func (f *Flattener) NotModified(w http.ResponseWriter, r *http.Request) bool {
+	etag := f.ETag()
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// Len returns the size of the flattened content in bytes, for a
+// Content-Length header or a memory dashboard.
+func (f *Flattener) Len() int {
+	return len(f.current().bytes)
+}
+
+// Hash returns the FNV-1a hash of the flattened content, computed once
+// when it was rendered. ETag is the same hash formatted for the header.
+func (f *Flattener) Hash() uint64 {
+	return f.current().hash
+}
+
+// LastRendered returns when the content was rendered. A Flattener renders
+// once, at construction, so this suits a Last-Modified header; for a
+// RefreshingFlattener it moves with each successful rebuild.
+func (f *Flattener) LastRendered() time.Time {
+	return f.current().rendered
+}
+
+// Rebuild flattens n with the configuration the flattener was created
+// with, and serves it from then on. It is a hook for development: a file
+// watcher that sees a template change calls it, and the next render picks
+// up the edit without a server restart. Renders already in flight finish
+// on the old content.
+//
+// If n is dynamic, or a transform or encoder fails, the error is returned
+// and the current content is kept.
+//
+// Example:
+//
+//	watcher.OnChange(func() {
+//	    if err := footer.Rebuild(Footer()); err != nil {
+//	        log.Print(err)
+//	    }
+//	})
+func (f *Flattener) Rebuild(n node.Node) error {
+	next, err := NewFlattener(n, f.cfg)
+	if err != nil {
+		return err
+	}
+	f.rebuilt.Store(next)
+	return nil
+}
+
+// current returns the flattener holding the content to serve: the last
+// rebuild if there has been one, or f. Rebuilt flatteners are always
+// stored on the original, so this is never more than one step.
+func (f *Flattener) current() *Flattener {
+	if next := f.rebuilt.Load(); next != nil {
+		return next
+	}
+	return f
+}
+
+// gzipBytes returns b compressed at level.
+func gzipBytes(b []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	// Writes to a bytes.Buffer cannot fail, so Close reports everything.
+	_, _ = zw.Write(b)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dynamicPaths returns the child-index path to every outermost dynamic node
+// under n. Descendants of a dynamic node are not reported separately - the
+// outermost node is what needs to change for the tree to flatten.
+func dynamicPaths(n node.Node, path []int, found [][]int) [][]int {
+	if isDynamicNode(n) {
+		return append(found, slices.Clone(path))
+	}
+	for i, child := range n.Nodes() {
+		found = dynamicPaths(child, append(path, i), found)
+	}
+	return found
+}
@@ -2,11 +2,21 @@ package jit
 
 import (
 	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jpl-au/fluent/html5/div"
 	"github.com/jpl-au/fluent/html5/span"
 	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
 )
 
 // TestFlattenerStaticContent verifies the happy path: a fully static tree
@@ -102,3 +112,225 @@ func TestFlattenerRenderConsistency(t *testing.T) {
 		t.Errorf("cached flattener should return identical bytes on every call:\n  first  %q\n  second %q", first, second)
 	}
 }
+
+// TestFlattenerGzip verifies that the gzipped variant decompresses to the
+// plain bytes, and that unavailable encodings write nothing.
+func TestFlattenerGzip(t *testing.T) {
+	n := div.New(span.Static(strings.Repeat("footer ", 50)))
+
+	f, err := NewFlattener(n, &FlattenerCfg{Gzip: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var compressed bytes.Buffer
+	if err := f.RenderCompressed(&compressed, "gzip"); err != nil {
+		t.Fatalf("gzip variant should be available: %v", err)
+	}
+	zr, err := gzip.NewReader(&compressed)
+	if err != nil {
+		t.Fatalf("variant is not valid gzip: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("variant is not valid gzip: %v", err)
+	}
+	if !bytes.Equal(plain, f.Render()) {
+		t.Errorf("gzip variant should decompress to the flattened bytes, got %q", plain)
+	}
+
+	var identity bytes.Buffer
+	if err := f.RenderCompressed(&identity, "identity"); err != nil || !bytes.Equal(identity.Bytes(), f.Render()) {
+		t.Errorf("identity should write the plain bytes, got %q, %v", identity.String(), err)
+	}
+
+	var none bytes.Buffer
+	if err := f.RenderCompressed(&none, "br"); !errors.Is(err, ErrEncodingUnavailable) || none.Len() > 0 {
+		t.Errorf("unsupported encoding should write nothing and return ErrEncodingUnavailable, got %d bytes, %v", none.Len(), err)
+	}
+
+	plainOnly, _ := NewFlattener(n)
+	if err := plainOnly.RenderCompressed(&none, "gzip"); !errors.Is(err, ErrEncodingUnavailable) {
+		t.Errorf("gzip without FlattenerCfg.Gzip should be unavailable, got %v", err)
+	}
+
+	if _, err := NewFlattener(n, &FlattenerCfg{Gzip: true, GzipLevel: 42}); err == nil {
+		t.Error("an invalid gzip level should be rejected")
+	}
+}
+
+// TestFlattenerEncoders verifies that a plugged-in encoder's output is
+// served under its encoding name, and that its error fails construction.
+func TestFlattenerEncoders(t *testing.T) {
+	n := div.New(span.Static("shell"))
+	reverse := func(plain []byte) ([]byte, error) {
+		out := slices.Clone(plain)
+		slices.Reverse(out)
+		return out, nil
+	}
+
+	f, err := NewFlattener(n, &FlattenerCfg{Gzip: true, Encoders: map[string]Encoder{"br": reverse}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var br bytes.Buffer
+	if err := f.RenderCompressed(&br, "br"); err != nil || br.String() != ">vid/<>naps/<llehs>naps<>vid<" {
+		t.Errorf("br should serve the encoder's output, got %q, %v", br.String(), err)
+	}
+	if err := f.RenderCompressed(io.Discard, "gzip"); err != nil {
+		t.Errorf("gzip should still be available alongside other encoders, got %v", err)
+	}
+
+	failed := errors.New("encoder failed")
+	_, err = NewFlattener(n, &FlattenerCfg{Encoders: map[string]Encoder{
+		"br": func([]byte) ([]byte, error) { return nil, failed },
+	}})
+	if !errors.Is(err, failed) {
+		t.Errorf("encoder error should fail NewFlattener, got %v", err)
+	}
+}
+
+// TestFlattenerETag verifies that the tag follows the content and that
+// NotModified answers a matching conditional GET with 304, weak form
+// included.
+func TestFlattenerETag(t *testing.T) {
+	a, _ := NewFlattener(div.New(span.Static("a")))
+	b, _ := NewFlattener(div.New(span.Static("b")))
+	again, _ := NewFlattener(div.New(span.Static("a")))
+	if a.ETag() == b.ETag() || a.ETag() != again.ETag() {
+		t.Errorf("tags should follow content: a=%s b=%s again=%s", a.ETag(), b.ETag(), again.ETag())
+	}
+	if !strings.HasPrefix(a.ETag(), `"`) || !strings.HasSuffix(a.ETag(), `"`) {
+		t.Errorf("tag should be quoted, got %s", a.ETag())
+	}
+
+	for _, header := range []string{a.ETag(), "W/" + a.ETag()} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", header)
+		w := httptest.NewRecorder()
+		if !a.NotModified(w, r) || w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s should get 304, got %d", header, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if a.NotModified(w, httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("a request without If-None-Match should be served")
+	}
+	if got := w.Header().Get("ETag"); got != a.ETag() {
+		t.Errorf("ETag header should be set, got %q", got)
+	}
+}
+
+// TestFlattenerRenderCopy verifies that modifying RenderCopy's result
+// leaves later renders untouched.
+func TestFlattenerRenderCopy(t *testing.T) {
+	f, _ := NewFlattener(div.New(span.Static("hello")))
+
+	out := f.RenderCopy()
+	copy(out, "XXXXX")
+	_ = append(out[:3], "tail"...)
+
+	if got := string(f.Render()); got != "<div><span>hello</span></div>" {
+		t.Errorf("modifying a copy should not change the flattener, got %q", got)
+	}
+	if &f.RenderCopy()[0] == &f.Render()[0] {
+		t.Error("RenderCopy should not return the cached slice")
+	}
+}
+
+// TestFlattenerRenderAppend verifies that appending to Render's result
+// cannot reach the flattener's memory.
+func TestFlattenerRenderAppend(t *testing.T) {
+	f, _ := NewFlattener(div.New(span.Static("hello")))
+	out := f.Render()
+	if cap(out) != len(out) {
+		t.Errorf("Render's slice should have no spare capacity, got len %d cap %d", len(out), cap(out))
+	}
+}
+
+// TestFlattenerTransforms verifies that transforms run in order, once, and
+// that the ETag and compressed variants are made from their result.
+func TestFlattenerTransforms(t *testing.T) {
+	var runs int
+	rewrite := func(content []byte) ([]byte, error) {
+		runs++
+		return bytes.ReplaceAll(content, []byte("/app.css"), []byte("https://cdn.example/app.3f2a.css")), nil
+	}
+	n := div.New(text.Static("<link href=\"/app.css\">\n   <!-- build 42 -->\n   <p>hi</p>"))
+
+	f, err := NewFlattener(n, &FlattenerCfg{Transforms: []Transform{rewrite, MinifyHTML}, Encoders: map[string]Encoder{
+		"id": func(plain []byte) ([]byte, error) { return plain, nil },
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `<div><link href="https://cdn.example/app.3f2a.css"> <p>hi</p></div>`
+	if got := string(f.Render()); got != want {
+		t.Errorf("transformed content:\n  got  %q\n  want %q", got, want)
+	}
+	f.Render()
+	if runs != 1 {
+		t.Errorf("transforms should run once at construction, ran %d times", runs)
+	}
+	var encoded bytes.Buffer
+	if err := f.RenderCompressed(&encoded, "id"); err != nil || encoded.String() != want {
+		t.Errorf("variants should be made from the transformed content, got %q, %v", encoded.String(), err)
+	}
+	plain, _ := NewFlattener(div.New(text.Static(want[5 : len(want)-6])))
+	if f.ETag() != plain.ETag() {
+		t.Error("ETag should be computed from the transformed content")
+	}
+
+	failed := errors.New("no manifest")
+	_, err = NewFlattener(n, &FlattenerCfg{Transforms: []Transform{func([]byte) ([]byte, error) { return nil, failed }}})
+	if !errors.Is(err, failed) {
+		t.Errorf("a transform's error should fail NewFlattener, got %v", err)
+	}
+}
+
+// TestFlattenerMetadata verifies that size, hash and render time describe
+// the content without rendering it again.
+func TestFlattenerMetadata(t *testing.T) {
+	before := time.Now()
+	f, _ := NewFlattener(div.New(span.Static("hello")))
+	again, _ := NewFlattener(div.New(span.Static("hello")))
+
+	if f.Len() != len("<div><span>hello</span></div>") {
+		t.Errorf("Len should be the content size, got %d", f.Len())
+	}
+	if f.Hash() == 0 || f.Hash() != again.Hash() {
+		t.Errorf("Hash should follow content, got %x and %x", f.Hash(), again.Hash())
+	}
+	if want := `"` + strconv.FormatUint(f.Hash(), 16) + `"`; f.ETag() != want {
+		t.Errorf("ETag should be the quoted hash, got %s want %s", f.ETag(), want)
+	}
+	if f.LastRendered().Before(before) || f.LastRendered().After(time.Now()) {
+		t.Errorf("LastRendered should be the construction time, got %v", f.LastRendered())
+	}
+}
+
+// TestFlattenerRebuild verifies that a rebuild is served from then on with
+// the original configuration, and that a failed one keeps the old content.
+func TestFlattenerRebuild(t *testing.T) {
+	upper := func(content []byte) ([]byte, error) { return bytes.ToUpper(content), nil }
+	f, _ := NewFlattener(div.New(span.Static("old")), &FlattenerCfg{Transforms: []Transform{upper}})
+	oldTag := f.ETag()
+
+	if err := f.Rebuild(div.New(span.Static("new"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(f.Render()); got != "<DIV><SPAN>NEW</SPAN></DIV>" {
+		t.Errorf("rebuilt content should be served with the original transforms, got %q", got)
+	}
+	if f.ETag() == oldTag || f.Len() != len("<DIV><SPAN>NEW</SPAN></DIV>") {
+		t.Errorf("metadata should follow the rebuild, got ETag %s Len %d", f.ETag(), f.Len())
+	}
+
+	if err := f.Rebuild(div.New(span.Text("x"))); !errors.Is(err, ErrDynamicContent) {
+		t.Errorf("expected ErrDynamicContent, got %v", err)
+	}
+	if got := string(f.Render()); got != "<DIV><SPAN>NEW</SPAN></DIV>" {
+		t.Errorf("a failed rebuild should keep the current content, got %q", got)
+	}
+}
@@ -0,0 +1,111 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// Dynamic marks n as dynamic so the compiler re-renders it on every render
+// instead of freezing it into static content. It is the inverse of Pure,
+// for nodes built with Static or plain attributes that still change per
+// request - a CSRF token in a hidden input is the usual case:
+//
+//	form.Post("/login",
+//	    jit.Dynamic(input.Hidden("csrf", token)),
+//	    // ... static fields ...
+//	)
+//
+// The wrapper renders exactly as n does and keeps n's dynamic key.
+func Dynamic(n node.Node) node.Node {
+	return &forced{n: n}
+}
+
+// DynamicAttr marks el's attributes as dynamic while its children compile
+// as usual, for a large static element whose opening tag carries a
+// per-request value. Only the opening tag is re-rendered on each render;
+// static children stay frozen, and dynamic children get their own paths.
+//
+// The wrapper takes el's place in the tree rather than adding a level, so
+// paths to el's children are unchanged.
+//
+// Example:
+//
+//	jit.DynamicAttr(form.Post("/checkout", fields...).SetData("nonce", nonce))
+func DynamicAttr(el node.Element) node.Node {
+	return &forcedAttr{Element: el}
+}
+
+// forced is the node behind Dynamic. Its only child is the wrapped node,
+// so tree walkers see n exactly as before, one level down.
+type forced struct {
+	n node.Node
+}
+
+// Render renders the wrapped node.
+func (f *forced) Render(w ...io.Writer) []byte {
+	buf := fluent.NewBuffer()
+	f.RenderBuilder(buf)
+
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// RenderBuilder renders the wrapped node into buf.
+func (f *forced) RenderBuilder(buf *bytes.Buffer) {
+	if f.n != nil {
+		f.n.RenderBuilder(buf)
+	}
+}
+
+// Nodes returns the wrapped node.
+func (f *forced) Nodes() []node.Node {
+	if f.n == nil {
+		return nil
+	}
+	return []node.Node{f.n}
+}
+
+// IsDynamic returns true - that is the promise Dynamic makes.
+func (f *forced) IsDynamic() bool { return true }
+
+// DynamicKey returns the wrapped node's key, if it has one.
+func (f *forced) DynamicKey() string {
+	if d, ok := f.n.(node.Dynamic); ok {
+		return d.DynamicKey()
+	}
+	return ""
+}
+
+// forcedAttr is the node behind DynamicAttr. It embeds the element so it
+// renders, and exposes children, exactly as the element does; only
+// IsDynamic differs, and walk recognises it before treating it as a whole
+// dynamic node.
+type forcedAttr struct {
+	node.Element
+}
+
+// IsDynamic returns true so the compiler gives the opening tag a path.
+func (f *forcedAttr) IsDynamic() bool { return true }
+
+// DynamicKey returns the element's key, if it has one.
+func (f *forcedAttr) DynamicKey() string {
+	if d, ok := f.Element.(node.Dynamic); ok {
+		return d.DynamicKey()
+	}
+	return ""
+}
+
+// unforced returns the node a Dynamic wrapper stands for, or n itself.
+func unforced(n node.Node) node.Node {
+	if f, ok := n.(*forced); ok && f.n != nil {
+		return f.n
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/form"
+	"github.com/jpl-au/fluent/html5/input"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestDynamicIsNotFrozen verifies that a static node wrapped in Dynamic is
+// re-rendered from each tree rather than frozen at compile time.
+func TestDynamicIsNotFrozen(t *testing.T) {
+	login := func(token string) node.Node {
+		return form.Post("/login",
+			Dynamic(input.Hidden("csrf", token)),
+			p.Static("Sign in"),
+		)
+	}
+
+	compiler := NewCompiler()
+	compiler.Render(login("first"))
+	got := string(compiler.Render(login("second")))
+
+	if want := string(login("second").Render()); got != want {
+		t.Errorf("wrapped node should render from the current tree:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestDynamicAttrKeepsChildrenCompiled verifies that DynamicAttr re-renders
+// only the opening tag: attributes change, static children stay frozen and
+// dynamic children still render from the tree.
+func TestDynamicAttrKeepsChildrenCompiled(t *testing.T) {
+	page := func(nonce, intro, name string) node.Node {
+		return div.New(
+			DynamicAttr(form.Post("/checkout",
+				p.Static(intro),
+				span.Text(name),
+			).SetData("nonce", nonce)),
+		)
+	}
+
+	compiler := NewCompiler()
+	compiler.Render(page("n1", "frozen", "Alice"))
+	got := string(compiler.Render(page("n2", "ignored", "Bob")))
+
+	want := string(page("n2", "frozen", "Bob").Render())
+	if got != want {
+		t.Errorf("unexpected output:\n  got  %q\n  want %q", got, want)
+	}
+
+	plan := compiler.executionPlan.Load()
+	var openTags int
+	for _, element := range plan.Elements {
+		if dp, ok := element.(*DynamicPath); ok && dp.OpenTag {
+			openTags++
+		}
+	}
+	if openTags != 1 {
+		t.Errorf("plan should have one opening-tag path, got %d", openTags)
+	}
+}
+
+// TestDynamicAttrMarkupCheck verifies that the markup check accounts for
+// an opening tag that lives in the dynamic part of the plan.
+func TestDynamicAttrMarkupCheck(t *testing.T) {
+	tree := div.New(DynamicAttr(form.Post("/x", p.Static("body"))))
+	if problems := compileChecked(tree); len(problems) != 0 {
+		t.Errorf("DynamicAttr element should balance, got %v", problems)
+	}
+}
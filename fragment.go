@@ -0,0 +1,82 @@
+package jit
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// RenderFragment renders only the subtree of root at path, so htmx or Turbo
+// endpoints can return the fragment being swapped instead of the whole
+// page. path is a list of child indices from root, as in DynamicPath.Path;
+// an empty path renders the whole tree.
+//
+// The fragment is rendered from a plan of its own, compiled the first time
+// that path is requested and kept alongside the page plan, so repeated
+// fragment requests cost the same as page renders of the same size. Its
+// static content is frozen from the first tree it is requested from, the
+// same rule as for the page, and it is dropped with the page plan on
+// Recompile or Invalidate. The compiler's buffer sizing and latency
+// histogram are not updated, since fragments say nothing about the page.
+// CompilerCfg.RecoverPanics applies, falling back to the subtree's
+// standard rendering.
+//
+// Returns an error wrapping ErrStructureMismatch if path does not resolve
+// in root, or the error from writing to w.
+//
+// Example:
+//
+//	// <tbody> of the orders table: div > table[1] > tbody[1]
+//	err := ordersCompiler.RenderFragment(OrdersPage(orders), []int{1, 1}, w)
+func (jc *Compiler) RenderFragment(root node.Node, path []int, w io.Writer) error {
+	plan := jc.currentPlan(root)
+
+	n, ok := resolve(root, path)
+	if !ok {
+		return fmt.Errorf("%w: fragment path %v does not resolve", ErrStructureMismatch, path)
+	}
+	fragment := plan.fragment(path, n, jc.settings)
+
+	buf := fluent.NewBuffer()
+	defer fluent.PutBuffer(buf)
+	jc.recovering(buf, n, func() { fragment.run(n, nil, buf) })
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// fragment returns the plan for the subtree n at path, compiling it with s
+// on first use. Concurrent first requests may both compile it;
+// LoadOrStore keeps whichever finished first.
+func (plan *ExecutionPlan) fragment(path []int, n node.Node, s planSettings) *ExecutionPlan {
+	key := fragmentKey(path)
+	if fragment, ok := plan.fragments.Load(key); ok {
+		return fragment.(*ExecutionPlan) //nolint:forcetypeassert // only *ExecutionPlan is stored
+	}
+
+	s.nodeDepth = len(path)
+	fragment := buildPlan(n, s)
+	// Whether a raw-text element is open where the fragment starts is not
+	// known here, so it is minified as if none were. A fragment inside a
+	// <pre> should be the <pre> itself.
+	s.raw, s.depth = "", 0
+	// The fragment's markup was already checked as part of the page.
+	s.markup = nil
+	fragment.apply(s)
+	stored, _ := plan.fragments.LoadOrStore(key, fragment)
+	return stored.(*ExecutionPlan) //nolint:forcetypeassert // only *ExecutionPlan is stored
+}
+
+// fragmentKey encodes a path as a map key, e.g. "1.0.3".
+func fragmentKey(path []int) string {
+	b := make([]byte, 0, len(path)*3)
+	for i, idx := range path {
+		if i > 0 {
+			b = append(b, '.')
+		}
+		b = strconv.AppendInt(b, int64(idx), 10)
+	}
+	return string(b)
+}
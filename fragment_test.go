@@ -0,0 +1,80 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// fragmentPage has a list whose items mix static and dynamic content.
+func fragmentPage(a, b string) node.Node {
+	return div.New(
+		h1.Static("Tasks"),
+		ul.New(
+			li.New(span.Static("first: "), span.Text(a)),
+			li.New(span.Static("second: "), span.Text(b)),
+		),
+	)
+}
+
+// TestRenderFragment verifies that a fragment renders exactly as the
+// subtree would, with fresh dynamic content on each request.
+func TestRenderFragment(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(fragmentPage("a", "b"))
+
+	for _, values := range [][2]string{{"x", "y"}, {"p", "q"}} {
+		tree := fragmentPage(values[0], values[1])
+		var buf bytes.Buffer
+		if err := compiler.RenderFragment(tree, []int{1}, &buf); err != nil {
+			t.Fatalf("RenderFragment failed: %v", err)
+		}
+		want := string(tree.Nodes()[1].Render())
+		if buf.String() != want {
+			t.Errorf("fragment should match the subtree:\n  got  %q\n  want %q", buf.String(), want)
+		}
+	}
+
+	plan := compiler.executionPlan.Load()
+	var fragments int
+	plan.fragments.Range(func(_, _ any) bool { fragments++; return true })
+	if fragments != 1 {
+		t.Errorf("repeated requests for one path should share a fragment plan, got %d", fragments)
+	}
+}
+
+// TestRenderFragmentDroppedOnInvalidate verifies that fragment plans go
+// with the page plan.
+func TestRenderFragmentDroppedOnInvalidate(t *testing.T) {
+	compiler := NewCompiler()
+	var buf bytes.Buffer
+	_ = compiler.RenderFragment(fragmentPage("a", "b"), []int{1, 0}, &buf)
+
+	compiler.Invalidate()
+	compiler.Render(fragmentPage("a", "b"))
+
+	var fragments int
+	compiler.executionPlan.Load().fragments.Range(func(_, _ any) bool { fragments++; return true })
+	if fragments != 0 {
+		t.Errorf("a rebuilt plan should start without fragments, got %d", fragments)
+	}
+}
+
+// TestRenderFragmentBadPath verifies a path that does not resolve.
+func TestRenderFragmentBadPath(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewCompiler().RenderFragment(fragmentPage("a", "b"), []int{1, 5}, &buf)
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Errorf("expected ErrStructureMismatch, got: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("nothing should be written for a bad path, got %q", buf.String())
+	}
+}
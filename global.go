@@ -2,8 +2,11 @@ package jit
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"sync"
+	"unique"
+	"unsafe"
 
 	"github.com/jpl-au/fluent/node"
 )
@@ -24,15 +27,32 @@ var (
 // Warning: The global registry grows indefinitely. Do not use dynamic IDs
 // without manually calling ResetCompile(id) to free memory.
 func Compile(id string, n node.Node, w ...io.Writer) []byte {
+	return registeredCompiler(id).Render(n, w...)
+}
+
+// registeredCompiler returns the compiler registered under id, creating it
+// if it doesn't exist.
+func registeredCompiler(id string) *Compiler {
 	// Load first to avoid allocating a NewCompiler on every call - LoadOrStore
 	// evaluates its arguments eagerly, so calling it directly would allocate
 	// even when the key already exists.
 	val, loaded := compilers.Load(id)
 	if !loaded {
-		val, _ = compilers.LoadOrStore(id, NewCompiler())
+		val, loaded = compilers.LoadOrStore(id, namedCompiler(id, nil))
+		if !loaded {
+			markAdded(Compilers, id)
+		}
 	}
-	compiler := val.(*Compiler) //nolint:forcetypeassert // type guaranteed by LoadOrStore
-	return compiler.Render(n, w...)
+	return val.(*Compiler) //nolint:forcetypeassert // type guaranteed by LoadOrStore
+}
+
+// namedCompiler returns a compiler for the registry under id, so errors it
+// reports can name the template.
+func namedCompiler(id string, cfg *CompilerCfg) *Compiler {
+	jc := NewCompiler(cfg)
+	jc.id = id
+	jc.settings.mismatches.template = id
+	return jc
 }
 
 // Tune looks up a tuner by ID in a global registry, creating it if it
@@ -44,36 +64,36 @@ func Compile(id string, n node.Node, w ...io.Writer) []byte {
 func Tune(id string, n node.Node, w ...io.Writer) []byte {
 	val, loaded := tuners.Load(id)
 	if !loaded {
-		val, _ = tuners.LoadOrStore(id, NewTuner())
+		val, loaded = tuners.LoadOrStore(id, registeredTuner(nil))
+		if !loaded {
+			markAdded(Tuners, id)
+		}
 	}
 	tuner := val.(*Tuner) //nolint:forcetypeassert // type guaranteed by LoadOrStore
 	return tuner.Tune(n).Render(w...)
 }
 
+// registeredTuner returns a tuner for the registry.
+func registeredTuner(cfg *TunerCfg) *Tuner {
+	jt := NewTuner(cfg)
+	jt.registered = true
+	return jt
+}
+
 // ResetCompile removes compiled templates from the global registry,
 // allowing them to be re-compiled on next use.
 // Call with no arguments to clear all entries, or pass specific IDs to remove.
+// To remove by prefix or age, use Reset.
 func ResetCompile(ids ...string) {
-	if len(ids) == 0 {
-		compilers.Clear()
-		return
-	}
-	for _, id := range ids {
-		compilers.Delete(id)
-	}
+	resetIDs(Compilers, ids)
 }
 
 // ResetTune removes tuned templates from the global registry,
 // causing their tuning statistics to be reset on next use.
 // Call with no arguments to clear all entries, or pass specific IDs to remove.
+// To remove by prefix or age, use Reset.
 func ResetTune(ids ...string) {
-	if len(ids) == 0 {
-		tuners.Clear()
-		return
-	}
-	for _, id := range ids {
-		tuners.Delete(id)
-	}
+	resetIDs(Tuners, ids)
 }
 
 // Flatten looks up flattened static content in the global registry.
@@ -84,55 +104,143 @@ func ResetTune(ids ...string) {
 // falls back to uncached rendering. This avoids disrupting request handlers where
 // returning an error would be impractical.
 //
+// The returned slice is the caller's own copy. Pass a writer to serve the
+// stored bytes without copying them.
+//
 // Warning: The global registry grows indefinitely. Do not use dynamic IDs
 // without manually calling ResetFlatten(id) to free memory.
 func Flatten(id string, n node.Node, w ...io.Writer) []byte {
-	val, loaded := flattened.Load(id)
-
-	if !loaded {
+	entry, ok := flatEntryFor(id, n)
+	if !ok {
 		// Falls back to standard render for dynamic content rather than erroring,
 		// since the global API is typically called in request handlers where
 		// returning an error would be disruptive.
+		return n.Render(w...)
+	}
+	return entry.write(w)
+}
+
+// FlattenStrict is Flatten for code paths that would rather fail than
+// quietly render a dynamic tree on every request. On first call, a tree
+// with dynamic content returns an error wrapping ErrDynamicContent, with
+// the path to each dynamic node, and nothing is written or stored; a
+// static tree is flattened and stored as by Flatten. Later calls serve the
+// stored bytes under id without checking n, so they cost the same as
+// Flatten's.
+func FlattenStrict(id string, n node.Node, w ...io.Writer) ([]byte, error) {
+	entry, ok := flatEntryFor(id, n)
+	if !ok {
+		return nil, fmt.Errorf("%w: flatten %q has dynamic nodes at paths %v", ErrDynamicContent, id, dynamicPaths(n, nil, nil))
+	}
+	return entry.write(w), nil
+}
+
+// flatEntryFor returns the entry stored under id, flattening n into it if
+// there is none yet. It reports false, storing nothing, if n has to be
+// flattened but is dynamic.
+func flatEntryFor(id string, n node.Node) (*flatEntry, bool) {
+	val, loaded := flattened.Load(id)
+	if !loaded {
 		if isDynamic(n) {
-			return n.Render(w...)
+			return nil, false
 		}
 
 		var buf bytes.Buffer
 		n.RenderBuilder(&buf)
 
-		flattened.Store(id, buf.Bytes())
-		val = buf.Bytes()
+		val = sharedFlat(buf.Bytes())
+		flattened.Store(id, val)
+		markAdded(Flattened, id)
 	}
+	return val.(*flatEntry), true //nolint:forcetypeassert // type guaranteed by Store above
+}
 
-	bytes := val.([]byte) //nolint:forcetypeassert // type guaranteed by Store above
+// flatEntry is a value in the flattened registry.
+type flatEntry struct {
+	content []byte
+	handle  unique.Handle[string] // Keeps content shared, see sharedFlat
+}
 
+// write writes the entry's content to the writer or returns a copy of it.
+// The content is shared with other IDs (see sharedFlat), so only a
+// writer, which must not modify what it is given, sees it directly.
+func (fe *flatEntry) write(w []io.Writer) []byte {
 	if len(w) > 0 && w[0] != nil {
-		_, _ = w[0].Write(bytes)
+		_, _ = w[0].Write(fe.content)
 		return nil
 	}
-	return bytes
+	return bytes.Clone(fe.content)
+}
+
+// sharedFlat returns an entry whose content is shared with every other
+// entry holding the same bytes. Multi-tenant deployments flatten the same
+// footer or header under many IDs, and each would otherwise hold its own
+// copy. Content is deduplicated with the unique package, as StaticContent
+// is with CompilerCfg.InternStatic, so a copy is dropped once no ID uses
+// it rather than kept by a hash table that only grows.
+func sharedFlat(content []byte) *flatEntry {
+	handle := unique.Make(string(content))
+	s := handle.Value()
+	return &flatEntry{content: unsafe.Slice(unsafe.StringData(s), len(s)), handle: handle}
+}
+
+// AssertStillStatic reports whether a template registered with Flatten is
+// still fully static. The global Flatten silently falls back to uncached
+// rendering when a tree gains dynamic content, so a refactor that adds a
+// Text() or Func() to a "static" page goes unnoticed in production. Call this
+// from a test with the same tree the handler passes to Flatten to catch it.
+//
+// Returns nil if the tree is static, or an error wrapping ErrDynamicContent
+// that lists the child-index path to each offending dynamic node.
+//
+//	func TestFooterStaysStatic(t *testing.T) {
+//	    if err := jit.AssertStillStatic("footer", Footer()); err != nil {
+//	        t.Fatal(err)
+//	    }
+//	}
+func AssertStillStatic(id string, n node.Node) error {
+	paths := dynamicPaths(n, nil, nil)
+	if len(paths) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: flatten %q has dynamic nodes at paths %v", ErrDynamicContent, id, paths)
 }
 
 // ResetFlatten removes flattened static content from the global registry.
 // Call with no arguments to clear all entries, or pass specific IDs to remove.
+// To remove by prefix or age, use Reset.
 func ResetFlatten(ids ...string) {
-	if len(ids) == 0 {
-		flattened.Clear()
-		return
-	}
-	for _, id := range ids {
-		flattened.Delete(id)
-	}
+	resetIDs(Flattened, ids)
 }
 
 // CompileConfig creates a compiler instance with custom configuration.
 // Must be called before first Compile() call for the given ID.
 func CompileConfig(id string, cfg CompilerCfg) {
-	compilers.Store(id, NewCompiler(&cfg))
+	compilers.Store(id, namedCompiler(id, &cfg))
+	markAdded(Compilers, id)
+}
+
+// MustCompileConfig is like CompileConfig but panics with the error from
+// cfg.Validate, registering nothing, if the cfg's sizing is invalid.
+func MustCompileConfig(id string, cfg CompilerCfg) {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	CompileConfig(id, cfg)
 }
 
 // TuneConfig creates a tuner instance with custom configuration.
 // Must be called before first Tune() call for the given ID.
 func TuneConfig(id string, cfg TunerCfg) {
-	tuners.Store(id, NewTuner(&cfg))
+	tuners.Store(id, registeredTuner(&cfg))
+	markAdded(Tuners, id)
+}
+
+// MustTuneConfig is like TuneConfig but panics with the error from
+// cfg.Validate, registering nothing, if the cfg's sizing is invalid.
+func MustTuneConfig(id string, cfg TunerCfg) {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	TuneConfig(id, cfg)
 }
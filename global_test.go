@@ -2,6 +2,7 @@ package jit
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
 
@@ -219,3 +220,88 @@ func TestGlobalTuneConfig(t *testing.T) {
 		t.Errorf("pre-configured Tune should still render correctly:\n  got  %q\n  want %q", result, expected)
 	}
 }
+
+// TestAssertStillStatic verifies that a static template passes and that a
+// template which has gained dynamic content fails with the path to each
+// dynamic node, so the developer can find what broke flattening. Text()
+// creates a dynamic text child, so the paths end one level below each span.
+func TestAssertStillStatic(t *testing.T) {
+	if err := AssertStillStatic("footer", div.New(span.Static("ok"))); err != nil {
+		t.Errorf("static tree should pass, got: %v", err)
+	}
+
+	tree := div.New(span.Static("ok"), div.New(span.Text("oops")), span.Text("again"))
+	err := AssertStillStatic("footer", tree)
+	if !errors.Is(err, ErrDynamicContent) {
+		t.Fatalf("dynamic tree should fail with ErrDynamicContent, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "[[1 0 0] [2 0]]") {
+		t.Errorf("error should list the path to each dynamic node, got: %v", err)
+	}
+}
+
+// TestGlobalFlattenSharesContent verifies that IDs flattening to the same
+// bytes share one copy, and that different content is kept apart.
+func TestGlobalFlattenSharesContent(t *testing.T) {
+	defer ResetFlatten()
+
+	Flatten("tenant:a:footer", div.New(span.Static("footer")))
+	Flatten("tenant:b:footer", div.New(span.Static("footer")))
+	other := Flatten("tenant:a:header", div.New(span.Static("header")))
+
+	stored := func(id string) []byte {
+		val, _ := flattened.Load(id)
+		return val.(*flatEntry).content //nolint:forcetypeassert // only *flatEntry is stored
+	}
+	if &stored("tenant:a:footer")[0] != &stored("tenant:b:footer")[0] {
+		t.Error("identical flattened content should share one backing array")
+	}
+	if &stored("tenant:a:footer")[0] == &stored("tenant:a:header")[0] || string(other) != "<div><span>header</span></div>" {
+		t.Errorf("different content should not be shared, got %q", other)
+	}
+}
+
+// TestGlobalFlattenReturnsCopy verifies that writing to the bytes Flatten
+// returns leaves the shared content, and so every other ID, untouched.
+func TestGlobalFlattenReturnsCopy(t *testing.T) {
+	defer ResetFlatten()
+
+	a := Flatten("copy:a", div.New(span.Static("footer")))
+	Flatten("copy:b", div.New(span.Static("footer")))
+	a[1] = 'X'
+
+	if got := string(Flatten("copy:b", nil)); got != "<div><span>footer</span></div>" {
+		t.Errorf("another ID's content should be unaffected, got %q", got)
+	}
+	if got := string(Flatten("copy:a", nil)); got != "<div><span>footer</span></div>" {
+		t.Errorf("the stored content should be unaffected, got %q", got)
+	}
+}
+
+// TestFlattenStrict verifies that a dynamic tree is an error rather than a
+// fallback render, and that a static one is stored and served like Flatten.
+func TestFlattenStrict(t *testing.T) {
+	defer ResetFlatten()
+
+	out, err := FlattenStrict("card", div.New(span.Text("Alice")))
+	if !errors.Is(err, ErrDynamicContent) || out != nil {
+		t.Errorf("dynamic tree should return ErrDynamicContent and no output, got %q, %v", out, err)
+	}
+	if !strings.Contains(err.Error(), "[[0 0]]") {
+		t.Errorf("error should give the path to the dynamic node, got %v", err)
+	}
+	if registered(Flattened, "card") {
+		t.Error("a dynamic tree should not be stored")
+	}
+
+	var w bytes.Buffer
+	if out, err := FlattenStrict("footer", div.New(span.Static("footer")), &w); err != nil || out != nil {
+		t.Errorf("static tree written to w should return nil, nil; got %q, %v", out, err)
+	}
+	if w.String() != "<div><span>footer</span></div>" {
+		t.Errorf("static tree wrote %q", w.String())
+	}
+	if got := string(Flatten("footer", nil)); got != w.String() {
+		t.Errorf("FlattenStrict should store under the ID Flatten reads, got %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package jit
+
+import "sync/atomic"
+
+// growthPeriod is the number of renders each learned growth adjustment is
+// judged over. Fewer and a single burst swings the factor; more and it
+// takes too long to respond to a template that changed.
+const growthPeriod = 100
+
+// growthStep is the percentage points the growth factor moves by per
+// period, so it settles over a few hundred renders rather than
+// oscillating.
+const growthStep = 5
+
+// maxGrowth bounds a learned growth factor. Past doubling, buffers are
+// mostly headroom, and a template that still outgrows them is better
+// served by SetPercentile or SetModes.
+const maxGrowth = 200
+
+// SetTargetOverflow adapts the growth factor so that about percent of
+// renders outgrow their predicted buffer, rather than fixing it at the
+// configured guess. The configured factor becomes the starting point;
+// every 100 renders in the baseline phase, the share that outgrew the
+// baseline is compared with percent. The factor rises by 5 points if more
+// outgrew it than targeted, and falls by 5 if fewer would have outgrown a
+// baseline 5 points lower, so a steady template settles rather than
+// swinging across the target. It stays between 100 and 200. Each change
+// rescales the current baseline at once, and Stats reports the factor in
+// use as Growth.
+//
+// A Compiler reports every render to a sizer with a target, not only
+// those deviating past CompilerCfg.Threshold, so that overflows are
+// counted. Configure starts learning again from its growth factor.
+// percent is clamped to 0-50; 0 turns learning off and returns to the
+// configured factor.
+func (as *AdaptiveSizer) SetTargetOverflow(percent int) {
+	var change baselineChange
+	defer as.report(&change)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	atomic.StoreInt64(&as.target, int64(min(max(percent, 0), 50)))
+	atomic.StoreInt64(&as.observed, 0)
+	atomic.StoreInt64(&as.overflows, 0)
+	atomic.StoreInt64(&as.tight, 0)
+	change = as.regrow(as.growthFactor)
+}
+
+// growth returns the growth factor in use: the learned one with
+// SetTargetOverflow, otherwise the configured one.
+func (as *AdaptiveSizer) growth() int {
+	if learned := atomic.LoadInt64(&as.learned); learned > 0 {
+		return int(learned)
+	}
+	return as.growthFactor
+}
+
+// learn counts whether size outgrew the baseline it was predicted with,
+// or would have outgrown one grown by growthStep less, and every
+// growthPeriod renders moves the growth factor towards the target
+// overflow rate. It is called before size updates the baseline.
+func (as *AdaptiveSizer) learn(size int) {
+	target := atomic.LoadInt64(&as.target)
+	if target == 0 || as.Active() {
+		return
+	}
+	baseline := atomic.LoadInt64(&as.baseline)
+	growth := int64(as.growth())
+	if int64(size) > baseline {
+		atomic.AddInt64(&as.overflows, 1)
+	}
+	if int64(size) > baseline*(growth-growthStep)/growth {
+		atomic.AddInt64(&as.tight, 1)
+	}
+	if atomic.AddInt64(&as.observed, 1)%growthPeriod != 0 {
+		return
+	}
+	rate := atomic.SwapInt64(&as.overflows, 0) * 100 / growthPeriod
+	lower := atomic.SwapInt64(&as.tight, 0) * 100 / growthPeriod
+
+	var change baselineChange
+	defer as.report(&change)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	switch growth := as.growth(); {
+	case rate > target:
+		change = as.regrow(min(growth+growthStep, maxGrowth))
+	case lower < target:
+		change = as.regrow(max(growth-growthStep, 100))
+	}
+}
+
+// regrow switches to growth factor next, rescaling the current baseline
+// from the factor it was grown by. The caller holds as.mu.
+func (as *AdaptiveSizer) regrow(next int) baselineChange {
+	growth := as.growth()
+	atomic.StoreInt64(&as.learned, int64(next))
+	baseline := atomic.LoadInt64(&as.baseline)
+	if next == growth || baseline == 0 || as.Active() {
+		return baselineChange{}
+	}
+	return as.setBaseline(baseline * int64(next) / int64(growth))
+}
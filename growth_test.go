@@ -0,0 +1,55 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestAdaptiveSizerTargetOverflow verifies that the growth factor rises
+// while renders outgrow the baseline, settles once they fit, and comes
+// down again when sizes shrink.
+func TestAdaptiveSizerTargetOverflow(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.MustConfigure(1, 50, 100)
+	as.SetTargetOverflow(5)
+	as.UpdateStats(1000)
+
+	for range 2 * growthPeriod {
+		as.UpdateStats(1100)
+	}
+	if st := as.Stats(); st.Growth != 110 || st.Baseline != 1100 {
+		t.Fatalf("renders 10%% over should raise the growth factor to 110, got %d (baseline %d)", st.Growth, st.Baseline)
+	}
+	for range 5 * growthPeriod {
+		as.UpdateStats(1100)
+	}
+	if got := as.Stats().Growth; got != 110 {
+		t.Errorf("a steady template should settle at 110, got %d", got)
+	}
+
+	for range growthPeriod {
+		as.UpdateStats(1000)
+	}
+	if got := as.Stats().Growth; got != 105 {
+		t.Errorf("smaller renders should lower the growth factor to 105, got %d", got)
+	}
+
+	as.SetTargetOverflow(0)
+	if got := as.Stats().Growth; got != 100 {
+		t.Errorf("turning learning off should restore the configured 100, got %d", got)
+	}
+}
+
+// TestCompilerTargetOverflow verifies that a Compiler feeds every render
+// to a learning sizer, including those within its threshold.
+func TestCompilerTargetOverflow(t *testing.T) {
+	jc := NewCompiler(&CompilerCfg{Threshold: 50, Max: 1, Variance: 50, GrowthFactor: 100, TargetOverflow: 5})
+	jc.Render(span.Text("x"))
+	for range growthPeriod {
+		jc.Render(span.Text("xx"))
+	}
+	if got := jc.SizerStats().Growth; got <= 100 {
+		t.Errorf("renders just past the baseline should raise the growth factor, got %d", got)
+	}
+}
@@ -0,0 +1,128 @@
+package jit
+
+import (
+	"slices"
+	"unique"
+	"unsafe"
+)
+
+// planSettings are a compiler's options that change how its plans are
+// built or rendered. They are applied to the root plan when it is compiled
+// and to each conditional sub-plan when that is compiled later, so a branch
+// first seen long after startup behaves like the rest of the plan.
+type planSettings struct {
+	mismatches *mismatchCounter // Report paths that fail to resolve, see CompilerCfg.SafeRender and SetMismatchHook
+	intern     bool             // Share identical static chunks, see CompilerCfg.InternStatic
+	minify     bool             // Minify static chunks, see CompilerCfg.Minify
+	pretty     bool             // Indent static chunks, see CompilerCfg.Pretty
+	raw        string           // Raw-text element open where the plan starts, for minify and pretty
+	depth      int              // Element nesting depth where the plan starts, for pretty
+	markup     *markupChecker   // Check static markup, see CompilerCfg.OnMarkupError
+	timeouts   *timeoutCounter  // Count Timeout nodes that miss their deadline, see CompilerStats
+	coalesce   bool             // Merge runs of dynamic siblings in the render layout, see CompilerCfg.CoalesceDynamic
+	maxDepth   int              // Deepest node a plan may compile, counted from the page root, see CompilerCfg.MaxDepth
+	nodeDepth  int              // Node depth where the plan starts, for maxDepth
+	base       *planBase        // Where a conditional sub-plan's root sits in the page, for CompileError paths
+}
+
+// planBase locates the root of a conditional branch's sub-plan in the
+// page, so a panic compiling the branch is reported with its full path.
+type planBase struct {
+	path []int    // Indices from the page root to the branch root
+	tags []string // Label of each node along path, excluding the branch root
+}
+
+// branch returns the base for the branches of a conditional at path,
+// labelled tags, in a plan based at b - nil for the page itself.
+func (b *planBase) branch(path []int, tags []string) *planBase {
+	if b == nil {
+		b = &planBase{}
+	}
+	// A branch root is the conditional's only child.
+	return &planBase{path: slices.Concat(b.path, path, []int{0}), tags: slices.Concat(b.tags, tags)}
+}
+
+// apply applies s to every element of the plan, including conditional
+// sub-plans that are already compiled. It must run before the plan is
+// published to other goroutines, since elements are read without
+// synchronisation.
+func (plan *ExecutionPlan) apply(s planSettings) {
+	// Minifying and interning replace static content, so the render layout
+	// is built once they are done, including when there is nothing to apply.
+	defer plan.layout(s.coalesce)
+	if s == (planSettings{}) {
+		return
+	}
+	raw := s.raw
+	// A plan that does not start at the top of the page follows the
+	// newline its parent wrote ahead of it.
+	pretty := prettyState{depth: s.depth, raw: s.raw}
+	for i, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			// Minify before interning so chunks that differ only in
+			// whitespace can share. Pretty output is laid out from
+			// scratch, so it replaces minifying.
+			if s.pretty {
+				var next CompiledElement
+				if i+1 < len(plan.Elements) {
+					next = plan.Elements[i+1]
+				}
+				el.Content = pretty.chunk(el.Content, next)
+				raw = pretty.raw
+			} else if s.minify {
+				el.Content, raw = minifyChunk(el.Content, raw)
+			}
+			if s.intern {
+				el.intern()
+			}
+		case *DynamicPath:
+			el.mismatches = s.mismatches
+			el.timeouts = s.timeouts
+			if el.OpenTag && len(el.Tags) > 0 {
+				// A DynamicAttr element's content is static and follows
+				// in the plan, so a raw-text element opens here.
+				tag := el.Tags[len(el.Tags)-1]
+				if slices.Contains(rawTextElements, tag) {
+					raw = tag
+					pretty.raw = tag
+				}
+				if !slices.Contains(voidElements, tag) {
+					pretty.depth++
+					pretty.afterOpen = true
+				}
+			}
+		case *ConditionalPath:
+			// A branch is a complete subtree, so whatever raw-text element
+			// is open here is still open where the branch starts.
+			s := s
+			s.raw, s.depth = raw, pretty.depth
+			s.nodeDepth += el.path.depth() + 1
+			el.settings = s
+			for i := range el.branches {
+				if sub := el.branches[i].Load(); sub != nil {
+					sub.apply(s)
+				}
+			}
+		}
+	}
+	if s.markup != nil {
+		s.markup.check(plan)
+	}
+}
+
+// intern replaces the chunk's bytes with a copy shared by every other
+// interned chunk holding the same bytes, across all compilers.
+//
+// The unique package keeps one canonical copy of each distinct string for
+// as long as any handle to it is alive, and drops it once none are - so
+// unlike a plain map, chunks from discarded compilers do not accumulate.
+// The chunk keeps its handle so the canonical copy stays shared for the
+// chunk's lifetime. The bytes are viewed in place rather than copied back
+// out of the string, which would undo the saving; static content is never
+// written to after compilation, so the read-only view is safe.
+func (sc *StaticContent) intern() {
+	sc.handle = unique.Make(string(sc.Content))
+	s := sc.handle.Value()
+	sc.Content = unsafe.Slice(unsafe.StringData(s), len(s))
+}
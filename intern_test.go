@@ -0,0 +1,62 @@
+package jit
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/header"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// firstChunk returns the first static chunk of the compiler's plan.
+func firstChunk(t *testing.T, c *Compiler) []byte {
+	t.Helper()
+	sc, ok := c.executionPlan.Load().Elements[0].(*StaticContent)
+	if !ok {
+		t.Fatal("plan should start with static content")
+	}
+	return sc.Content
+}
+
+// internPage is a page whose leading static chunk is the same for every
+// name, as a shared site header would be.
+func internPage(name string) node.Node {
+	return div.New(header.New(span.Static("Site")), span.Text(name))
+}
+
+// TestInternStaticSharesChunks verifies that two compilers with
+// InternStatic hold the same static chunk in one shared allocation.
+func TestInternStaticSharesChunks(t *testing.T) {
+	cfg := &CompilerCfg{Threshold: 15, Max: 5, Variance: 20, GrowthFactor: 115, InternStatic: true}
+	a := NewCompiler(cfg)
+	b := NewCompiler(cfg)
+	a.Render(internPage("Alice"))
+	b.Render(internPage("Bob"))
+
+	ca, cb := firstChunk(t, a), firstChunk(t, b)
+	if string(ca) != string(cb) {
+		t.Fatalf("test pages should share their first chunk: %q vs %q", ca, cb)
+	}
+	if unsafe.SliceData(ca) != unsafe.SliceData(cb) {
+		t.Error("identical chunks should share one allocation when interned")
+	}
+
+	if got := string(b.Render(internPage("Carol"))); got != "<div><header><span>Site</span></header><span>Carol</span></div>" {
+		t.Errorf("interned plan should render normally, got %q", got)
+	}
+}
+
+// TestInternStaticOffByDefault verifies that compilers without the option
+// keep their own copies.
+func TestInternStaticOffByDefault(t *testing.T) {
+	a := NewCompiler()
+	b := NewCompiler()
+	a.Render(internPage("Alice"))
+	b.Render(internPage("Bob"))
+
+	if unsafe.SliceData(firstChunk(t, a)) == unsafe.SliceData(firstChunk(t, b)) {
+		t.Error("chunks should not be shared unless InternStatic is set")
+	}
+}
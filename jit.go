@@ -2,7 +2,7 @@ package jit
 
 import (
 	"errors"
-	"slices"
+	"time"
 
 	"github.com/jpl-au/fluent/node"
 )
@@ -21,12 +21,310 @@ var ErrDynamicContent = errors.New("NewFlattener() requires static content - use
 // the correct nodes - producing truncated or incorrect output.
 var ErrStructureMismatch = errors.New("node tree structure does not match the compiled execution plan")
 
+// ErrNotCompiled is returned when an operation needs a compiled execution
+// plan but the compiler has not rendered yet.
+var ErrNotCompiled = errors.New("compiler has no execution plan yet - call Render first")
+
+// ErrUnfillableSlot is returned by Compiler.RenderFromMap when the plan has
+// dynamic content that a map of strings cannot supply.
+var ErrUnfillableSlot = errors.New("dynamic slot cannot be filled from a map")
+
+// ErrMalformedMarkup is wrapped by each problem reported to
+// CompilerCfg.OnMarkupError.
+var ErrMalformedMarkup = errors.New("malformed static markup")
+
+// ErrBadArtifact is returned by LoadArtifact for a file that is not a
+// complete artifact written by ExportArtifact.
+var ErrBadArtifact = errors.New("invalid plan artifact")
+
+// ErrDynamicTimeout is wrapped by a TimeoutError for a Timeout node that
+// missed its deadline.
+var ErrDynamicTimeout = errors.New("dynamic content timed out")
+
+// ErrCompilePanic is wrapped by a CompileError, the panic value when a
+// node panics while a plan is compiled.
+var ErrCompilePanic = errors.New("node panicked during compile")
+
+// ErrBuildPanic is wrapped by the error when a builder func panics: the
+// one given to NewVariantFlattener, NewRefreshingFlattener or
+// NewTypedCompiler, or the flattening or compiling of the tree it
+// returned. Nothing is kept from a build that panicked, so the next
+// request or refresh builds again.
+var ErrBuildPanic = errors.New("builder panicked")
+
+// ErrRenderPanic is wrapped by the error passed to CompilerCfg.OnPanic
+// when a compiled render panics and falls back to standard rendering.
+var ErrRenderPanic = errors.New("compiled render panicked")
+
+// ErrTreeTooDeep is wrapped by the CompileError value when a tree being
+// compiled nests deeper than CompilerCfg.MaxDepth.
+var ErrTreeTooDeep = errors.New("node tree nested too deeply to compile")
+
+// DefaultMaxDepth is the deepest a node may be nested in a compiled tree
+// unless CompilerCfg.MaxDepth says otherwise. Browser HTML parsers stop
+// nesting elements after a few hundred levels, so real pages stay well
+// inside it.
+const DefaultMaxDepth = 1024
+
+// ErrMostlyDynamic is wrapped by the error passed to
+// CompilerCfg.OnMostlyDynamic for a template whose output is mostly
+// dynamic.
+var ErrMostlyDynamic = errors.New("template is mostly dynamic - a Tuner would serve it with less overhead")
+
+// ErrSegmentPanic is wrapped by a SegmentError whose dynamic element
+// panicked during Compiler.RenderSegments.
+var ErrSegmentPanic = errors.New("dynamic element panicked")
+
+// ErrEncodingUnavailable is returned by Flattener.RenderCompressed for a
+// content encoding the flattener holds no variant of.
+var ErrEncodingUnavailable = errors.New("flattener has no variant in the requested content encoding")
+
+// ErrInvalidSizing is wrapped by the error ValidateSizing,
+// CompilerCfg.Validate and TunerCfg.Validate return, and the Must
+// variants of Configure, CompileConfig and TuneConfig panic with, for a
+// sample count, variance or growth factor that is not positive.
+var ErrInvalidSizing = errors.New("invalid adaptive sizing parameters")
+
+// ErrNotRegistered is reported by Rebuild for an ID that none of the
+// selected registries hold.
+var ErrNotRegistered = errors.New("template is not registered")
+
+// FlattenerCfg holds configuration for NewFlattener.
+type FlattenerCfg struct {
+	// Gzip compresses the flattened bytes once, when the flattener is
+	// created, so RenderCompressed can serve Content-Encoding: gzip
+	// without compressing on each request.
+	Gzip bool
+	// GzipLevel is the compression level (default gzip.BestCompression,
+	// since the cost is paid once).
+	GzipLevel int
+	// Encoders adds variants in other content encodings, keyed by the
+	// Content-Encoding name, such as "br". Each is run once over the
+	// flattened bytes. The standard library has no brotli encoder, so it
+	// is plugged in here rather than the package depending on one.
+	Encoders map[string]Encoder
+	// Transforms run in order over the rendered bytes, once, before the
+	// ETag and compressed variants are made from the result - to minify
+	// (see MinifyHTML), strip comments, or rewrite asset URLs to hashed
+	// CDN paths. A transform's error fails NewFlattener.
+	Transforms []Transform
+	// CacheControl is sent as the Cache-Control header by ServeHTTP and
+	// ServeNegotiated, keeping the cache policy with the content it
+	// covers, such as "public, max-age=3600". Empty sends none.
+	CacheControl string
+	// LastModified is sent as the Last-Modified header and compared with
+	// If-Modified-Since. Zero uses LastRendered, which moves on Rebuild;
+	// set it to when the page's source last changed, such as a build time,
+	// for a date that stays put across restarts.
+	LastModified time.Time
+}
+
+// Transform rewrites flattened content for FlattenerCfg.Transforms. It
+// may modify content in place and return it.
+type Transform func(content []byte) ([]byte, error)
+
+// Encoder compresses flattened content for FlattenerCfg.Encoders.
+//
+// Example, with github.com/andybalholm/brotli:
+//
+//	func(plain []byte) ([]byte, error) {
+//	    var buf bytes.Buffer
+//	    bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+//	    bw.Write(plain)
+//	    err := bw.Close()
+//	    return buf.Bytes(), err
+//	}
+type Encoder func(plain []byte) ([]byte, error)
+
 // CompilerCfg holds configuration for JIT compiler instances.
 type CompilerCfg struct {
 	Threshold    int // deviation threshold percentage for conditional stats updates
 	Max          int // samples before establishing baseline
 	Variance     int // threshold percentage for detecting size changes
 	GrowthFactor int // multiplier percentage for average size
+	Percentile   int // baseline from this percentile of samples rather than the mean, see AdaptiveSizer.SetPercentile
+	EWMA         int // weight percentage of each render in a moving-average baseline, see AdaptiveSizer.SetEWMA
+	Trim         int // percentage of samples dropped from each end before averaging, see AdaptiveSizer.SetTrim
+	Window       int // renders in a sliding window the baseline is recomputed from, see AdaptiveSizer.SetWindow
+	MinBaseline  int // smallest buffer capacity the sizer will predict once sampled, see AdaptiveSizer.SetMinBaseline
+	MaxBaseline  int // largest buffer capacity the sizer will predict, see AdaptiveSizer.SetMaxBaseline
+	Modes        int // size clusters tracked instead of one baseline, see AdaptiveSizer.SetModes
+
+	InitialBaseline int // buffer capacity to start from, skipping sampling, see AdaptiveSizer.SetInitialBaseline
+
+	TargetOverflow int // percentage of renders the learned growth factor lets outgrow their buffer, see AdaptiveSizer.SetTargetOverflow
+
+	Cooldown       int           // renders a new baseline is held before it may resample, see AdaptiveSizer.SetCooldown
+	CooldownPeriod time.Duration // time a new baseline is held before it may resample, see AdaptiveSizer.SetCooldown
+
+	RefreshEvery  int           // renders after which the baseline is resampled regardless, see AdaptiveSizer.SetRefresh
+	RefreshPeriod time.Duration // time after which the baseline is resampled regardless, see AdaptiveSizer.SetRefresh
+
+	// OnBaselineChange, if set, is called with the old and new baseline
+	// each time the sizer settles on a different one. It runs on the
+	// rendering goroutine, so it must be fast and safe for concurrent use.
+	// See AdaptiveSizer.OnBaselineChange.
+	OnBaselineChange func(old, new int)
+
+	SizeHistogram bool // record a histogram of render sizes, see AdaptiveSizer.SetHistogram
+
+	// Sizing, if set, is called once per compiler, and once per Clone, for
+	// the SizingStrategy that sizes its buffers in place of its own
+	// AdaptiveSizer. Max, Variance, GrowthFactor, Percentile, EWMA, Trim,
+	// Window, MinBaseline, MaxBaseline, Modes, InitialBaseline,
+	// TargetOverflow, Cooldown, CooldownPeriod, RefreshEvery,
+	// RefreshPeriod, OnBaselineChange and SizeHistogram are then unused.
+	// A strategy other than an AdaptiveSizer observes every render rather
+	// than only those deviating past Threshold, since it applies its own
+	// policy. See SharedSizer to pool one sizer across compilers.
+	Sizing func() SizingStrategy
+
+	// SeparateByteSizing gives renders that return their output - Render
+	// without a writer, and AppendRender - a sizer of their own, so an
+	// application rendering fragments to bytes and full pages to writers
+	// keeps a baseline for each rather than one that resamples as they
+	// alternate. Both sizers share the cfg's parameters. With Sizing, it is
+	// called once more for the second sizer; SharedSizer returns the same
+	// one, so the paths are then pooled again.
+	SeparateByteSizing bool
+
+	// FixedSize, if above zero, is the buffer capacity every render starts
+	// with. The adaptive sizer is bypassed entirely - no samples are taken
+	// and no deviation is checked - which saves that work on every render
+	// of a template whose output size is known and stable. Threshold, Max,
+	// Variance and GrowthFactor are then unused.
+	FixedSize int
+
+	// SafeRender counts dynamic paths that fail to resolve at render time
+	// instead of skipping them silently. See Compiler.Stats.
+	SafeRender bool
+	// OnMismatch, if set with SafeRender, is called with an error wrapping
+	// ErrStructureMismatch for each path that fails to resolve. It runs on
+	// the rendering goroutine, so it must be fast and safe for concurrent use.
+	OnMismatch func(err error)
+
+	// RecoverPanics catches a panic from the compiled render, discards the
+	// partial output and renders the tree the standard way instead, so the
+	// response still completes when the plan and tree disagree. It covers
+	// Render, AppendRender, Reader, RenderContext, RenderFragment,
+	// RenderPretty, Preview, spilled renders and the page RenderStream
+	// writes before its chunks. RenderSegments and streamed chunks report
+	// panics as SegmentErrors whether or not it is set. Each one recovered
+	// is counted in Compiler.Stats. A panic that recurs in the standard
+	// render is not caught.
+	RecoverPanics bool
+	// OnPanic, if set with RecoverPanics, is called with an error wrapping
+	// ErrRenderPanic for each recovered panic, on the rendering goroutine.
+	// With BackgroundCompile it also receives the *CompileError from a
+	// background compile that panicked.
+	OnPanic func(err error)
+
+	// BackgroundCompile keeps the first compile out of the request path:
+	// until the plan is ready, renders use the tree's standard rendering
+	// while the first of them compiles the plan on another goroutine. The
+	// tree is compiled while that request is still rendering it, so its
+	// components must be safe to render concurrently. If compiling panics
+	// the error goes to OnPanic and a later render tries again.
+	BackgroundCompile bool
+
+	// InternStatic shares static chunks that are byte-for-byte identical
+	// across every compiler with this set, so a header or footer that many
+	// templates compile to the same chunk is held in memory once. Chunks are
+	// split at dynamic content, so only templates whose markup matches up to
+	// the same dynamic node produce identical chunks.
+	InternStatic bool
+
+	// Minify collapses whitespace and strips comments in static content
+	// when the plan is compiled, so every render emits smaller output at no
+	// per-render cost. Content of pre, textarea, script and style is left
+	// untouched, as is dynamic content.
+	Minify bool
+
+	// MaxDepth is the deepest a node may be nested, counting from the root,
+	// before compiling panics with a CompileError wrapping ErrTreeTooDeep.
+	// It guards against generated trees, such as deeply nested rich text,
+	// that would otherwise exhaust the stack while rendering. Zero uses
+	// DefaultMaxDepth.
+	MaxDepth int
+
+	// Pretty lays out static content one tag per line, indented by
+	// nesting, when the plan is compiled, so view-source is readable during
+	// development. Dynamic content starts on its own line at its depth and
+	// is not reformatted. Text is trimmed, which can change spacing between
+	// inline elements, so leave this off in production. Overrides Minify.
+	Pretty bool
+
+	// CoalesceDynamic merges dynamic siblings with nothing but static
+	// content between them, such as interpolated text or a list of
+	// components inside one element, into one render step that finds their
+	// parent once and renders each child in turn, instead of walking the
+	// full path to every one. It only changes how the plan is laid out for
+	// rendering; the output is the same.
+	CoalesceDynamic bool
+
+	// SlotEscaping sets how Compiler.RenderFromMap escapes the value for
+	// each named slot. Slots not listed are HTML-escaped.
+	SlotEscaping map[string]Escaping
+
+	// OnMarkupError, if set, checks the static markup of each plan when it
+	// is compiled and is called with an error wrapping ErrMalformedMarkup
+	// for each problem found: unbalanced tags, elements such as form or a
+	// nested inside themselves, and duplicate ids. Content that is dynamic
+	// is not checked, and each conditional branch is checked on its own
+	// when it is first compiled.
+	OnMarkupError func(err error)
+
+	// OnLint, if set, runs the lints added with RegisterLint over each
+	// template when it is compiled, and is called with each issue found.
+	// Without it registered lints do not run.
+	OnLint func(issue Issue)
+
+	// SpillThreshold, if above zero, bounds the memory a render to a
+	// writer holds: once this many bytes are buffered they are moved to a
+	// temporary file, which is copied to the writer when the render
+	// completes. Meant for export-style pages of tens of megabytes. Renders
+	// that return bytes are unaffected.
+	SpillThreshold int
+	// SpillDir is the directory for spill files (default os.TempDir).
+	SpillDir string
+
+	// PoolStats counts buffer pool hits, misses and resizes for renders to
+	// a writer, read back with Compiler.PoolStats. Off by default, as it
+	// adds atomic counters to every render.
+	PoolStats bool
+
+	// LocalPool gives the compiler its own pool of buffers for renders to a
+	// writer, sized to its own output, instead of Fluent's pool shared by
+	// every template. Buffers grown by a large page are then never handed
+	// to a small one, nor small ones to a page that immediately outgrows
+	// them. A buffer more than twice the predicted size is not kept.
+	LocalPool bool
+
+	// Latency records each render's time in a histogram, read back with
+	// Compiler.Latency or, across the registry, CompiledLatency. Off by
+	// default, as it reads the clock twice per render.
+	Latency bool
+
+	// MinStaticRatio, if above zero, is the percentage of a compiled
+	// template's output that should be static. A template below it gains
+	// little from a plan, since most of each render is still evaluated from
+	// the tree, and a Tuner serves it with less overhead. Each plan below
+	// the ratio is reported to OnMostlyDynamic and flagged in
+	// Compiler.Stats. The ratio is measured on the render that compiles the
+	// plan.
+	MinStaticRatio int
+	// OnMostlyDynamic, if set with MinStaticRatio, is called with an error
+	// wrapping ErrMostlyDynamic when a plan is compiled below the ratio.
+	OnMostlyDynamic func(err error)
+
+	// OnTimeout, if set, is called with a *TimeoutError for each Timeout
+	// node that misses its deadline, reporting whether a shared last good
+	// output was served. Like OnMismatch it runs on the rendering goroutine.
+	OnTimeout func(err error)
+
+	// Surrogate sets the cache surrogate keys written by RenderRequest and
+	// SetSurrogateKeys.
+	Surrogate SurrogateCfg
 }
 
 // TunerCfg holds configuration for JIT tuner instances.
@@ -34,19 +332,112 @@ type TunerCfg struct {
 	Max          int // samples before establishing baseline
 	Variance     int // threshold percentage for detecting size changes
 	GrowthFactor int // multiplier percentage for average size
+	Percentile   int // baseline from this percentile of samples rather than the mean, see AdaptiveSizer.SetPercentile
+	EWMA         int // weight percentage of each render in a moving-average baseline, see AdaptiveSizer.SetEWMA
+	Trim         int // percentage of samples dropped from each end before averaging, see AdaptiveSizer.SetTrim
+	Window       int // renders in a sliding window the baseline is recomputed from, see AdaptiveSizer.SetWindow
+	MinBaseline  int // smallest buffer capacity the sizer will predict once sampled, see AdaptiveSizer.SetMinBaseline
+	MaxBaseline  int // largest buffer capacity the sizer will predict, see AdaptiveSizer.SetMaxBaseline
+	Modes        int // size clusters tracked instead of one baseline, see AdaptiveSizer.SetModes
+
+	InitialBaseline int // buffer capacity to start from, skipping sampling, see AdaptiveSizer.SetInitialBaseline
+
+	TargetOverflow int // percentage of renders the learned growth factor lets outgrow their buffer, see AdaptiveSizer.SetTargetOverflow
+
+	Cooldown       int           // renders a new baseline is held before it may resample, see AdaptiveSizer.SetCooldown
+	CooldownPeriod time.Duration // time a new baseline is held before it may resample, see AdaptiveSizer.SetCooldown
+
+	RefreshEvery  int           // renders after which the baseline is resampled regardless, see AdaptiveSizer.SetRefresh
+	RefreshPeriod time.Duration // time after which the baseline is resampled regardless, see AdaptiveSizer.SetRefresh
+
+	OnBaselineChange func(old, new int) // called with the old and new baseline on each change, see CompilerCfg.OnBaselineChange
+
+	SizeHistogram bool // record a histogram of render sizes, see AdaptiveSizer.SetHistogram
+
+	SpillThreshold int    // bytes buffered before spilling to a temporary file, see CompilerCfg.SpillThreshold
+	SpillDir       string // directory for spill files (default os.TempDir)
+
+	PoolStats bool // count buffer pool hits, misses and resizes, see CompilerCfg.PoolStats
+
+	Sizing func() SizingStrategy // custom buffer sizing in place of the AdaptiveSizer, see CompilerCfg.Sizing
+}
+
+// SizingStrategy decides the buffer capacity a render starts with. The
+// AdaptiveSizer is the default; an application with better knowledge of
+// its output - a fixed size per route, a percentile from its own metrics,
+// a model's prediction - supplies its own through CompilerCfg.Sizing or
+// TunerCfg.Sizing, and the Compiler and Tuner use nothing else.
+//
+// Both methods are called from every render, concurrently, so they must
+// be safe for concurrent use, and Baseline should be cheap. A strategy
+// that also has a Reset method is reset by Tuner.Reset.
+type SizingStrategy interface {
+	// Observe reports the size of a finished render.
+	Observe(size int)
+	// Baseline returns the capacity to start the next render with, or 0
+	// for no preallocation.
+	Baseline() int
+}
+
+// BudgetCfg holds configuration for a Budget.
+type BudgetCfg struct {
+	Limit          int64 // bytes that flattened output and compiled plans may hold in total
+	Interval       int   // renders between automatic rebalances (default 1000)
+	MinStaticRatio int   // percentage of output that must be static before a template is compiled (default 50)
+}
+
+// SurrogateCfg holds configuration for the surrogate keys a compiler
+// writes to responses, which CDNs use to purge every page carrying a key.
+// The defaults suit Fastly; for Cloudflare use Header "Cache-Tag" and
+// Separator ",".
+type SurrogateCfg struct {
+	Header    string   // response header (default "Surrogate-Key")
+	Separator string   // between keys in the header (default " ")
+	Keys      []string // keys added to every response, such as the template's name
+}
+
+// StreamCfg holds configuration for Compiler.RenderStream.
+type StreamCfg struct {
+	Nonce string // Content-Security-Policy nonce for the inline swap scripts
+}
+
+// BulkCfg holds configuration for registry-wide operations: Warm,
+// BuildAll, FlattenAll, Rebuild, Prune, ExportSite and SiteFS.
+type BulkCfg struct {
+	Concurrency int // maximum templates processed at once (default GOMAXPROCS)
 }
 
 // isDynamicNode reports whether a single node contains dynamic content
 // that requires runtime evaluation and cannot be pre-rendered.
+//
+// Only a node's own report decides, so the node kinds that carry literal
+// markup are classified as follows:
+//
+//   - The doctype is written by html.New's opening tag, and is frozen with
+//     it like any other tag.
+//   - Comments have no node of their own in Fluent; written with
+//     text.Static, or by any node that does not implement node.Dynamic,
+//     they are frozen as static content.
+//   - text.RawText is raw HTML supplied per render, which Fluent marks
+//     dynamic. It is evaluated on every render: freezing it would serve the
+//     first request's HTML to every later one. Constant raw HTML belongs in
+//     text.Static, which is never escaped either.
 func isDynamicNode(n node.Node) bool {
 	d, ok := n.(node.Dynamic)
 	return ok && d.IsDynamic()
 }
 
 // isDynamic reports whether a node or any of its descendants contain dynamic content.
+// It uses an explicit stack so a very deep tree cannot exhaust the goroutine stack.
 func isDynamic(n node.Node) bool {
-	if isDynamicNode(n) {
-		return true
+	stack := []node.Node{n}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if isDynamicNode(n) {
+			return true
+		}
+		stack = append(stack, n.Nodes()...)
 	}
-	return slices.ContainsFunc(n.Nodes(), isDynamic)
+	return false
 }
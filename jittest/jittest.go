@@ -0,0 +1,69 @@
+// Package jittest provides test helpers for locking in the allocation
+// behaviour of Fluent JIT render paths, and a deterministic Sizer for
+// tests that assert buffer sizing.
+//
+// Avoiding allocations is the point of compiling, tuning and flattening, so
+// a change that quietly adds one to a hot path is a regression even when
+// the output is still correct. These helpers turn that into a failing test:
+//
+//	func TestHomePageAllocs(t *testing.T) {
+//	    compiler := jit.NewCompiler()
+//	    jittest.AssertCompileAllocs(t, compiler, HomePage(sample), 0)
+//	}
+package jittest
+
+import (
+	"io"
+	"testing"
+
+	jit "github.com/jpl-au/fluent-jit"
+	"github.com/jpl-au/fluent/node"
+)
+
+// runs is how many times each measurement calls fn. testing.AllocsPerRun
+// averages over the runs, so one-off allocations such as a pool being
+// filled do not dominate the result.
+const runs = 100
+
+// warmups is how many renders happen before measuring. It must exceed the
+// adaptive sizer's default sample count so the baseline is established and
+// buffers are sized, otherwise the measurement includes the sampling phase.
+const warmups = 10
+
+// AssertMaxAllocs fails t if fn allocates more than n times per call on
+// average.
+func AssertMaxAllocs(t testing.TB, fn func(), n float64) {
+	t.Helper()
+	if got := testing.AllocsPerRun(runs, fn); got > n {
+		t.Errorf("expected at most %v allocations per call, got %v", n, got)
+	}
+}
+
+// AssertCompileAllocs fails t if rendering root through c to a writer
+// allocates more than n times per render once the plan is compiled and
+// buffer sizing has settled.
+func AssertCompileAllocs(t testing.TB, c *jit.Compiler, root node.Node, n float64) {
+	t.Helper()
+	for range warmups {
+		c.Render(root, io.Discard)
+	}
+	AssertMaxAllocs(t, func() { c.Render(root, io.Discard) }, n)
+}
+
+// AssertTuneAllocs fails t if rendering root through tuner to a writer
+// allocates more than n times per render once buffer sizing has settled.
+func AssertTuneAllocs(t testing.TB, tuner *jit.Tuner, root node.Node, n float64) {
+	t.Helper()
+	tuner.Tune(root)
+	for range warmups {
+		tuner.Render(io.Discard)
+	}
+	AssertMaxAllocs(t, func() { tuner.Render(io.Discard) }, n)
+}
+
+// AssertFlattenAllocs fails t if writing f's output allocates more than n
+// times per render.
+func AssertFlattenAllocs(t testing.TB, f *jit.Flattener, n float64) {
+	t.Helper()
+	AssertMaxAllocs(t, func() { f.Render(io.Discard) }, n)
+}
@@ -0,0 +1,119 @@
+package jittest
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	jit "github.com/jpl-au/fluent-jit"
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// These tests lock in the package's allocation guarantees for each render
+// path. A failure here means a change added allocations to a hot path.
+
+// TestCompileRenderAllocs verifies that a compiled render of a reused tree
+// does not allocate once the plan is built and buffer sizing has settled.
+func TestCompileRenderAllocs(t *testing.T) {
+	tree := div.New(p.Static("Welcome back"), span.Text("Alice"))
+	AssertCompileAllocs(t, jit.NewCompiler(), tree, 0)
+}
+
+// TestTuneRenderAllocs verifies that a tuned render does not allocate once
+// buffer sizing has settled.
+func TestTuneRenderAllocs(t *testing.T) {
+	tree := div.New(p.Static("Welcome back"), span.Text("Alice"))
+	AssertTuneAllocs(t, jit.NewTuner(), tree, 0)
+}
+
+// TestFlattenRenderAllocs verifies that writing flattened content does not
+// allocate - it is a single write of stored bytes.
+func TestFlattenRenderAllocs(t *testing.T) {
+	f, err := jit.NewFlattener(div.New(p.Static("Footer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertFlattenAllocs(t, f, 0)
+}
+
+// failRecorder captures failures from an assertion under test so they do
+// not fail the enclosing test.
+type failRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *failRecorder) Helper()               {}
+func (r *failRecorder) Errorf(string, ...any) { r.failed = true }
+
+// TestAssertMaxAllocsFails verifies that the guard actually fails when the
+// limit is exceeded, so the tests above are not vacuous.
+func TestAssertMaxAllocsFails(t *testing.T) {
+	var sink []node.Node
+	rec := &failRecorder{TB: t}
+	AssertMaxAllocs(rec, func() { sink = make([]node.Node, 8) }, 0)
+	_ = sink
+	if !rec.failed {
+		t.Error("allocating function should fail a limit of 0")
+	}
+}
+
+// TestAppendRenderAllocs verifies that appending a compiled render to a
+// slice that already has room does not allocate.
+func TestAppendRenderAllocs(t *testing.T) {
+	tree := div.New(p.Static("Welcome back"), span.Text("Alice"))
+	compiler := jit.NewCompiler()
+	dst := make([]byte, 0, 4096)
+	for range 10 {
+		dst = compiler.AppendRender(dst[:0], tree)
+	}
+	AssertMaxAllocs(t, func() { dst = compiler.AppendRender(dst[:0], tree) }, 0)
+}
+
+// TestSizer verifies that concurrent renders are all recorded while the
+// prediction stays where the test put it.
+func TestSizer(t *testing.T) {
+	s := NewSizer(4096)
+	compiler := jit.NewCompiler(&jit.CompilerCfg{Sizing: jit.SharedSizer(s)})
+	tree := div.New(span.Text("Alice"))
+	compiler.Render(tree)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() { compiler.Render(tree) })
+	}
+	wg.Wait()
+
+	if got := len(s.Observed()); got != 10 {
+		t.Errorf("want the compile and 9 renders observed, got %d", got)
+	}
+	if got := compiler.SizerStats().Baseline; got != 4096 {
+		t.Errorf("observed sizes should not move the baseline, got %d", got)
+	}
+	s.SetBaseline(64)
+	if got := compiler.SizerStats().Baseline; got != 64 {
+		t.Errorf("SetBaseline should set the prediction, got %d", got)
+	}
+	s.Reset()
+	if len(s.Observed()) != 0 {
+		t.Error("Reset should forget the observed sizes")
+	}
+}
+
+// TestReplay verifies that replaying sizes shows each baseline the
+// adaptive sizer passes through.
+func TestReplay(t *testing.T) {
+	as := jit.NewAdaptiveSizer()
+	as.MustConfigure(2, 20, 100)
+	got := Replay(as, []int{100, 300, 200, 1000})
+	want := []int{0, 200, 200, 200}
+	if !slices.Equal(got, want) {
+		t.Errorf("want baselines %v, got %v", want, got)
+	}
+	if !as.Active() {
+		t.Error("the 1000 byte render should have restarted sampling")
+	}
+}
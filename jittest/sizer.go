@@ -0,0 +1,87 @@
+package jittest
+
+import (
+	"slices"
+	"sync"
+
+	jit "github.com/jpl-au/fluent-jit"
+)
+
+// Sizer is a deterministic jit.SizingStrategy for tests that assert buffer
+// behaviour. Its baseline changes only when the test sets it, whatever
+// sizes are observed or in what order, so concurrent renders cannot move
+// a prediction under an assertion. Every observed size is recorded in
+// arrival order for inspection, and can be replayed into a real
+// AdaptiveSizer in whatever order the test chooses to check its phase
+// transitions.
+//
+// Install it with jit.SharedSizer, which hands the same Sizer to every
+// compiler, clone and tuner given the cfg:
+//
+//	s := jittest.NewSizer(4096)
+//	c := jit.NewCompiler(&jit.CompilerCfg{Sizing: jit.SharedSizer(s)})
+//
+// A compiler reports every render to a strategy other than an
+// AdaptiveSizer, and one extra size when it compiles a plan.
+type Sizer struct {
+	mu       sync.Mutex
+	baseline int
+	observed []int
+}
+
+// NewSizer returns a Sizer predicting baseline bytes for every render.
+func NewSizer(baseline int) *Sizer {
+	return &Sizer{baseline: baseline}
+}
+
+// Baseline returns the baseline last set, implementing jit.SizingStrategy.
+func (s *Sizer) Baseline() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.baseline
+}
+
+// Observe records size, implementing jit.SizingStrategy. It never
+// changes the baseline.
+func (s *Sizer) Observe(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observed = append(s.observed, size)
+}
+
+// SetBaseline sets the baseline every later render is predicted with.
+func (s *Sizer) SetBaseline(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.baseline = n
+}
+
+// Observed returns a copy of the sizes observed since NewSizer or the
+// last Reset, in the order they arrived.
+func (s *Sizer) Observed() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.observed)
+}
+
+// Reset forgets the observed sizes, keeping the baseline. Tuner.Reset
+// calls it.
+func (s *Sizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observed = nil
+}
+
+// Replay feeds sizes to as one at a time, in order, and returns the
+// baseline after each, so a test can assert exactly when the sizer
+// leaves sampling and what it settles on. Pass Observed, sorted or
+// reordered as the test needs, to replay what concurrent renders
+// produced in a fixed order.
+func Replay(as *jit.AdaptiveSizer, sizes []int) []int {
+	baselines := make([]int, len(sizes))
+	for i, size := range sizes {
+		as.UpdateStats(size)
+		baselines[i] = as.GetBaseline()
+	}
+	return baselines
+}
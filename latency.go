@@ -0,0 +1,148 @@
+package jit
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyStats summarises a compiler's render times, read with
+// Compiler.Latency. Quantiles are taken from a histogram with eight buckets
+// per power of two, so each is reported as the upper bound of its bucket -
+// at most 12.5% above the true value - rather than an exact time.
+type LatencyStats struct {
+	Count int64         // Renders recorded
+	P50   time.Duration // Median render time
+	P90   time.Duration // 90th percentile
+	P99   time.Duration // 99th percentile
+	Max   time.Duration // Slowest render recorded, exact
+}
+
+// Latency returns a summary of the compiler's render times. They are only
+// recorded when CompilerCfg.Latency is set, and are zero otherwise.
+//
+// The time recorded is from the start of executing the plan to the end,
+// so it covers evaluating dynamic content but not compiling the plan or
+// writing the output to the writer, which depends on the client.
+func (jc *Compiler) Latency() LatencyStats {
+	return jc.latency.stats()
+}
+
+// CompiledLatency returns the render latency of every template in the
+// global Compile registry that records it, keyed by template ID.
+func CompiledLatency() map[string]LatencyStats {
+	all := make(map[string]LatencyStats)
+	compilers.Range(func(key, val any) bool {
+		id := key.(string)          //nolint:forcetypeassert // only string IDs are stored
+		compiler := val.(*Compiler) //nolint:forcetypeassert // only *Compiler is stored
+		if compiler.latency != nil {
+			all[id] = compiler.Latency()
+		}
+		return true
+	})
+	return all
+}
+
+const (
+	// latencySubBits is log2 of the buckets per power of two.
+	latencySubBits = 3
+	latencySub     = 1 << latencySubBits
+	// latencyBuckets covers durations up to 2^40ns, about eighteen
+	// minutes; anything slower is counted in the last bucket.
+	latencyBuckets = (40-latencySubBits+1)*latencySub + latencySub
+)
+
+// latencyHistogram counts render times in logarithmic buckets, HDR-style:
+// each power of two is split into latencySub linear buckets, so the
+// relative error is the same at every scale and recording is a few bit
+// operations and one atomic add. A nil histogram records nothing, so
+// compilers without CompilerCfg.Latency pay only a nil check.
+type latencyHistogram struct {
+	buckets [latencyBuckets]atomic.Int64
+	count   atomic.Int64
+	max     atomic.Int64
+}
+
+// start returns the time a render began, or the zero time if h is nil so
+// that the clock is not read for nothing.
+func (h *latencyHistogram) start() time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe records the time since start.
+func (h *latencyHistogram) observe(start time.Time) {
+	if h == nil {
+		return
+	}
+	ns := max(int64(time.Since(start)), 0)
+	h.buckets[latencyBucket(uint64(ns))].Add(1)
+	h.count.Add(1)
+	for {
+		cur := h.max.Load()
+		if ns <= cur || h.max.CompareAndSwap(cur, ns) {
+			return
+		}
+	}
+}
+
+// stats summarises the histogram. Renders recorded while it runs may be
+// missing from some quantiles and not others, which is fine for a summary.
+func (h *latencyHistogram) stats() LatencyStats {
+	if h == nil {
+		return LatencyStats{}
+	}
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		total += counts[i]
+	}
+	maxNs := time.Duration(h.max.Load())
+	quantile := func(q float64) time.Duration {
+		if total == 0 {
+			return 0
+		}
+		rank := int64(q*float64(total-1)) + 1
+		var seen int64
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				return min(time.Duration(latencyUpper(i)), maxNs)
+			}
+		}
+		return maxNs
+	}
+	return LatencyStats{
+		Count: h.count.Load(),
+		P50:   quantile(0.50),
+		P90:   quantile(0.90),
+		P99:   quantile(0.99),
+		Max:   maxNs,
+	}
+}
+
+// latencyBucket returns the bucket for ns. Values below latencySub get a
+// bucket each; above that, the bucket is the power of two plus the next
+// latencySubBits bits below the leading one.
+func latencyBucket(ns uint64) int {
+	if ns < latencySub {
+		return int(ns)
+	}
+	exp := bits.Len64(ns) - 1
+	sub := int(ns>>(exp-latencySubBits)) & (latencySub - 1)
+	return min((exp-latencySubBits+1)*latencySub+sub, latencyBuckets-1)
+}
+
+// latencyUpper returns the largest value that falls in bucket i.
+func latencyUpper(i int) uint64 {
+	if i < latencySub {
+		return uint64(i)
+	}
+	exp := i/latencySub + latencySubBits - 1
+	sub := uint64(i % latencySub)
+	width := uint64(1) << (exp - latencySubBits)
+	return (1<<exp + (sub+1)*width) - 1
+}
@@ -0,0 +1,76 @@
+package jit
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestCompilerLatency verifies that every way of rendering is recorded
+// when CompilerCfg.Latency is set, and nothing is recorded otherwise.
+func TestCompilerLatency(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Latency: true})
+	compiler.Render(poolPage(10))
+	compiler.Render(poolPage(10), io.Discard)
+	compiler.AppendRender(nil, poolPage(10))
+	if err := compiler.RenderContext(context.Background(), poolPage(10), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := compiler.Latency()
+	if stats.Count != 4 {
+		t.Errorf("expected 4 recorded renders, got %d", stats.Count)
+	}
+	if stats.Max <= 0 || stats.P50 > stats.P99 || stats.P99 > stats.Max {
+		t.Errorf("quantiles should be ordered and bounded by Max, got %+v", stats)
+	}
+
+	plain := NewCompiler()
+	plain.Render(poolPage(10))
+	if stats := plain.Latency(); stats != (LatencyStats{}) {
+		t.Errorf("latency should not be recorded without the option, got %+v", stats)
+	}
+}
+
+// TestLatencyBuckets verifies that each value lands in a bucket whose
+// upper bound is at or above it and within an eighth of it.
+func TestLatencyBuckets(t *testing.T) {
+	for _, ns := range []uint64{0, 1, 7, 8, 9, 15, 16, 17, 100, 1000, 12345, 1 << 20, 999999999} {
+		upper := latencyUpper(latencyBucket(ns))
+		if upper < ns || float64(upper-ns) > float64(ns)/8 {
+			t.Errorf("%dns landed in a bucket with upper bound %d", ns, upper)
+		}
+	}
+	if got := latencyBucket(1 << 62); got != latencyBuckets-1 {
+		t.Errorf("values past the range should go in the last bucket, got %d", got)
+	}
+}
+
+// TestLatencyQuantiles verifies quantiles against a known distribution:
+// 99 fast renders and one slow one.
+func TestLatencyQuantiles(t *testing.T) {
+	var h latencyHistogram
+	record := func(d time.Duration) {
+		h.buckets[latencyBucket(uint64(d))].Add(1)
+		h.count.Add(1)
+		if int64(d) > h.max.Load() {
+			h.max.Store(int64(d))
+		}
+	}
+	for range 99 {
+		record(time.Microsecond)
+	}
+	record(time.Millisecond)
+
+	stats := h.stats()
+	if stats.P50 < time.Microsecond || stats.P50 > time.Microsecond*9/8 {
+		t.Errorf("p50 should be about 1µs, got %v", stats.P50)
+	}
+	if stats.P99 > time.Microsecond*9/8 {
+		t.Errorf("p99 of 99 fast renders in 100 should still be fast, got %v", stats.P99)
+	}
+	if stats.Max != time.Millisecond {
+		t.Errorf("max should be exact, got %v", stats.Max)
+	}
+}
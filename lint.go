@@ -0,0 +1,97 @@
+package jit
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// Issue is a problem a Lint found in a template.
+type Issue struct {
+	Rule     string // Short name of the rule that found it, e.g. "img-alt"
+	Message  string // What is wrong, e.g. "img has no alt attribute"
+	Path     []int  // The offending node's path from the root, set by the compiler
+	Location string // The path described by tag, e.g. "div > img[2]", set by the compiler
+}
+
+// String formats the issue as "Location: Message (Rule)".
+func (i Issue) String() string {
+	return i.Location + ": " + i.Message + " (" + i.Rule + ")"
+}
+
+// Lint checks one node of a template and returns any issues with it. path
+// is the node's position from the root, as child indices. A lint is called
+// for every node in the tree, so it should only inspect n itself - its
+// children get their own call.
+type Lint func(n node.Node, path []int) []Issue
+
+// lints holds the lints registered with RegisterLint.
+var lints struct {
+	mu  sync.RWMutex
+	fns []Lint
+}
+
+// RegisterLint adds a lint that compilers run over each template they
+// compile, for house rules such as every img having alt text or no inline
+// styles. Register lints at start-up, before compiling.
+//
+// Lints only run for compilers with CompilerCfg.OnLint set, which receives
+// each issue. They run once per compile on the tree being compiled - the
+// same moment its static content is frozen - so they cost nothing per
+// render. Only the branch of a conditional active at compile time is
+// checked.
+//
+// Example:
+//
+//	jit.RegisterLint(func(n node.Node, path []int) []jit.Issue {
+//	    el, ok := n.(node.Element)
+//	    if !ok {
+//	        return nil
+//	    }
+//	    var open bytes.Buffer
+//	    el.RenderOpen(&open)
+//	    if bytes.Contains(open.Bytes(), []byte(" style=")) {
+//	        return []jit.Issue{{Rule: "no-inline-style", Message: "inline style attribute"}}
+//	    }
+//	    return nil
+//	})
+func RegisterLint(lint Lint) {
+	lints.mu.Lock()
+	lints.fns = append(lints.fns, lint)
+	lints.mu.Unlock()
+}
+
+// runLints runs every registered lint over the tree at root and passes each
+// issue to report, with its Path and Location filled in.
+func runLints(root node.Node, report func(Issue)) {
+	lints.mu.RLock()
+	fns := slices.Clone(lints.fns)
+	lints.mu.RUnlock()
+	if len(fns) == 0 || root == nil {
+		return
+	}
+	lintNode(root, fns, nil, nil, report)
+}
+
+// lintNode runs fns on n and then on each of its children, depth-first.
+func lintNode(n node.Node, fns []Lint, path []int, tags []string, report func(Issue)) {
+	tags = append(tags, nodeLabel(n))
+	for _, lint := range fns {
+		for _, issue := range lint(n, path) {
+			if issue.Path == nil {
+				issue.Path = slices.Clone(path)
+			}
+			if issue.Location == "" {
+				issue.Location = describePath(path, tags)
+			}
+			report(issue)
+		}
+	}
+	for i, child := range n.Nodes() {
+		if child != nil {
+			// Depth-first, so reusing the backing arrays is safe - see walk.
+			lintNode(child, fns, append(path, i), tags, report)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package jit
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/img"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// registerTestLint registers lint for the duration of the test.
+func registerTestLint(t *testing.T, lint Lint) {
+	t.Helper()
+	lints.mu.Lock()
+	saved := slices.Clone(lints.fns)
+	lints.mu.Unlock()
+	t.Cleanup(func() {
+		lints.mu.Lock()
+		lints.fns = saved
+		lints.mu.Unlock()
+	})
+	RegisterLint(lint)
+}
+
+// noInlineStyle flags elements whose opening tag has a style attribute.
+func noInlineStyle(n node.Node, _ []int) []Issue {
+	el, ok := n.(node.Element)
+	if !ok {
+		return nil
+	}
+	var open bytes.Buffer
+	el.RenderOpen(&open)
+	if bytes.Contains(open.Bytes(), []byte(" style=")) {
+		return []Issue{{Rule: "no-inline-style", Message: "inline style attribute"}}
+	}
+	return nil
+}
+
+// TestLintReportsIssuesAtCompile verifies that registered lints run over
+// static and dynamic nodes alike when a template compiles, that the issue
+// is located by path, and that they do not run again on later renders.
+func TestLintReportsIssuesAtCompile(t *testing.T) {
+	registerTestLint(t, noInlineStyle)
+
+	var issues []Issue
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, OnLint: func(issue Issue) { issues = append(issues, issue) }})
+	tree := func() node.Node {
+		return div.New(
+			p.Static("intro"),
+			div.New(img.New().Src("a.png").Style("border:0")),
+			span.Text("name").Style("color:red"),
+		)
+	}
+	compiler.Render(tree())
+	compiler.Render(tree())
+
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues from one compile, got %d: %v", len(issues), issues)
+	}
+	if got := issues[0]; !slices.Equal(got.Path, []int{1, 0}) || got.Location != "div > div[1] > img[0]" || got.Rule != "no-inline-style" {
+		t.Errorf("static img issue should be located at div > div[1] > img[0], got %v", got)
+	}
+	if got := issues[1].Location; got != "div > span[2]" {
+		t.Errorf("dynamic span issue should be located at div > span[2], got %s", got)
+	}
+}
+
+// TestLintRequiresOnLint verifies that registered lints do not run for
+// compilers that have not asked for them.
+func TestLintRequiresOnLint(t *testing.T) {
+	ran := false
+	registerTestLint(t, func(node.Node, []int) []Issue {
+		ran = true
+		return nil
+	})
+
+	NewCompiler().Render(div.New(p.Static("intro")))
+	if ran {
+		t.Error("lints should not run without CompilerCfg.OnLint")
+	}
+}
@@ -0,0 +1,66 @@
+package jit
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/pool"
+)
+
+// localPool is a compiler's own buffer pool, see CompilerCfg.LocalPool.
+// Fluent's pool is shared by every template in the process, so a buffer
+// grown by a 200KB report can be handed to a 2KB fragment, and the report
+// can be handed a buffer it immediately outgrows. A pool per compiler only
+// ever holds buffers sized for that compiler's own output.
+//
+// A nil localPool stands for Fluent's pool, so callers need no branch.
+type localPool struct {
+	buffers sync.Pool
+	size    func() int // The compiler's predicted render size
+}
+
+// newLocalPool returns a pool whose buffers are pre-sized by size.
+func newLocalPool(size func() int) *localPool {
+	return &localPool{size: size}
+}
+
+// get returns a buffer grown to hint bytes.
+func (lp *localPool) get(hint int) *bytes.Buffer {
+	if lp == nil {
+		return fluent.NewBuffer(hint)
+	}
+	buf, ok := lp.buffers.Get().(*bytes.Buffer)
+	if !ok {
+		return bytes.NewBuffer(make([]byte, 0, max(hint, lp.size())))
+	}
+	buf.Grow(hint)
+	return buf
+}
+
+// probe returns the smallest hint that selects the same pool as hint, see
+// poolCounter.get. The local pool has one size class.
+func (lp *localPool) probe(hint int) int {
+	if lp != nil {
+		return 0
+	}
+	if threshold := pool.Threshold(); hint >= threshold {
+		return threshold
+	}
+	return 0
+}
+
+// put resets buf and keeps it for the next render. A buffer more than
+// twice the predicted size is dropped rather than kept, so one unusually
+// large render does not pin its memory for the compiler's lifetime.
+func (lp *localPool) put(buf *bytes.Buffer) {
+	if lp == nil {
+		fluent.PutBuffer(buf)
+		return
+	}
+	if size := lp.size(); size > 0 && buf.Cap() > 2*size {
+		return
+	}
+	buf.Reset()
+	lp.buffers.Put(buf)
+}
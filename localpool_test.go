@@ -0,0 +1,42 @@
+package jit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestLocalPoolRenders verifies that renders to a writer through the
+// compiler's own pool produce the same output and are counted like
+// renders through Fluent's.
+func TestLocalPoolRenders(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, LocalPool: true, PoolStats: true})
+	for range 10 {
+		var out bytes.Buffer
+		compiler.Render(poolPage(100), &out)
+		if !strings.HasSuffix(out.String(), strings.Repeat("x", 100)+"</span></div>") {
+			t.Fatalf("render through the local pool produced %q", out.String())
+		}
+	}
+	if stats := compiler.PoolStats(); stats.Gets != 10 || stats.Hits+stats.Misses != 10 {
+		t.Errorf("expected 10 counted gets, got %+v", stats)
+	}
+	if compiler.Clone().buffers == compiler.buffers {
+		t.Error("clone should have its own local pool")
+	}
+}
+
+// TestLocalPoolSizing verifies that new buffers start at the predicted
+// size and that a buffer far larger than it is not kept.
+func TestLocalPoolSizing(t *testing.T) {
+	lp := newLocalPool(func() int { return 1000 })
+
+	if buf := lp.get(0); buf.Cap() < 1000 {
+		t.Errorf("new buffer should be pre-sized to the prediction, got capacity %d", buf.Cap())
+	}
+
+	lp.put(bytes.NewBuffer(make([]byte, 0, 5000)))
+	if buf := lp.get(0); buf.Cap() >= 5000 {
+		t.Errorf("buffer over twice the prediction should have been dropped, got capacity %d", buf.Cap())
+	}
+}
@@ -0,0 +1,227 @@
+package jit
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// voidElements never have a closing tag.
+var voidElements = []string{
+	"area", "base", "br", "col", "embed", "hr", "img", "input",
+	"link", "meta", "source", "track", "wbr",
+}
+
+// unparsedElements hold text that browsers do not parse as markup, so a
+// '<' inside one does not start a tag.
+var unparsedElements = []string{"script", "style", "textarea", "title"}
+
+// unnestableElements may not contain another element of the same kind.
+// Browsers do not report the error - they close the outer element early,
+// so a nested form submits to the wrong place and a nested link splits in
+// two.
+var unnestableElements = []string{"a", "button", "form", "label"}
+
+// markupChecker runs the CompilerCfg.OnMarkupError pass over each plan a
+// compiler builds.
+type markupChecker struct {
+	onError func(err error)
+}
+
+// check reports each problem in the plan's static markup. The static
+// chunks are read as one stream with dynamic elements skipped: dynamic
+// nodes are whole subtrees, so the markup around them must balance on its
+// own, and their content changes per render so cannot be judged here.
+func (mc *markupChecker) check(plan *ExecutionPlan) {
+	s := markupScan{ids: make(map[string]bool)}
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			s.scan(el.Content)
+		case *DynamicPath:
+			// A DynamicAttr element's closing tag is static, so its
+			// opening tag has to be accounted for here.
+			if el.OpenTag && len(el.Tags) > 0 {
+				s.open = append(s.open, el.Tags[len(el.Tags)-1])
+			}
+		}
+	}
+	for i := len(s.open) - 1; i >= 0; i-- {
+		s.problems = append(s.problems, fmt.Sprintf("<%s> is never closed", s.open[i]))
+	}
+	for _, problem := range s.problems {
+		mc.onError(fmt.Errorf("%w: %s", ErrMalformedMarkup, problem))
+	}
+}
+
+// markupScan is the state carried between the chunks of one plan.
+type markupScan struct {
+	open     []string        // Elements opened and not yet closed, outermost first
+	raw      string          // Unparsed element whose text is being skipped, or ""
+	ids      map[string]bool // id attribute values seen so far
+	problems []string
+
+	onStart func(name string, attrs []byte) // Called for each start tag with open holding its ancestors, see Compiler.Audit
+}
+
+// scan reads one static chunk, recording problems as it goes.
+func (s *markupScan) scan(chunk []byte) {
+	i := 0
+	for i < len(chunk) {
+		if s.raw != "" {
+			end := indexCloseTag(chunk[i:], s.raw)
+			if end < 0 {
+				return
+			}
+			i += end
+			s.raw = ""
+			continue
+		}
+
+		start := bytes.IndexByte(chunk[i:], '<')
+		if start < 0 {
+			return
+		}
+		i += start
+		if bytes.HasPrefix(chunk[i:], []byte("<!--")) {
+			end := bytes.Index(chunk[i+4:], []byte("-->"))
+			if end < 0 {
+				s.problems = append(s.problems, "comment is never closed")
+				return
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		end := tagEnd(chunk[i:])
+		if end < 0 {
+			s.problems = append(s.problems, fmt.Sprintf("tag %q is never closed", truncate(chunk[i:], 20)))
+			return
+		}
+		s.tag(chunk[i : i+end])
+		i += end
+	}
+}
+
+// tag processes one complete tag, from '<' to '>'.
+func (s *markupScan) tag(tag []byte) {
+	if len(tag) < 3 || tag[1] == '!' || tag[1] == '?' {
+		return // doctype, processing instruction or "<>"
+	}
+	closing := tag[1] == '/'
+	body := tag[1 : len(tag)-1]
+	if closing {
+		body = body[1:]
+	}
+	nameEnd := bytes.IndexAny(body, " \t\n\r\f/")
+	if nameEnd < 0 {
+		nameEnd = len(body)
+	}
+	name := strings.ToLower(string(body[:nameEnd]))
+
+	if closing {
+		s.close(name)
+		return
+	}
+
+	if id, ok := attrValue(body[nameEnd:], "id"); ok {
+		if s.ids[id] {
+			s.problems = append(s.problems, fmt.Sprintf("id %q is used more than once", id))
+		}
+		s.ids[id] = true
+	}
+	if slices.Contains(unnestableElements, name) && slices.Contains(s.open, name) {
+		s.problems = append(s.problems, fmt.Sprintf("<%s> is nested inside another <%s> at %s", name, name, s.location()))
+	}
+	if s.onStart != nil {
+		s.onStart(name, body[nameEnd:])
+	}
+
+	if slices.Contains(voidElements, name) || bytes.HasSuffix(tag, []byte("/>")) {
+		return
+	}
+	s.open = append(s.open, name)
+	if slices.Contains(unparsedElements, name) {
+		s.raw = name
+	}
+}
+
+// close matches a closing tag against the open elements. Anything still
+// open inside the element being closed was never closed itself; a browser
+// closes it here, and so does the scan, so one mistake is not reported
+// again for every tag after it.
+func (s *markupScan) close(name string) {
+	i := len(s.open) - 1
+	for i >= 0 && s.open[i] != name {
+		i--
+	}
+	if i < 0 {
+		s.problems = append(s.problems, fmt.Sprintf("</%s> has no matching opening tag at %s", name, s.location()))
+		return
+	}
+	for j := len(s.open) - 1; j > i; j-- {
+		s.problems = append(s.problems, fmt.Sprintf("<%s> is never closed at %s", s.open[j], strings.Join(s.open[:j], " > ")))
+	}
+	s.open = s.open[:i]
+}
+
+// location describes the open elements, e.g. "div > form > p".
+func (s *markupScan) location() string {
+	if len(s.open) == 0 {
+		return "the top level"
+	}
+	return strings.Join(s.open, " > ")
+}
+
+// attrValue returns the value of the named attribute in attrs, the part of
+// a start tag after the element name.
+func attrValue(attrs []byte, name string) (string, bool) {
+	i := 0
+	for i < len(attrs) {
+		for i < len(attrs) && (isSpace(attrs[i]) || attrs[i] == '/') {
+			i++
+		}
+		start := i
+		for i < len(attrs) && !isSpace(attrs[i]) && attrs[i] != '=' && attrs[i] != '/' {
+			i++
+		}
+		attr := attrs[start:i]
+		if i >= len(attrs) || attrs[i] != '=' {
+			if bytes.EqualFold(attr, []byte(name)) {
+				return "", true
+			}
+			continue
+		}
+
+		i++ // '='
+		var value []byte
+		if i < len(attrs) && (attrs[i] == '"' || attrs[i] == '\'') {
+			quote := attrs[i]
+			end := bytes.IndexByte(attrs[i+1:], quote)
+			if end < 0 {
+				end = len(attrs) - i - 1
+			}
+			value = attrs[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start := i
+			for i < len(attrs) && !isSpace(attrs[i]) {
+				i++
+			}
+			value = attrs[start:i]
+		}
+		if bytes.EqualFold(attr, []byte(name)) {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// truncate returns up to n bytes of b as a string, for error messages.
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,102 @@
+package jit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/a"
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/form"
+	"github.com/jpl-au/fluent/html5/input"
+	"github.com/jpl-au/fluent/html5/script"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
+)
+
+// compileChecked compiles tree with the markup check enabled and returns
+// the problems reported.
+func compileChecked(tree node.Node) []error {
+	var problems []error
+	compiler := NewCompiler(&CompilerCfg{OnMarkupError: func(err error) {
+		problems = append(problems, err)
+	}})
+	compiler.Render(tree)
+	return problems
+}
+
+// TestMarkupCheckFindsProblems verifies each kind of problem is reported
+// with enough detail to find it.
+func TestMarkupCheckFindsProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		tree node.Node
+		want string
+	}{
+		{
+			"nested form",
+			div.New(form.New(div.New(form.New(input.Text("q", "")))), span.Text("x")),
+			"<form> is nested inside another <form> at div > form > div",
+		},
+		{
+			"nested link",
+			div.New(a.New(span.Static("outer"), a.New(text.Static("inner")))),
+			"<a> is nested inside another <a>",
+		},
+		{
+			"duplicate id",
+			div.New(div.Static("one").ID("main"), span.Text("x"), div.Static("two").ID("main")),
+			`id "main" is used more than once`,
+		},
+		{
+			"unclosed",
+			div.New(text.Static("<section>"), span.Text("x")),
+			"<section> is never closed",
+		},
+		{
+			"stray close",
+			div.New(text.Static("</p>"), span.Text("x")),
+			"</p> has no matching opening tag at div",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := compileChecked(tt.tree)
+			if len(problems) != 1 {
+				t.Fatalf("expected one problem, got %v", problems)
+			}
+			if !errors.Is(problems[0], ErrMalformedMarkup) {
+				t.Errorf("problem should wrap ErrMalformedMarkup, got: %v", problems[0])
+			}
+			if !strings.Contains(problems[0].Error(), tt.want) {
+				t.Errorf("problem should mention %q, got: %v", tt.want, problems[0])
+			}
+		})
+	}
+}
+
+// TestMarkupCheckAcceptsValid verifies that well-formed markup, including
+// void elements, script bodies and markup split around dynamic content,
+// reports nothing.
+func TestMarkupCheckAcceptsValid(t *testing.T) {
+	tree := div.New(
+		form.New(input.Text("q", "").ID("q"), span.Text("x")),
+		script.Static("if (a < b && c > d) { document.write('</div>') }"),
+		text.Static("<!-- <div> in a comment -->"),
+		div.New(span.Text("y")).ID("other"),
+	)
+	if problems := compileChecked(tree); len(problems) != 0 {
+		t.Errorf("valid markup should report nothing, got %v", problems)
+	}
+}
+
+// TestMarkupCheckBranches verifies that a conditional branch is checked
+// when it is compiled.
+func TestMarkupCheckBranches(t *testing.T) {
+	tree := div.New(node.When(true, div.New(text.Static("<b>"), span.Text("x"))))
+	problems := compileChecked(tree)
+	if len(problems) != 1 || !strings.Contains(problems[0].Error(), "<b> is never closed") {
+		t.Errorf("branch markup should be checked, got %v", problems)
+	}
+}
@@ -0,0 +1,119 @@
+package jit
+
+import (
+	"bytes"
+)
+
+// rawTextElements are elements whose content must be emitted byte for
+// byte. Whitespace is significant in pre and textarea, and collapsing it in
+// script or style could join a line comment onto the code after it.
+var rawTextElements = []string{"pre", "textarea", "script", "style"}
+
+// minifyChunk collapses whitespace in text and strips HTML comments from a
+// static chunk. Each whitespace run becomes a single space rather than
+// being removed, since whitespace between inline elements is visible.
+// Markup inside tags, such as attribute values, is copied unchanged.
+//
+// raw names the raw-text element that is open at the start of the chunk,
+// or "" if none. Chunks are split at dynamic content, so a <pre> can open
+// in one chunk and close in a later one; the returned raw carries that
+// state to the next chunk.
+func minifyChunk(chunk []byte, raw string) ([]byte, string) {
+	out := make([]byte, 0, len(chunk))
+	i := 0
+	for i < len(chunk) {
+		if raw != "" {
+			end := indexCloseTag(chunk[i:], raw)
+			if end < 0 {
+				return append(out, chunk[i:]...), raw
+			}
+			out = append(out, chunk[i:i+end]...)
+			i += end
+			raw = ""
+			continue
+		}
+
+		switch c := chunk[i]; {
+		case bytes.HasPrefix(chunk[i:], []byte("<!--")) && !bytes.HasPrefix(chunk[i:], []byte("<!--[if")):
+			// Conditional comments are kept - old IE treats them as markup.
+			end := bytes.Index(chunk[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, chunk[i:]...), raw
+			}
+			i += 4 + end + 3
+		case c == '<':
+			end := tagEnd(chunk[i:])
+			if end < 0 {
+				return append(out, chunk[i:]...), raw
+			}
+			tag := chunk[i : i+end]
+			out = append(out, tag...)
+			i += end
+			raw = openedRawElement(tag)
+		case isSpace(c):
+			// A removed comment can leave two runs next to each other.
+			if len(out) == 0 || out[len(out)-1] != ' ' {
+				out = append(out, ' ')
+			}
+			for i < len(chunk) && isSpace(chunk[i]) {
+				i++
+			}
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out, raw
+}
+
+// tagEnd returns the length of the tag at the start of b, up to and
+// including its closing '>', or -1 if the tag does not close in b. A '>'
+// inside a quoted attribute value does not end the tag.
+func tagEnd(b []byte) int {
+	var quote byte
+	for i := 1; i < len(b); i++ {
+		switch {
+		case quote != 0:
+			if b[i] == quote {
+				quote = 0
+			}
+		case b[i] == '"' || b[i] == '\'':
+			quote = b[i]
+		case b[i] == '>':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// openedRawElement returns the name of the raw-text element tag opens, or
+// "" if it is a closing tag, a self-closing tag or any other element.
+func openedRawElement(tag []byte) string {
+	name := tag[1:]
+	if end := bytes.IndexAny(name, " \t\n\r\f/>"); end >= 0 {
+		name = name[:end]
+	}
+	for _, raw := range rawTextElements {
+		if bytes.EqualFold(name, []byte(raw)) && !bytes.HasSuffix(tag, []byte("/>")) {
+			return raw
+		}
+	}
+	return ""
+}
+
+// indexCloseTag returns the index of the closing tag for name in b,
+// matched case-insensitively, or -1 if it is not there.
+func indexCloseTag(b []byte, name string) int {
+	closeTag := []byte("</" + name)
+	for i := 0; i+len(closeTag) <= len(b); i++ {
+		if b[i] == '<' && bytes.EqualFold(b[i:i+len(closeTag)], closeTag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isSpace reports whether c is HTML whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,65 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/pre"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+	"github.com/jpl-au/fluent/text"
+)
+
+// TestMinifyChunk covers the minifier's rules on single chunks.
+func TestMinifyChunk(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"collapses whitespace", "<p>a  \n\t b</p>", "<p>a b</p>"},
+		{"keeps one space between inline elements", "<b>a</b>   <i>b</i>", "<b>a</b> <i>b</i>"},
+		{"strips comments", "<p>a<!-- note -->b</p>", "<p>ab</p>"},
+		{"keeps conditional comments", "<!--[if IE]><p>x</p><![endif]-->", "<!--[if IE]><p>x</p><![endif]-->"},
+		{"leaves attribute values alone", `<p title="a   b">x</p>`, `<p title="a   b">x</p>`},
+		{"leaves pre alone", "<pre>a\n  b</pre>  <p>c</p>", "<pre>a\n  b</pre> <p>c</p>"},
+		{"leaves script alone", "<script>// a\nb()</script>", "<script>// a\nb()</script>"},
+	}
+	for _, tt := range tests {
+		got, raw := minifyChunk([]byte(tt.in), "")
+		if string(got) != tt.want {
+			t.Errorf("%s:\n  got  %q\n  want %q", tt.name, got, tt.want)
+		}
+		if raw != "" {
+			t.Errorf("%s: no raw-text element should be left open, got %q", tt.name, raw)
+		}
+	}
+}
+
+// TestCompilerMinify verifies that minification applies to compiled
+// static content but never to dynamic values.
+func TestCompilerMinify(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Max: 5, Variance: 20, GrowthFactor: 115, Minify: true})
+	tree := func(name string) node.Node {
+		return div.New(
+			text.Static("\n  <!-- header -->\n  "),
+			span.Text(name),
+		)
+	}
+
+	compiler.Render(tree("a  b"))
+	got := string(compiler.Render(tree("c  d")))
+	if want := "<div> <span>c  d</span></div>"; got != want {
+		t.Errorf("static content should be minified and dynamic content kept:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestCompilerMinifyPreAcrossDynamic verifies that a pre split by dynamic
+// content is still left alone after the dynamic node.
+func TestCompilerMinifyPreAcrossDynamic(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Max: 5, Variance: 20, GrowthFactor: 115, Minify: true})
+	tree := pre.New(text.Static("a  "), text.Text("x"), text.Static("  b"))
+
+	got := string(compiler.Render(tree))
+	if want := "<pre>a  x  b</pre>"; got != want {
+		t.Errorf("whitespace inside pre should survive across chunks:\n  got  %q\n  want %q", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+package jit
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// maxModes bounds SetModes. Past a handful the clusters stop meaning
+// anything and each render pays for the search.
+const maxModes = 8
+
+// modeWeight is the share, as a divisor, that each render moves its
+// mode's centre by: an eighth, so a mode follows drift over tens of
+// renders without one odd render dragging it.
+const modeWeight = 8
+
+// modeRounds is the number of k-means rounds run over the samples to seed
+// the modes. Sizes are one-dimensional and the samples few, so a few
+// rounds settle.
+const modeRounds = 5
+
+// SetModes lets the sizer track up to n clusters of render sizes rather
+// than one baseline, and resets all statistics as Configure does. A
+// template whose output falls into distinct modes - an empty state and a
+// full one, a logged-out and a logged-in page - is badly served by their
+// average, which is too large for one and too small for the other.
+//
+// The modes are seeded from the samples when sampling ends, with sizes
+// within the variance of each other counted as one mode, so a template
+// with a single mode behaves much as it would without this. From then on
+// each render joins its nearest mode, moving that mode's centre towards
+// it, and the baseline becomes that mode's centre, grown by the growth
+// factor: the next render is predicted to be like the last. A render
+// further than the variance from every mode starts a new one while there
+// are fewer than n; once there are n it joins the nearest.
+//
+// Each render then takes the sizer's mutex briefly, as with SetWindow. The
+// modes replace EWMA and Window, which are unused while n is above 1. n
+// is clamped to 0-8; 0 and 1 turn it off.
+func (as *AdaptiveSizer) SetModes(n int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	n = min(max(n, 0), maxModes)
+	if n == 1 {
+		n = 0
+	}
+	atomic.StoreInt64(&as.modes, int64(n))
+	as.restart()
+}
+
+// seedModes sets the mode centres from samples by k-means, merging
+// centres within the variance of each other. samples is sorted in place.
+// The caller holds as.mu.
+func (as *AdaptiveSizer) seedModes(samples []int) {
+	as.centres = as.centres[:0]
+	if len(samples) == 0 {
+		return
+	}
+	slices.Sort(samples)
+
+	// Start from evenly spaced quantiles, then refine
+	k := min(int(atomic.LoadInt64(&as.modes)), len(samples))
+	centres := make([]int, k)
+	for i := range centres {
+		centres[i] = samples[(2*i+1)*len(samples)/(2*k)]
+	}
+	sums := make([]int, k)
+	counts := make([]int, k)
+	for range modeRounds {
+		clear(sums)
+		clear(counts)
+		for _, size := range samples {
+			i := nearest(centres, size)
+			sums[i] += size
+			counts[i]++
+		}
+		for i := range centres {
+			if counts[i] > 0 {
+				centres[i] = sums[i] / counts[i]
+			}
+		}
+	}
+
+	slices.Sort(centres)
+	for _, c := range centres {
+		if n := len(as.centres); n > 0 && !as.distinct(as.centres[n-1], c) {
+			as.centres[n-1] = (as.centres[n-1] + c) / 2
+			continue
+		}
+		as.centres = append(as.centres, c)
+	}
+}
+
+// cluster moves size's nearest mode towards it, or starts a new mode if
+// none is close and there is room, and sets the baseline from that mode.
+func (as *AdaptiveSizer) cluster(size int) {
+	var change baselineChange
+	defer as.report(&change)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	limit := int(atomic.LoadInt64(&as.modes))
+	if atomic.LoadInt64(&as.active) == 1 || limit == 0 {
+		return // sampling restarted or modes were turned off meanwhile
+	}
+	mode := -1
+	if len(as.centres) > 0 {
+		mode = nearest(as.centres, size)
+	}
+	switch {
+	case mode >= 0 && !as.distinct(as.centres[mode], size):
+		as.centres[mode] += (size - as.centres[mode]) / modeWeight
+	case len(as.centres) < limit:
+		as.centres = append(as.centres, size)
+		mode = len(as.centres) - 1
+	default:
+		as.centres[mode] += (size - as.centres[mode]) / modeWeight
+	}
+	change = as.setBaseline(int64(as.centres[mode] * as.growth() / 100))
+}
+
+// distinct reports whether sizes a and b are more than the variance
+// apart, relative to the larger, and so belong to different modes.
+func (as *AdaptiveSizer) distinct(a, b int) bool {
+	return abs(a-b)*100 > max(a, b)*as.variance
+}
+
+// nearest returns the index of the centre closest to size.
+func nearest(centres []int, size int) int {
+	best := 0
+	for i, c := range centres {
+		if abs(c-size) < abs(centres[best]-size) {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,62 @@
+package jit
+
+import "testing"
+
+// TestAdaptiveSizerModes verifies that two clusters of sizes are seeded
+// as two modes and that each render predicts the next from its own mode.
+func TestAdaptiveSizerModes(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(10, 20, 100)
+	as.SetModes(3)
+
+	// Empty-state and full-state pages, ending on a full one
+	for _, size := range []int{200, 10000, 210, 10100, 190, 9900, 200, 10000, 200, 10000} {
+		as.UpdateStats(size)
+	}
+	st := as.Stats()
+	if st.Sampling || len(st.Modes) != 2 {
+		t.Fatalf("two clusters should seed two modes, got %+v", st)
+	}
+	if st.Baseline != st.Modes[1] {
+		t.Errorf("the last sample was a full page, so the baseline should be the large mode %d, got %d", st.Modes[1], st.Baseline)
+	}
+
+	as.UpdateStats(205)
+	if got := as.GetBaseline(); got < 190 || got > 210 {
+		t.Errorf("after an empty page the baseline should be near 200, got %d", got)
+	}
+	as.UpdateStats(10050)
+	if got := as.GetBaseline(); got < 9900 || got > 10100 {
+		t.Errorf("after a full page the baseline should be near 10000, got %d", got)
+	}
+
+	// A third, distinct size starts a new mode; it never resamples
+	as.UpdateStats(50000)
+	if st := as.Stats(); st.Sampling || len(st.Modes) != 3 || st.Baseline != 50000 {
+		t.Errorf("a distant render should start a third mode, got %+v", st)
+	}
+	// With all three modes in use, a fourth joins the nearest
+	as.UpdateStats(2000)
+	if st := as.Stats(); len(st.Modes) != 3 {
+		t.Errorf("modes should stay at the limit of 3, got %v", st.Modes)
+	}
+}
+
+// TestAdaptiveSizerModesUnimodal verifies that sizes from one cluster are
+// merged into a single mode.
+func TestAdaptiveSizerModesUnimodal(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.Configure(6, 20, 100)
+	as.SetModes(4)
+	for _, size := range []int{1000, 1050, 980, 1020, 990, 1010} {
+		as.UpdateStats(size)
+	}
+	if modes := as.Stats().Modes; len(modes) != 1 || modes[0] < 980 || modes[0] > 1050 {
+		t.Errorf("one cluster should seed one mode near 1000, got %v", modes)
+	}
+
+	as.SetModes(1)
+	if as.tracking() || len(as.Stats().Modes) > 0 {
+		t.Errorf("a single mode should turn modes off, got %v", as.Stats().Modes)
+	}
+}
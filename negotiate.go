@@ -0,0 +1,78 @@
+package jit
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// FragmentParam is the query parameter that asks RenderRequest for a
+// single region rather than the full page, e.g. /orders?fragment=table.
+const FragmentParam = "fragment"
+
+// RequestedFragment returns the dynamic key of the region r asks for, or ""
+// if it wants the full page. An explicit FragmentParam wins; otherwise an
+// htmx request (HX-Request: true) asks for the region named by its
+// HX-Target header, which is the id of the element htmx will swap.
+func RequestedFragment(r *http.Request) string {
+	if name := r.URL.Query().Get(FragmentParam); name != "" {
+		return name
+	}
+	if r.Header.Get("HX-Request") == "true" {
+		return r.Header.Get("HX-Target")
+	}
+	return ""
+}
+
+// RenderRequest renders root in full through the compiler, or only the
+// region r asks for (see RequestedFragment), so one handler serves both the
+// page and its partial updates. A region is any node marked with
+// .Dynamic(key); name the key after the element id htmx targets.
+//
+// If the requested region is not in the tree, the full page is rendered.
+// htmx sends HX-Request on boosted navigation too, where the target is the
+// body rather than a keyed region, and that request wants the whole page.
+//
+// Vary is set so a shared cache does not serve a fragment in place of the
+// page, or the other way round. Surrogate keys from CompilerCfg.Surrogate
+// are set too, if any are configured.
+//
+// Example:
+//
+//	func ordersHandler(w http.ResponseWriter, r *http.Request) {
+//	    ordersCompiler.RenderRequest(w, r, OrdersPage(loadOrders()))
+//	}
+func (jc *Compiler) RenderRequest(w http.ResponseWriter, r *http.Request, root node.Node) {
+	w.Header().Add("Vary", "HX-Request")
+	w.Header().Add("Vary", "HX-Target")
+	jc.SetSurrogateKeys(w)
+
+	if name := RequestedFragment(r); name != "" {
+		if path, ok := findKey(root, name, nil); ok {
+			// The region is known to resolve, so the only error left is
+			// the write, which Render does not report either.
+			_ = jc.RenderFragment(root, path, w)
+			return
+		}
+	}
+	jc.Render(root, w)
+}
+
+// findKey returns the path from n to the first node under it, depth first,
+// whose dynamic key is key. path is the path to n, and is extended in
+// place, so callers pass nil.
+func findKey(n node.Node, key string, path []int) ([]int, bool) {
+	if d, ok := n.(node.Dynamic); ok && d.DynamicKey() == key {
+		return slices.Clone(path), true
+	}
+	for i, child := range n.Nodes() {
+		if child == nil {
+			continue
+		}
+		if found, ok := findKey(child, key, append(path, i)); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
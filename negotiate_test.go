@@ -0,0 +1,74 @@
+package jit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// negotiatePage is a page with one keyed region, the shape RenderRequest
+// is designed for.
+func negotiatePage(count string) node.Node {
+	return div.New(
+		h1.Static("Orders"),
+		div.New(span.Text(count)).Dynamic("orders"),
+	)
+}
+
+// TestRenderRequestFullPage verifies that a plain request gets the page.
+func TestRenderRequestFullPage(t *testing.T) {
+	compiler := NewCompiler()
+	rec := httptest.NewRecorder()
+	compiler.RenderRequest(rec, httptest.NewRequest("GET", "/orders", nil), negotiatePage("3"))
+
+	want := "<div><h1>Orders</h1><div data-tether-key=\"orders\"><span>3</span></div></div>"
+	if rec.Body.String() != want {
+		t.Errorf("plain request should render the full page:\n  got  %q\n  want %q", rec.Body.String(), want)
+	}
+	if len(rec.Header().Values("Vary")) == 0 {
+		t.Error("response should set Vary so caches keep page and fragment apart")
+	}
+}
+
+// TestRenderRequestFragment verifies that both the query parameter and an
+// htmx request select just the keyed region.
+func TestRenderRequestFragment(t *testing.T) {
+	compiler := NewCompiler()
+	want := "<div data-tether-key=\"orders\"><span>4</span></div>"
+
+	rec := httptest.NewRecorder()
+	compiler.RenderRequest(rec, httptest.NewRequest("GET", "/orders?fragment=orders", nil), negotiatePage("4"))
+	if rec.Body.String() != want {
+		t.Errorf("?fragment= should render only the region:\n  got  %q\n  want %q", rec.Body.String(), want)
+	}
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "orders")
+	rec = httptest.NewRecorder()
+	compiler.RenderRequest(rec, req, negotiatePage("4"))
+	if rec.Body.String() != want {
+		t.Errorf("htmx request should render only the targeted region:\n  got  %q\n  want %q", rec.Body.String(), want)
+	}
+}
+
+// TestRenderRequestUnknownFragment verifies that a request for a region
+// the page does not have falls back to the full page, as htmx boosted
+// navigation expects.
+func TestRenderRequestUnknownFragment(t *testing.T) {
+	compiler := NewCompiler()
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "body")
+
+	rec := httptest.NewRecorder()
+	compiler.RenderRequest(rec, req, negotiatePage("5"))
+	want := "<div><h1>Orders</h1><div data-tether-key=\"orders\"><span>5</span></div></div>"
+	if rec.Body.String() != want {
+		t.Errorf("unknown region should fall back to the full page:\n  got  %q\n  want %q", rec.Body.String(), want)
+	}
+}
@@ -0,0 +1,102 @@
+package jit
+
+import (
+	"io"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// PageInfo describes which slice of a listing a page shows.
+type PageInfo struct {
+	Page    int // Current page, starting at 1
+	PerPage int // Items per page
+	Total   int // Items across all pages
+}
+
+// Pages returns the number of pages needed for Total items, or 0 if
+// PerPage is not set.
+func (pi PageInfo) Pages() int {
+	if pi.PerPage <= 0 {
+		return 0
+	}
+	return (pi.Total + pi.PerPage - 1) / pi.PerPage
+}
+
+// HasPrev reports whether there is a page before the current one.
+func (pi PageInfo) HasPrev() bool {
+	return pi.Page > 1
+}
+
+// HasNext reports whether there is a page after the current one.
+func (pi PageInfo) HasNext() bool {
+	return pi.Page < pi.Pages()
+}
+
+// Page is the data a Paginator binds on each render.
+type Page[T any] struct {
+	Items []T
+	Info  PageInfo
+}
+
+// Paginator renders a paginated listing: a shell that is built and frozen
+// once, a row for each item on the page, and pagination controls. It is a
+// TypedCompiler whose two holes - the rows and the controls - are filled
+// from the page being rendered, so handlers pass only the items and page
+// info rather than rebuilding the table, headers and layout per request.
+//
+// Rows are built from the row function on every render rather than
+// compiled, because listing rows routinely carry per-item attributes (links,
+// IDs, classes) that a compiled plan would freeze to the first item.
+type Paginator[T any] struct {
+	tc *TypedCompiler[Page[T]]
+}
+
+// NewPaginator returns a Paginator. shell builds the static listing around
+// the two regions it is given - rows and controls - and is called once.
+// row builds the markup for one item, and controls builds the pagination
+// links for the page being rendered.
+//
+// Example:
+//
+//	var users = jit.NewPaginator(
+//	    func(rows, controls node.Node) node.Node {
+//	        return div.New(
+//	            table.New(
+//	                thead.New(tr.New(th.Static("Name"), th.Static("Email"))),
+//	                tbody.New(rows),
+//	            ),
+//	            nav.New(controls).Class("pagination"),
+//	        )
+//	    },
+//	    func(u User) node.Node {
+//	        return tr.New(td.Text(u.Name), td.Text(u.Email))
+//	    },
+//	    func(pi jit.PageInfo) node.Node {
+//	        return span.Textf("Page %d of %d", pi.Page, pi.Pages())
+//	    },
+//	)
+//	users.RenderPage(page, jit.PageInfo{Page: 2, PerPage: 20, Total: 95}, w)
+func NewPaginator[T any](
+	shell func(rows, controls node.Node) node.Node,
+	row func(item T) node.Node,
+	controls func(info PageInfo) node.Node,
+) *Paginator[T] {
+	return &Paginator[T]{
+		tc: NewTypedCompiler(func(_ Page[T]) node.Node {
+			rows := Bind(func(p Page[T]) node.Node {
+				return node.Map(p.Items, row)
+			})
+			pager := Bind(func(p Page[T]) node.Node {
+				return controls(p.Info)
+			})
+			return shell(rows, pager)
+		}),
+	}
+}
+
+// RenderPage renders the listing for items, which should already be the
+// slice of results for info.Page. Output is written to w, or returned as
+// bytes if no writer is given.
+func (p *Paginator[T]) RenderPage(items []T, info PageInfo, w ...io.Writer) []byte {
+	return p.tc.Render(Page[T]{Items: items, Info: info}, w...)
+}
@@ -0,0 +1,83 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// newTestPaginator builds a listing with a static heading, one li per item
+// and a page counter, so tests can check each region independently.
+func newTestPaginator(shellBuilds *int) *Paginator[string] {
+	return NewPaginator(
+		func(rows, controls node.Node) node.Node {
+			*shellBuilds++
+			return div.New(h1.Static("Users"), ul.New(rows), controls)
+		},
+		func(name string) node.Node { return li.Text(name) },
+		func(pi PageInfo) node.Node { return span.Textf("%d/%d", pi.Page, pi.Pages()) },
+	)
+}
+
+// TestPaginatorRenderPage verifies that each page renders its own rows and
+// controls while the shell is only built once.
+func TestPaginatorRenderPage(t *testing.T) {
+	builds := 0
+	pager := newTestPaginator(&builds)
+
+	first := string(pager.RenderPage([]string{"Alice", "Bob"}, PageInfo{Page: 1, PerPage: 2, Total: 3}))
+	second := string(pager.RenderPage([]string{"Carol"}, PageInfo{Page: 2, PerPage: 2, Total: 3}))
+
+	if want := "<div><h1>Users</h1><ul><li>Alice</li><li>Bob</li></ul><span>1/2</span></div>"; first != want {
+		t.Errorf("first page:\n  got  %q\n  want %q", first, want)
+	}
+	if want := "<div><h1>Users</h1><ul><li>Carol</li></ul><span>2/2</span></div>"; second != want {
+		t.Errorf("second page should have its own rows and controls:\n  got  %q\n  want %q", second, want)
+	}
+	if builds != 1 {
+		t.Errorf("shell should be built once, was built %d times", builds)
+	}
+}
+
+// TestPaginatorEmptyPage verifies that a page with no items renders the
+// shell with an empty row region rather than failing.
+func TestPaginatorEmptyPage(t *testing.T) {
+	builds := 0
+	pager := newTestPaginator(&builds)
+
+	got := string(pager.RenderPage(nil, PageInfo{Page: 1, PerPage: 10}))
+	if want := "<div><h1>Users</h1><ul></ul><span>1/0</span></div>"; got != want {
+		t.Errorf("empty page:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestPageInfo verifies page arithmetic at its boundaries.
+func TestPageInfo(t *testing.T) {
+	tests := []struct {
+		info             PageInfo
+		pages            int
+		hasPrev, hasNext bool
+	}{
+		{PageInfo{Page: 1, PerPage: 10, Total: 0}, 0, false, false},
+		{PageInfo{Page: 1, PerPage: 10, Total: 10}, 1, false, false},
+		{PageInfo{Page: 1, PerPage: 10, Total: 11}, 2, false, true},
+		{PageInfo{Page: 2, PerPage: 10, Total: 11}, 2, true, false},
+		{PageInfo{Page: 1, PerPage: 0, Total: 5}, 0, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.info.Pages(); got != tt.pages {
+			t.Errorf("%+v: Pages() = %d, want %d", tt.info, got, tt.pages)
+		}
+		if got := tt.info.HasPrev(); got != tt.hasPrev {
+			t.Errorf("%+v: HasPrev() = %v, want %v", tt.info, got, tt.hasPrev)
+		}
+		if got := tt.info.HasNext(); got != tt.hasNext {
+			t.Errorf("%+v: HasNext() = %v, want %v", tt.info, got, tt.hasNext)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package jit
+
+import (
+	"encoding/binary"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// packedPath is a path of child indices encoded as unsigned varints, one
+// after another, which the render loop follows in place of the exported
+// []int Path. Almost every index is below 128 and takes a single byte,
+// against eight for an int, and the string header is smaller than a slice
+// header, so the ops a render walks stay small. Being a string it is
+// immutable, so plans and ops can share it freely, and two paths compare
+// equal with ==.
+type packedPath string
+
+// packPath encodes path.
+func packPath(path []int) packedPath {
+	b := make([]byte, 0, len(path))
+	for _, idx := range path {
+		b = binary.AppendUvarint(b, uint64(idx))
+	}
+	return packedPath(b)
+}
+
+// or returns p, or path packed if p is empty and path is not - for an
+// element built by hand with only its exported Path set.
+func (p packedPath) or(path []int) packedPath {
+	if p == "" && len(path) > 0 {
+		return packPath(path)
+	}
+	return p
+}
+
+// ints decodes p. It allocates, so it is kept off the render path - use
+// resolve there.
+func (p packedPath) ints() []int {
+	path := make([]int, 0, p.depth())
+	for i := 0; i < len(p); {
+		idx, n := p.next(i)
+		path = append(path, idx)
+		i = n
+	}
+	return path
+}
+
+// depth returns the number of indices in p.
+func (p packedPath) depth() int {
+	depth := 0
+	for i := range len(p) {
+		if p[i] < 0x80 {
+			depth++ // The last byte of each varint has the high bit clear
+		}
+	}
+	return depth
+}
+
+// next decodes the index starting at byte i and returns it with the
+// position of the one after.
+func (p packedPath) next(i int) (int, int) {
+	b := p[i]
+	i++
+	if b < 0x80 {
+		return int(b), i
+	}
+	idx, shift := int(b&0x7f), 7
+	for i < len(p) {
+		b = p[i]
+		i++
+		idx |= int(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+		shift += 7
+	}
+	return idx, i
+}
+
+// resolve follows p from root like the package-level resolve, decoding as
+// it goes so nothing is allocated.
+func (p packedPath) resolve(root node.Node) (node.Node, bool) {
+	n := root
+	for i := 0; i < len(p); {
+		var idx int
+		if b := p[i]; b < 0x80 {
+			idx, i = int(b), i+1 // Single-byte index, inlined for the common case
+		} else {
+			idx, i = p.next(i)
+		}
+		children := n.Nodes()
+		if idx >= len(children) {
+			return nil, false
+		}
+		n = children[idx]
+	}
+	return n, true
+}
@@ -0,0 +1,72 @@
+package jit
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestPackedPathRoundTrip verifies that paths decode to what was packed,
+// including indices that need more than one varint byte, and that the
+// common case takes one byte per level.
+func TestPackedPathRoundTrip(t *testing.T) {
+	paths := [][]int{{}, {0}, {1, 0, 3}, {127, 128, 300}, {1 << 20, 0, 1<<31 - 1}}
+	for _, path := range paths {
+		p := packPath(path)
+		if got := p.ints(); !slices.Equal(got, path) {
+			t.Errorf("packed %v decoded to %v", path, got)
+		}
+		if got := p.depth(); got != len(path) {
+			t.Errorf("packed %v should have depth %d, got %d", path, len(path), got)
+		}
+	}
+	if got := len(packPath([]int{1, 0, 3, 127})); got != 4 {
+		t.Errorf("indices below 128 should take one byte each, got %d bytes for 4", got)
+	}
+}
+
+// TestPackedPathResolve verifies that resolving a packed path finds the
+// same node as the unpacked one, rejects paths the tree does not have,
+// and allocates nothing.
+func TestPackedPathResolve(t *testing.T) {
+	children := make([]node.Node, 200)
+	for i := range children {
+		children[i] = span.Static("x")
+	}
+	target := span.New(span.Text("here"))
+	children[150] = div.New(span.Static("a"), target)
+	root := div.New(children...)
+
+	p := packPath([]int{150, 1})
+	n, ok := p.resolve(root)
+	if !ok || n != target {
+		t.Fatalf("packed path should resolve to the target node, got %v, %v", n, ok)
+	}
+	if _, ok := packPath([]int{150, 2}).resolve(root); ok {
+		t.Error("path past the last child should not resolve")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { p.resolve(root) }); allocs != 0 {
+		t.Errorf("resolve should not allocate, got %v allocations", allocs)
+	}
+}
+
+// TestDynamicPathBuiltByHand verifies that an element given only its
+// exported Path renders from it once its plan is laid out.
+func TestDynamicPathBuiltByHand(t *testing.T) {
+	plan := &ExecutionPlan{Elements: []CompiledElement{
+		&StaticContent{Content: []byte("<div>")},
+		&DynamicPath{Path: []int{1}},
+		&StaticContent{Content: []byte("</div>")},
+	}}
+	plan.layout(false)
+
+	var buf bytes.Buffer
+	plan.run(div.New(span.Static("a"), span.Text("b")), nil, &buf)
+	if got := buf.String(); got != "<div><span>b</span></div>" {
+		t.Errorf("hand-built path should resolve from Path, got %q", got)
+	}
+}
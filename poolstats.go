@@ -0,0 +1,92 @@
+package jit
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// PoolStats counts how a renderer's buffers behaved, to show whether the
+// adaptive sizer is actually removing reallocations. Only renders to a
+// writer borrow from a buffer pool - Fluent's, or the compiler's own with
+// CompilerCfg.LocalPool - so only they are counted.
+//
+// A hit is a pooled buffer that already had room for the predicted size,
+// so the render started without allocating; a miss had to grow to the
+// prediction first. A resize is a render whose output outgrew the buffer
+// part way through, meaning the prediction was too small. With a settled
+// sizer and a warm pool, Misses and Resizes should stop increasing.
+type PoolStats struct {
+	Gets    int64 // Buffers borrowed from the pool
+	Hits    int64 // Borrowed buffers already large enough for the prediction
+	Misses  int64 // Borrowed buffers that had to grow to the prediction
+	Resizes int64 // Renders that grew the buffer beyond the prediction
+}
+
+// PoolStats returns the compiler's buffer pool counters. They are only
+// collected when CompilerCfg.PoolStats is set, and are zero otherwise.
+func (jc *Compiler) PoolStats() PoolStats {
+	return jc.pool.stats()
+}
+
+// PoolStats returns the tuner's buffer pool counters. They are only
+// collected when TunerCfg.PoolStats is set, and are zero otherwise.
+func (jt *Tuner) PoolStats() PoolStats {
+	return jt.pool.stats()
+}
+
+// poolCounter wraps a buffer pool to count hits, misses and resizes. lp is
+// the pool to use, nil for Fluent's. A nil counter passes straight through,
+// so renderers that are not instrumented pay only a nil check.
+type poolCounter struct {
+	gets    atomic.Int64
+	hits    atomic.Int64
+	misses  atomic.Int64
+	resizes atomic.Int64
+}
+
+// get borrows a buffer with room for hint bytes and returns its capacity,
+// which put compares against to detect a resize.
+//
+// Pools grow a buffer to the hint before returning it, which hides
+// whether that allocated. So the counter asks for the smallest hint that
+// still selects the same pool - for Fluent's, zero for the small pool and
+// the threshold for the large one - checks the capacity it got, and grows
+// it itself.
+func (pc *poolCounter) get(lp *localPool, hint int) (*bytes.Buffer, int) {
+	if pc == nil {
+		buf := lp.get(hint)
+		return buf, buf.Cap()
+	}
+
+	buf := lp.get(lp.probe(hint))
+	pc.gets.Add(1)
+	if buf.Cap() >= hint {
+		pc.hits.Add(1)
+	} else {
+		pc.misses.Add(1)
+		buf.Grow(hint)
+	}
+	return buf, buf.Cap()
+}
+
+// put counts a resize if buf outgrew the capacity get returned, then
+// returns it to the pool.
+func (pc *poolCounter) put(lp *localPool, buf *bytes.Buffer, capacity int) {
+	if pc != nil && buf.Cap() > capacity {
+		pc.resizes.Add(1)
+	}
+	lp.put(buf)
+}
+
+// stats snapshots the counters.
+func (pc *poolCounter) stats() PoolStats {
+	if pc == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Gets:    pc.gets.Load(),
+		Hits:    pc.hits.Load(),
+		Misses:  pc.misses.Load(),
+		Resizes: pc.resizes.Load(),
+	}
+}
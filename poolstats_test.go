@@ -0,0 +1,78 @@
+package jit
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// poolPage renders a static paragraph and a dynamic span of size bytes.
+func poolPage(size int) node.Node {
+	return div.New(p.Static("header"), span.Text(strings.Repeat("x", size)))
+}
+
+// TestPoolStatsCountsWriterRenders verifies that every render to a writer
+// is counted once as either a hit or a miss, and that renders returning
+// bytes, which do not use the pool, are not counted.
+func TestPoolStatsCountsWriterRenders(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, PoolStats: true})
+	for range 10 {
+		compiler.Render(poolPage(100), io.Discard)
+	}
+	compiler.Render(poolPage(100))
+
+	stats := compiler.PoolStats()
+	if stats.Gets != 10 {
+		t.Errorf("expected 10 gets for 10 writer renders, got %d", stats.Gets)
+	}
+	if stats.Hits+stats.Misses != stats.Gets {
+		t.Errorf("hits and misses should add up to gets: %+v", stats)
+	}
+}
+
+// TestPoolStatsCountsResize verifies that a render outgrowing its buffer is
+// counted. The output is larger than Fluent keeps in its pool, so no pooled
+// buffer can already be big enough.
+func TestPoolStatsCountsResize(t *testing.T) {
+	tuner := NewTuner(&TunerCfg{Max: 5, Variance: 20, GrowthFactor: 115, PoolStats: true})
+	tuner.Tune(poolPage(300 * 1024)).Render(io.Discard)
+
+	if got := tuner.PoolStats().Resizes; got != 1 {
+		t.Errorf("expected the first render to resize, got %d resizes", got)
+	}
+}
+
+// TestPoolStatsDisabled verifies that counters stay zero unless enabled.
+func TestPoolStatsDisabled(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(poolPage(100), io.Discard)
+	if got := compiler.PoolStats(); got != (PoolStats{}) {
+		t.Errorf("expected zero stats without PoolStats, got %+v", got)
+	}
+}
+
+// BenchmarkCompilerPoolStats reports misses and resizes per render once
+// the sizer has settled, which should both be close to zero.
+func BenchmarkCompilerPoolStats(b *testing.B) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Max: 5, Variance: 20, GrowthFactor: 115, PoolStats: true})
+	page := poolPage(8 * 1024)
+	for range 10 {
+		compiler.Render(page, io.Discard)
+	}
+	before := compiler.PoolStats()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		compiler.Render(page, io.Discard)
+	}
+
+	after := compiler.PoolStats()
+	b.ReportMetric(float64(after.Misses-before.Misses)/float64(b.N), "misses/op")
+	b.ReportMetric(float64(after.Resizes-before.Resizes)/float64(b.N), "resizes/op")
+}
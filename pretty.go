@@ -0,0 +1,196 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+	"slices"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// RenderPretty renders root like Render, but with static content laid out
+// one tag per line as CompilerCfg.Pretty does, so output can be read and
+// diffed by eye during development. Render is unaffected: the indented
+// layout is an alternate set of static content kept beside the plan, not a
+// replacement for it.
+//
+// The alternate set is built from root the first time RenderPretty is
+// called for a plan, so production renders never pay for it, and rebuilt
+// after each recompile. Pretty renders do not feed the adaptive sizer or
+// the latency histogram, which are for production output, but
+// CompilerCfg.RecoverPanics applies as for Render.
+func (jc *Compiler) RenderPretty(root node.Node, w ...io.Writer) []byte {
+	plan := jc.prettyPlan(jc.currentPlan(root), root)
+
+	buf := bytes.NewBuffer(make([]byte, 0, jc.predict()+jc.predict()/2))
+	jc.recovering(buf, root, func() { plan.run(root, nil, buf) })
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// prettyPlan returns plan with indented static content, building it from
+// root if this is the first pretty render since plan was compiled. A
+// compiler already set to Pretty renders its plan unchanged.
+func (jc *Compiler) prettyPlan(plan *ExecutionPlan, root node.Node) *ExecutionPlan {
+	if jc.settings.pretty || plan == jc.fallback {
+		return plan
+	}
+	if pretty := plan.pretty.Load(); pretty != nil {
+		return pretty
+	}
+	// Markup was checked when the plan compiled; checking the indented
+	// copy would report every problem twice.
+	s := jc.settings
+	s.pretty, s.minify, s.intern, s.markup = true, false, false, nil
+	pretty := buildPlan(root, s)
+	pretty.apply(s)
+	// Concurrent first pretty renders may each build one; any will do.
+	plan.pretty.CompareAndSwap(nil, pretty)
+	return plan.pretty.Load()
+}
+
+// prettyIndent is the indentation added per level of nesting.
+const prettyIndent = "  "
+
+// prettyState is the layout state carried from one static chunk of a plan
+// to the next, as minifyChunk carries raw.
+type prettyState struct {
+	depth     int    // Element nesting depth
+	raw       string // Raw-text element open, or ""
+	lead      bool   // The next line needs a newline before it
+	afterOpen bool   // The last thing written was an opening tag
+	inline    bool   // Content was written on the opening tag's line, so its closing tag follows on it
+}
+
+// chunk re-lays out a static chunk with one tag or text run per line,
+// indented by nesting depth. An element holding only text, such as
+// <p>Hello</p>, stays on one line. Text is trimmed, so whitespace between
+// inline elements may change; this is for reading, not for production.
+// Content of raw-text elements is copied unchanged.
+//
+// next is the plan element after the chunk, or nil. The plan says where
+// dynamic content sits without it having to be parsed at render time: a
+// dynamic text node straight after an opening tag stays on that line, and
+// anything else starts on a line of its own at the current depth.
+func (ps *prettyState) chunk(chunk []byte, next CompiledElement) []byte {
+	out := make([]byte, 0, len(chunk)+len(chunk)/2)
+	out = ps.layout(out, chunk)
+
+	if next == nil || ps.raw != "" {
+		return out
+	}
+	if dp, ok := next.(*DynamicPath); ok && ps.afterOpen && !dp.OpenTag && len(dp.Tags) > 0 && dp.Tags[len(dp.Tags)-1] == "text" {
+		ps.inline = true
+	} else {
+		out = prettyLine(out, ps.depth)
+		ps.inline = false
+	}
+	ps.afterOpen, ps.lead = false, true
+	return out
+}
+
+// layout appends chunk to out, laid out line by line.
+func (ps *prettyState) layout(out, chunk []byte) []byte {
+	line := func() {
+		if ps.lead {
+			out = prettyLine(out, ps.depth)
+		}
+		ps.lead = true
+	}
+
+	i := 0
+	for i < len(chunk) {
+		if ps.raw != "" {
+			end := indexCloseTag(chunk[i:], ps.raw)
+			if end < 0 {
+				return append(out, chunk[i:]...)
+			}
+			out = append(out, chunk[i:i+end]...)
+			i += end
+			ps.raw = ""
+			// The closing tag stays on the content's last line, since a
+			// newline inside a pre would be rendered.
+			ps.afterOpen, ps.inline = false, true
+			continue
+		}
+
+		if chunk[i] != '<' {
+			end := bytes.IndexByte(chunk[i:], '<')
+			if end < 0 {
+				end = len(chunk) - i
+			}
+			text := bytes.TrimSpace(chunk[i : i+end])
+			i += end
+			if len(text) == 0 {
+				continue
+			}
+			if ps.afterOpen && bytes.HasPrefix(chunk[i:], []byte("</")) {
+				ps.inline = true
+			} else {
+				line()
+			}
+			out = append(out, text...)
+			ps.afterOpen = false
+			continue
+		}
+
+		if bytes.HasPrefix(chunk[i:], []byte("<!--")) {
+			end := bytes.Index(chunk[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, chunk[i:]...)
+			}
+			line()
+			out = append(out, chunk[i:i+4+end+3]...)
+			i += 4 + end + 3
+			ps.afterOpen, ps.inline = false, false
+			continue
+		}
+
+		end := tagEnd(chunk[i:])
+		if end < 0 {
+			return append(out, chunk[i:]...)
+		}
+		tag := chunk[i : i+end]
+		i += end
+
+		closing := len(tag) > 1 && tag[1] == '/'
+		if closing {
+			ps.depth = max(ps.depth-1, 0)
+		}
+		if !closing || (!ps.afterOpen && !ps.inline) {
+			line()
+		}
+		out = append(out, tag...)
+		ps.afterOpen, ps.inline = false, false
+		if !closing && tag[1] != '!' && tag[1] != '?' && !prettyVoid(tag) {
+			ps.depth++
+			ps.afterOpen = true
+			ps.raw = openedRawElement(tag)
+		}
+	}
+	return out
+}
+
+// prettyLine starts a new line indented to depth.
+func prettyLine(out []byte, depth int) []byte {
+	out = append(out, '\n')
+	for range depth {
+		out = append(out, prettyIndent...)
+	}
+	return out
+}
+
+// prettyVoid reports whether tag opens an element with no closing tag.
+func prettyVoid(tag []byte) bool {
+	if bytes.HasSuffix(tag, []byte("/>")) {
+		return true
+	}
+	name := tag[1:]
+	if end := bytes.IndexAny(name, " \t\n\r\f/>"); end >= 0 {
+		name = name[:end]
+	}
+	return slices.Contains(voidElements, string(bytes.ToLower(name)))
+}
@@ -0,0 +1,103 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/body"
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/img"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/pre"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestPrettyIndentsStaticAndDynamic verifies that static markup is laid out
+// one tag per line by depth, that dynamic content starts on its own line
+// at its depth, and that text-only elements stay on one line.
+func TestPrettyIndentsStaticAndDynamic(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Pretty: true})
+	tree := func(name string) node.Node {
+		return body.New(
+			h1.Static("Title"),
+			div.New(img.New().Src("a.png"), span.Text(name)),
+			ul.New(li.Static("one"), li.Static("two")),
+		)
+	}
+	compiler.Render(tree("Alice"))
+	got := string(compiler.Render(tree("Bob")))
+
+	want := `<body>
+  <h1>Title</h1>
+  <div>
+    <img src="a.png" />
+    <span>Bob</span>
+  </div>
+  <ul>
+    <li>one</li>
+    <li>two</li>
+  </ul>
+</body>`
+	if got != want {
+		t.Errorf("pretty output mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestPrettyKeepsRawText verifies that content of a pre is left exactly as
+// written, closing tag included.
+func TestPrettyKeepsRawText(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Pretty: true})
+	got := string(compiler.Render(div.New(pre.Static("  a\n  b"), p.Static("after"))))
+
+	want := "<div>\n  <pre>  a\n  b</pre>\n  <p>after</p>\n</div>"
+	if got != want {
+		t.Errorf("pre content should be untouched:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+// TestPrettyIndentsConditionalBranches verifies that a conditional branch,
+// compiled as a separate plan, is indented to where the conditional sits.
+func TestPrettyIndentsConditionalBranches(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Pretty: true})
+	tree := func(admin bool) node.Node {
+		return div.New(node.When(admin, p.Static("admin")), span.Static("end"))
+	}
+	compiler.Render(tree(true))
+
+	want := "<div>\n  <p>admin</p>\n  <span>end</span>\n</div>"
+	if got := string(compiler.Render(tree(true))); got != want {
+		t.Errorf("compiled branch mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+// TestRenderPrettyLeavesRenderAlone verifies that RenderPretty indents the
+// output of a compiler not set to Pretty, that Render keeps producing
+// compact output alongside it, and that a recompile rebuilds the indented
+// copy.
+func TestRenderPrettyLeavesRenderAlone(t *testing.T) {
+	compiler := NewCompiler()
+	tree := func(name string) node.Node {
+		return div.New(h1.Static("Title"), span.Text(name))
+	}
+	compact := "<div><h1>Title</h1><span>Alice</span></div>"
+	if got := string(compiler.Render(tree("Alice"))); got != compact {
+		t.Fatalf("unexpected compact output %q", got)
+	}
+
+	want := "<div>\n  <h1>Title</h1>\n  <span>Bob</span>\n</div>"
+	if got := string(compiler.RenderPretty(tree("Bob"))); got != want {
+		t.Errorf("pretty output mismatch:\ngot:  %q\nwant: %q", got, want)
+	}
+	if got := string(compiler.Render(tree("Alice"))); got != compact {
+		t.Errorf("Render should be unaffected by RenderPretty, got %q", got)
+	}
+
+	compiler.Recompile(div.New(h1.Static("New"), span.Text("x")))
+	want = "<div>\n  <h1>New</h1>\n  <span>Bob</span>\n</div>"
+	if got := string(compiler.RenderPretty(div.New(h1.Static("New"), span.Text("Bob")))); got != want {
+		t.Errorf("pretty copy should follow a recompile:\ngot:  %q\nwant: %q", got, want)
+	}
+}
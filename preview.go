@@ -0,0 +1,97 @@
+package jit
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// Preview renders root up to maxBytes and closes whatever elements are open
+// at that point, so the result is valid HTML: for previews, feed snippets
+// and admin listings. If the whole page fits it is returned as Render would.
+//
+// The plan is run element by element and stops as soon as the budget is
+// spent, so dynamic content past it is never evaluated. The cut is moved
+// back so it never splits a tag, a comment, a character reference or a
+// UTF-8 sequence, and a script or style that would be cut is dropped
+// whole. maxBytes bounds the content; the closing tags are added after it.
+//
+// Example:
+//
+//	snippet := articleCompiler.Preview(Article(post), 500)
+func (jc *Compiler) Preview(root node.Node, maxBytes int) []byte {
+	plan := jc.currentPlan(root)
+
+	var buf bytes.Buffer
+	buf.Grow(min(jc.predict(), maxBytes+256))
+	jc.recovering(&buf, root, func() {
+		nodes := jc.resolved(plan, root)
+		for i := range plan.ops {
+			if buf.Len() > maxBytes {
+				break
+			}
+			op := &plan.ops[i]
+			if op.kind == opStatic {
+				buf.Write(op.static)
+				continue
+			}
+			op.render(root, nodes, &buf)
+		}
+	})
+	if buf.Len() <= maxBytes {
+		return buf.Bytes()
+	}
+	return previewClose(buf.Bytes(), max(maxBytes, 0))
+}
+
+// previewClose truncates b to at most n bytes at a point that leaves only
+// complete markup, then appends a closing tag for each element still open.
+func previewClose(b []byte, n int) []byte {
+	cut := previewCut(b, n)
+
+	s := markupScan{ids: make(map[string]bool)}
+	s.scan(b[:cut])
+	if s.raw != "" {
+		// Half a script or style is worse than none.
+		cut = lastIndexFold(b[:cut], "<"+s.raw)
+		s = markupScan{ids: make(map[string]bool)}
+		s.scan(b[:cut])
+	}
+
+	out := b[:cut:cut] // cap it so the closing tags do not overwrite the rest of b
+	for i := len(s.open) - 1; i >= 0; i-- {
+		out = append(out, "</"+s.open[i]+">"...)
+	}
+	return out
+}
+
+// previewCut returns the largest cut of b no longer than n that does not
+// end inside a UTF-8 sequence, tag, comment or character reference.
+func previewCut(b []byte, n int) int {
+	cut := min(n, len(b))
+	for cut > 0 && cut < len(b) && !utf8.RuneStart(b[cut]) {
+		cut--
+	}
+	if open := bytes.LastIndex(b[:cut], []byte("<!--")); open >= 0 && !bytes.Contains(b[open:cut], []byte("-->")) {
+		cut = open
+	}
+	if lt := bytes.LastIndexByte(b[:cut], '<'); lt >= 0 && tagEnd(b[lt:cut]) < 0 {
+		cut = lt
+	}
+	if amp := bytes.LastIndexByte(b[:cut], '&'); amp >= 0 && cut-amp <= 10 && bytes.IndexByte(b[amp:cut], ';') < 0 && !bytes.ContainsAny(b[amp:cut], " \t\n<") {
+		cut = amp
+	}
+	return cut
+}
+
+// lastIndexFold returns the index of the last case-insensitive match of sep
+// in b, or 0 if there is none.
+func lastIndexFold(b []byte, sep string) int {
+	for i := len(b) - len(sep); i >= 0; i-- {
+		if bytes.EqualFold(b[i:i+len(sep)], []byte(sep)) {
+			return i
+		}
+	}
+	return 0
+}
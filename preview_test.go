@@ -0,0 +1,92 @@
+package jit
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/script"
+	"github.com/jpl-au/fluent/html5/section"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestPreviewClosesOpenElements verifies that a truncated preview ends
+// with the closing tags of every element open at the cut.
+func TestPreviewClosesOpenElements(t *testing.T) {
+	compiler := NewCompiler()
+	tree := section.New(
+		h1.Static("Title"),
+		ul.New(li.Text("first item"), li.Text("second item")),
+		p.Static("never reached"),
+	)
+	full := string(compiler.Render(tree))
+	cut := strings.Index(full, "first") + len("first")
+
+	got := string(compiler.Preview(tree, cut))
+	want := "<section><h1>Title</h1><ul><li>first</li></ul></section>"
+	if got != want {
+		t.Errorf("preview should close open elements:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestPreviewNeverSplitsMarkup verifies that the cut moves back rather
+// than ending inside a tag, a character reference or a multi-byte rune.
+func TestPreviewNeverSplitsMarkup(t *testing.T) {
+	compiler := NewCompiler()
+	tree := section.New(p.Text("Fish & chips – café"), p.Static("next").Class("x"))
+	full := string(compiler.Render(tree))
+
+	for n := range len(full) {
+		got := string(compiler.Preview(tree, n))
+		if strings.Count(got, "<") != strings.Count(got, ">") {
+			t.Errorf("preview at %d splits a tag: %q", n, got)
+		}
+		if i := strings.LastIndex(got, "&"); i >= 0 && !strings.Contains(got[i:], ";") {
+			t.Errorf("preview at %d splits a character reference: %q", n, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("preview at %d splits a rune: %q", n, got)
+		}
+	}
+}
+
+// TestPreviewDropsPartialScript verifies that a script cut part way through
+// is left out entirely.
+func TestPreviewDropsPartialScript(t *testing.T) {
+	compiler := NewCompiler()
+	tree := section.New(p.Static("intro"), script.Text("let x = '<b>';"), p.Static("after"))
+	full := string(compiler.Render(tree))
+
+	got := string(compiler.Preview(tree, strings.Index(full, "x =")))
+	if want := "<section><p>intro</p></section>"; got != want {
+		t.Errorf("partial script should be dropped:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestPreviewSkipsDynamicPastBudget verifies that dynamic content after the
+// budget is spent is never evaluated, and that a page within budget
+// renders in full.
+func TestPreviewSkipsDynamicPastBudget(t *testing.T) {
+	compiler := NewCompiler()
+	calls := 0
+	tree := func() node.Node {
+		return section.New(p.Static(strings.Repeat("x", 100)), node.Func(func() node.Node {
+			calls++
+			return p.Text("late")
+		}))
+	}
+	compiler.Render(tree())
+	calls = 0
+
+	compiler.Preview(tree(), 50)
+	if calls != 0 {
+		t.Errorf("dynamic content past the budget should not render, rendered %d times", calls)
+	}
+	if got, want := string(compiler.Preview(tree(), 1000)), string(compiler.Render(tree())); got != want {
+		t.Errorf("a page within budget should render in full:\n  got  %q\n  want %q", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// Pure marks n as deterministic: its output never changes between renders,
+// even though it is built by a function or contains dynamic text. The
+// compiler evaluates it once, when the plan is built, and bakes the output
+// into static content, and a Flattener accepts it like any static node.
+//
+// Use it for components such as a navigation menu built from a fixed
+// config, or a node.Func that formats constants. Anything that reads
+// per-request state must not be wrapped - its first output would be served
+// to every request.
+//
+// A pure node has no children to tree walkers, so the Differ and
+// RenderRequest do not see keys inside it.
+//
+// Example:
+//
+//	div.New(
+//	    jit.Pure(node.Func(func() node.Node { return Nav(siteMenu) })),
+//	    main.New(span.Text(user.Name)),
+//	)
+func Pure(n node.Node) node.Node {
+	return &pure{n: n}
+}
+
+// pure is the node behind Pure. It reports itself as static and hides its
+// children, so the compiler renders it whole into the surrounding static
+// chunk instead of finding the dynamic nodes within it.
+type pure struct {
+	n node.Node
+}
+
+// Render renders the wrapped node.
+func (p *pure) Render(w ...io.Writer) []byte {
+	buf := fluent.NewBuffer()
+	p.RenderBuilder(buf)
+
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// RenderBuilder renders the wrapped node into buf.
+func (p *pure) RenderBuilder(buf *bytes.Buffer) {
+	if p.n != nil {
+		p.n.RenderBuilder(buf)
+	}
+}
+
+// Nodes returns nothing so the wrapped node is treated as a single leaf.
+func (p *pure) Nodes() []node.Node { return nil }
+
+// IsDynamic returns false - that is the promise Pure makes.
+func (p *pure) IsDynamic() bool { return false }
+
+// DynamicKey returns "" - pure content is not tracked by the diff engine.
+func (p *pure) DynamicKey() string { return "" }
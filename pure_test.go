@@ -0,0 +1,49 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestPureIsBakedIntoStaticContent verifies that a pure function is
+// evaluated once, when the plan is built, and its output frozen.
+func TestPureIsBakedIntoStaticContent(t *testing.T) {
+	calls := 0
+	nav := Pure(node.Func(func() node.Node {
+		calls++
+		return span.Text("menu")
+	}))
+
+	compiler := NewCompiler()
+	page := func(name string) node.Node { return div.New(nav, span.Text(name)) }
+
+	compiler.Render(page("Alice"))
+	calls = 0
+	got := string(compiler.Render(page("Bob")))
+
+	if want := "<div><span>menu</span><span>Bob</span></div>"; got != want {
+		t.Errorf("unexpected output:\n  got  %q\n  want %q", got, want)
+	}
+	if calls != 0 {
+		t.Errorf("pure function should not be called after compilation, called %d times", calls)
+	}
+	if n := len(compiler.Slots()); n != 1 {
+		t.Errorf("only the name should be a dynamic slot, got %d", n)
+	}
+}
+
+// TestPureCanBeFlattened verifies that a tree whose only dynamic content is
+// pure is accepted by a Flattener.
+func TestPureCanBeFlattened(t *testing.T) {
+	tree := div.New(Pure(node.Func(func() node.Node { return span.Text("menu") })))
+	f, err := NewFlattener(tree)
+	if err != nil {
+		t.Fatalf("pure content should flatten: %v", err)
+	}
+	if got, want := string(f.Render()), "<div><span>menu</span></div>"; got != want {
+		t.Errorf("unexpected output:\n  got  %q\n  want %q", got, want)
+	}
+}
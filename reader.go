@@ -0,0 +1,106 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// Reader returns root's compiled output as an io.Reader, for APIs that pull
+// rather than push: request bodies, multipart parts, or a compressor fed
+// with io.Copy. Nothing is rendered until the first Read or WriteTo.
+//
+// The reader also implements io.WriterTo, so io.Copy renders straight into
+// the destination through a pooled buffer, as Render(root, w) does, without
+// handing the caller an intermediate []byte. A reader produces its output
+// once; read it to EOF so its pooled buffer is returned.
+//
+// Example:
+//
+//	gz := gzip.NewWriter(w)
+//	io.Copy(gz, compiler.Reader(Page(data)))
+//	gz.Close()
+func (jc *Compiler) Reader(root node.Node) io.Reader {
+	return &renderReader{jc: jc, root: root}
+}
+
+// renderReader renders its tree on first use. buf is nil before then and
+// after the output has been consumed.
+type renderReader struct {
+	jc   *Compiler
+	root node.Node
+	buf  *bytes.Buffer
+	done bool
+}
+
+// Read renders on the first call, then returns the output in pieces.
+func (rr *renderReader) Read(p []byte) (int, error) {
+	if rr.done {
+		return 0, io.EOF
+	}
+	if rr.buf == nil {
+		rr.render()
+	}
+	n, _ := rr.buf.Read(p)
+	if rr.buf.Len() == 0 {
+		rr.finish()
+		if n == 0 {
+			return 0, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// WriteTo renders straight to w, or writes whatever Read has not yet
+// returned if reading has already begun.
+func (rr *renderReader) WriteTo(w io.Writer) (int64, error) {
+	if rr.done {
+		return 0, nil
+	}
+	if rr.buf != nil {
+		n, err := rr.buf.WriteTo(w)
+		rr.finish()
+		return n, err
+	}
+	rr.done = true
+	cw := &countingWriter{w: w}
+	rr.jc.Render(rr.root, cw)
+	return cw.n, cw.err
+}
+
+// render renders the tree into a pooled buffer for Read to hand out.
+func (rr *renderReader) render() {
+	jc := rr.jc
+	plan := jc.currentPlan(rr.root)
+	predictedSize := jc.predict()
+	rr.buf = fluent.NewBuffer(predictedSize)
+	jc.execute(plan, rr.root, rr.buf)
+	jc.record(predictedSize, rr.buf.Len())
+}
+
+// finish returns the buffer to the pool and marks the reader drained.
+func (rr *renderReader) finish() {
+	fluent.PutBuffer(rr.buf)
+	rr.buf = nil
+	rr.done = true
+}
+
+// countingWriter counts the bytes written to w and keeps the first error,
+// which Render does not return.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
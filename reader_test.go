@@ -0,0 +1,70 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestReaderMatchesRender verifies that reading a render to EOF, in small
+// pieces, yields exactly what Render returns.
+func TestReaderMatchesRender(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(p.Static("Hello"), span.Text("Alice"))
+	want := compiler.Render(tree)
+
+	if err := iotest.TestReader(compiler.Reader(tree), want); err != nil {
+		t.Error(err)
+	}
+	got, err := io.ReadAll(iotest.OneByteReader(compiler.Reader(tree)))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("byte-at-a-time read should match Render:\n  got  %q (%v)\n  want %q", got, err, want)
+	}
+}
+
+// TestReaderWriteTo verifies that io.Copy uses WriteTo, reporting the bytes
+// written, and that a reader produces its output only once.
+func TestReaderWriteTo(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(p.Static("Hello"), span.Text("Bob"))
+	want := compiler.Render(tree)
+
+	r := compiler.Reader(tree)
+	if _, ok := r.(io.WriterTo); !ok {
+		t.Fatal("reader should implement io.WriterTo")
+	}
+	var out bytes.Buffer
+	n, err := io.Copy(&out, r)
+	if err != nil || n != int64(len(want)) || !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("io.Copy should write the render:\n  got  %q (%d bytes, %v)\n  want %q", out.Bytes(), n, err, want)
+	}
+	if n, _ := io.Copy(&out, r); n != 0 {
+		t.Errorf("a drained reader should write nothing, wrote %d bytes", n)
+	}
+}
+
+// TestReaderWriteToAfterRead verifies that WriteTo after a partial Read
+// writes only the rest of the output.
+func TestReaderWriteToAfterRead(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(p.Static("Hello"), span.Text("Carol"))
+	want := compiler.Render(tree)
+
+	r := compiler.Reader(tree)
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	var rest bytes.Buffer
+	if _, err := r.(io.WriterTo).WriteTo(&rest); err != nil {
+		t.Fatal(err)
+	}
+	if got := append(head, rest.Bytes()...); !bytes.Equal(got, want) {
+		t.Errorf("Read then WriteTo should yield the whole render:\n  got  %q\n  want %q", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package jit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetRefresh resamples the baseline every renders renders, or once period
+// has passed since it was set, whichever comes first, even if no render
+// deviated past the variance. Content that drifts slowly - a catalogue
+// growing a few products a day - never trips the variance in one render,
+// so without this the baseline set at startup is kept for good while
+// every render outgrows it a little more.
+//
+// A refresh returns to sampling like a deviating render does, keeping the
+// current baseline until the new samples are in, and is counted as
+// SizerStats.Refreshes rather than Resamples. A Compiler reports every
+// render to a sizer with a refresh, not only those deviating past
+// CompilerCfg.Threshold, so that renders are counted and the new samples
+// are not only the outliers. 0 turns off either limit; the statistics
+// are kept.
+func (as *AdaptiveSizer) SetRefresh(renders int, period time.Duration) {
+	atomic.StoreInt64(&as.refreshEvery, int64(max(renders, 0)))
+	atomic.StoreInt64(&as.refreshAfter, int64(max(period, 0)))
+}
+
+// refreshing reports whether a refresh is set, see SetRefresh.
+func (as *AdaptiveSizer) refreshing() bool {
+	return atomic.LoadInt64(&as.refreshEvery) > 0 || atomic.LoadInt64(&as.refreshAfter) > 0
+}
+
+// age counts a render in the baseline phase and returns to sampling if
+// the baseline is due a refresh.
+func (as *AdaptiveSizer) age() {
+	if !as.refreshing() || as.Active() {
+		return
+	}
+	aged := atomic.AddInt64(&as.aged, 1)
+	every := atomic.LoadInt64(&as.refreshEvery)
+	after := atomic.LoadInt64(&as.refreshAfter)
+	if (every > 0 && aged >= every) || (after > 0 && time.Now().UnixNano()-atomic.LoadInt64(&as.settledAt) >= after) {
+		as.refresh()
+	}
+}
+
+// refresh restarts sampling, keeping the baseline until it completes.
+func (as *AdaptiveSizer) refresh() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if atomic.LoadInt64(&as.active) == 1 {
+		return // another render refreshed or resampled meanwhile
+	}
+	as.sum = 0
+	atomic.StoreInt64(&as.count, 0)
+	as.samples = as.samples[:0]
+	as.clearWindow()
+	as.refreshes++
+	atomic.StoreInt64(&as.active, 1)
+}
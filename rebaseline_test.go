@@ -0,0 +1,41 @@
+package jit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAdaptiveSizerRefresh verifies that drift within the variance is
+// picked up on schedule, keeping the old baseline while resampling.
+func TestAdaptiveSizerRefresh(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.MustConfigure(2, 20, 100)
+	as.SetRefresh(10, 0)
+	as.UpdateStats(1000)
+	as.UpdateStats(1000)
+
+	for range 9 {
+		as.UpdateStats(1100)
+	}
+	if as.Active() {
+		t.Fatal("renders within the variance should not resample before the refresh is due")
+	}
+	as.UpdateStats(1100)
+	if st := as.Stats(); !st.Sampling || st.Baseline != 1000 || st.Refreshes != 1 || st.Resamples != 0 {
+		t.Fatalf("the 10th render should refresh, keeping the 1000 baseline, got %+v", st)
+	}
+	as.UpdateStats(1100)
+	if got := as.GetBaseline(); got != 1100 || as.Active() {
+		t.Errorf("the refresh should settle on the drifted 1100, got %d (sampling %v)", got, as.Active())
+	}
+
+	timed := NewAdaptiveSizer()
+	timed.MustConfigure(1, 20, 100)
+	timed.SetRefresh(0, time.Millisecond)
+	timed.UpdateStats(1000)
+	time.Sleep(2 * time.Millisecond)
+	timed.UpdateStats(1000)
+	if got := timed.Stats().Refreshes; got != 1 {
+		t.Errorf("a render after the period should refresh, got %d refreshes", got)
+	}
+}
@@ -0,0 +1,97 @@
+package jit
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// RefreshingFlattener serves content that is static between deploys of
+// something it does not control - a CMS snapshot, a feature flag file -
+// by flattening it again once it is older than a TTL. The rebuild runs in
+// the background, so requests always get the last good bytes straight
+// away, and a rebuild that fails leaves them in place.
+type RefreshingFlattener struct {
+	build   func() node.Node
+	ttl     time.Duration
+	cfg     *FlattenerCfg
+	current atomic.Pointer[Flattener] // Last good flattening
+	built   atomic.Int64              // When current was last built or a rebuild last failed, in Unix nanoseconds
+	running atomic.Bool               // Set while a background rebuild runs, so only one does
+
+	mu  sync.Mutex // Protects err
+	err error      // Why the last rebuild failed, or nil
+}
+
+// NewRefreshingFlattener flattens the tree returned by build, and again
+// in the background on the first render after it is older than ttl. The
+// first build runs before it returns, so there are always good bytes to
+// serve; its error, such as ErrDynamicContent, is returned.
+//
+// Example:
+//
+//	pricing, err := jit.NewRefreshingFlattener(func() node.Node {
+//	    return PricingPage(cms.Snapshot())
+//	}, 5*time.Minute)
+func NewRefreshingFlattener(build func() node.Node, ttl time.Duration, cfg ...*FlattenerCfg) (*RefreshingFlattener, error) {
+	rf := &RefreshingFlattener{build: build, ttl: ttl}
+	if len(cfg) > 0 {
+		rf.cfg = cfg[0]
+	}
+	if err := rf.Refresh(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Render writes the last good bytes to the writer or returns them, and
+// starts a background rebuild if they are older than the TTL.
+func (rf *RefreshingFlattener) Render(w ...io.Writer) []byte {
+	return rf.Flattener().Render(w...)
+}
+
+// Flattener returns the last good flattening, for its ETag or compressed
+// variants, and starts a background rebuild if it is older than the TTL.
+func (rf *RefreshingFlattener) Flattener() *Flattener {
+	if time.Since(time.Unix(0, rf.built.Load())) > rf.ttl && rf.running.CompareAndSwap(false, true) {
+		go func() {
+			defer rf.running.Store(false)
+			_ = rf.Refresh()
+		}()
+	}
+	return rf.current.Load()
+}
+
+// Refresh rebuilds the content now, for a deploy hook that knows it has
+// changed. On error the last good bytes are kept, the error is returned
+// and kept for Err, and the next rebuild waits for the TTL again. A build
+// that panics is reported as an error wrapping ErrBuildPanic.
+func (rf *RefreshingFlattener) Refresh() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = buildPanic(r)
+		}
+		rf.built.Store(time.Now().UnixNano())
+		rf.mu.Lock()
+		rf.err = err
+		rf.mu.Unlock()
+	}()
+
+	f, err := NewFlattener(rf.build(), rf.cfg)
+	if err != nil {
+		return err
+	}
+	rf.current.Store(f)
+	return nil
+}
+
+// Err returns why the last rebuild failed, or nil if it succeeded. A
+// failing rebuild is otherwise silent, since the old bytes are served.
+func (rf *RefreshingFlattener) Err() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.err
+}
@@ -0,0 +1,90 @@
+package jit
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestRefreshingFlattener verifies that stale content is served while the
+// rebuild runs in the background, and the new content after it finishes.
+func TestRefreshingFlattener(t *testing.T) {
+	var builds atomic.Int64
+	release := make(chan struct{})
+	rf, err := NewRefreshingFlattener(func() node.Node {
+		if builds.Add(1) == 1 {
+			return div.New(span.Static("v1"))
+		}
+		<-release
+		return div.New(span.Static("v2"))
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	for range 3 {
+		if got := string(rf.Render()); got != "<div><span>v1</span></div>" {
+			t.Errorf("stale content should be served while rebuilding, got %q", got)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for string(rf.Render()) != "<div><span>v2</span></div>" {
+		if time.Now().After(deadline) {
+			t.Fatal("background rebuild never served the new content")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := builds.Load(); n < 2 {
+		t.Errorf("expected a rebuild, got %d builds", n)
+	}
+}
+
+// TestRefreshingFlattenerKeepsLastGood verifies that a failing rebuild
+// leaves the last good bytes in place and reports why through Err.
+func TestRefreshingFlattenerKeepsLastGood(t *testing.T) {
+	var broken atomic.Bool
+	rf, err := NewRefreshingFlattener(func() node.Node {
+		if broken.Load() {
+			return div.New(span.Text("oops"))
+		}
+		return div.New(span.Static("good"))
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	broken.Store(true)
+	if err := rf.Refresh(); !errors.Is(err, ErrDynamicContent) {
+		t.Errorf("expected ErrDynamicContent, got %v", err)
+	}
+	if !errors.Is(rf.Err(), ErrDynamicContent) {
+		t.Errorf("Err should report the failed rebuild, got %v", rf.Err())
+	}
+	if got := string(rf.Render()); got != "<div><span>good</span></div>" {
+		t.Errorf("last good bytes should be kept, got %q", got)
+	}
+
+	broken.Store(false)
+	if err := rf.Refresh(); err != nil || rf.Err() != nil {
+		t.Errorf("a successful rebuild should clear Err, got %v, %v", err, rf.Err())
+	}
+}
+
+// TestRefreshingFlattenerFirstBuild verifies that a first build with
+// nothing good to fall back on is an error, panics included.
+func TestRefreshingFlattenerFirstBuild(t *testing.T) {
+	if _, err := NewRefreshingFlattener(func() node.Node { return span.Text("x") }, time.Hour); !errors.Is(err, ErrDynamicContent) {
+		t.Errorf("expected ErrDynamicContent, got %v", err)
+	}
+	if _, err := NewRefreshingFlattener(func() node.Node { panic("cms down") }, time.Hour); !errors.Is(err, ErrBuildPanic) {
+		t.Errorf("a panicking first build should be an error wrapping ErrBuildPanic, got %v", err)
+	}
+}
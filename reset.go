@@ -0,0 +1,137 @@
+package jit
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry selects the global registries Reset clears. Combine them with |.
+type Registry int
+
+const (
+	Compilers Registry = 1 << iota // templates registered by Compile, CompileConfig and Serve
+	Tuners                         // templates registered by Tune and TuneConfig
+	Flattened                      // content registered by Flatten
+
+	All = Compilers | Tuners | Flattened // every registry
+)
+
+// added records when each registry entry was created, for OlderThan.
+// Entries are registryKey -> time.Time.
+var added sync.Map
+
+// registryKey identifies one entry across the global registries.
+type registryKey struct {
+	registry Registry
+	id       string
+}
+
+// ResetOption narrows which entries Reset removes. An entry is removed only
+// if it matches every option given.
+type ResetOption func(*resetFilter)
+
+// resetFilter is the combined effect of a Reset call's options.
+type resetFilter struct {
+	prefix    string
+	olderThan time.Duration
+}
+
+// MatchPrefix removes only entries whose ID starts with prefix, such as
+// every template of one tenant.
+func MatchPrefix(prefix string) ResetOption {
+	return func(f *resetFilter) { f.prefix = prefix }
+}
+
+// OlderThan removes only entries registered more than d ago. An entry's
+// age counts from its creation, or from the last CompileConfig or
+// TuneConfig that replaced it, not from its last use.
+func OlderThan(d time.Duration) ResetOption {
+	return func(f *resetFilter) { f.olderThan = d }
+}
+
+// Reset removes entries from the selected global registries and returns
+// how many were removed. With no options every entry in them is removed;
+// options narrow that down, so operational cleanup such as dropping a
+// departed tenant's templates or evicting week-old entries registered
+// under dynamic IDs needs no list of IDs.
+//
+// Removed templates are rebuilt on next use, like those removed by
+// ResetCompile, ResetTune and ResetFlatten.
+//
+// Example:
+//
+//	jit.Reset(jit.All, jit.MatchPrefix("tenant:acme:"))
+//	jit.Reset(jit.Compilers|jit.Tuners, jit.OlderThan(24*time.Hour))
+func Reset(which Registry, opts ...ResetOption) int {
+	var f resetFilter
+	for _, opt := range opts {
+		opt(&f)
+	}
+
+	now := time.Now()
+	removed := 0
+	for _, reg := range []Registry{Compilers, Tuners, Flattened} {
+		if which&reg == 0 {
+			continue
+		}
+		m := reg.entries()
+		m.Range(func(key, _ any) bool {
+			id := key.(string) //nolint:forcetypeassert // only string IDs are stored
+			if f.matches(reg, id, now) {
+				m.Delete(id)
+				added.Delete(registryKey{reg, id})
+				removed++
+			}
+			return true
+		})
+	}
+	return removed
+}
+
+// matches reports whether the entry id in reg passes every filter.
+func (f *resetFilter) matches(reg Registry, id string, now time.Time) bool {
+	if !strings.HasPrefix(id, f.prefix) {
+		return false
+	}
+	if f.olderThan > 0 {
+		// An entry with no record was created before this package could
+		// see it; its age is unknown, so it is kept.
+		at, ok := added.Load(registryKey{reg, id})
+		if !ok || now.Sub(at.(time.Time)) <= f.olderThan { //nolint:forcetypeassert // only time.Time is stored
+			return false
+		}
+	}
+	return true
+}
+
+// entries returns the map behind a single registry.
+func (reg Registry) entries() *sync.Map {
+	switch reg {
+	case Tuners:
+		return &tuners
+	case Flattened:
+		return &flattened
+	default:
+		return &compilers
+	}
+}
+
+// markAdded records that id was just created or replaced in reg.
+func markAdded(reg Registry, id string) {
+	added.Store(registryKey{reg, id}, time.Now())
+}
+
+// resetIDs removes ids from reg, or every entry if there are none. It backs
+// the per-registry Reset functions.
+func resetIDs(reg Registry, ids []string) {
+	if len(ids) == 0 {
+		Reset(reg)
+		return
+	}
+	m := reg.entries()
+	for _, id := range ids {
+		m.Delete(id)
+		added.Delete(registryKey{reg, id})
+	}
+}
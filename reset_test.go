@@ -0,0 +1,91 @@
+package jit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// registered reports whether id is present in reg.
+func registered(reg Registry, id string) bool {
+	_, ok := reg.entries().Load(id)
+	return ok
+}
+
+// TestResetMatchPrefix verifies that only matching IDs are removed, across
+// every selected registry.
+func TestResetMatchPrefix(t *testing.T) {
+	defer Reset(All)
+
+	tree := div.New(span.Static("x"))
+	Compile("tenant:a:home", tree)
+	Compile("tenant:b:home", tree)
+	Tune("tenant:a:list", tree)
+	Flatten("tenant:a:footer", tree)
+
+	if n := Reset(All, MatchPrefix("tenant:a:")); n != 3 {
+		t.Errorf("expected 3 entries removed, got %d", n)
+	}
+	for _, e := range []struct {
+		reg Registry
+		id  string
+	}{{Compilers, "tenant:a:home"}, {Tuners, "tenant:a:list"}, {Flattened, "tenant:a:footer"}} {
+		if registered(e.reg, e.id) {
+			t.Errorf("%s should have been removed", e.id)
+		}
+	}
+	if !registered(Compilers, "tenant:b:home") {
+		t.Error("other tenant's template should be kept")
+	}
+}
+
+// TestResetSelectsRegistries verifies that unselected registries are left
+// alone.
+func TestResetSelectsRegistries(t *testing.T) {
+	defer Reset(All)
+
+	tree := div.New(span.Static("x"))
+	Compile("page", tree)
+	Tune("page", tree)
+
+	Reset(Tuners)
+	if registered(Tuners, "page") {
+		t.Error("tuner should have been removed")
+	}
+	if !registered(Compilers, "page") {
+		t.Error("compiler should be kept when only Tuners is reset")
+	}
+}
+
+// TestResetOlderThan verifies that only entries registered before the
+// cut-off are removed, and that options combine.
+func TestResetOlderThan(t *testing.T) {
+	defer Reset(All)
+
+	tree := div.New(span.Static("x"))
+	Compile("old", tree)
+	Compile("old-2", tree)
+	Compile("new", tree)
+	hourAgo := time.Now().Add(-time.Hour)
+	added.Store(registryKey{Compilers, "old"}, hourAgo)
+	added.Store(registryKey{Compilers, "old-2"}, hourAgo)
+
+	if n := Reset(Compilers, OlderThan(time.Minute), MatchPrefix("old")); n != 2 {
+		t.Errorf("expected both old entries removed, got %d", n)
+	}
+	if !registered(Compilers, "new") {
+		t.Error("recently registered template should be kept")
+	}
+}
+
+// TestResetCompileForgetsAge verifies that the per-registry functions
+// drop the age record along with the entry.
+func TestResetCompileForgetsAge(t *testing.T) {
+	Compile("aged", div.New(span.Static("x")))
+	ResetCompile("aged")
+	if _, ok := added.Load(registryKey{Compilers, "aged"}); ok {
+		t.Error("age record should be removed with the entry")
+	}
+}
@@ -0,0 +1,102 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// SegmentError reports one dynamic element of a plan that failed during a
+// render, so a page that was otherwise served can still be logged with
+// exactly which widgets were missing from it.
+type SegmentError struct {
+	Path string // The failed element's path, described by tag
+	Err  error  // ErrStructureMismatch, or an error wrapping the recovered panic
+}
+
+// Error returns the path and the cause.
+func (e *SegmentError) Error() string {
+	return fmt.Sprintf("segment %s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the cause, so errors.Is(err, ErrStructureMismatch) works
+// through a SegmentError.
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
+
+// RenderSegments renders like Render, but isolates each dynamic element: an
+// element that panics or whose path does not resolve is left out of the
+// output, and the rest of the page still renders. Every failure is returned
+// as a *SegmentError, joined, alongside the error from writing to w.
+//
+// Output is buffered, so any bytes a failing element wrote before it
+// panicked are discarded rather than leaving half a widget in the page.
+// Compiling the plan is not isolated - if this is the compiler's first
+// render and an element panics while the plan is seeded, the panic
+// propagates as it would from Render.
+//
+// Example:
+//
+//	if err := compiler.RenderSegments(Dashboard(user), w); err != nil {
+//	    var seg *jit.SegmentError
+//	    if errors.As(err, &seg) {
+//	        log.Printf("dashboard rendered with failures: %v", err)
+//	    }
+//	}
+func (jc *Compiler) RenderSegments(root node.Node, w io.Writer) error {
+	plan := jc.currentPlan(root)
+
+	predictedSize := jc.predict()
+	buf := fluent.NewBuffer(predictedSize)
+	defer fluent.PutBuffer(buf)
+
+	var errs []error
+	for _, element := range plan.Elements {
+		var path []int
+		var tags []string
+		switch el := element.(type) {
+		case *DynamicPath:
+			path, tags = el.Path, el.Tags
+		case *ConditionalPath:
+			path, tags = el.Path, el.Tags
+		default:
+			element.Render(root, buf)
+			continue
+		}
+
+		n, ok := resolve(root, path)
+		if !ok {
+			errs = append(errs, &SegmentError{Path: describePath(path, tags), Err: ErrStructureMismatch})
+			continue
+		}
+
+		start := buf.Len()
+		if err := renderSegment(element, n, buf); err != nil {
+			buf.Truncate(start)
+			errs = append(errs, &SegmentError{Path: describePath(path, tags), Err: err})
+		}
+	}
+
+	actualSize := buf.Len()
+	jc.record(predictedSize, actualSize)
+
+	_, err := buf.WriteTo(w)
+	return errors.Join(append(errs, err)...)
+}
+
+// renderSegment renders one resolved dynamic element, turning a panic into
+// an error so the caller can carry on with the rest of the plan.
+func renderSegment(element CompiledElement, n node.Node, buf *bytes.Buffer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrSegmentPanic, r)
+		}
+	}()
+	renderResolved(element, n, buf)
+	return nil
+}
@@ -0,0 +1,74 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// segmentPage has two widgets; the first panics when broken is set.
+func segmentPage(broken bool) node.Node {
+	return div.New(
+		node.Func(func() node.Node {
+			if broken {
+				panic("widget data missing")
+			}
+			return span.Text("weather")
+		}),
+		span.Text("news"),
+	)
+}
+
+// TestRenderSegmentsIsolatesPanics verifies that one failing widget is
+// reported with its path while the rest of the page is still served.
+func TestRenderSegmentsIsolatesPanics(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(segmentPage(false))
+
+	var buf bytes.Buffer
+	err := compiler.RenderSegments(segmentPage(true), &buf)
+
+	if want := "<div><span>news</span></div>"; buf.String() != want {
+		t.Errorf("page should render without the failed widget:\n  got  %q\n  want %q", buf.String(), want)
+	}
+	var seg *SegmentError
+	if !errors.As(err, &seg) {
+		t.Fatalf("error should contain a *SegmentError, got: %v", err)
+	}
+	if seg.Path != "div > func[0]" {
+		t.Errorf("segment error should name the failed widget's path, got %q", seg.Path)
+	}
+	if !errors.Is(err, ErrSegmentPanic) {
+		t.Errorf("a panicking widget should be reported as ErrSegmentPanic, got: %v", err)
+	}
+}
+
+// TestRenderSegmentsReportsMismatch verifies that a path missing from the
+// tree is reported rather than silently skipped.
+func TestRenderSegmentsReportsMismatch(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Static("a"), span.Text("b")))
+
+	var buf bytes.Buffer
+	err := compiler.RenderSegments(div.New(span.Static("a")), &buf)
+	if !errors.Is(err, ErrStructureMismatch) {
+		t.Errorf("missing path should be reported as ErrStructureMismatch, got: %v", err)
+	}
+}
+
+// TestRenderSegmentsNoFailures verifies the clean case returns nil.
+func TestRenderSegmentsNoFailures(t *testing.T) {
+	compiler := NewCompiler()
+
+	var buf bytes.Buffer
+	if err := compiler.RenderSegments(segmentPage(false), &buf); err != nil {
+		t.Errorf("clean render should return nil, got: %v", err)
+	}
+	if want := "<div><span>weather</span><span>news</span></div>"; buf.String() != want {
+		t.Errorf("clean render output:\n  got  %q\n  want %q", buf.String(), want)
+	}
+}
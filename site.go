@@ -0,0 +1,302 @@
+package jit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// encodingExtensions are the file extensions a static site uses for
+// compressed variants, which CDNs and file servers look for beside the
+// plain file. Other encodings use their name.
+var encodingExtensions = map[string]string{"gzip": ".gz", "br": ".br", "zstd": ".zst"}
+
+// ExportSite flattens each page and writes it under dir, turning a set of
+// Fluent trees into a static site for CDN upload. Pages are keyed by
+// slash-separated path relative to the site root, such as
+// "about/index.html". Compressed variants made with fc, which may be nil,
+// are written beside each page, as "about/index.html.gz" for gzip and
+// ".br" for brotli.
+//
+// Every page is checked before anything is written, so a site with a
+// dynamic page or a path that escapes dir (see fs.ValidPath) is rejected
+// whole; the error names each problem and wraps ErrDynamicContent if a
+// page is dynamic. Paths that conflict - a page that is also another's
+// directory, such as "a" beside "a/b.html", or a page named like another's
+// compressed variant, such as "x.html.gz" beside "x.html" with gzip - are
+// rejected before any page is flattened. Pages are flattened, then written, up to
+// BulkCfg.Concurrency at a time, and nothing further is started once ctx
+// is done, as for Warm.
+//
+// Example:
+//
+//	err := jit.ExportSite(ctx, "public", map[string]node.Node{
+//	    "index.html":       HomePage(),
+//	    "about/index.html": AboutPage(),
+//	}, &jit.FlattenerCfg{Gzip: true})
+func ExportSite(ctx context.Context, dir string, pages map[string]node.Node, fc *FlattenerCfg, cfg ...BulkCfg) error {
+	files, err := siteFiles(ctx, pages, fc, cfg)
+	if err != nil {
+		return err
+	}
+	return runBulk(ctx, slices.Sorted(maps.Keys(files)), cfg, func(name string) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, files[name], 0o644)
+	})
+}
+
+// SiteFS flattens each page like ExportSite, but returns the site as an
+// in-memory fs.FS instead of writing it, to serve with
+// http.FileServerFS, embed in a test, or hand to an uploader that reads
+// an fs.FS.
+func SiteFS(ctx context.Context, pages map[string]node.Node, fc *FlattenerCfg, cfg ...BulkCfg) (fs.FS, error) {
+	files, err := siteFiles(ctx, pages, fc, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newSiteFS(files), nil
+}
+
+// siteFiles flattens every page and returns the site's files by path,
+// compressed variants included, or an error listing every page that
+// could not be flattened.
+func siteFiles(ctx context.Context, pages map[string]node.Node, fc *FlattenerCfg, cfg []BulkCfg) (map[string][]byte, error) {
+	if err := siteConflicts(pages, fc); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	err := runBulk(ctx, slices.Sorted(maps.Keys(pages)), cfg, func(name string) error {
+		if !fs.ValidPath(name) || name == "." {
+			return errors.New("invalid page path")
+		}
+		if paths := dynamicPaths(pages[name], nil, nil); len(paths) > 0 {
+			return fmt.Errorf("%w: dynamic nodes at paths %v", ErrDynamicContent, paths)
+		}
+		f, err := NewFlattener(pages[name], fc)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		files[name] = f.bytes
+		for encoding, content := range f.variants {
+			files[name+variantExtension(encoding)] = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// siteConflicts reports every path the site would need to hold twice,
+// before anything is flattened: a page that is also a directory of
+// another page, such as "a" beside "a/b.html", or a page named like the
+// compressed variant fc makes of another, such as "x.html.gz" beside
+// "x.html" with gzip. Either would otherwise fail halfway through
+// writing, or silently lose one of the files.
+func siteConflicts(pages map[string]node.Node, fc *FlattenerCfg) error {
+	var exts []string
+	if fc != nil {
+		if fc.Gzip {
+			exts = append(exts, variantExtension("gzip"))
+		}
+		for encoding := range fc.Encoders {
+			if ext := variantExtension(encoding); !slices.Contains(exts, ext) {
+				exts = append(exts, ext)
+			}
+		}
+	}
+
+	// Every file the site would hold, mapped to the page it comes from.
+	owners := make(map[string]string)
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(pages)) {
+		owners[name] = name
+	}
+	for _, name := range slices.Sorted(maps.Keys(pages)) {
+		for _, ext := range exts {
+			if _, ok := pages[name+ext]; ok {
+				errs = append(errs, fmt.Errorf("%s: page collides with the %s variant of %s", name+ext, ext, name))
+				continue
+			}
+			owners[name+ext] = name
+		}
+	}
+
+	reported := make(map[string]bool)
+	for _, name := range slices.Sorted(maps.Keys(owners)) {
+		for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if _, ok := owners[dir]; ok && !reported[dir] {
+				reported[dir] = true
+				errs = append(errs, fmt.Errorf("%s: file is also the directory of %s", dir, owners[name]))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// variantExtension returns the file extension for a compressed variant in
+// encoding.
+func variantExtension(encoding string) string {
+	if ext, ok := encodingExtensions[encoding]; ok {
+		return ext
+	}
+	return "." + encoding
+}
+
+// siteFS is a read-only file system over flattened files. Directories are
+// implied by the files' paths.
+type siteFS struct {
+	files map[string][]byte
+	dirs  map[string][]fs.DirEntry // Sorted entries of each directory, "." for the root
+}
+
+// newSiteFS indexes files into directories.
+func newSiteFS(files map[string][]byte) *siteFS {
+	sfs := &siteFS{files: files, dirs: map[string][]fs.DirEntry{".": nil}}
+	seen := make(map[string]bool)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		child := siteInfo{name: path.Base(name), size: int64(len(files[name]))}
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			key := dir + "/" + child.name
+			if !seen[key] {
+				seen[key] = true
+				sfs.dirs[dir] = append(sfs.dirs[dir], fs.FileInfoToDirEntry(child))
+			}
+			if dir == "." {
+				break
+			}
+			child = siteInfo{name: path.Base(dir), dir: true}
+		}
+	}
+	for _, entries := range sfs.dirs {
+		slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	}
+	return sfs
+}
+
+// Open opens the named file or directory.
+func (sfs *siteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if content, ok := sfs.files[name]; ok {
+		return &siteFile{info: siteInfo{name: path.Base(name), size: int64(len(content))}, content: content}, nil
+	}
+	if entries, ok := sfs.dirs[name]; ok {
+		return &siteDir{info: siteInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir lists the named directory, sorted by name.
+func (sfs *siteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := sfs.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(entries), nil
+}
+
+// siteInfo describes a file or directory of a siteFS.
+type siteInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (si siteInfo) Name() string       { return si.name }
+func (si siteInfo) Size() int64        { return si.size }
+func (si siteInfo) ModTime() time.Time { return time.Time{} }
+func (si siteInfo) IsDir() bool        { return si.dir }
+func (si siteInfo) Sys() any           { return nil }
+func (si siteInfo) Mode() fs.FileMode {
+	if si.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// siteFile is an open file of a siteFS. It implements io.Seeker so
+// http.FileServerFS can serve ranges.
+type siteFile struct {
+	info    siteInfo
+	content []byte
+	offset  int64
+}
+
+func (f *siteFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *siteFile) Close() error               { return nil }
+
+func (f *siteFile) Read(b []byte) (int, error) {
+	if f.offset >= int64(len(f.content)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.content[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *siteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.content))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// siteDir is an open directory of a siteFS.
+type siteDir struct {
+	info    siteInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *siteDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *siteDir) Close() error               { return nil }
+
+func (d *siteDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining ones if n <= 0, as
+// fs.ReadDirFile requires.
+func (d *siteDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return slices.Clone(rest), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.offset += len(rest)
+	return slices.Clone(rest), nil
+}
@@ -0,0 +1,128 @@
+package jit
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// sitePages is a small site for the export tests.
+func sitePages() map[string]node.Node {
+	return map[string]node.Node{
+		"index.html":          div.New(span.Static("home")),
+		"about/index.html":    div.New(span.Static("about")),
+		"docs/api/index.html": div.New(span.Static("api")),
+	}
+}
+
+// TestExportSite verifies that each page and its compressed variant are
+// written under the directory at their paths.
+func TestExportSite(t *testing.T) {
+	dir := t.TempDir()
+	if err := ExportSite(context.Background(), dir, sitePages(), &FlattenerCfg{Gzip: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "docs", "api", "index.html"))
+	if err != nil || string(got) != "<div><span>api</span></div>" {
+		t.Errorf("docs/api/index.html: got %q, %v", got, err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "about", "index.html.gz"))
+	if err != nil {
+		t.Fatalf("gzip variant should be written beside the page: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("variant is not valid gzip: %v", err)
+	}
+	if plain, _ := io.ReadAll(zr); string(plain) != "<div><span>about</span></div>" {
+		t.Errorf("gzip variant decompressed to %q", plain)
+	}
+}
+
+// TestExportSiteRejectsWhole verifies that a dynamic page or an escaping
+// path rejects the site before anything is written.
+func TestExportSiteRejectsWhole(t *testing.T) {
+	dir := t.TempDir()
+	pages := sitePages()
+	pages["profile.html"] = div.New(span.Text("Alice"))
+	pages["../escape.html"] = div.New(span.Static("x"))
+
+	err := ExportSite(context.Background(), dir, pages, nil)
+	if !errors.Is(err, ErrDynamicContent) {
+		t.Errorf("expected ErrDynamicContent, got %v", err)
+	}
+	for _, want := range []string{"profile.html", "../escape.html: invalid page path"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got %v", want, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("nothing should be written for a rejected site, found %d entries", len(entries))
+	}
+}
+
+// TestExportSiteRejectsDirectoryConflict verifies that a page which is
+// also another page's directory is rejected before anything is written.
+func TestExportSiteRejectsDirectoryConflict(t *testing.T) {
+	dir := t.TempDir()
+	pages := map[string]node.Node{
+		"a":          div.Static("a"),
+		"a/b.html":   div.Static("b"),
+		"index.html": div.Static("home"),
+	}
+
+	err := ExportSite(context.Background(), dir, pages, nil)
+	if err == nil || !strings.Contains(err.Error(), "a: file is also the directory of a/b.html") {
+		t.Errorf("error should name the conflicting paths, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("nothing should be written for a conflicting site, found %d entries", len(entries))
+	}
+}
+
+// TestSiteFSRejectsVariantCollision verifies that a page named like
+// another page's compressed variant is rejected, and allowed when no
+// variant is made.
+func TestSiteFSRejectsVariantCollision(t *testing.T) {
+	pages := map[string]node.Node{
+		"x.html":    div.Static("x"),
+		"x.html.gz": div.Static("not gzip"),
+	}
+
+	_, err := SiteFS(context.Background(), pages, &FlattenerCfg{Gzip: true})
+	if err == nil || !strings.Contains(err.Error(), "x.html.gz: page collides with the .gz variant of x.html") {
+		t.Errorf("error should name the colliding page, got %v", err)
+	}
+
+	if _, err := SiteFS(context.Background(), pages, nil); err != nil {
+		t.Errorf("without gzip there is no variant to collide with, got %v", err)
+	}
+}
+
+// TestSiteFS verifies the in-memory site against the fs.FS contract.
+func TestSiteFS(t *testing.T) {
+	fsys, err := SiteFS(context.Background(), sitePages(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fstest.TestFS(fsys, "index.html", "about/index.html", "docs/api/index.html"); err != nil {
+		t.Error(err)
+	}
+	if got, _ := fs.ReadFile(fsys, "about/index.html"); string(got) != "<div><span>about</span></div>" {
+		t.Errorf("about/index.html: got %q", got)
+	}
+}
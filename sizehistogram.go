@@ -0,0 +1,99 @@
+package jit
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// SizeBucket is one bucket of a render size histogram: the number of
+// renders whose output was between Min and Max bytes, inclusive.
+type SizeBucket struct {
+	Min   int
+	Max   int
+	Count int64
+}
+
+// sizeBuckets holds one bucket for empty output and one per power of two
+// up to the largest int.
+const sizeBuckets = bits.UintSize
+
+// sizeHistogram counts render sizes in power-of-two buckets. The buckets
+// are coarse on purpose - the point is to see the shape of the
+// distribution, such as mobile and desktop variants of a page clustering
+// apart, not to estimate a size - and recording is one atomic add.
+type sizeHistogram struct {
+	buckets [sizeBuckets]atomic.Int64
+}
+
+// observe counts size. A nil histogram records nothing.
+func (h *sizeHistogram) observe(size int) {
+	if h == nil {
+		return
+	}
+	h.buckets[min(bits.Len(uint(max(size, 0))), sizeBuckets-1)].Add(1)
+}
+
+// snapshot returns the non-empty buckets, smallest first.
+func (h *sizeHistogram) snapshot() []SizeBucket {
+	if h == nil {
+		return nil
+	}
+	var out []SizeBucket
+	for i := range h.buckets {
+		count := h.buckets[i].Load()
+		if count == 0 {
+			continue
+		}
+		b := SizeBucket{Count: count}
+		if i > 0 {
+			b.Min = 1 << (i - 1)
+			b.Max = 1<<i - 1
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// SetHistogram turns recording a histogram of observed render sizes on or
+// off. The baseline is one number, so it hides a distribution with two
+// humps - a page served in a small mobile and a large desktop variant
+// sizes buffers for neither - where the histogram shows both. Turning it
+// on starts an empty histogram; the sizing statistics are kept either way.
+//
+// A Compiler reports every render to a sizer with a histogram, not only
+// those deviating past CompilerCfg.Threshold, so that the histogram is
+// complete.
+func (as *AdaptiveSizer) SetHistogram(on bool) {
+	if on {
+		as.histogram.Store(&sizeHistogram{})
+	} else {
+		as.histogram.Store(nil)
+	}
+}
+
+// Histogram returns the render sizes recorded since SetHistogram, as the
+// non-empty power-of-two buckets, smallest first. It is nil if the
+// histogram is off.
+func (as *AdaptiveSizer) Histogram() []SizeBucket {
+	return as.histogram.Load().snapshot()
+}
+
+// SizeHistogram returns the histogram of the compiler's render sizes,
+// recorded when CompilerCfg.SizeHistogram is set and nil otherwise. See
+// AdaptiveSizer.SetHistogram.
+func (jc *Compiler) SizeHistogram() []SizeBucket {
+	if as, ok := jc.sizer.(*AdaptiveSizer); ok {
+		return as.Histogram()
+	}
+	return nil
+}
+
+// SizeHistogram returns the histogram of the tuner's render sizes,
+// recorded when TunerCfg.SizeHistogram is set and nil otherwise. See
+// AdaptiveSizer.SetHistogram.
+func (jt *Tuner) SizeHistogram() []SizeBucket {
+	if as, ok := jt.sizer.(*AdaptiveSizer); ok {
+		return as.Histogram()
+	}
+	return nil
+}
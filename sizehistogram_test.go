@@ -0,0 +1,65 @@
+package jit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/span"
+)
+
+// TestSizeHistogram verifies that a bimodal distribution shows as two
+// separate buckets, with the bucket bounds covering each size.
+func TestSizeHistogram(t *testing.T) {
+	as := NewAdaptiveSizer()
+	if as.Histogram() != nil {
+		t.Fatal("the histogram should be nil until turned on")
+	}
+	as.SetHistogram(true)
+	for range 30 {
+		as.UpdateStats(3000) // mobile
+	}
+	for range 20 {
+		as.UpdateStats(40000) // desktop
+	}
+	as.UpdateStats(0)
+
+	want := []SizeBucket{
+		{Min: 0, Max: 0, Count: 1},
+		{Min: 2048, Max: 4095, Count: 30},
+		{Min: 32768, Max: 65535, Count: 20},
+	}
+	got := as.Histogram()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("bucket %d: want %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	as.SetHistogram(false)
+	if as.Histogram() != nil {
+		t.Error("turning the histogram off should drop it")
+	}
+}
+
+// TestCompilerSizeHistogram verifies that a compiler with SizeHistogram
+// records every render, including those its threshold would skip.
+func TestCompilerSizeHistogram(t *testing.T) {
+	jc := NewCompiler(&CompilerCfg{Max: 2, Variance: 20, GrowthFactor: 115, Threshold: 15, SizeHistogram: true})
+	for range 10 {
+		jc.Render(span.Text(strings.Repeat("x", 100)))
+	}
+	var total int64
+	for _, b := range jc.SizeHistogram() {
+		total += b.Count
+	}
+	// The compile render is observed as well as the ten renders
+	if total < 10 {
+		t.Errorf("every render should be recorded, got %d of 10", total)
+	}
+	if NewCompiler().SizeHistogram() != nil {
+		t.Error("a compiler without SizeHistogram should return nil")
+	}
+}
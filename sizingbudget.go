@@ -0,0 +1,114 @@
+package jit
+
+import "sync/atomic"
+
+// sizingRebalance is the number of registered renders between
+// recomputing the fleet-wide prediction total. Summing means walking both
+// registries, so it is done occasionally rather than per render; a
+// baseline that moves meanwhile is picked up at the next rebalance.
+const sizingRebalance = 1024
+
+// sizingBudget is the package-wide accounting of predicted buffer sizes,
+// see SetSizingBudget.
+var sizingBudget sizingAccount
+
+// sizingAccount holds the fleet-wide cap and the scale it last worked
+// out. All fields are atomic, as every registered render reads them.
+type sizingAccount struct {
+	limit   atomic.Int64 // Cap on the total, 0 for none
+	total   atomic.Int64 // Unscaled predictions summed at the last rebalance
+	scale   atomic.Int64 // Percentage predictions are scaled to, 0 or 100 for none
+	renders atomic.Int64 // Registered renders, counting towards the next rebalance
+}
+
+// SizingBudgetStats describes the package-wide accounting of predicted
+// buffer sizes across registered compilers and tuners.
+type SizingBudgetStats struct {
+	Predicted int // Sum of the baselines, before scaling
+	Limit     int // Cap set by SetSizingBudget, 0 for none
+	Scale     int // Percentage each baseline is scaled to, 100 within the cap
+}
+
+// SetSizingBudget caps the sum of the buffer sizes predicted by every
+// registered compiler and tuner - those used through Compile, Tune,
+// CompileConfig, TuneConfig and Serve - at limit bytes. Each sizer still
+// learns its own baseline, but while the sum is over the cap every
+// registered render starts from its baseline scaled down by the same
+// proportion, so a burst of large templates cannot together pin more
+// buffer memory than the process can spare. Buffers still grow as a
+// render needs; the cap trades some regrowth for the bound.
+//
+// The sum is recomputed when the cap is set and every 1024 registered
+// renders after, so it lags baselines that move in between. Compilers and
+// tuners made with NewCompiler and NewTuner are neither counted nor
+// scaled, and neither is CompilerCfg.FixedSize. 0 removes the cap.
+func SetSizingBudget(limit int) {
+	sizingBudget.limit.Store(int64(max(limit, 0)))
+	sizingBudget.balance()
+}
+
+// SizingBudget returns the package-wide accounting, recomputing the total
+// first so it is current whether or not a cap is set.
+func SizingBudget() SizingBudgetStats {
+	sizingBudget.balance()
+	return SizingBudgetStats{
+		Predicted: int(sizingBudget.total.Load()),
+		Limit:     int(sizingBudget.limit.Load()),
+		Scale:     sizingBudget.percent(),
+	}
+}
+
+// apply returns baseline scaled to the budget, counting a registered
+// render towards the next rebalance. Without a cap it is one atomic load.
+func (a *sizingAccount) apply(baseline int) int {
+	if a.limit.Load() == 0 {
+		return baseline
+	}
+	if a.renders.Add(1)%sizingRebalance == 0 {
+		a.balance()
+	}
+	if scale := a.scale.Load(); scale > 0 && scale < 100 {
+		return int(int64(baseline) * scale / 100)
+	}
+	return baseline
+}
+
+// balance sums the unscaled predictions of the registered compilers and
+// tuners and works out the scale that brings them within the cap.
+func (a *sizingAccount) balance() {
+	var total int64
+	compilers.Range(func(_, val any) bool {
+		jc := val.(*Compiler) //nolint:forcetypeassert // only *Compiler is stored
+		if jc.fixed == 0 {
+			total += int64(jc.sizer.Baseline())
+			if jc.byteSizer != nil {
+				total += int64(jc.byteSizer.Baseline())
+			}
+		}
+		return true
+	})
+	tuners.Range(func(_, val any) bool {
+		jt := val.(*Tuner) //nolint:forcetypeassert // only *Tuner is stored
+		total += int64(jt.sizer.Baseline())
+		return true
+	})
+	a.total.Store(total)
+
+	limit := a.limit.Load()
+	if limit == 0 || total <= limit {
+		a.scale.Store(100)
+		return
+	}
+	// At least 1%, so that a cap far below the total still leaves every
+	// render some preallocation rather than none.
+	a.scale.Store(max(limit*100/total, 1))
+}
+
+// percent returns the current scale as a percentage, 100 before any
+// rebalance.
+func (a *sizingAccount) percent() int {
+	if scale := a.scale.Load(); scale > 0 {
+		return int(scale)
+	}
+	return 100
+}
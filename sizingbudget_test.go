@@ -0,0 +1,51 @@
+package jit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+)
+
+// TestSizingBudget verifies that registered predictions are summed, that
+// a cap scales each down by the same proportion, and that compilers
+// outside the registry are left alone.
+func TestSizingBudget(t *testing.T) {
+	defer Reset(All)
+	defer SetSizingBudget(0)
+
+	page := div.Static(strings.Repeat("x", 1000))
+	size := len(page.Render())
+	CompileConfig("budget:page", CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100})
+	TuneConfig("budget:list", TunerCfg{Max: 1, Variance: 20, GrowthFactor: 100})
+	Compile("budget:page", page)
+	Tune("budget:list", page)
+	Tune("budget:list", page)
+
+	st := SizingBudget()
+	if st.Predicted != 2*size || st.Limit != 0 || st.Scale != 100 {
+		t.Fatalf("want %d bytes predicted, unscaled, got %+v", 2*size, st)
+	}
+
+	SetSizingBudget(size)
+	if st := SizingBudget(); st.Scale != 50 {
+		t.Errorf("a cap of half the total should scale to 50%%, got %+v", st)
+	}
+	if got := registeredCompiler("budget:page").predict(); got != size/2 {
+		t.Errorf("registered compiler should predict %d, got %d", size/2, got)
+	}
+	if jt, _ := tuners.Load("budget:list"); jt.(*Tuner).predict() != size/2 {
+		t.Errorf("registered tuner should predict %d, got %d", size/2, jt.(*Tuner).predict())
+	}
+
+	jc := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100})
+	jc.Render(page)
+	if got := jc.predict(); got != size {
+		t.Errorf("a compiler outside the registry should not be scaled, got %d", got)
+	}
+
+	SetSizingBudget(0)
+	if got := registeredCompiler("budget:page").predict(); got != size {
+		t.Errorf("removing the cap should restore the baseline, got %d", got)
+	}
+}
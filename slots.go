@@ -0,0 +1,100 @@
+package jit
+
+import (
+	"slices"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// SlotInfo describes one dynamic slot of a compiled template - a place
+// where each render reads content from the tree rather than from the plan.
+type SlotInfo struct {
+	Name     string // The slot's dynamic key, set with .Dynamic("name"), or "" if unnamed
+	Path     []int  // Child indices from the template root to the slot
+	Location string // Path described by tag, e.g. "div > form[1] > input[0]"
+	Kind     string // The slot node's tag, or text, func, funcs or condition
+}
+
+// Slots lists the dynamic slots of the compiled plan in render order, or
+// nil if nothing has been compiled yet. Tooling such as form builders and
+// CMS integrations can use it to discover what data a template expects
+// without reading its Go source.
+//
+// Slots inside a conditional are included for each branch that has been
+// compiled, with paths running through the conditional to the branch. A
+// branch no render has selected yet has no plan and contributes nothing.
+func (jc *Compiler) Slots() []SlotInfo {
+	plan := jc.executionPlan.Load()
+	if plan == nil {
+		return nil
+	}
+	return planSlots(plan, nil, nil, nil)
+}
+
+// CompiledSlots returns the slots of every template in the global Compile
+// registry that has been compiled, keyed by template ID.
+func CompiledSlots() map[string][]SlotInfo {
+	all := make(map[string][]SlotInfo)
+	compilers.Range(func(key, val any) bool {
+		id := key.(string)          //nolint:forcetypeassert // only string IDs are stored
+		compiler := val.(*Compiler) //nolint:forcetypeassert // only *Compiler is stored
+		if slots := compiler.Slots(); slots != nil {
+			all[id] = slots
+		}
+		return true
+	})
+	return all
+}
+
+// planSlots appends the slots of plan to found. prefix and prefixTags
+// locate the plan's root within the template - for a branch sub-plan, the
+// path to the conditional plus the branch index, and the labels up to and
+// including the conditional - so slots inside branches are reported
+// relative to the template root rather than to their branch.
+func planSlots(plan *ExecutionPlan, prefix []int, prefixTags []string, found []SlotInfo) []SlotInfo {
+	for _, element := range plan.Elements {
+		var (
+			path []int
+			tags []string
+			key  string
+		)
+		switch el := element.(type) {
+		case *DynamicPath:
+			path, tags, key = el.Path, el.Tags, el.Key
+		case *ConditionalPath:
+			path, tags, key = el.Path, el.Tags, el.Key
+		default:
+			continue
+		}
+
+		fullPath := append(slices.Clone(prefix), path...)
+		fullTags := append(slices.Clone(prefixTags), tags...)
+		found = append(found, SlotInfo{
+			Name:     key,
+			Path:     fullPath,
+			Location: describePath(fullPath, fullTags),
+			Kind:     fullTags[len(fullTags)-1],
+		})
+
+		if cp, ok := element.(*ConditionalPath); ok {
+			// The branch root is the conditional's only child.
+			branchPath := append(slices.Clone(fullPath), 0)
+			for _, condition := range []bool{true, false} {
+				if sub := cp.Branch(condition); sub != nil {
+					found = planSlots(sub, branchPath, fullTags, found)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// slotName returns n's dynamic key, ignoring the "_" sentinel that marks a
+// node as dynamic without naming it.
+func slotName(n node.Node) string {
+	d, ok := n.(node.Dynamic)
+	if !ok || d.DynamicKey() == "_" {
+		return ""
+	}
+	return d.DynamicKey()
+}
@@ -0,0 +1,81 @@
+package jit
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestSlotsListsNamedSlots verifies that Slots reports each dynamic slot
+// with its name, path and kind, in render order.
+func TestSlotsListsNamedSlots(t *testing.T) {
+	compiler := NewCompiler()
+	if compiler.Slots() != nil {
+		t.Error("Slots should be nil before the first render")
+	}
+
+	compiler.Render(div.New(
+		p.Static("Hello"),
+		span.Text("Alice").Dynamic("name"),
+		span.Text("3"),
+	))
+
+	got := compiler.Slots()
+	want := []SlotInfo{
+		{Name: "name", Path: []int{1}, Location: "div > span[1]", Kind: "span"},
+		{Name: "", Path: []int{2, 0}, Location: "div > span[2] > text[0]", Kind: "text"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d slots, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || !slices.Equal(got[i].Path, want[i].Path) ||
+			got[i].Location != want[i].Location || got[i].Kind != want[i].Kind {
+			t.Errorf("slot %d:\n  got  %+v\n  want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestSlotsIncludesCompiledBranches verifies that slots inside a compiled
+// conditional branch are reported with paths from the template root.
+func TestSlotsIncludesCompiledBranches(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(
+		node.When(true, div.New(span.Static("Hi "), span.Text("Alice").Dynamic("user"))),
+	))
+
+	slots := compiler.Slots()
+	if len(slots) != 2 {
+		t.Fatalf("expected the conditional and its branch slot, got %+v", slots)
+	}
+	if slots[0].Kind != "condition" {
+		t.Errorf("first slot should be the conditional, got kind %q", slots[0].Kind)
+	}
+	user := slots[1]
+	if user.Name != "user" || !slices.Equal(user.Path, []int{0, 0, 1}) {
+		t.Errorf("branch slot should be named user at [0 0 1], got %+v", user)
+	}
+	if want := "div > condition[0] > div[0] > span[1]"; user.Location != want {
+		t.Errorf("branch slot location:\n  got  %q\n  want %q", user.Location, want)
+	}
+}
+
+// TestCompiledSlots verifies the registry-wide query covers every compiled
+// template and skips those not yet rendered.
+func TestCompiledSlots(t *testing.T) {
+	t.Cleanup(func() { ResetCompile("slots-profile", "slots-pending") })
+	Compile("slots-profile", div.New(span.Text("Alice").Dynamic("name")))
+	CompileConfig("slots-pending", CompilerCfg{})
+
+	all := CompiledSlots()
+	if slots := all["slots-profile"]; len(slots) != 1 || slots[0].Name != "name" {
+		t.Errorf("compiled template should report its name slot, got %+v", slots)
+	}
+	if _, ok := all["slots-pending"]; ok {
+		t.Error("template that has not rendered should not be reported")
+	}
+}
@@ -0,0 +1,51 @@
+package jit
+
+import (
+	"bytes"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// Snapshot holds a tree's output captured at one moment, dynamic content
+// included - a leaderboard frozen on the hour, a report as of midnight.
+// Where a Flattener refuses dynamic content because serving it stale
+// would be a bug, a Snapshot serves it stale on purpose, so the two are
+// kept as separate types and a snapshot cannot be passed off as static
+// content by accident.
+//
+// The embedded Flattener serves the captured bytes, with Render, ETag,
+// NotModified and Len as for static content; LastRendered is when the
+// snapshot was taken.
+type Snapshot struct {
+	*Flattener
+}
+
+// NewSnapshot renders n once, evaluating its dynamic content as it stands
+// now, and keeps the output. To move the snapshot on, take a new one and
+// swap it in, for instance through an atomic.Pointer[jit.Snapshot], or
+// call Rebuild on this one.
+//
+// Example:
+//
+//	var leaderboard atomic.Pointer[jit.Snapshot]
+//
+//	func refreshLeaderboard() { // run hourly
+//	    leaderboard.Store(jit.NewSnapshot(Leaderboard(loadScores())))
+//	}
+//
+//	func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+//	    leaderboard.Load().Render(w)
+//	}
+func NewSnapshot(n node.Node) *Snapshot {
+	var buf bytes.Buffer
+	n.RenderBuilder(&buf)
+	return &Snapshot{Flattener: newFlattener(buf.Bytes())}
+}
+
+// Rebuild takes the snapshot again from n and serves that from then on.
+// Unlike Flattener.Rebuild it accepts dynamic content, since capturing it
+// is the point; the error is always nil.
+func (s *Snapshot) Rebuild(n node.Node) error {
+	s.Flattener.rebuilt.Store(NewSnapshot(n).Flattener)
+	return nil
+}
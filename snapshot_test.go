@@ -0,0 +1,51 @@
+package jit
+
+import (
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestSnapshotFreezesDynamicContent verifies that dynamic content is
+// evaluated once, when the snapshot is taken, and not on later renders.
+func TestSnapshotFreezesDynamicContent(t *testing.T) {
+	leader := "Alice"
+	calls := 0
+	tree := div.New(
+		span.Static("Leader: "),
+		node.Func(func() node.Node {
+			calls++
+			return span.Text(leader)
+		}),
+	)
+
+	snap := NewSnapshot(tree)
+	leader = "Bob"
+
+	want := "<div><span>Leader: </span><span>Alice</span></div>"
+	for range 3 {
+		if got := string(snap.Render()); got != want {
+			t.Errorf("snapshot should keep the output from when it was taken:\n  got  %q\n  want %q", got, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("dynamic content should be evaluated once, was evaluated %d times", calls)
+	}
+	if snap.ETag() == "" || snap.Len() != len(want) {
+		t.Errorf("snapshot should carry Flattener metadata, got ETag %q Len %d", snap.ETag(), snap.Len())
+	}
+}
+
+// TestSnapshotRebuild verifies that Rebuild retakes the snapshot from a
+// dynamic tree rather than rejecting it as Flattener.Rebuild would.
+func TestSnapshotRebuild(t *testing.T) {
+	snap := NewSnapshot(span.Text("Alice"))
+	if err := snap.Rebuild(span.Text("Bob")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(snap.Render()); got != "<span>Bob</span>" {
+		t.Errorf("retaken snapshot rendered %q", got)
+	}
+}
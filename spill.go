@@ -0,0 +1,202 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// spillBuffer collects a render in memory until limit bytes are buffered,
+// then moves them to a temporary file and carries on, so a render of any
+// size holds at most about limit bytes at once. The file is copied to the
+// writer when the render completes.
+//
+// The whole render is still collected before anything is written, as with
+// an in-memory render, so a response is never cut off part way by a slow
+// template. If the file cannot be created or written, the render carries on
+// in memory - the output is still correct, only the bound is lost.
+type spillBuffer struct {
+	buf    *bytes.Buffer
+	limit  int
+	dir    string
+	file   *os.File
+	failed bool // The file could not be used, so buffer the rest in memory
+	size   int  // Bytes moved to the file
+}
+
+// newSpillBuffer returns a spillBuffer writing through buf. An empty dir
+// uses os.TempDir.
+func newSpillBuffer(buf *bytes.Buffer, limit int, dir string) *spillBuffer {
+	return &spillBuffer{buf: buf, limit: limit, dir: dir}
+}
+
+// spill moves the buffered bytes to the file once there are at least limit
+// of them. It is called between nodes, so a single leaf node larger than
+// the limit is still rendered whole in memory.
+func (sb *spillBuffer) spill() {
+	if sb.failed || sb.buf.Len() < sb.limit {
+		return
+	}
+	if sb.file == nil {
+		f, err := os.CreateTemp(sb.dir, "fluent-jit-*.html")
+		if err != nil {
+			sb.failed = true
+			return
+		}
+		sb.file = f
+	}
+	// On error WriteTo leaves the unwritten bytes in buf, so the file holds
+	// a prefix of the output and buf the rest.
+	n, err := sb.buf.WriteTo(sb.file)
+	sb.size += int(n)
+	if err != nil {
+		sb.failed = true
+	}
+}
+
+// plan renders plan against root, spilling between elements and within
+// dynamic content.
+func (sb *spillBuffer) plan(plan *ExecutionPlan, root node.Node) {
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *DynamicPath:
+			n, ok := el.path.resolve(root)
+			if !ok {
+				el.Render(root, sb.buf) // reports the mismatch
+				continue
+			}
+			if _, isTimed := n.(*timed); isTimed || el.OpenTag {
+				// A DynamicAttr element's children follow in the plan, and
+				// a Timeout node needs the path's counters and shared output.
+				el.renderNode(n, sb.buf)
+				sb.spill()
+				continue
+			}
+			sb.node(n)
+		case *ConditionalPath:
+			n, ok := el.path.resolve(root)
+			if !ok {
+				el.Render(root, sb.buf)
+				continue
+			}
+			c, ok := n.(*node.ConditionalBuilder)
+			if !ok {
+				sb.node(n)
+				continue
+			}
+			sub, branchRoot := el.branchPlan(c)
+			if branchRoot != nil {
+				sb.plan(sub, branchRoot)
+			}
+		default:
+			element.Render(root, sb.buf)
+			sb.spill()
+		}
+	}
+}
+
+// node renders n, descending into elements and the node package's
+// containers so that a large list or table spills row by row rather than
+// being rendered whole. Other nodes are rendered whole, since they may not
+// render as the concatenation of their children.
+func (sb *spillBuffer) node(n node.Node) {
+	switch n := n.(type) {
+	case node.Element:
+		n.RenderOpen(sb.buf)
+		sb.children(n.Nodes())
+		n.RenderClose(sb.buf)
+	case *node.ConditionalBuilder, *node.FunctionComponent, *node.FuncsComponent:
+		sb.children(n.Nodes())
+	default:
+		n.RenderBuilder(sb.buf)
+	}
+	sb.spill()
+}
+
+// children renders each non-nil node in turn.
+func (sb *spillBuffer) children(nodes []node.Node) {
+	for _, child := range nodes {
+		if child != nil {
+			sb.node(child)
+		}
+	}
+}
+
+// total returns the bytes rendered so far, in the file and in memory.
+func (sb *spillBuffer) total() int {
+	return sb.size + sb.buf.Len()
+}
+
+// finish writes the whole render to w and removes the temporary file.
+func (sb *spillBuffer) finish(w io.Writer) error {
+	if sb.file == nil {
+		_, err := sb.buf.WriteTo(w)
+		return err
+	}
+	_, err := sb.file.Seek(0, io.SeekStart)
+	if err == nil {
+		_, err = io.Copy(w, sb.file)
+	}
+	if err == nil {
+		_, err = sb.buf.WriteTo(w)
+	}
+	return errors.Join(err, sb.discard())
+}
+
+// discard closes and removes the temporary file, if there is one, and
+// forgets what was spilled to it. It is deferred by every spilling render
+// so that a panic part way through does not leave the file behind.
+func (sb *spillBuffer) discard() error {
+	if sb.file == nil {
+		return nil
+	}
+	err := sb.file.Close()
+	_ = os.Remove(sb.file.Name())
+	sb.file, sb.size = nil, 0
+	return err
+}
+
+// renderSpill renders like Render with a writer, but through a spillBuffer
+// bounded by CompilerCfg.SpillThreshold. The sizer still learns the full
+// response size, but the buffer never starts larger than the threshold.
+// A render recovered by CompilerCfg.RecoverPanics drops what was spilled
+// and falls back to rendering the whole tree in memory.
+func (jc *Compiler) renderSpill(plan *ExecutionPlan, root node.Node, w io.Writer) {
+	predictedSize := jc.predict()
+	buf := fluent.NewBuffer(min(predictedSize, jc.cfg.SpillThreshold))
+	defer fluent.PutBuffer(buf)
+
+	sb := newSpillBuffer(buf, jc.cfg.SpillThreshold, jc.cfg.SpillDir)
+	defer sb.discard()
+	start := jc.latency.start()
+	completed := false
+	jc.recovering(buf, root, func() {
+		sb.plan(plan, root)
+		completed = true
+	})
+	if !completed {
+		_ = sb.discard() // The fallback rendered the whole tree into buf
+	}
+	jc.latency.observe(start)
+	actualSize := sb.total()
+	jc.record(predictedSize, actualSize)
+	// Write errors are not actionable mid-render, as in Render.
+	_ = sb.finish(w)
+}
+
+// tuneSpill renders n like tune with a writer, but through a spillBuffer
+// bounded by TunerCfg.SpillThreshold.
+func (jt *Tuner) tuneSpill(n node.Node, w io.Writer) {
+	buf := fluent.NewBuffer(min(jt.predict(), jt.cfg.SpillThreshold))
+	defer fluent.PutBuffer(buf)
+
+	sb := newSpillBuffer(buf, jt.cfg.SpillThreshold, jt.cfg.SpillDir)
+	defer sb.discard()
+	sb.node(n)
+	jt.sizer.Observe(sb.total())
+	_ = sb.finish(w)
+}
@@ -0,0 +1,159 @@
+package jit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/li"
+	"github.com/jpl-au/fluent/html5/ul"
+	"github.com/jpl-au/fluent/node"
+)
+
+// report builds an export-style page with one large dynamic list.
+func report(rows int) node.Node {
+	items := make([]int, rows)
+	for i := range items {
+		items[i] = i
+	}
+	return div.New(
+		h1.Static("Report"),
+		ul.New(node.Map(items, func(i int) node.Node {
+			return li.Text(fmt.Sprintf("row %d %s", i, strings.Repeat("x", 50)))
+		})),
+		node.When(rows > 0, div.Static("end")),
+	)
+}
+
+// spillWriter records whether a spill file existed while it was written to.
+type spillWriter struct {
+	bytes.Buffer
+	dir     string
+	sawFile bool
+}
+
+func (sw *spillWriter) Write(p []byte) (int, error) {
+	if entries, _ := os.ReadDir(sw.dir); len(entries) > 0 {
+		sw.sawFile = true
+	}
+	return sw.Buffer.Write(p)
+}
+
+// TestCompilerSpill verifies that a render larger than SpillThreshold goes
+// through a temporary file, matches the in-memory output, and leaves no
+// file behind.
+func TestCompilerSpill(t *testing.T) {
+	dir := t.TempDir()
+	tree := report(1000)
+	want := string(tree.Render())
+
+	compiler := NewCompiler(&CompilerCfg{SpillThreshold: 4096, SpillDir: dir})
+	for i := range 2 {
+		w := &spillWriter{dir: dir}
+		compiler.Render(tree, w)
+
+		if w.String() != want {
+			t.Fatalf("render %d: spilled output should match standard rendering (got %d bytes, want %d)", i, w.Len(), len(want))
+		}
+		if !w.sawFile {
+			t.Errorf("render %d: output over the threshold should have spilled to a file", i)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("render %d: spill file should be removed after the render, found %d entries", i, len(entries))
+		}
+	}
+}
+
+// TestCompilerSpillSmallRender verifies that a render under the threshold
+// never touches the disk.
+func TestCompilerSpillSmallRender(t *testing.T) {
+	dir := t.TempDir()
+	compiler := NewCompiler(&CompilerCfg{SpillThreshold: 1 << 20, SpillDir: dir})
+
+	w := &spillWriter{dir: dir}
+	compiler.Render(report(3), w)
+	if w.sawFile {
+		t.Error("render under the threshold should stay in memory")
+	}
+	if want := string(report(3).Render()); w.String() != want {
+		t.Errorf("output should match standard rendering:\n  got  %q\n  want %q", w.String(), want)
+	}
+}
+
+// TestCompilerSpillUnwritableDir verifies that a spill directory that
+// cannot be used falls back to memory rather than losing output.
+func TestCompilerSpillUnwritableDir(t *testing.T) {
+	tree := report(200)
+	compiler := NewCompiler(&CompilerCfg{SpillThreshold: 1024, SpillDir: t.TempDir() + "/missing"})
+
+	var buf bytes.Buffer
+	compiler.Render(tree, &buf)
+	if want := string(tree.Render()); buf.String() != want {
+		t.Errorf("output should be complete when spilling fails (got %d bytes, want %d)", buf.Len(), len(want))
+	}
+}
+
+// TestTunerSpill verifies the tuner spills large renders the same way.
+func TestTunerSpill(t *testing.T) {
+	dir := t.TempDir()
+	tree := report(1000)
+	tuner := NewTuner(&TunerCfg{SpillThreshold: 4096, SpillDir: dir})
+
+	w := &spillWriter{dir: dir}
+	tuner.Tune(tree).Render(w)
+	if want := string(tree.Render()); w.String() != want {
+		t.Fatalf("spilled output should match standard rendering (got %d bytes, want %d)", w.Len(), len(want))
+	}
+	if !w.sawFile {
+		t.Error("output over the threshold should have spilled to a file")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spill file should be removed after the render, found %d entries", len(entries))
+	}
+}
+
+// panicOnce returns report(rows) with a node at the end that panics once
+// when armed, after the rows before it have spilled, and disarms itself.
+func panicOnce(rows int, armed *bool) node.Node {
+	return div.New(report(rows), node.Func(func() node.Node {
+		if *armed {
+			*armed = false
+			panic("export failed")
+		}
+		return div.Static("done")
+	}))
+}
+
+// TestCompilerSpillPanic verifies that a render panicking after it spilled
+// removes the file, and that with RecoverPanics the fallback output is
+// complete rather than prefixed by what had spilled.
+func TestCompilerSpillPanic(t *testing.T) {
+	for _, recovering := range []bool{false, true} {
+		dir := t.TempDir()
+		armed := false
+		compiler := NewCompiler(&CompilerCfg{SpillThreshold: 4096, SpillDir: dir, RecoverPanics: recovering})
+		compiler.Render(panicOnce(1000, &armed))
+		want := string(panicOnce(1000, &armed).Render())
+
+		armed = true
+		var out bytes.Buffer
+		func() {
+			defer func() {
+				if r := recover(); (r == nil) != recovering {
+					t.Errorf("RecoverPanics %v: recovered %v", recovering, r)
+				}
+			}()
+			compiler.Render(panicOnce(1000, &armed), &out)
+		}()
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("RecoverPanics %v: spill file should be removed after a panic, found %d entries", recovering, len(entries))
+		}
+		if recovering && out.String() != want {
+			t.Errorf("fallback output should be the whole page once (got %d bytes, want %d)", out.Len(), len(want))
+		}
+	}
+}
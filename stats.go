@@ -0,0 +1,172 @@
+package jit
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// CompilerStats is a snapshot of a compiler's render-time counters.
+type CompilerStats struct {
+	// Mismatches counts dynamic paths that did not resolve in the tree being
+	// rendered, each of which left a gap in the output. Only counted when
+	// CompilerCfg.SafeRender is set.
+	Mismatches int64
+
+	// Timeouts counts renders of Timeout and TimeoutShared nodes that
+	// missed their deadline, and Substitutions the subset that served a
+	// shared last good output rather than the fallback.
+	Timeouts      int64
+	Substitutions int64
+
+	// Recovered counts compiled renders that panicked and were rendered
+	// the standard way instead. Only counted when CompilerCfg.RecoverPanics
+	// is set.
+	Recovered int64
+
+	// StaticRatio is the percentage of the output that came from static
+	// content on the render that compiled the current plan, or zero before
+	// the first. MostlyDynamic is set when it is below
+	// CompilerCfg.MinStaticRatio, suggesting a Tuner instead.
+	StaticRatio   int
+	MostlyDynamic bool
+
+	// Sampling is set while the compiler's sizer is still learning a
+	// baseline, with Samples the sizes collected so far, and Resamples
+	// counts the times a deviating render sent it back to sampling. After
+	// a deploy, templates still Sampling are those rendering without a
+	// sized buffer. All three are zero for a custom CompilerCfg.Sizing
+	// strategy; with SeparateByteSizing they describe the writer sizer.
+	Sampling  bool
+	Samples   int
+	Resamples int64
+}
+
+// Stats returns the compiler's counters. Reading them takes only atomic
+// loads, so it is safe to poll from a metrics endpoint.
+func (jc *Compiler) Stats() CompilerStats {
+	var stats CompilerStats
+	if jc.settings.mismatches != nil && jc.settings.mismatches.safe {
+		stats.Mismatches = jc.settings.mismatches.count.Load()
+	}
+	if jc.settings.timeouts != nil {
+		stats.Timeouts = jc.settings.timeouts.timeouts.Load()
+		stats.Substitutions = jc.settings.timeouts.substitutions.Load()
+	}
+	stats.Recovered = jc.recovered.Load()
+	if plan := jc.executionPlan.Load(); plan != nil {
+		stats.StaticRatio = plan.staticRatio
+		stats.MostlyDynamic = jc.mostlyDynamic(plan)
+	}
+	stats.Sampling, stats.Samples, stats.Resamples = sizerPhase(jc.sizer)
+	return stats
+}
+
+// TunerStats is a snapshot of a tuner's sizing phase, with the same
+// meaning as the fields of CompilerStats.
+type TunerStats struct {
+	Sampling  bool
+	Samples   int
+	Resamples int64
+}
+
+// Stats returns the tuner's sizing phase without taking the sizer's lock,
+// so it is safe to poll from a metrics endpoint. For the full sizer state
+// see SizerStats.
+func (jt *Tuner) Stats() TunerStats {
+	var stats TunerStats
+	stats.Sampling, stats.Samples, stats.Resamples = sizerPhase(jt.sizer)
+	return stats
+}
+
+// sizerPhase returns whether s is sampling, with its sample and resample
+// counts, from atomic loads. It is zero for strategies other than an
+// AdaptiveSizer, which have no phases.
+func sizerPhase(s SizingStrategy) (sampling bool, samples int, resamples int64) {
+	as, ok := s.(*AdaptiveSizer)
+	if !ok {
+		return false, 0, 0
+	}
+	return as.Active(), int(atomic.LoadInt64(&as.count)), atomic.LoadInt64(&as.resamples)
+}
+
+// staticRatio returns the percentage of a render of size bytes that is
+// the plan's static content. Empty output counts as entirely static.
+func staticRatio(plan *ExecutionPlan, size int) int {
+	if size == 0 {
+		return 100
+	}
+	static := 0
+	for _, element := range plan.Elements {
+		if sc, ok := element.(*StaticContent); ok {
+			static += len(sc.Content)
+		}
+	}
+	return min(static*100/size, 100)
+}
+
+// mostlyDynamic reports whether plan is below CompilerCfg.MinStaticRatio.
+func (jc *Compiler) mostlyDynamic(plan *ExecutionPlan) bool {
+	return jc.cfg != nil && jc.cfg.MinStaticRatio > 0 && plan.staticRatio < jc.cfg.MinStaticRatio
+}
+
+// mismatchHook is the function set by SetMismatchHook, or nil.
+var mismatchHook atomic.Pointer[func(template string, err error)]
+
+// SetMismatchHook sets a function called whenever a compiled render of any
+// compiler hits a dynamic path that does not resolve, leaving a gap in the
+// output. template is the compiler's registry ID, or "" for one made with
+// NewCompiler. Unlike CompilerCfg.OnMismatch it needs no per-compiler
+// setup, so operators can alert on mismatches across every template from
+// one place. Pass nil to remove it.
+//
+// The hook runs on the rendering goroutine, so it must be fast and safe
+// for concurrent use - typically incrementing a metric labelled by
+// template. Renders whose paths all resolve never call it.
+//
+// Example:
+//
+//	jit.SetMismatchHook(func(template string, err error) {
+//	    mismatches.WithLabelValues(template).Inc()
+//	})
+func SetMismatchHook(hook func(template string, err error)) {
+	if hook == nil {
+		mismatchHook.Store(nil)
+		return
+	}
+	mismatchHook.Store(&hook)
+}
+
+// mismatchCounter records paths that fail to resolve at render time. It is
+// the production counterpart to Validate: instead of walking every path up
+// front, it only does work on the render that actually hits a bad path.
+// Every compiler has one, so SetMismatchHook sees every compiler, but it
+// only counts and calls onMismatch with CompilerCfg.SafeRender.
+type mismatchCounter struct {
+	count      atomic.Int64
+	safe       bool   // CompilerCfg.SafeRender is set
+	template   string // The compiler's registry ID, for the hook
+	onMismatch func(err error)
+}
+
+// report counts one failed path and passes it to the callback and hook, if
+// any. The error is only built when there is something to receive it.
+func (mc *mismatchCounter) report(path []int, tags []string) {
+	if mc.safe {
+		mc.count.Add(1)
+	}
+	hook := mismatchHook.Load()
+	onMismatch := mc.onMismatch
+	if !mc.safe {
+		onMismatch = nil
+	}
+	if hook == nil && onMismatch == nil {
+		return
+	}
+	err := fmt.Errorf("%w: path %s did not resolve at render time", ErrStructureMismatch, describePath(path, tags))
+	if onMismatch != nil {
+		onMismatch(err)
+	}
+	if hook != nil {
+		(*hook)(mc.template, err)
+	}
+}
@@ -0,0 +1,248 @@
+package jit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestCompilerSafeRenderCountsMismatches verifies that with SafeRender a
+// path that no longer resolves is counted and reported to the callback,
+// rather than silently leaving a gap in the output.
+func TestCompilerSafeRenderCountsMismatches(t *testing.T) {
+	var reported []error
+	compiler := NewCompiler(&CompilerCfg{
+		Threshold:    15,
+		Max:          5,
+		Variance:     20,
+		GrowthFactor: 115,
+		SafeRender:   true,
+		OnMismatch:   func(err error) { reported = append(reported, err) },
+	})
+
+	compiler.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+	if got := compiler.Stats().Mismatches; got != 0 {
+		t.Fatalf("matching tree should not count mismatches, got %d", got)
+	}
+
+	compiler.Render(div.New(span.Static("Hello ")))
+	if got := compiler.Stats().Mismatches; got != 1 {
+		t.Errorf("missing dynamic child should count one mismatch, got %d", got)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrStructureMismatch) {
+		t.Fatalf("callback should receive one ErrStructureMismatch, got %v", reported)
+	}
+	if !strings.Contains(reported[0].Error(), "div > span[1] > text[0]") {
+		t.Errorf("reported error should describe the path by tag, got: %v", reported[0])
+	}
+}
+
+// TestCompilerSafeRenderConditionalBranch verifies that paths inside a
+// conditional's sub-plan are counted too.
+func TestCompilerSafeRenderConditionalBranch(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, Max: 5, Variance: 20, GrowthFactor: 115, SafeRender: true})
+
+	compiler.Render(div.New(node.When(true, div.New(span.Static("Hi "), span.Text("Alice")))))
+	compiler.Render(div.New(node.When(true, div.New(span.Static("Hi ")))))
+
+	if got := compiler.Stats().Mismatches; got != 1 {
+		t.Errorf("missing child inside the active branch should count one mismatch, got %d", got)
+	}
+}
+
+// TestCompilerStatsWithoutSafeRender verifies that mismatches are not
+// counted unless SafeRender is enabled.
+func TestCompilerStatsWithoutSafeRender(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Text("Alice")))
+	compiler.Render(div.New())
+
+	if got := compiler.Stats().Mismatches; got != 0 {
+		t.Errorf("mismatches should only be counted with SafeRender, got %d", got)
+	}
+}
+
+// TestMismatchHookSeesEveryCompiler verifies that the package-level hook
+// receives mismatches from registry compilers without SafeRender, labelled
+// with the template ID, and that SafeRender's count is left alone.
+func TestMismatchHookSeesEveryCompiler(t *testing.T) {
+	defer ResetCompile()
+	type report struct {
+		template string
+		err      error
+	}
+	var reported []report
+	SetMismatchHook(func(template string, err error) {
+		reported = append(reported, report{template, err})
+	})
+	defer SetMismatchHook(nil)
+
+	Compile("profile", div.New(span.Static("Hello "), span.Text("Alice")))
+	if len(reported) != 0 {
+		t.Fatalf("matching tree should not call the hook, got %v", reported)
+	}
+	Compile("profile", div.New(span.Static("Hello ")))
+	if len(reported) != 1 || reported[0].template != "profile" {
+		t.Fatalf("hook should receive one mismatch for \"profile\", got %v", reported)
+	}
+	if !errors.Is(reported[0].err, ErrStructureMismatch) {
+		t.Errorf("hook error should wrap ErrStructureMismatch, got: %v", reported[0].err)
+	}
+	if got := registeredCompiler("profile").Stats().Mismatches; got != 0 {
+		t.Errorf("hook alone should not count mismatches in Stats, got %d", got)
+	}
+
+	SetMismatchHook(nil)
+	Compile("profile", div.New(span.Static("Hello ")))
+	if len(reported) != 1 {
+		t.Errorf("removed hook should not be called, got %d reports", len(reported))
+	}
+}
+
+// TestCompilerRecoverPanicsFallsBack verifies that with RecoverPanics a
+// panic mid-render discards the partial output, reports the panic and
+// completes the response with standard rendering.
+func TestCompilerRecoverPanicsFallsBack(t *testing.T) {
+	var reported []error
+	compiler := NewCompiler(&CompilerCfg{
+		Threshold:     15,
+		RecoverPanics: true,
+		OnPanic:       func(err error) { reported = append(reported, err) },
+	})
+
+	calls := 0
+	flaky := func() node.Node {
+		return div.New(span.Static("Hello "), node.Func(func() node.Node {
+			calls++
+			if calls == 2 {
+				panic("transient")
+			}
+			return span.Text("Alice")
+		}))
+	}
+	want := string(compiler.Render(flaky()))
+
+	var out strings.Builder
+	compiler.Render(flaky(), &out)
+	if out.String() != want {
+		t.Errorf("fallback should complete the page once:\n  got  %q\n  want %q", out.String(), want)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrRenderPanic) || !strings.Contains(reported[0].Error(), "transient") {
+		t.Errorf("callback should receive one ErrRenderPanic naming the value, got %v", reported)
+	}
+	if got := compiler.Stats().Recovered; got != 1 {
+		t.Errorf("expected 1 recovered render, got %d", got)
+	}
+}
+
+// TestCompilerRecoverPanicsEntryPoints verifies that RecoverPanics covers
+// RenderContext, RenderFragment and RenderPretty, not only Render.
+func TestCompilerRecoverPanicsEntryPoints(t *testing.T) {
+	armed := false
+	tree := func() node.Node {
+		return div.New(span.Static("Hello "), div.New(node.Func(func() node.Node {
+			if armed {
+				armed = false
+				panic("transient")
+			}
+			return span.Text("Alice")
+		})))
+	}
+	compiler := NewCompiler(&CompilerCfg{Threshold: 15, RecoverPanics: true})
+	want := string(compiler.Render(tree()))
+
+	renders := map[string]func(w io.Writer) error{
+		"RenderContext": func(w io.Writer) error { return compiler.RenderContext(context.Background(), tree(), w) },
+		"RenderFragment": func(w io.Writer) error {
+			_, err := io.WriteString(w, "<div><span>Hello </span>")
+			if err == nil {
+				err = compiler.RenderFragment(tree(), []int{1}, w)
+			}
+			_, _ = io.WriteString(w, "</div>")
+			return err
+		},
+		"RenderPretty": func(w io.Writer) error {
+			compiler.RenderPretty(tree(), w)
+			return nil
+		},
+		"Preview": func(w io.Writer) error {
+			_, err := w.Write(compiler.Preview(tree(), 1000))
+			return err
+		},
+	}
+	for name, render := range renders {
+		before := compiler.Stats().Recovered
+		armed = true
+		var out strings.Builder
+		if err := render(&out); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if got := compiler.Stats().Recovered - before; got != 1 {
+			t.Errorf("%s: expected 1 recovered render, got %d", name, got)
+		}
+		if name != "RenderPretty" && out.String() != want {
+			t.Errorf("%s: fallback should complete the output:\n  got  %q\n  want %q", name, out.String(), want)
+		}
+	}
+}
+
+// TestCompilerMostlyDynamicAdvisory verifies that a plan whose output is
+// mostly dynamic is reported and flagged, and that one with enough static
+// content is not.
+func TestCompilerMostlyDynamicAdvisory(t *testing.T) {
+	var reported []error
+	cfg := &CompilerCfg{
+		Threshold:       15,
+		MinStaticRatio:  50,
+		OnMostlyDynamic: func(err error) { reported = append(reported, err) },
+	}
+
+	dynamic := NewCompiler(cfg)
+	dynamic.Render(div.New(span.Text(strings.Repeat("x", 200))))
+	stats := dynamic.Stats()
+	if !stats.MostlyDynamic || stats.StaticRatio >= 50 {
+		t.Errorf("mostly dynamic template should be flagged, got %+v", stats)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrMostlyDynamic) {
+		t.Fatalf("callback should receive one ErrMostlyDynamic, got %v", reported)
+	}
+
+	static := NewCompiler(cfg)
+	static.Render(div.New(span.Static(strings.Repeat("x", 200)), span.Text("y")))
+	if stats := static.Stats(); stats.MostlyDynamic || stats.StaticRatio < 90 {
+		t.Errorf("mostly static template should not be flagged, got %+v", stats)
+	}
+	if len(reported) != 1 {
+		t.Errorf("mostly static template should not be reported, got %v", reported)
+	}
+}
+
+// TestStatsSizingPhase verifies that compiler and tuner stats show the
+// sizer learning, settling, and being sent back by a deviating render.
+func TestStatsSizingPhase(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Max: 3, Variance: 20, GrowthFactor: 100})
+	compiler.Render(span.Text("Alice"))
+	if st := compiler.Stats(); !st.Sampling || st.Samples != 2 {
+		t.Errorf("want sampling with the compile and one render counted, got %+v", st)
+	}
+	compiler.Render(span.Text("Alice"))
+	if st := compiler.Stats(); st.Sampling || st.Resamples != 0 {
+		t.Errorf("the third sample should settle the baseline, got %+v", st)
+	}
+	compiler.Render(span.Text(strings.Repeat("Alice", 20)))
+	if st := compiler.Stats(); !st.Sampling || st.Samples != 1 || st.Resamples != 1 {
+		t.Errorf("a deviating render should restart sampling from itself, got %+v", st)
+	}
+
+	tuner := NewTuner().Tune(span.Text("Alice"))
+	tuner.Render()
+	if st := tuner.Stats(); !st.Sampling || st.Samples != 1 {
+		t.Errorf("want the tuner sampling with one render counted, got %+v", st)
+	}
+}
@@ -0,0 +1,306 @@
+package jit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// Defer marks n as slow, such as a widget backed by a database query.
+// RenderStream sends the page with fallback in its place, then streams n
+// once it is ready, and a small inline script swaps it in. Everywhere else
+// - Render, a Tuner, a plain n.Render - the wrapper renders n in place and
+// fallback is never shown.
+//
+// fallback may be nil to leave the slot empty until n arrives.
+//
+// Example:
+//
+//	div.New(
+//	    h1.Static("Dashboard"),
+//	    jit.Defer(node.Func(func() node.Node { return RecentOrders(db) }),
+//	        p.Static("Loading orders...")),
+//	)
+func Defer(n, fallback node.Node) node.Node {
+	return &deferred{n: n, fallback: fallback}
+}
+
+// DeferContext is Defer for content that should stop work early when the
+// stream is abandoned. RenderStream calls fn with a context that is
+// cancelled when the client goes away or RenderStream returns, so a query
+// behind a widget nobody will see can be abandoned. Everywhere else fn is
+// called with context.Background().
+//
+// Example:
+//
+//	jit.DeferContext(func(ctx context.Context) node.Node {
+//	    return RecentOrders(ctx, db)
+//	}, p.Static("Loading orders..."))
+func DeferContext(fn func(context.Context) node.Node, fallback node.Node) node.Node {
+	return &deferred{fn: fn, fallback: fallback}
+}
+
+// deferred is the node behind Defer and DeferContext. It is dynamic so the
+// compiler gives it a path, which is how RenderStream finds it in the plan.
+type deferred struct {
+	n        node.Node
+	fn       func(context.Context) node.Node
+	fallback node.Node
+}
+
+// Render renders the deferred node in place.
+func (d *deferred) Render(w ...io.Writer) []byte {
+	buf := fluent.NewBuffer()
+	d.RenderBuilder(buf)
+
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// RenderBuilder renders the deferred node in place into buf.
+func (d *deferred) RenderBuilder(buf *bytes.Buffer) {
+	d.renderContext(context.Background(), buf)
+}
+
+// renderContext renders the deferred node into buf, passing ctx to a
+// DeferContext func.
+func (d *deferred) renderContext(ctx context.Context, buf *bytes.Buffer) {
+	n := d.n
+	if d.fn != nil {
+		n = d.fn(ctx)
+	}
+	if n != nil {
+		n.RenderBuilder(buf)
+	}
+}
+
+// Nodes returns the deferred node, which is what renders outside a stream.
+// A DeferContext func is not called just to walk the tree.
+func (d *deferred) Nodes() []node.Node {
+	if d.n == nil {
+		return nil
+	}
+	return []node.Node{d.n}
+}
+
+// IsDynamic returns true - the content is evaluated on every render.
+func (d *deferred) IsDynamic() bool { return true }
+
+// DynamicKey returns "" - deferred slots are not tracked by the diff engine.
+func (d *deferred) DynamicKey() string { return "" }
+
+// streamSwapScript moves a streamed template's content into its slot. It is
+// sent once per stream, before the first deferred chunk, and takes the
+// stream's id prefix so that several streams can share one page.
+const streamSwapScript = `function __jitSwap(p,i){var t=document.getElementById(p+"c-"+i),s=document.getElementById(p+"s-"+i);if(t&&s){s.replaceWith(t.content);t.remove()}}`
+
+// streams numbers RenderStream calls, giving each its own id prefix so
+// the placeholders of two streams written into one page never collide.
+var streams atomic.Uint64
+
+// RenderStream renders root in two phases for pages with slow sections.
+// First the page is written with each Defer node's fallback in a
+// placeholder and flushed, so the browser can show it straight away.
+// Meanwhile every deferred node renders concurrently, and each is written
+// as soon as it finishes, in whatever order they finish, inside a
+// <template> followed by an inline script that swaps it into its
+// placeholder.
+//
+// The page itself comes from the compiled plan as for Render. Defer nodes
+// inside conditional branches are streamed too; ones nested inside other
+// dynamic content, such as the output of a node.Func, render in place.
+//
+// If w is an http.ResponseWriter or otherwise implements http.Flusher, it
+// is flushed after the page and after each chunk. A deferred node that
+// panics keeps its fallback and is reported as a *SegmentError. With
+// CompilerCfg.RecoverPanics, a panic while writing the page renders the
+// whole tree the standard way instead, deferred nodes in place, and
+// nothing is streamed after it. If ctx is
+// done before every chunk is sent, RenderStream stops waiting and returns
+// ctx.Err() - the fallbacks still on the page are the last word. When it
+// returns, chunks not yet started are skipped and the context given to
+// DeferContext funcs is cancelled; a plain Defer node already rendering
+// runs to completion and its output is discarded.
+//
+// As with RenderSegments, compiling the plan renders the whole tree once,
+// deferred nodes included - render once at startup, or Warm a registry
+// template, to keep that off the request path.
+//
+// Placeholders are display: contents elements so they do not affect
+// layout, and the swap script is inline, so a Content-Security-Policy must
+// allow it - pass StreamCfg.Nonce to have it carry a nonce.
+func (jc *Compiler) RenderStream(ctx context.Context, root node.Node, w io.Writer, cfg ...StreamCfg) error {
+	plan := jc.currentPlan(root)
+
+	var sc StreamCfg
+	if len(cfg) > 0 {
+		sc = cfg[0]
+	}
+
+	st := &stream{prefix: "jit-" + strconv.FormatUint(streams.Add(1), 36) + "-"}
+	buf := fluent.NewBuffer(jc.predict())
+	defer fluent.PutBuffer(buf)
+	jc.recovering(buf, root, func() {
+		completed := false
+		defer func() {
+			if !completed {
+				// The fallback renders Defer nodes in place, and the
+				// placeholders queued so far were dropped with the output.
+				st.pending = nil
+			}
+		}()
+		st.plan(plan, root, buf)
+		completed = true
+	})
+
+	if _, err := buf.WriteTo(w); err != nil {
+		return err
+	}
+	flush(w)
+	if len(st.pending) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan streamChunk, len(st.pending))
+	for i, p := range st.pending {
+		go func() {
+			results <- renderChunk(ctx, i, p)
+		}()
+	}
+
+	var errs []error
+	scriptOpen := "<script>"
+	if sc.Nonce != "" {
+		scriptOpen = `<script nonce="` + html.EscapeString(sc.Nonce) + `">`
+	}
+	scripted := false
+	for range len(st.pending) {
+		var chunk streamChunk
+		select {
+		case chunk = <-results:
+		case <-ctx.Done():
+			return errors.Join(append(errs, ctx.Err())...)
+		}
+		if chunk.err != nil {
+			errs = append(errs, chunk.err)
+			continue
+		}
+
+		var out bytes.Buffer
+		if !scripted {
+			out.WriteString(scriptOpen + streamSwapScript + "</script>")
+		}
+		id := strconv.Itoa(chunk.index)
+		out.WriteString(`<template id="` + st.prefix + `c-` + id + `">`)
+		out.Write(chunk.content)
+		out.WriteString("</template>" + scriptOpen + `__jitSwap("` + st.prefix + `",` + id + ")</script>")
+		if _, err := out.WriteTo(w); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		scripted = true
+		flush(w)
+	}
+	return errors.Join(errs...)
+}
+
+// stream collects the Defer nodes found while writing the page.
+type stream struct {
+	prefix  string // Id prefix unique to this stream, such as "jit-1-"
+	pending []pendingChunk
+}
+
+// pendingChunk is a Defer node waiting to be rendered.
+type pendingChunk struct {
+	d    *deferred
+	path string // Described by tag, for errors
+}
+
+// streamChunk is a rendered Defer node, or why it could not be rendered.
+type streamChunk struct {
+	index   int
+	content []byte
+	err     error
+}
+
+// plan writes plan against root into buf, with a placeholder for each
+// Defer node.
+func (st *stream) plan(plan *ExecutionPlan, root node.Node, buf *bytes.Buffer) {
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *DynamicPath:
+			n, ok := el.path.resolve(root)
+			if d, isDeferred := n.(*deferred); ok && isDeferred {
+				st.placeholder(d, el.String(), buf)
+				continue
+			}
+			el.Render(root, buf)
+		case *ConditionalPath:
+			n, ok := el.path.resolve(root)
+			c, isCond := n.(*node.ConditionalBuilder)
+			if !ok || !isCond {
+				el.Render(root, buf)
+				continue
+			}
+			sub, branchRoot := el.branchPlan(c)
+			if branchRoot != nil {
+				st.plan(sub, branchRoot, buf)
+			}
+		default:
+			element.Render(root, buf)
+		}
+	}
+}
+
+// placeholder writes d's fallback in a slot the swap script can find, and
+// queues d to be rendered.
+func (st *stream) placeholder(d *deferred, path string, buf *bytes.Buffer) {
+	id := strconv.Itoa(len(st.pending))
+	buf.WriteString(`<jit-slot id="` + st.prefix + `s-` + id + `" style="display:contents">`)
+	if d.fallback != nil {
+		d.fallback.RenderBuilder(buf)
+	}
+	buf.WriteString("</jit-slot>")
+	st.pending = append(st.pending, pendingChunk{d: d, path: path})
+}
+
+// renderChunk renders one Defer node, turning a panic into an error so one
+// broken widget does not take down the response. It does nothing once ctx
+// is done, as nobody is waiting for the result.
+func renderChunk(ctx context.Context, index int, p pendingChunk) (chunk streamChunk) {
+	chunk.index = index
+	if ctx.Err() != nil {
+		return chunk
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			chunk.content = nil
+			chunk.err = &SegmentError{Path: p.path, Err: fmt.Errorf("%w: %v", ErrSegmentPanic, r)}
+		}
+	}()
+	var buf bytes.Buffer
+	p.d.renderContext(ctx, &buf)
+	chunk.content = buf.Bytes()
+	return chunk
+}
+
+// flush sends buffered output to the client if w supports it.
+func flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
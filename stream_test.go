@@ -0,0 +1,260 @@
+package jit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/h1"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// streamPage has a slow widget that waits on release and a fast one.
+func streamPage(release <-chan struct{}) node.Node {
+	return div.New(
+		h1.Static("Dashboard"),
+		Defer(node.Func(func() node.Node {
+			<-release
+			return span.Text("slow")
+		}), p.Static("Loading...")),
+		Defer(node.Func(func() node.Node { return span.Text("fast") }), nil),
+	)
+}
+
+// streamRecorder calls onWrite with each write, on the writing goroutine.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	onWrite func(p []byte)
+}
+
+func (sr *streamRecorder) Write(p []byte) (int, error) {
+	n, err := sr.ResponseRecorder.Write(p)
+	sr.onWrite(p)
+	return n, err
+}
+
+// TestRenderStreamOutOfOrder verifies that the page is sent with fallbacks
+// first, and that deferred chunks follow in the order they finish.
+func TestRenderStreamOutOfOrder(t *testing.T) {
+	compiler := NewCompiler()
+	done := make(chan struct{})
+	close(done)
+	compiler.Render(streamPage(done)) // compile with nothing blocking
+
+	// The slow widget is only released once the fast one has been sent,
+	// so the test deadlocks unless chunks go out as they finish.
+	release := make(chan struct{})
+	rec := &streamRecorder{ResponseRecorder: httptest.NewRecorder(), onWrite: func(p []byte) {
+		if strings.Contains(string(p), "fast") {
+			close(release)
+		}
+	}}
+
+	if err := compiler.RenderStream(context.Background(), streamPage(release), rec); err != nil {
+		t.Fatalf("RenderStream failed: %v", err)
+	}
+
+	body := rec.Body.String()
+	id := streamPrefix(t, body)
+	shell := `<div><h1>Dashboard</h1><jit-slot id="` + id + `s-0" style="display:contents"><p>Loading...</p></jit-slot>` +
+		`<jit-slot id="` + id + `s-1" style="display:contents"></jit-slot></div>`
+	if !strings.HasPrefix(body, shell) {
+		t.Fatalf("page should be sent first with fallbacks in placeholders:\n  got  %q\n  want prefix %q", body, shell)
+	}
+	fast := strings.Index(body, `<template id="`+id+`c-1"><span>fast</span></template>`)
+	slow := strings.Index(body, `<template id="`+id+`c-0"><span>slow</span></template>`)
+	if fast < 0 || slow < 0 || fast > slow {
+		t.Errorf("fast chunk should arrive before the slow one:\n%s", body)
+	}
+	if strings.Count(body, "function __jitSwap") != 1 {
+		t.Error("swap function should be sent exactly once")
+	}
+	if !rec.Flushed {
+		t.Error("response should be flushed")
+	}
+}
+
+// TestRenderStreamPanic verifies that a failing widget keeps its fallback
+// and is reported, while the others are still sent.
+func TestRenderStreamPanic(t *testing.T) {
+	tree := div.New(
+		Defer(node.Func(func() node.Node { panic("db down") }), p.Static("Unavailable")),
+		Defer(span.Text("ok"), nil),
+	)
+
+	compiler := NewCompiler()
+	compiler.Render(div.New(Defer(span.Text("x"), nil), Defer(span.Text("y"), nil)))
+
+	rec := httptest.NewRecorder()
+	err := compiler.RenderStream(context.Background(), tree, rec)
+
+	var seg *SegmentError
+	if !errors.As(err, &seg) || !errors.Is(err, ErrSegmentPanic) {
+		t.Errorf("expected a SegmentError wrapping ErrSegmentPanic, got: %v", err)
+	}
+	body := rec.Body.String()
+	id := streamPrefix(t, body)
+	if !strings.Contains(body, "<p>Unavailable</p>") || strings.Contains(body, `id="`+id+`c-0"`) {
+		t.Errorf("failed widget should leave its fallback and send no chunk:\n%s", body)
+	}
+	if !strings.Contains(body, `<template id="`+id+`c-1"><span>ok</span></template>`) {
+		t.Errorf("working widget should still be sent:\n%s", body)
+	}
+}
+
+// TestRenderStreamFirstChunkFails verifies that the swap function is still
+// defined before it is called when the first chunk to finish fails.
+func TestRenderStreamFirstChunkFails(t *testing.T) {
+	release := make(chan struct{})
+	tree := div.New(
+		Defer(node.Func(func() node.Node {
+			defer close(release)
+			panic("db down")
+		}), p.Static("Unavailable")),
+		Defer(node.Func(func() node.Node {
+			<-release
+			return span.Text("ok")
+		}), nil),
+	)
+
+	compiler := NewCompiler()
+	compiler.Render(div.New(Defer(span.Text("x"), nil), Defer(span.Text("y"), nil)))
+
+	rec := httptest.NewRecorder()
+	err := compiler.RenderStream(context.Background(), tree, rec)
+	if !errors.Is(err, ErrSegmentPanic) {
+		t.Errorf("expected ErrSegmentPanic, got: %v", err)
+	}
+	body := rec.Body.String()
+	def := strings.Index(body, "function __jitSwap")
+	call := strings.Index(body, "__jitSwap(\"")
+	if def < 0 || call < 0 || def > call {
+		t.Errorf("swap function should be defined before it is called:\n%s", body)
+	}
+}
+
+// TestRenderStreamIDs verifies that two streams written into one page use
+// different ids.
+func TestRenderStreamIDs(t *testing.T) {
+	compiler := NewCompiler()
+	tree := div.New(Defer(span.Text("x"), nil))
+	var first, second httptest.ResponseRecorder
+	first.Body, second.Body = new(bytes.Buffer), new(bytes.Buffer)
+	if err := compiler.RenderStream(context.Background(), tree, &first); err != nil {
+		t.Fatalf("RenderStream failed: %v", err)
+	}
+	if err := compiler.RenderStream(context.Background(), tree, &second); err != nil {
+		t.Fatalf("RenderStream failed: %v", err)
+	}
+	if a, b := streamPrefix(t, first.Body.String()), streamPrefix(t, second.Body.String()); a == b {
+		t.Errorf("streams should not share the id prefix %q", a)
+	}
+}
+
+// TestRenderStreamCancel verifies that the context given to DeferContext
+// is cancelled when RenderStream gives up waiting.
+func TestRenderStreamCancel(t *testing.T) {
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	tree := div.New(DeferContext(func(ctx context.Context) node.Node {
+		if ctx.Done() == nil {
+			return nil // compiling, outside the stream
+		}
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	}, p.Static("Loading...")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	err := NewCompiler().RenderStream(ctx, tree, httptest.NewRecorder())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("deferred work should see its context cancelled")
+	}
+}
+
+// streamPrefix returns the id prefix of the stream written to body.
+func streamPrefix(t *testing.T, body string) string {
+	t.Helper()
+	_, rest, ok := strings.Cut(body, `<jit-slot id="`)
+	prefix, _, found := strings.Cut(rest, "s-")
+	if !ok || !found {
+		t.Fatalf("no placeholder in:\n%s", body)
+	}
+	return prefix
+}
+
+// TestRenderStreamNonce verifies scripts carry the CSP nonce.
+func TestRenderStreamNonce(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tree := div.New(Defer(span.Text("x"), nil))
+	if err := NewCompiler().RenderStream(context.Background(), tree, rec, StreamCfg{Nonce: "abc"}); err != nil {
+		t.Fatalf("RenderStream failed: %v", err)
+	}
+	if n := strings.Count(rec.Body.String(), `<script nonce="abc">`); n != 2 {
+		t.Errorf("both scripts should carry the nonce, found %d", n)
+	}
+}
+
+// TestDeferRendersInPlace verifies that outside a stream Defer renders its
+// content and never the fallback.
+func TestDeferRendersInPlace(t *testing.T) {
+	tree := div.New(Defer(span.Text("content"), p.Static("fallback")))
+	want := "<div><span>content</span></div>"
+	if got := string(tree.Render()); got != want {
+		t.Errorf("plain render:\n  got  %q\n  want %q", got, want)
+	}
+	if got := string(NewCompiler().Render(tree)); got != want {
+		t.Errorf("compiled render:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestRenderStreamRecoverPanics verifies that with RecoverPanics a panic
+// while the page is written falls back to the standard render, deferred
+// nodes included, and streams no chunks for placeholders that were
+// dropped with the partial page.
+func TestRenderStreamRecoverPanics(t *testing.T) {
+	armed := false
+	page := func() node.Node {
+		return div.New(
+			Defer(node.Func(func() node.Node { return span.Text("widget") }), p.Static("Loading...")),
+			node.Func(func() node.Node {
+				if armed {
+					armed = false
+					panic("page failed")
+				}
+				return span.Text("body")
+			}),
+		)
+	}
+	compiler := NewCompiler(&CompilerCfg{RecoverPanics: true})
+	compiler.Render(page())
+
+	armed = true
+	rec := httptest.NewRecorder()
+	if err := compiler.RenderStream(context.Background(), page(), rec); err != nil {
+		t.Fatalf("a recovered page should not fail the stream: %v", err)
+	}
+	if got := compiler.Stats().Recovered; got != 1 {
+		t.Errorf("expected 1 recovered render, got %d", got)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "jit-slot") || strings.Contains(body, "<template") || !strings.Contains(body, "<span>widget</span>") {
+		t.Errorf("the fallback should render deferred nodes in place and stream nothing, got %q", body)
+	}
+}
@@ -0,0 +1,78 @@
+package jit
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// SurrogateKeyHeader is the default header for surrogate keys.
+const SurrogateKeyHeader = "Surrogate-Key"
+
+// SetSurrogateKeys adds the keys from CompilerCfg.Surrogate and keys to the
+// response's surrogate key header, so a CDN purge by any of them reaches
+// this page. Pass keys naming the data the page shows, such as
+// "product-42", so a change to that entity can purge exactly the pages
+// that display it. Keys already in the header are not repeated, and no
+// header is set if there are no keys.
+//
+// Keys must not contain the separator. Call SetSurrogateKeys before the
+// first write to w.
+//
+// Example:
+//
+//	productCompiler.SetSurrogateKeys(w, "product-"+p.ID, "brand-"+p.BrandID)
+//	productCompiler.RenderRequest(w, r, ProductPage(p))
+func (jc *Compiler) SetSurrogateKeys(w http.ResponseWriter, keys ...string) {
+	var cfg SurrogateCfg
+	if jc.cfg != nil {
+		cfg = jc.cfg.Surrogate
+	}
+	header, sep := cfg.Header, cfg.Separator
+	if header == "" {
+		header = SurrogateKeyHeader
+	}
+	if sep == "" {
+		sep = " "
+	}
+
+	existing := w.Header().Get(header)
+	var all []string
+	for key := range strings.SplitSeq(existing, sep) {
+		if key = strings.TrimSpace(key); key != "" {
+			all = append(all, key)
+		}
+	}
+	n := len(all)
+	for _, key := range slices.Concat(cfg.Keys, keys) {
+		if key != "" && !slices.Contains(all, key) {
+			all = append(all, key)
+		}
+	}
+	if len(all) == n {
+		return
+	}
+	w.Header().Set(header, strings.Join(all, sep))
+}
+
+// Serve renders n for the request through the compiler registered under id,
+// as RenderRequest does, and tags the response with id and keys as
+// surrogate keys. Purging id at the CDN then clears every page the template
+// produced, and purging one of keys clears the pages showing that entity.
+//
+// The compiler is created on first use like Compile's; configure it with
+// CompileConfig first to change the surrogate header.
+//
+// Example:
+//
+//	func productHandler(w http.ResponseWriter, r *http.Request) {
+//	    p := loadProduct(r.PathValue("id"))
+//	    jit.Serve("product", w, r, ProductPage(p), "product-"+p.ID)
+//	}
+func Serve(id string, w http.ResponseWriter, r *http.Request, n node.Node, keys ...string) {
+	compiler := registeredCompiler(id)
+	compiler.SetSurrogateKeys(w, append([]string{id}, keys...)...)
+	compiler.RenderRequest(w, r, n)
+}
@@ -0,0 +1,56 @@
+package jit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSetSurrogateKeys verifies configured and per-request keys are joined
+// into one header without repeats.
+func TestSetSurrogateKeys(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Surrogate: SurrogateCfg{Keys: []string{"orders"}}})
+	rec := httptest.NewRecorder()
+
+	compiler.SetSurrogateKeys(rec, "customer-7", "orders")
+	compiler.SetSurrogateKeys(rec, "customer-7")
+
+	if got, want := rec.Header().Get(SurrogateKeyHeader), "orders customer-7"; got != want {
+		t.Errorf("surrogate keys:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestSetSurrogateKeysCustomHeader verifies the header and separator can be
+// set for CDNs other than Fastly, and that no header is set without keys.
+func TestSetSurrogateKeysCustomHeader(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{Surrogate: SurrogateCfg{Header: "Cache-Tag", Separator: ","}})
+
+	rec := httptest.NewRecorder()
+	compiler.SetSurrogateKeys(rec)
+	if len(rec.Header()) != 0 {
+		t.Errorf("no header should be set without keys, got %v", rec.Header())
+	}
+
+	compiler.SetSurrogateKeys(rec, "a", "b")
+	if got, want := rec.Header().Get("Cache-Tag"), "a,b"; got != want {
+		t.Errorf("Cache-Tag:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestServeTagsTemplateID verifies that Serve renders through the registry
+// and tags the response with the template ID and the caller's keys.
+func TestServeTagsTemplateID(t *testing.T) {
+	defer ResetCompile("serve-orders")
+
+	rec := httptest.NewRecorder()
+	Serve("serve-orders", rec, httptest.NewRequest("GET", "/orders", nil), negotiatePage("3"), "customer-7")
+
+	if got, want := rec.Header().Get(SurrogateKeyHeader), "serve-orders customer-7"; got != want {
+		t.Errorf("surrogate keys:\n  got  %q\n  want %q", got, want)
+	}
+	if want := string(negotiatePage("3").Render()); rec.Body.String() != want {
+		t.Errorf("Serve should render the page:\n  got  %q\n  want %q", rec.Body.String(), want)
+	}
+	if _, ok := compilers.Load("serve-orders"); !ok {
+		t.Error("Serve should register the compiler under its ID")
+	}
+}
@@ -0,0 +1,243 @@
+package jit
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// Data carries the per-render values for a Template, keyed by whatever
+// names the template's holes read.
+type Data map[string]any
+
+// Hole marks a region of a Template that is re-evaluated on every render.
+// fn receives that render's Data and returns the nodes to render in its
+// place. Everything outside a hole is built once and frozen.
+//
+// Holes must sit in the template's own structure. A hole returned from
+// inside a node.Func closure is rebuilt on each render and never receives
+// data - it renders as if Data were empty.
+func Hole(fn func(d Data) node.Node) node.Node {
+	return Bind(fn)
+}
+
+// Bind is the typed form of Hole for use with TypedCompiler. fn receives
+// the T passed to TypedCompiler.Render. A Bind whose T does not match the
+// compiler's is not bound and renders with T's zero value.
+func Bind[T any](fn func(d T) node.Node) node.Node {
+	return &hole[T]{fn: fn}
+}
+
+// hole is the node behind Hole and Bind. It reports itself as dynamic so
+// the compiler gives it its own path rather than freezing its output.
+type hole[T any] struct {
+	fn func(d T) node.Node
+}
+
+// render evaluates the hole against d and writes the result to buf.
+func (h *hole[T]) render(d T, buf *bytes.Buffer) {
+	if n := h.fn(d); n != nil {
+		n.RenderBuilder(buf)
+	}
+}
+
+// Render renders the hole with empty Data, for use outside a Template.
+func (h *hole[T]) Render(w ...io.Writer) []byte {
+	buf := fluent.NewBuffer()
+	h.RenderBuilder(buf)
+
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// RenderBuilder renders with T's zero value - outside a compiler of the
+// matching type there is nothing to bind against.
+func (h *hole[T]) RenderBuilder(buf *bytes.Buffer) {
+	var zero T
+	h.render(zero, buf)
+}
+
+// Nodes returns nothing so tree walkers do not call fn without data.
+func (h *hole[T]) Nodes() []node.Node { return nil }
+
+// IsDynamic returns true - a hole's output depends on the render's Data.
+func (h *hole[T]) IsDynamic() bool { return true }
+
+// DynamicKey returns "" - holes are not tracked by the diff engine.
+func (h *hole[T]) DynamicKey() string { return "" }
+
+// Template is a TypedCompiler whose data is an untyped Data map.
+type Template = TypedCompiler[Data]
+
+// CompileTemplate returns a Template that builds its tree by calling build.
+// build is called once, on the first Render, with that render's data.
+// Anything it reads from d directly is frozen like any other static content -
+// wrap values that change between renders in Hole.
+//
+// Example:
+//
+//	page := jit.CompileTemplate(func(d jit.Data) node.Node {
+//	    return div.New(
+//	        h1.Static("Profile"),
+//	        jit.Hole(func(d jit.Data) node.Node {
+//	            return p.Text(d["name"].(string))
+//	        }),
+//	    )
+//	})
+//	page.Render(jit.Data{"name": "Alice"}, w)
+func CompileTemplate(build func(d Data) node.Node) *Template {
+	return NewTypedCompiler(build)
+}
+
+// TypedCompiler is a compiled template whose tree is built once and whose
+// holes are bound to a value of type T on each render. Unlike Compiler,
+// which needs a fresh tree on every render to read dynamic values from, a
+// TypedCompiler keeps the tree it was built with and evaluates only its
+// Bind nodes against the T passed to Render - so template data is checked
+// by the Go compiler rather than threaded through loosely typed trees.
+type TypedCompiler[T any] struct {
+	build func(d T) node.Node
+	ops   atomic.Pointer[[]templateOp[T]] // Flattened plan with every path resolved against the built tree, nil until built
+	mu    sync.Mutex                      // Held while building
+	sizer *AdaptiveSizer
+}
+
+// templateOp is one step of a TypedCompiler render: either static bytes, a
+// hole to evaluate against the render's data, or a dynamic node from the
+// built tree that re-renders itself (such as a node.Func) as the plan's
+// path renders it - for a DynamicAttr element, only its opening tag.
+type templateOp[T any] struct {
+	static  []byte
+	hole    *hole[T]
+	dynamic node.Node
+	path    *DynamicPath // The plan element dynamic was resolved from
+}
+
+// NewTypedCompiler returns a TypedCompiler that builds its tree by calling
+// build. build is called once, on the first Render, with that render's
+// data. If it panics, that Render panics with an error wrapping
+// ErrBuildPanic and the next Render calls build again. Anything it reads
+// from d directly is frozen - wrap values that change between renders in
+// Bind.
+//
+// Example:
+//
+//	type Profile struct{ Name string }
+//
+//	var page = jit.NewTypedCompiler(func(_ Profile) node.Node {
+//	    return div.New(
+//	        h1.Static("Profile"),
+//	        jit.Bind(func(d Profile) node.Node { return p.Text(d.Name) }),
+//	    )
+//	})
+//	page.Render(Profile{Name: "Alice"}, w)
+func NewTypedCompiler[T any](build func(d T) node.Node) *TypedCompiler[T] {
+	return &TypedCompiler[T]{
+		build: build,
+		sizer: NewAdaptiveSizer(),
+	}
+}
+
+// Render evaluates the compiler's holes against d and writes the result to
+// w, or returns it as bytes if no writer is given.
+func (tc *TypedCompiler[T]) Render(d T, w ...io.Writer) []byte {
+	ops := tc.compiled(d)
+	predictedSize := tc.sizer.Baseline()
+
+	// With writer: use pooled buffer, write, then return to pool
+	if len(w) > 0 && w[0] != nil {
+		buf := fluent.NewBuffer(predictedSize)
+		tc.renderOps(ops, d, buf)
+		tc.sizer.Observe(buf.Len())
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+
+	// Without writer: use local buffer with predicted capacity
+	buf := bytes.NewBuffer(make([]byte, 0, predictedSize))
+	tc.renderOps(ops, d, buf)
+	tc.sizer.Observe(buf.Len())
+	return buf.Bytes()
+}
+
+// compiled returns the template's ops, building the tree from d if no
+// build has succeeded yet. A build that panics stores nothing, and the
+// render panics again with an error wrapping ErrBuildPanic, so the next
+// render builds again rather than every later render running an empty
+// plan.
+func (tc *TypedCompiler[T]) compiled(d T) []templateOp[T] {
+	if ops := tc.ops.Load(); ops != nil {
+		return *ops
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if ops := tc.ops.Load(); ops != nil {
+		return *ops
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panic(buildPanic(r))
+		}
+	}()
+	root := tc.build(d)
+	ops := templateOps[T](buildPlan(root, planSettings{}), root, nil)
+	tc.ops.Store(&ops)
+	return ops
+}
+
+// renderOps executes the resolved plan, evaluating holes against d.
+func (tc *TypedCompiler[T]) renderOps(ops []templateOp[T], d T, buf *bytes.Buffer) {
+	for _, op := range ops {
+		switch {
+		case op.hole != nil:
+			op.hole.render(d, buf)
+		case op.dynamic != nil:
+			op.path.renderNode(op.dynamic, buf)
+		default:
+			buf.Write(op.static)
+		}
+	}
+}
+
+// templateOps resolves every path in plan against root once, since the tree
+// never changes. Conditionals in a built tree can no longer change branch,
+// so the active branch's sub-plan is inlined - which also lets holes inside
+// a branch receive data.
+func templateOps[T any](plan *ExecutionPlan, root node.Node, ops []templateOp[T]) []templateOp[T] {
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			ops = append(ops, templateOp[T]{static: el.Content})
+		case *DynamicPath:
+			n, ok := el.path.resolve(root)
+			if !ok {
+				continue
+			}
+			if h, ok := n.(*hole[T]); ok {
+				ops = append(ops, templateOp[T]{hole: h})
+			} else {
+				ops = append(ops, templateOp[T]{dynamic: n, path: el})
+			}
+		case *ConditionalPath:
+			n, ok := el.path.resolve(root)
+			if !ok {
+				continue
+			}
+			c := n.(*node.ConditionalBuilder) //nolint:forcetypeassert // ConditionalPath is only built for conditionals
+			branchPlan, branchRoot := el.branchPlan(c)
+			if branchRoot != nil {
+				ops = templateOps(branchPlan, branchRoot, ops)
+			}
+		}
+	}
+	return ops
+}
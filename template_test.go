@@ -0,0 +1,189 @@
+package jit
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestTemplateBuildsOnce verifies the point of a Template: the tree is
+// constructed once, and later renders only evaluate holes against new data.
+func TestTemplateBuildsOnce(t *testing.T) {
+	builds := 0
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		builds++
+		return div.New(
+			span.Static("Hello "),
+			Hole(func(d Data) node.Node {
+				return span.Text(d["name"].(string))
+			}),
+		)
+	})
+
+	first := string(tmpl.Render(Data{"name": "Alice"}))
+	second := string(tmpl.Render(Data{"name": "Bob"}))
+
+	if first != "<div><span>Hello </span><span>Alice</span></div>" {
+		t.Errorf("first render should fill the hole with Alice, got %q", first)
+	}
+	if second != "<div><span>Hello </span><span>Bob</span></div>" {
+		t.Errorf("second render should fill the hole with Bob, got %q", second)
+	}
+	if builds != 1 {
+		t.Errorf("builder should run once, ran %d times - the tree is being rebuilt per render", builds)
+	}
+}
+
+// TestTemplateBuildPanicRetries verifies that a build which panics is not
+// remembered: the first Render panics with an error wrapping
+// ErrBuildPanic, and the next Render builds again rather than rendering an
+// empty plan forever.
+func TestTemplateBuildPanicRetries(t *testing.T) {
+	builds := 0
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		builds++
+		if builds == 1 {
+			panic("build failed")
+		}
+		return div.New(Hole(func(d Data) node.Node {
+			return span.Text(d["name"].(string))
+		}))
+	})
+
+	func() {
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, ErrBuildPanic) {
+				t.Errorf("first Render should panic with ErrBuildPanic, got %v", err)
+			}
+		}()
+		tmpl.Render(Data{"name": "Alice"})
+	}()
+
+	got := string(tmpl.Render(Data{"name": "Bob"}))
+	if got != "<div><span>Bob</span></div>" {
+		t.Errorf("Render after a failed build should build again, got %q", got)
+	}
+	tmpl.Render(Data{"name": "Carol"})
+	if builds != 2 {
+		t.Errorf("builder should run again only after a panic, ran %d times", builds)
+	}
+}
+
+// TestTemplateHoleInsideConditional verifies that holes inside a conditional
+// branch still receive the render's data. The branch sub-plan is inlined when
+// the template is compiled, so its holes are resolved like any other.
+func TestTemplateHoleInsideConditional(t *testing.T) {
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		return div.New(node.When(true, p.New(Hole(func(d Data) node.Node {
+			return span.Text(d["msg"].(string))
+		}))))
+	})
+
+	tmpl.Render(Data{"msg": "one"})
+	got := string(tmpl.Render(Data{"msg": "two"}))
+	if got != "<div><p><span>two</span></p></div>" {
+		t.Errorf("hole inside a branch should be bound to render data, got %q", got)
+	}
+}
+
+// TestTemplateDynamicAttr verifies that a DynamicAttr element renders its
+// opening tag from the op and its children once, from the rest of the plan.
+func TestTemplateDynamicAttr(t *testing.T) {
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		return div.New(DynamicAttr(p.New(
+			span.Static("Hello "),
+			Hole(func(d Data) node.Node { return span.Text(d["name"].(string)) }),
+		).Class("greeting")))
+	})
+
+	tmpl.Render(Data{"name": "Alice"})
+	got := string(tmpl.Render(Data{"name": "Bob"}))
+	want := `<div><p class="greeting"><span>Hello </span><span>Bob</span></p></div>`
+	if got != want {
+		t.Errorf("DynamicAttr element should render its children once:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// TestTemplateRenderToWriter verifies the writer path matches the byte path.
+func TestTemplateRenderToWriter(t *testing.T) {
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		return div.New(Hole(func(d Data) node.Node { return span.Text(d["v"].(string)) }))
+	})
+
+	var buf bytes.Buffer
+	if out := tmpl.Render(Data{"v": "x"}, &buf); out != nil {
+		t.Error("Render should return nil when writing to a writer")
+	}
+	if buf.String() != "<div><span>x</span></div>" {
+		t.Errorf("writer output should contain the filled hole, got %q", buf.String())
+	}
+}
+
+// TestTemplateConcurrentRender verifies that concurrent renders with
+// different data do not see each other's values. Data is passed down the
+// render rather than stored on the template, so there is nothing to race on.
+func TestTemplateConcurrentRender(t *testing.T) {
+	tmpl := CompileTemplate(func(d Data) node.Node {
+		return div.New(Hole(func(d Data) node.Node { return span.Text(d["v"].(string)) }))
+	})
+
+	var wg sync.WaitGroup
+	for _, v := range []string{"a", "b", "c", "d"} {
+		wg.Go(func() {
+			for range 100 {
+				want := "<div><span>" + v + "</span></div>"
+				if got := string(tmpl.Render(Data{"v": v})); got != want {
+					t.Errorf("concurrent render leaked data:\n  got  %q\n  want %q", got, want)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// TestTypedCompilerBindsFields verifies that Bind holes receive the typed
+// value passed to Render, so template data is checked at compile time.
+func TestTypedCompilerBindsFields(t *testing.T) {
+	type profile struct {
+		Name  string
+		Admin bool
+	}
+
+	tc := NewTypedCompiler(func(_ profile) node.Node {
+		return div.New(
+			span.Static("User: "),
+			Bind(func(d profile) node.Node { return span.Text(d.Name) }),
+			Bind(func(d profile) node.Node { return node.When(d.Admin, span.Static(" (admin)")) }),
+		)
+	})
+
+	first := string(tc.Render(profile{Name: "Alice", Admin: true}))
+	second := string(tc.Render(profile{Name: "Bob"}))
+
+	if first != "<div><span>User: </span><span>Alice</span><span> (admin)</span></div>" {
+		t.Errorf("typed holes should bind to Alice's fields, got %q", first)
+	}
+	if second != "<div><span>User: </span><span>Bob</span></div>" {
+		t.Errorf("typed holes should bind to Bob's fields, got %q", second)
+	}
+}
+
+// TestTypedCompilerMismatchedBind verifies that a Bind for a different type
+// is not bound to the compiler's data and renders with its zero value rather
+// than panicking.
+func TestTypedCompilerMismatchedBind(t *testing.T) {
+	tc := NewTypedCompiler(func(_ string) node.Node {
+		return div.New(Bind(func(d int) node.Node { return span.Textf("%d", d) }))
+	})
+
+	if got := string(tc.Render("ignored")); got != "<div><span>0</span></div>" {
+		t.Errorf("mismatched Bind should render with the zero value, got %q", got)
+	}
+}
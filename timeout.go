@@ -0,0 +1,241 @@
+package jit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpl-au/fluent"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TimeoutError reports a Timeout node that did not render within its
+// deadline. It wraps ErrDynamicTimeout.
+type TimeoutError struct {
+	Path        string        // The node's path, described by tag
+	Timeout     time.Duration // The deadline it missed
+	Substituted bool          // Whether a shared last good output was served in its place
+}
+
+// Error describes the timeout and what was served instead.
+func (e *TimeoutError) Error() string {
+	served := "fallback"
+	if e.Substituted {
+		served = "last good output"
+	}
+	return fmt.Sprintf("%s did not render within %v, served %s", e.Path, e.Timeout, served)
+}
+
+// Unwrap returns ErrDynamicTimeout.
+func (e *TimeoutError) Unwrap() error {
+	return ErrDynamicTimeout
+}
+
+// Timeout bounds how long n may take to render, for dynamic content backed
+// by a dependency that can slow down. If n has not rendered within d,
+// rendering carries on without it and fallback is served in its place.
+// fallback is rendered on each timeout, so a node.Func can build it from
+// the request's own data; it may be nil. A render that times out keeps
+// running in the background and its output is dropped. Use TimeoutShared
+// to serve the last good output instead.
+//
+// Each timed-out render under a Compiler is counted in CompilerStats and
+// passed to CompilerCfg.OnTimeout as a *TimeoutError.
+//
+// n is rendered on its own goroutine, so it must not rely on running on
+// the caller's. Each render costs a goroutine and a timer; a d of zero or
+// less renders n inline with no deadline and neither, so a deadline can be
+// turned off by configuration at no cost.
+//
+// Example:
+//
+//	jit.Timeout(node.Func(func() node.Node { return Recommendations(api) }),
+//	    150*time.Millisecond, p.Static("Recommendations unavailable"))
+func Timeout(n node.Node, d time.Duration, fallback node.Node) node.Node {
+	return &timed{n: n, d: d, fallback: fallback}
+}
+
+// TimeoutShared is Timeout for content that is the same for every request
+// rendering it with the same key, such as a price list keyed by currency.
+// A Compiler keeps the last output n rendered successfully at this path
+// under key, late renders included, and serves it when a render with the
+// same key misses its deadline, so during a brownout the page shows
+// slightly stale content rather than a gap. fallback is served only while
+// there is none. Rendering outside a Compiler has nothing to substitute
+// and always uses fallback.
+//
+// The output is served to any request with the same key, so the key must
+// capture everything n's output depends on. Never use it for content that
+// varies by user unless the key identifies the user, and keep the number
+// of keys small - one output is kept per key and path for the life of the
+// plan.
+//
+// Example:
+//
+//	jit.TimeoutShared(node.Func(func() node.Node { return Prices(api, currency) }),
+//	    150*time.Millisecond, p.Static("Prices unavailable"), "prices:"+currency)
+func TimeoutShared(n node.Node, d time.Duration, fallback node.Node, key string) node.Node {
+	return &timed{n: n, d: d, fallback: fallback, shared: true, key: key}
+}
+
+// timed is the node behind Timeout and TimeoutShared. It is dynamic so the
+// compiler gives it a path, which is where shared output is kept.
+type timed struct {
+	n        node.Node
+	d        time.Duration
+	fallback node.Node
+	shared   bool   // Substitute the last good output for key, see TimeoutShared
+	key      string // Which last good output this render may be served
+}
+
+// Render renders with the deadline but no substitution.
+func (t *timed) Render(w ...io.Writer) []byte {
+	buf := fluent.NewBuffer()
+	t.RenderBuilder(buf)
+
+	if len(w) > 0 && w[0] != nil {
+		_, _ = buf.WriteTo(w[0])
+		fluent.PutBuffer(buf)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// RenderBuilder renders n into buf, or fallback if n misses its deadline.
+func (t *timed) RenderBuilder(buf *bytes.Buffer) {
+	if out, ok := t.within(nil); ok {
+		buf.Write(out)
+	} else if t.fallback != nil {
+		t.fallback.RenderBuilder(buf)
+	}
+}
+
+// Nodes returns the timed node, which is what renders when it is on time.
+func (t *timed) Nodes() []node.Node {
+	if t.n == nil {
+		return nil
+	}
+	return []node.Node{t.n}
+}
+
+// IsDynamic returns true - the content is evaluated on every render.
+func (t *timed) IsDynamic() bool { return true }
+
+// DynamicKey returns "" - timed nodes are not tracked by the diff engine.
+func (t *timed) DynamicKey() string { return "" }
+
+// within renders n on its own goroutine and returns its output if it
+// finishes within the deadline. Whenever it finishes, even late, its
+// output is stored in lastGood if that is not nil. A panic in n is
+// re-raised on the caller's goroutine if it happens in time, so it behaves
+// as it would without a deadline, and is dropped if it happens late.
+// Without a deadline n renders on the caller's goroutine.
+func (t *timed) within(lastGood *atomic.Pointer[[]byte]) ([]byte, bool) {
+	if t.n == nil {
+		return nil, true
+	}
+	if t.d <= 0 {
+		var out bytes.Buffer
+		t.n.RenderBuilder(&out)
+		b := out.Bytes()
+		if lastGood != nil {
+			lastGood.Store(&b)
+		}
+		return b, true
+	}
+
+	type result struct {
+		out   []byte
+		panic any
+	}
+	done := make(chan result, 1) // buffered so a late render does not block forever
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{panic: r}
+			}
+		}()
+		var out bytes.Buffer
+		t.n.RenderBuilder(&out)
+		b := out.Bytes()
+		if lastGood != nil {
+			lastGood.Store(&b)
+		}
+		done <- result{out: b}
+	}()
+
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		return r.out, true
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+// renderTimed renders a Timeout node at dp, counting it if it misses its
+// deadline. A TimeoutShared node is then served the last good output for
+// its key, if there is one.
+func (dp *DynamicPath) renderTimed(t *timed, buf *bytes.Buffer) {
+	var lastGood *atomic.Pointer[[]byte]
+	if t.shared {
+		lastGood = dp.lastGood.forKey(t.key)
+	}
+	if out, ok := t.within(lastGood); ok {
+		buf.Write(out)
+		return
+	}
+
+	var last *[]byte
+	if lastGood != nil {
+		last = lastGood.Load()
+	}
+	if last != nil {
+		buf.Write(*last)
+	} else if t.fallback != nil {
+		t.fallback.RenderBuilder(buf)
+	}
+	if dp.timeouts != nil {
+		dp.timeouts.report(&TimeoutError{Path: dp.String(), Timeout: t.d, Substituted: last != nil})
+	}
+}
+
+// sharedOutput holds the last good output of TimeoutShared nodes at one
+// path. Entries are string key -> *atomic.Pointer[[]byte].
+type sharedOutput struct {
+	keys sync.Map
+}
+
+// forKey returns the last good output slot for key, adding it if needed.
+func (so *sharedOutput) forKey(key string) *atomic.Pointer[[]byte] {
+	if p, ok := so.keys.Load(key); ok {
+		return p.(*atomic.Pointer[[]byte]) //nolint:forcetypeassert // only *atomic.Pointer[[]byte] is stored
+	}
+	p, _ := so.keys.LoadOrStore(key, new(atomic.Pointer[[]byte]))
+	return p.(*atomic.Pointer[[]byte]) //nolint:forcetypeassert // only *atomic.Pointer[[]byte] is stored
+}
+
+// timeoutCounter records Timeout nodes that missed their deadline.
+type timeoutCounter struct {
+	timeouts      atomic.Int64
+	substitutions atomic.Int64
+	onTimeout     func(err error)
+}
+
+// report counts one timeout and passes it to the callback, if any.
+func (tc *timeoutCounter) report(err *TimeoutError) {
+	tc.timeouts.Add(1)
+	if err.Substituted {
+		tc.substitutions.Add(1)
+	}
+	if tc.onTimeout != nil {
+		tc.onTimeout(err)
+	}
+}
@@ -0,0 +1,179 @@
+package jit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/p"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// timeoutPage has a TimeoutShared node keyed "prices" that renders label,
+// waiting on release first if it is not nil.
+func timeoutPage(label string, release <-chan struct{}) node.Node {
+	return div.New(
+		p.Static("header"),
+		TimeoutShared(slowText(label, release), 20*time.Millisecond, p.Static("unavailable"), "prices"),
+	)
+}
+
+// slowText renders label, waiting on release first if it is not nil.
+func slowText(label string, release <-chan struct{}) node.Node {
+	return node.Func(func() node.Node {
+		if release != nil {
+			<-release
+		}
+		return span.Text(label)
+	})
+}
+
+// TestTimeoutSubstitutesLastGood verifies that a TimeoutShared node that
+// misses its deadline is replaced by its last successful output at that
+// path, and that the substitution is counted and reported.
+func TestTimeoutSubstitutesLastGood(t *testing.T) {
+	var reported []error
+	compiler := NewCompiler(&CompilerCfg{OnTimeout: func(err error) { reported = append(reported, err) }})
+
+	good := string(compiler.Render(timeoutPage("prices v1", nil)))
+	if !strings.Contains(good, "prices v1") {
+		t.Fatalf("on-time render missing content: %s", good)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	got := string(compiler.Render(timeoutPage("prices v2", release)))
+	if got != good {
+		t.Errorf("timed-out render did not serve last good output:\nwant %s\ngot  %s", good, got)
+	}
+
+	if len(reported) != 1 {
+		t.Fatalf("expected one reported timeout, got %d", len(reported))
+	}
+	var te *TimeoutError
+	if !errors.As(reported[0], &te) || !errors.Is(reported[0], ErrDynamicTimeout) {
+		t.Fatalf("expected *TimeoutError wrapping ErrDynamicTimeout, got %v", reported[0])
+	}
+	if !te.Substituted {
+		t.Errorf("expected substitution to be reported: %v", te)
+	}
+
+	stats := compiler.Stats()
+	if stats.Timeouts != 1 || stats.Substitutions != 1 {
+		t.Errorf("expected 1 timeout and 1 substitution, got %d and %d", stats.Timeouts, stats.Substitutions)
+	}
+}
+
+// TestTimeoutFallbackWithoutLastGood verifies that the fallback is used when
+// the path has never rendered successfully.
+func TestTimeoutFallbackWithoutLastGood(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	got := string(NewCompiler().Render(timeoutPage("late", release)))
+	if !strings.Contains(got, "unavailable") || strings.Contains(got, "late") {
+		t.Errorf("expected fallback with no last good output, got %s", got)
+	}
+}
+
+// TestTimeoutLateRenderRefreshesLastGood verifies that a render that misses
+// its deadline still becomes the last good output once it finishes.
+func TestTimeoutLateRenderRefreshesLastGood(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(timeoutPage("v1", nil))
+
+	release := make(chan struct{})
+	if got := string(compiler.Render(timeoutPage("v2", release))); !strings.Contains(got, "v1") {
+		t.Fatalf("expected v1 substituted, got %s", got)
+	}
+
+	var dp *DynamicPath
+	for _, el := range compiler.executionPlan.Load().Elements {
+		if d, ok := el.(*DynamicPath); ok {
+			dp = d
+		}
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for last := dp.lastGood.forKey("prices"); last.Load() == nil || !strings.Contains(string(*last.Load()), "v2"); {
+		if time.Now().After(deadline) {
+			t.Fatal("late render never stored its output")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stalled := make(chan struct{})
+	defer close(stalled)
+	if got := string(compiler.Render(timeoutPage("v3", stalled))); !strings.Contains(got, "v2") {
+		t.Errorf("expected late v2 output to be substituted, got %s", got)
+	}
+}
+
+// TestTimeoutDoesNotShare verifies that a plain Timeout never serves output
+// rendered for another request, and that a TimeoutShared node is only
+// served output rendered under its own key.
+func TestTimeoutDoesNotShare(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	page := func(label string, release <-chan struct{}, shared bool, key string) node.Node {
+		if !shared {
+			return div.New(Timeout(slowText(label, release), 20*time.Millisecond, p.Static("unavailable")))
+		}
+		return div.New(TimeoutShared(slowText(label, release), 20*time.Millisecond, p.Static("unavailable"), key))
+	}
+
+	plain := NewCompiler()
+	plain.Render(page("alice's basket", nil, false, ""))
+	if got := string(plain.Render(page("bob's basket", release, false, ""))); strings.Contains(got, "alice") || !strings.Contains(got, "unavailable") {
+		t.Errorf("plain Timeout should serve its fallback, got %s", got)
+	}
+
+	shared := NewCompiler()
+	shared.Render(page("GBP prices", nil, true, "GBP"))
+	if got := string(shared.Render(page("EUR prices", release, true, "EUR"))); strings.Contains(got, "GBP") {
+		t.Errorf("output for one key should not be served for another, got %s", got)
+	}
+	if got := string(shared.Render(page("GBP v2", release, true, "GBP"))); !strings.Contains(got, "GBP prices") {
+		t.Errorf("output for the same key should be substituted, got %s", got)
+	}
+}
+
+// TestTimeoutZeroRendersInline verifies that a zero deadline renders on the
+// caller's goroutine and never times out.
+func TestTimeoutZeroRendersInline(t *testing.T) {
+	tree := div.New(Timeout(node.Func(func() node.Node {
+		time.Sleep(5 * time.Millisecond)
+		return span.Text("done")
+	}), 0, p.Static("unavailable")))
+	compiler := NewCompiler()
+	for range 2 {
+		if got := string(compiler.Render(tree)); got != "<div><span>done</span></div>" {
+			t.Errorf("zero deadline should always render the node, got %s", got)
+		}
+	}
+	if got := compiler.Stats().Timeouts; got != 0 {
+		t.Errorf("zero deadline should never time out, got %d", got)
+	}
+}
+
+// TestTimeoutSpill verifies that spilled renders count timeouts and
+// substitute shared output like in-memory ones.
+func TestTimeoutSpill(t *testing.T) {
+	compiler := NewCompiler(&CompilerCfg{SpillThreshold: 16, SpillDir: t.TempDir()})
+	var good strings.Builder
+	compiler.Render(timeoutPage("prices v1", nil), &good)
+
+	release := make(chan struct{})
+	defer close(release)
+	var got strings.Builder
+	compiler.Render(timeoutPage("prices v2", release), &got)
+	if got.String() != good.String() {
+		t.Errorf("spilled render should substitute the last good output:\nwant %s\ngot  %s", good.String(), got.String())
+	}
+	if stats := compiler.Stats(); stats.Timeouts != 1 || stats.Substitutions != 1 {
+		t.Errorf("expected 1 timeout and 1 substitution, got %d and %d", stats.Timeouts, stats.Substitutions)
+	}
+}
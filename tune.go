@@ -5,7 +5,6 @@ import (
 	"io"
 	"sync"
 
-	"github.com/jpl-au/fluent"
 	"github.com/jpl-au/fluent/node"
 )
 
@@ -19,10 +18,12 @@ import (
 //
 // This approach is ideal for templates with dynamic content that varies significantly.
 type Tuner struct {
-	rootNode node.Node      // current template to render
-	sizer    *AdaptiveSizer // shared adaptive sizing logic
-	mu       sync.RWMutex   // protects rootNode access during concurrent usage
-	cfg      *TunerCfg      // optional custom configuration
+	rootNode   node.Node      // current template to render
+	sizer      SizingStrategy // buffer sizing, an AdaptiveSizer unless TunerCfg.Sizing
+	mu         sync.RWMutex   // protects rootNode access during concurrent usage
+	cfg        *TunerCfg      // optional custom configuration
+	pool       *poolCounter   // buffer pool counters, nil unless TunerCfg.PoolStats
+	registered bool           // in the global registry, so subject to SetSizingBudget
 }
 
 // NewTuner creates a tuner with adaptive sizing defaults.
@@ -38,7 +39,10 @@ func NewTuner(cfg ...*TunerCfg) *Tuner {
 	// Apply custom config if provided
 	if len(cfg) > 0 && cfg[0] != nil {
 		jt.cfg = cfg[0]
-		jt.sizer.Configure(cfg[0].Max, cfg[0].Variance, cfg[0].GrowthFactor)
+		jt.sizer = newSizer(cfg[0].Sizing, cfg[0].sizerParams())
+		if cfg[0].PoolStats {
+			jt.pool = &poolCounter{}
+		}
 	}
 
 	return jt
@@ -51,16 +55,36 @@ func NewTuner(cfg ...*TunerCfg) *Tuner {
 // - max: number of samples to collect before establishing baseline.
 // - variance: threshold percentage for detecting significant size changes (e.g. 20).
 // - growthFactor: multiplier percentage applied to average size (e.g. 115).
+//
+// Parameters ValidateSizing rejects leave the tuner unchanged;
+// MustConfigure panics on them instead.
 func (jt *Tuner) Configure(max int, variance, growthFactor int) *Tuner {
-	jt.cfg = &TunerCfg{
-		Max:          max,
-		Variance:     variance,
-		GrowthFactor: growthFactor,
+	if ValidateSizing(max, variance, growthFactor) != nil {
+		return jt
+	}
+	cfg := TunerCfg{}
+	if jt.cfg != nil {
+		cfg = *jt.cfg // keep SpillThreshold and SpillDir, which this does not set
+	}
+	cfg.Max = max
+	cfg.Variance = variance
+	cfg.GrowthFactor = growthFactor
+	jt.cfg = &cfg
+	if as, ok := jt.sizer.(*AdaptiveSizer); ok {
+		as.Configure(max, variance, growthFactor)
 	}
-	jt.sizer.Configure(max, variance, growthFactor)
 	return jt
 }
 
+// MustConfigure is like Configure but panics with the error from
+// ValidateSizing if the parameters are invalid.
+func (jt *Tuner) MustConfigure(max int, variance, growthFactor int) *Tuner {
+	if err := ValidateSizing(max, variance, growthFactor); err != nil {
+		panic(err)
+	}
+	return jt.Configure(max, variance, growthFactor)
+}
+
 // Tune sets the template to render with adaptive buffer sizing.
 // Thread-safe for concurrent usage. Returns the same instance for method chaining.
 func (jt *Tuner) Tune(root node.Node) *Tuner {
@@ -95,25 +119,41 @@ func (jt *Tuner) Render(w ...io.Writer) []byte {
 func (jt *Tuner) tune(n node.Node, w io.Writer) []byte {
 	// With writer: use pooled buffer to avoid allocation, then return it to the pool
 	if w != nil {
-		buf := fluent.NewBuffer(jt.sizer.GetBaseline())
+		if jt.cfg != nil && jt.cfg.SpillThreshold > 0 {
+			jt.tuneSpill(n, w)
+			return nil
+		}
+		buf, capacity := jt.pool.get(nil, jt.predict())
 		n.RenderBuilder(buf)
-		jt.sizer.UpdateStats(buf.Len())
+		jt.sizer.Observe(buf.Len())
 		_, _ = buf.WriteTo(w)
-		fluent.PutBuffer(buf)
+		jt.pool.put(nil, buf, capacity)
 		return nil
 	}
 
 	// Without writer: use local buffer with predicted capacity
-	buf := bytes.NewBuffer(make([]byte, 0, jt.sizer.GetBaseline()))
+	buf := bytes.NewBuffer(make([]byte, 0, jt.predict()))
 	n.RenderBuilder(buf)
-	jt.sizer.UpdateStats(buf.Len())
+	jt.sizer.Observe(buf.Len())
 	return buf.Bytes()
 }
 
+// predict returns the buffer capacity to start a render with, scaled to
+// the SetSizingBudget cap if the tuner is registered.
+func (jt *Tuner) predict() int {
+	if jt.registered {
+		return sizingBudget.apply(jt.sizer.Baseline())
+	}
+	return jt.sizer.Baseline()
+}
+
 // Reset clears all collected statistics and restarts adaptive sizing.
 // Useful when content patterns change significantly or for testing scenarios.
+// A custom SizingStrategy is reset if it has a Reset method.
 // Returns the same instance for method chaining.
 func (jt *Tuner) Reset() *Tuner {
-	jt.sizer.Reset()
+	if r, ok := jt.sizer.(interface{ Reset() }); ok {
+		r.Reset()
+	}
 	return jt
 }
@@ -0,0 +1,112 @@
+package jit
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jpl-au/fluent/node"
+)
+
+// VariantFlattener holds pages that are static per variant - a locale, a
+// theme - as one Flattener each. A variant is built and flattened the
+// first time it is asked for, so variants nobody requests cost nothing.
+//
+// Variants are kept until Reset. Map untrusted input, such as an
+// Accept-Language header, onto the set of variants the site supports
+// before passing it in, or every distinct value is flattened and kept.
+type VariantFlattener struct {
+	build    func(variant string) node.Node
+	cfg      *FlattenerCfg
+	variants sync.Map // variant -> *variantEntry
+}
+
+// variantEntry flattens its variant once, however many renders ask for it
+// at the same time.
+type variantEntry struct {
+	mu   sync.Mutex  // Held while building
+	done atomic.Bool // Set once f and err hold a finished build
+	f    *Flattener
+	err  error
+}
+
+// NewVariantFlattener creates a flattener that calls build for each
+// variant the first time it is rendered. Each variant is flattened with
+// cfg, so compressed variants and ETags work as with NewFlattener.
+//
+// Example:
+//
+//	var about = jit.NewVariantFlattener(func(locale string) node.Node {
+//	    return AboutPage(translations[locale])
+//	})
+//
+//	func aboutHandler(w http.ResponseWriter, r *http.Request) {
+//	    about.Render(localeFor(r), w)
+//	}
+func NewVariantFlattener(build func(variant string) node.Node, cfg ...*FlattenerCfg) *VariantFlattener {
+	vf := &VariantFlattener{build: build}
+	if len(cfg) > 0 {
+		vf.cfg = cfg[0]
+	}
+	return vf
+}
+
+// Variant returns the Flattener for variant, building it if this is the
+// first request for it. The error is ErrDynamicContent if the tree built
+// for variant is not fully static, or an error from the configured
+// encoders; it is kept like a flattened variant, so a failing variant is
+// not rebuilt on every request. A build that panics returns an error
+// wrapping ErrBuildPanic and is not kept, so the next request builds the
+// variant again.
+func (vf *VariantFlattener) Variant(variant string) (*Flattener, error) {
+	v, ok := vf.variants.Load(variant)
+	if !ok {
+		v, _ = vf.variants.LoadOrStore(variant, &variantEntry{})
+	}
+	entry := v.(*variantEntry) //nolint:forcetypeassert // only *variantEntry is stored
+	return entry.flatten(vf, variant)
+}
+
+// flatten returns the entry's result, building and flattening variant
+// first if no build has finished.
+func (entry *variantEntry) flatten(vf *VariantFlattener, variant string) (f *Flattener, err error) {
+	if entry.done.Load() {
+		return entry.f, entry.err
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.done.Load() {
+		return entry.f, entry.err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, buildPanic(r)
+		}
+	}()
+	entry.f, entry.err = NewFlattener(vf.build(variant), vf.cfg)
+	entry.done.Store(true)
+	return entry.f, entry.err
+}
+
+// Render writes variant's pre-rendered bytes to the writer or returns
+// them, building the variant first if needed. On error nothing is written.
+func (vf *VariantFlattener) Render(variant string, w ...io.Writer) ([]byte, error) {
+	f, err := vf.Variant(variant)
+	if err != nil {
+		return nil, err
+	}
+	return f.Render(w...), nil
+}
+
+// Reset drops the given variants, or every variant if none are given, so
+// they are built again on their next render - after translations are
+// reloaded, for instance.
+func (vf *VariantFlattener) Reset(variants ...string) {
+	if len(variants) == 0 {
+		vf.variants.Clear()
+		return
+	}
+	for _, variant := range variants {
+		vf.variants.Delete(variant)
+	}
+}
@@ -0,0 +1,101 @@
+package jit
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestVariantFlattener verifies that each variant is built once, on first
+// request, even when requested concurrently, and that Reset rebuilds it.
+func TestVariantFlattener(t *testing.T) {
+	var builds atomic.Int64
+	greetings := map[string]string{"en": "Hello", "fr": "Bonjour"}
+	vf := NewVariantFlattener(func(locale string) node.Node {
+		builds.Add(1)
+		return div.New(span.Static(greetings[locale]))
+	})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if out, err := vf.Render("fr"); err != nil || string(out) != "<div><span>Bonjour</span></div>" {
+				t.Errorf("fr rendered %q, %v", out, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := builds.Load(); n != 1 {
+		t.Errorf("a variant should be built once however many renders ask for it, got %d builds", n)
+	}
+
+	if out, _ := vf.Render("en"); string(out) != "<div><span>Hello</span></div>" {
+		t.Errorf("en rendered %q", out)
+	}
+	if n := builds.Load(); n != 2 {
+		t.Errorf("a new variant should be built on first request, got %d builds", n)
+	}
+
+	greetings["fr"] = "Salut"
+	vf.Reset("fr")
+	if out, _ := vf.Render("fr"); string(out) != "<div><span>Salut</span></div>" {
+		t.Errorf("Reset variant should be rebuilt, got %q", out)
+	}
+	if out, _ := vf.Render("en"); string(out) != "<div><span>Hello</span></div>" || builds.Load() != 3 {
+		t.Errorf("other variants should survive Reset, got %q after %d builds", out, builds.Load())
+	}
+}
+
+// TestVariantFlattenerDynamic verifies that a variant with dynamic content
+// reports ErrDynamicContent without being rebuilt on each request.
+func TestVariantFlattenerDynamic(t *testing.T) {
+	var builds atomic.Int64
+	vf := NewVariantFlattener(func(name string) node.Node {
+		builds.Add(1)
+		return div.New(span.Text(name))
+	})
+	for range 3 {
+		if _, err := vf.Render("x"); !errors.Is(err, ErrDynamicContent) {
+			t.Errorf("expected ErrDynamicContent, got %v", err)
+		}
+	}
+	if n := builds.Load(); n != 1 {
+		t.Errorf("a failing variant should be built once, got %d builds", n)
+	}
+}
+
+// TestVariantFlattenerBuildPanics verifies that a variant whose build
+// panics reports an error wrapping ErrBuildPanic rather than a nil
+// Flattener, and is built again on the next request instead of keeping
+// the error.
+func TestVariantFlattenerBuildPanics(t *testing.T) {
+	var builds atomic.Int64
+	vf := NewVariantFlattener(func(name string) node.Node {
+		if builds.Add(1) == 1 {
+			panic("translations missing")
+		}
+		return div.Static(name)
+	})
+	f, err := vf.Variant("en")
+	if !errors.Is(err, ErrBuildPanic) {
+		t.Errorf("expected ErrBuildPanic, got %v", err)
+	}
+	if f != nil {
+		t.Error("a variant that panicked should have no Flattener")
+	}
+
+	for range 2 {
+		out, err := vf.Render("en")
+		if err != nil || string(out) != "<div>en</div>" {
+			t.Errorf("the next request should build the variant again, got %q, %v", out, err)
+		}
+	}
+	if n := builds.Load(); n != 2 {
+		t.Errorf("a variant should be rebuilt only after a panic, got %d builds", n)
+	}
+}
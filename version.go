@@ -0,0 +1,142 @@
+package jit
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// VersionHeader is the response header set by Compiler.SetVersionHeader.
+const VersionHeader = "X-Jit-Plan-Version"
+
+// Version returns an identifier for the compiled execution plan, or "" if
+// nothing has been compiled yet. It is a hash of the plan's static content
+// and dynamic paths, so two compilers built from the same template agree on
+// the version and any change to the frozen markup produces a new one.
+//
+// Use it to coordinate cache purges with template deploys, or to tie a bug
+// report back to the exact plan that served the page.
+func (jc *Compiler) Version() string {
+	if plan := jc.executionPlan.Load(); plan != nil {
+		return plan.version
+	}
+	return ""
+}
+
+// SetVersionHeader sets VersionHeader on the response to the plan version.
+// Call it before the first write to w, and after the compiler has rendered
+// at least once - before then there is no plan and no header is set.
+func (jc *Compiler) SetVersionHeader(w http.ResponseWriter) {
+	if v := jc.Version(); v != "" {
+		w.Header().Set(VersionHeader, v)
+	}
+}
+
+// ETag returns an entity tag for a response rendered from the current plan
+// with data at dataVersion, or "" if nothing has been compiled yet. The
+// plan's Version covers the template; dataVersion is whatever identifies
+// the dynamic content, such as a row's updated-at timestamp. The tag
+// changes when either does, so it survives deploys that leave the
+// template's static markup alone and is invalidated by those that change it.
+//
+// The result is quoted, ready for the ETag header.
+func (jc *Compiler) ETag(dataVersion string) string {
+	v := jc.Version()
+	if v == "" {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(v))
+	h.Write([]byte{0})
+	h.Write([]byte(dataVersion))
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// NotModified sets the ETag header for dataVersion and reports whether the
+// request's If-None-Match already names it, in which case it has written a
+// 304 response and the handler should return without rendering. Before the
+// first render there is no plan, so it sets nothing and returns false.
+//
+// Example:
+//
+//	if productCompiler.NotModified(w, r, product.UpdatedAt.String()) {
+//	    return
+//	}
+//	productCompiler.Render(ProductPage(product), w)
+func (jc *Compiler) NotModified(w http.ResponseWriter, r *http.Request, dataVersion string) bool {
+	etag := jc.ETag(dataVersion)
+	if etag == "" {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header names etag. The
+// comparison is weak, as RFC 9110 requires for If-None-Match, so a W/
+// prefix added by a proxy is ignored.
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// planVersion hashes the plan's elements in order. Each element is prefixed
+// with a marker byte so a static chunk can never hash the same as a path
+// with identical bytes.
+func planVersion(plan *ExecutionPlan) string {
+	h := fnv.New64a()
+	hashPlan(h, plan)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// hashPlan writes plan's elements to h, descending into both sub-plans of
+// each conditional so that changing either branch changes the version.
+func hashPlan(h io.Writer, plan *ExecutionPlan) {
+	for _, element := range plan.Elements {
+		switch el := element.(type) {
+		case *StaticContent:
+			h.Write([]byte{'s'})
+			h.Write(el.Content)
+		case *DynamicPath:
+			if el.OpenTag {
+				h.Write([]byte{'a'})
+			} else {
+				h.Write([]byte{'d'})
+			}
+			writePath(h, el.Path)
+		case *ConditionalPath:
+			h.Write([]byte{'c'})
+			writePath(h, el.Path)
+			for i := range el.branches {
+				sub := el.branches[i].Load()
+				if sub == nil {
+					h.Write([]byte{'n'}) // Not compiled
+					continue
+				}
+				h.Write([]byte{'b'})
+				hashPlan(h, sub)
+				h.Write([]byte{'e'})
+			}
+		}
+	}
+}
+
+// writePath writes a path's length and indices so [1 2] and [12] differ.
+func writePath(h io.Writer, path []int) {
+	h.Write(binary.AppendUvarint(nil, uint64(len(path))))
+	for _, idx := range path {
+		h.Write(binary.AppendUvarint(nil, uint64(idx)))
+	}
+}
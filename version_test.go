@@ -0,0 +1,156 @@
+package jit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+	"github.com/jpl-au/fluent/html5/span"
+	"github.com/jpl-au/fluent/node"
+)
+
+// TestCompilerVersionBeforeCompile verifies that a compiler with no plan
+// reports no version, so a header is never emitted for a plan that does not
+// exist yet.
+func TestCompilerVersionBeforeCompile(t *testing.T) {
+	compiler := NewCompiler()
+	if v := compiler.Version(); v != "" {
+		t.Errorf("version before first render should be empty, got %q", v)
+	}
+}
+
+// TestCompilerVersionStableAcrossCompilers verifies that the version is
+// derived from the plan, not the instance. Two deploys compiling the same
+// template must agree, otherwise the header is useless for correlation.
+func TestCompilerVersionStableAcrossCompilers(t *testing.T) {
+	a := NewCompiler()
+	b := NewCompiler()
+	a.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+	b.Render(div.New(span.Static("Hello "), span.Text("Bob")))
+
+	if a.Version() != b.Version() {
+		t.Errorf("same template with different dynamic data should share a version: %q vs %q", a.Version(), b.Version())
+	}
+}
+
+// TestCompilerVersionChangesWithStaticContent verifies that changing the
+// frozen markup produces a new version.
+func TestCompilerVersionChangesWithStaticContent(t *testing.T) {
+	a := NewCompiler()
+	b := NewCompiler()
+	a.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+	b.Render(div.New(span.Static("Goodbye "), span.Text("Alice")))
+
+	if a.Version() == b.Version() {
+		t.Errorf("different static content should produce different versions, both were %q", a.Version())
+	}
+}
+
+// TestCompilerVersionChangesWithBranchContent verifies that both branches
+// of a conditional are hashed, including the one inactive at compile time.
+func TestCompilerVersionChangesWithBranchContent(t *testing.T) {
+	page := func(active, inactive string) node.Node {
+		return div.New(node.Condition(true).True(span.Static(active)).False(span.Static(inactive)))
+	}
+	a := NewCompiler()
+	a.Render(page("Welcome", "Sign in"))
+
+	for _, tree := range []node.Node{page("Hello", "Sign in"), page("Welcome", "Log in")} {
+		b := NewCompiler()
+		b.Render(tree)
+		if a.Version() == b.Version() {
+			t.Errorf("different branch content should produce a different version, both were %q", a.Version())
+		}
+	}
+}
+
+// TestCompilerSetVersionHeader verifies the header helper writes the version.
+func TestCompilerSetVersionHeader(t *testing.T) {
+	compiler := NewCompiler()
+
+	rec := httptest.NewRecorder()
+	compiler.SetVersionHeader(rec)
+	if got := rec.Header().Get(VersionHeader); got != "" {
+		t.Errorf("no header should be set before the plan is compiled, got %q", got)
+	}
+
+	compiler.Render(div.Static("hello"))
+	compiler.SetVersionHeader(rec)
+	if got := rec.Header().Get(VersionHeader); got != compiler.Version() {
+		t.Errorf("header should carry the plan version:\n  got  %q\n  want %q", got, compiler.Version())
+	}
+}
+
+// TestCompilerETag verifies that the entity tag changes with the data
+// version and with the template, but not between compilers of the same
+// template.
+func TestCompilerETag(t *testing.T) {
+	a := NewCompiler()
+	if etag := a.ETag("1"); etag != "" {
+		t.Errorf("ETag before first render should be empty, got %q", etag)
+	}
+	a.Render(div.New(span.Static("Hello "), span.Text("Alice")))
+	b := NewCompiler()
+	b.Render(div.New(span.Static("Hello "), span.Text("Bob")))
+	changed := NewCompiler()
+	changed.Render(div.New(span.Static("Goodbye "), span.Text("Alice")))
+
+	if a.ETag("1") != b.ETag("1") {
+		t.Errorf("same template and data version should share an ETag: %q vs %q", a.ETag("1"), b.ETag("1"))
+	}
+	if a.ETag("1") == a.ETag("2") {
+		t.Error("a new data version should change the ETag")
+	}
+	if a.ETag("1") == changed.ETag("1") {
+		t.Error("changed static content should change the ETag")
+	}
+}
+
+// TestCompilerETagChangesWithBranchContent verifies that editing a
+// conditional branch, even the one inactive at compile time, changes the
+// ETag, so a cached page never outlives a template change in that branch.
+func TestCompilerETagChangesWithBranchContent(t *testing.T) {
+	page := func(inactive string) node.Node {
+		return div.New(node.Condition(true).True(span.Text("Alice")).False(span.Static(inactive)))
+	}
+	a := NewCompiler()
+	a.Render(page("Sign in"))
+	changed := NewCompiler()
+	changed.Render(page("Log in"))
+
+	if a.ETag("1") == changed.ETag("1") {
+		t.Errorf("changed branch content should change the ETag, both were %q", a.ETag("1"))
+	}
+}
+
+// TestCompilerNotModified verifies that a matching If-None-Match, weak or
+// in a list, gets a 304, and a stale one does not.
+func TestCompilerNotModified(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.Render(div.New(span.Text("Alice")))
+	etag := compiler.ETag("7")
+
+	for header, want := range map[string]bool{
+		"":                 false,
+		`"stale"`:          false,
+		etag:               true,
+		"W/" + etag:        true,
+		`"stale", ` + etag: true,
+		"*":                true,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("If-None-Match", header)
+		}
+		if got := compiler.NotModified(rec, req, "7"); got != want {
+			t.Errorf("If-None-Match %q: NotModified = %v, want %v", header, got, want)
+		}
+		if want && rec.Code != 304 {
+			t.Errorf("If-None-Match %q: expected a 304, got %d", header, rec.Code)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("If-None-Match %q: ETag header should be %s, got %q", header, etag, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package jit
+
+import (
+	"bufio"
+	"io"
+)
+
+// minWriterSize is the smallest suggested writer buffer: bufio's own
+// default, used too before a baseline is set.
+const minWriterSize = 4096
+
+// maxWriterSize bounds the suggested writer buffer. A page larger than
+// this is written through in chunks anyway, and a per-connection buffer
+// of megabytes costs more than the writes it saves.
+const maxWriterSize = 1 << 20
+
+// writerSize returns the bufio.Writer size for output predicted to be
+// baseline bytes.
+func writerSize(baseline int) int {
+	return min(max(baseline, minWriterSize), maxWriterSize)
+}
+
+// SuggestWriterSize returns a bufio.Writer size for the output this sizer
+// predicts: the baseline, so a whole render passes through the writer in
+// one flush, but at least 4KB, bufio's default, and at most 1MB.
+func (as *AdaptiveSizer) SuggestWriterSize() int {
+	return writerSize(as.GetBaseline())
+}
+
+// BufferWriter wraps w in a bufio.Writer of SuggestWriterSize bytes, so
+// the output path beyond the render buffer is sized from the learned
+// baseline too - a response writer with a small buffer of its own
+// otherwise splits a large page into many writes. If w is already a
+// bufio.Writer at least that large it is returned as it is. The caller
+// must Flush it.
+func (as *AdaptiveSizer) BufferWriter(w io.Writer) *bufio.Writer {
+	return bufio.NewWriterSize(w, as.SuggestWriterSize())
+}
+
+// BufferWriter wraps w in a bufio.Writer sized for the compiler's
+// predicted output, as AdaptiveSizer.BufferWriter does. It follows
+// whatever the compiler predicts, so CompilerCfg.FixedSize and custom
+// Sizing strategies apply. The caller must Flush it.
+//
+// Example:
+//
+//	bw := compiler.BufferWriter(w)
+//	compiler.Render(Page(data), bw)
+//	bw.Flush()
+func (jc *Compiler) BufferWriter(w io.Writer) *bufio.Writer {
+	return bufio.NewWriterSize(w, writerSize(jc.predict()))
+}
+
+// BufferWriter wraps w in a bufio.Writer sized for the tuner's predicted
+// output, as AdaptiveSizer.BufferWriter does. The caller must Flush it.
+func (jt *Tuner) BufferWriter(w io.Writer) *bufio.Writer {
+	return bufio.NewWriterSize(w, writerSize(jt.predict()))
+}
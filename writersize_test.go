@@ -0,0 +1,58 @@
+package jit
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jpl-au/fluent/html5/div"
+)
+
+// TestSuggestWriterSize verifies the default before a baseline, that the
+// baseline is followed, and the bounds.
+func TestSuggestWriterSize(t *testing.T) {
+	as := NewAdaptiveSizer()
+	as.MustConfigure(1, 20, 100)
+	if got := as.SuggestWriterSize(); got != 4096 {
+		t.Errorf("before a baseline the size should be bufio's default 4096, got %d", got)
+	}
+	as.UpdateStats(20000)
+	if got := as.SuggestWriterSize(); got != 20000 {
+		t.Errorf("the size should follow the 20000 baseline, got %d", got)
+	}
+	as.SetInitialBaseline(64 << 20)
+	if got := as.SuggestWriterSize(); got != 1<<20 {
+		t.Errorf("the size should be capped at 1MB, got %d", got)
+	}
+
+	if bw := as.BufferWriter(&bytes.Buffer{}); bw.Size() != 1<<20 {
+		t.Errorf("BufferWriter should use the suggested size, got %d", bw.Size())
+	}
+	big := bufio.NewWriterSize(&bytes.Buffer{}, 2<<20)
+	if as.BufferWriter(big) != big {
+		t.Error("a large enough bufio.Writer should be returned as it is")
+	}
+}
+
+// TestCompilerBufferWriter verifies that a compiler's writer is sized
+// from its prediction and carries the render through.
+func TestCompilerBufferWriter(t *testing.T) {
+	page := div.Static(strings.Repeat("x", 10000))
+	jc := NewCompiler(&CompilerCfg{Max: 1, Variance: 20, GrowthFactor: 100})
+	want := jc.Render(page)
+
+	var out bytes.Buffer
+	bw := jc.BufferWriter(&out)
+	if bw.Size() != len(want) {
+		t.Errorf("writer should be sized to the %d byte prediction, got %d", len(want), bw.Size())
+	}
+	jc.Render(page, bw)
+	if out.Len() != 0 {
+		t.Error("a render that fits should stay in the writer until Flush")
+	}
+	bw.Flush()
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Error("flushed output should match the render")
+	}
+}